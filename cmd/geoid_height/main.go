@@ -0,0 +1,263 @@
+// geoid_height reports the height of the EGM96 geoid, i.e. mean sea level,
+// above the WGS-84 ellipsoid, and converts heights between the two.
+//
+// Usage is
+//  geoid_height --to_msl --nearest --format=text [latitude] [longitude] [height]
+//  geoid_height --to_ellipsoid --input=points.txt
+//
+// A single point may be given on the command line.  Otherwise points are read
+// from the --input file, or standard input, one per line as
+//  latitude longitude [height]
+// separated by whitespace or commas, with the latitude and longitude in decimal
+// degrees (N/S/E/W prefixes are allowed) and the height in meters.
+// A negative latitude on the command line must follow -- or use the S prefix,
+// so that it is not taken for a flag.
+// Blank lines and lines starting with # are ignored.
+//
+// For each point the geoid height (undulation) N interpolated from the 15'x15'
+// EGM96 grid is written.  With --to_msl the input height is taken to be above
+// the ellipsoid and the height above mean sea level is also written; with
+// --to_ellipsoid the input height is taken to be above mean sea level and the
+// height above the ellipsoid is written.  With --nearest the nearest grid point
+// and its geoid height are also written.
+//
+// The output format is text by default, or json, csv or tsv as for the other
+// commands.  Sample output:
+//  $ geoid_height --to_msl S12.25 82.75 1000
+//   Latitude   Longitude   Geoid (m)     HAE (m)     MSL (m)
+//   -12.2500     82.7500     -67.347    1000.000    1067.347
+//
+// Points that cannot be parsed or are outside the grid are reported on standard
+// error with their line number and skipped.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/westphae/geomag/internal/format"
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+const (
+	usage = "geoid_height --to_msl|--to_ellipsoid --nearest --format=text [latitude] [longitude] [height]\n" +
+		"geoid_height --to_msl|--to_ellipsoid --nearest --format=text --input=points.txt"
+	toMSLUsage = "Input heights are above the WGS-84 ellipsoid; also output heights above mean sea level"
+	toHAEUsage = "Input heights are above mean sea level; also output heights above the WGS-84 ellipsoid"
+	nearestUsage = "Also output the nearest EGM96 grid point and its geoid height"
+	inputUsage = "File of points to read, - or empty for standard input"
+	formatUsage = "Output format: text, json, csv or tsv"
+)
+
+var (
+	toMSL     bool
+	toHAE     bool
+	nearest   bool
+	inFile    string
+	outFormat string
+)
+
+func init() {
+	flag.BoolVar(&toMSL, "to_msl", false, toMSLUsage)
+	flag.BoolVar(&toHAE, "to_ellipsoid", false, toHAEUsage)
+	flag.BoolVar(&nearest, "nearest", false, nearestUsage)
+	flag.StringVar(&inFile, "input", "", inputUsage)
+	flag.StringVar(&inFile, "i", "", inputUsage)
+	flag.StringVar(&outFormat, "format", "text", formatUsage)
+	flag.StringVar(&outFormat, "f", "text", formatUsage)
+}
+
+func main() {
+	flag.Parse()
+	if toMSL && toHAE {
+		_, _ = fmt.Fprintln(os.Stderr, "Only one of --to_msl and --to_ellipsoid may be given")
+		os.Exit(2)
+	}
+	if outFormat!="text" && outFormat!="json" && outFormat!="csv" && outFormat!="tsv" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format %s, must be text, json, csv or tsv\n", outFormat)
+		os.Exit(2)
+	}
+
+	var (
+		rows [][]interface{}
+		nErr int
+		err  error
+	)
+	if flag.NArg()>0 {
+		if flag.NArg()>3 {
+			_, _ = fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		row, err := point(flag.Args())
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		rows = append(rows, row)
+	} else {
+		in := os.Stdin
+		if inFile!="" && inFile!="-" {
+			if in, err = os.Open(inFile); err!=nil {
+				_, _ = fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer in.Close()
+		}
+		rows, nErr = readPoints(in)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if outFormat=="text" {
+		writeText(w, rows)
+	} else if err = format.WriteTable(w, outFormat, columns(), rows...); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	_ = w.Flush()
+	if nErr>0 {
+		os.Exit(1)
+	}
+}
+
+// readPoints reads the points from r and returns their output rows and the
+// number of lines that could not be processed.
+func readPoints(r io.Reader) (rows [][]interface{}, nErr int) {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line=="" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c==' ' || c=='\t' || c==','
+		})
+		row, err := point(fields)
+		if err!=nil {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: %s\n", lineNo, err)
+			nErr++
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		nErr++
+	}
+	return rows, nErr
+}
+
+// columns returns the names of the output columns.
+func columns() (cs []string) {
+	cs = []string{"latitude", "longitude", "geoid_height"}
+	if toMSL || toHAE {
+		cs = append(cs, "height_ellipsoid", "height_msl")
+	}
+	if nearest {
+		cs = append(cs, "grid_latitude", "grid_longitude", "grid_geoid_height")
+	}
+	return cs
+}
+
+// point returns the output row for the point with fields latitude, longitude
+// and optionally height.
+func point(fields []string) (row []interface{}, err error) {
+	if len(fields)<2 || len(fields)>3 {
+		return nil, fmt.Errorf("expected latitude, longitude and an optional height, got %d fields", len(fields))
+	}
+	lat, err := parsing.ParseLatLng(fields[0])
+	if err!=nil {
+		return nil, err
+	}
+	if lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %s is outside the range -90 to 90", fields[0])
+	}
+	lng, err := parsing.ParseLatLng(fields[1])
+	if err!=nil {
+		return nil, err
+	}
+	if lng < -180 || lng >= 360 {
+		return nil, fmt.Errorf("longitude %s is outside the range -180 to 360", fields[1])
+	}
+	var h float64
+	if len(fields)==3 {
+		if h, err = strconv.ParseFloat(fields[2], 64); err!=nil {
+			return nil, fmt.Errorf("invalid height %s", fields[2])
+		}
+	} else if toMSL || toHAE {
+		return nil, fmt.Errorf("a height is required to convert")
+	}
+
+	lng360 := lng
+	for lng360<0 {
+		lng360 += 360
+	}
+	loc := egm96.NewLocationGeodetic(lat, lng360, 0)
+	hMSL, err := loc.HeightAboveMSL()
+	if err!=nil {
+		return nil, err
+	}
+	n := -hMSL
+
+	row = []interface{}{lat, lng, n}
+	if toMSL {
+		row = append(row, h, h-n)
+	}
+	if toHAE {
+		row = append(row, h+n, h)
+	}
+	if nearest {
+		g, err := loc.NearestEGM96GridPoint()
+		if err!=nil {
+			return nil, err
+		}
+		gLat, gLng, gN := g.Geodetic()
+		gLng /= egm96.Deg
+		if lng<0 && gLng>=180 {
+			gLng -= 360
+		}
+		row = append(row, gLat/egm96.Deg, gLng, gN)
+	}
+	return row, nil
+}
+
+// textColumns are the headings and numbers of decimal places of the columns
+// in the text output.
+var textColumns = map[string]struct {
+	heading string
+	prec    int
+}{
+	"latitude":          {"Latitude", 4},
+	"longitude":         {"Longitude", 4},
+	"geoid_height":      {"Geoid (m)", 3},
+	"height_ellipsoid":  {"HAE (m)", 3},
+	"height_msl":        {"MSL (m)", 3},
+	"grid_latitude":     {"Grid Lat", 4},
+	"grid_longitude":    {"Grid Lng", 4},
+	"grid_geoid_height": {"Grid Geoid (m)", 3},
+}
+
+// writeText writes the rows as an aligned table.
+func writeText(w io.Writer, rows [][]interface{}) {
+	cs := columns()
+	for i, c := range cs {
+		if i>0 {
+			fmt.Fprint(w, "   ")
+		}
+		fmt.Fprintf(w, "%9s", textColumns[c].heading)
+	}
+	fmt.Fprintln(w)
+	for _, row := range rows {
+		for i, v := range row {
+			if i>0 {
+				fmt.Fprint(w, "   ")
+			}
+			fmt.Fprintf(w, "%9.*f", textColumns[cs[i]].prec, v)
+		}
+		fmt.Fprintln(w)
+	}
+}
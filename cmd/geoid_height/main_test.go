@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+// setFlags sets the conversion flags for a test and returns a function restoring them.
+func setFlags(msl, hae, near bool) func() {
+	oldMSL, oldHAE, oldNearest := toMSL, toHAE, nearest
+	toMSL, toHAE, nearest = msl, hae, near
+	return func() {
+		toMSL, toHAE, nearest = oldMSL, oldHAE, oldNearest
+	}
+}
+
+// geoidHeight returns the geoid height at the latitude and longitude in degrees.
+func geoidHeight(t *testing.T, lat, lng float64) float64 {
+	h, err := egm96.NewLocationGeodetic(lat, lng, 0).HeightAboveMSL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return -h
+}
+
+func TestPointToMSL(t *testing.T) {
+	defer setFlags(true, false, false)()
+
+	row, err := point([]string{"S12.25", "82.75", "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != 5 || len(row) != len(columns()) {
+		t.Fatalf("expected 5 values, got %v", row)
+	}
+	n := geoidHeight(t, -12.25, 82.75)
+	testDiff("latitude", row[0].(float64), -12.25, 0, t)
+	testDiff("longitude", row[1].(float64), 82.75, 0, t)
+	testDiff("geoid height", row[2].(float64), n, 1e-9, t)
+	testDiff("height above ellipsoid", row[3].(float64), 1000, 0, t)
+	testDiff("height above MSL", row[4].(float64), 1000-n, 1e-9, t)
+
+	if _, err = point([]string{"10", "20"}); err == nil {
+		t.Error("expected an error for a missing height")
+	}
+}
+
+func TestPointToEllipsoid(t *testing.T) {
+	defer setFlags(false, true, false)()
+
+	row, err := point([]string{"38", "-90.1", "250.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := geoidHeight(t, 38, 269.9)
+	testDiff("longitude", row[1].(float64), -90.1, 0, t)
+	testDiff("geoid height", row[2].(float64), n, 1e-9, t)
+	testDiff("height above ellipsoid", row[3].(float64), 250.5+n, 1e-9, t)
+	testDiff("height above MSL", row[4].(float64), 250.5, 0, t)
+}
+
+func TestPointNearest(t *testing.T) {
+	defer setFlags(false, false, true)()
+
+	// The nearest grid point of a negative longitude is also given as a negative longitude
+	row, err := point([]string{"38.1", "-90.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != 6 || len(row) != len(columns()) {
+		t.Fatalf("expected 6 values, got %v", row)
+	}
+	testDiff("grid latitude", row[3].(float64), 38, 1e-9, t)
+	testDiff("grid longitude", row[4].(float64), -90, 1e-9, t)
+	testDiff("grid geoid height", row[5].(float64), geoidHeight(t, 38, 270), 1e-9, t)
+
+	// but is not wrapped for a positive longitude
+	if row, err = point([]string{"38.1", "269.9"}); err != nil {
+		t.Fatal(err)
+	}
+	testDiff("grid longitude", row[4].(float64), 270, 1e-9, t)
+
+	// nor near the antimeridian
+	if row, err = point([]string{"0", "-179.9"}); err != nil {
+		t.Fatal(err)
+	}
+	testDiff("grid longitude", row[4].(float64), -180, 1e-9, t)
+}
+
+func TestPointErrors(t *testing.T) {
+	defer setFlags(false, false, false)()
+
+	for _, fields := range [][]string{
+		{"10"},
+		{"10", "20", "30", "40"},
+		{"91", "20"},
+		{"10", "360"},
+		{"10", "-181"},
+		{"x", "20"},
+		{"10", "20", "high"},
+	} {
+		if _, err := point(fields); err == nil {
+			t.Errorf("expected an error for %v", fields)
+		}
+	}
+}
+
+func TestReadPoints(t *testing.T) {
+	defer setFlags(true, false, false)()
+
+	rows, nErr := readPoints(strings.NewReader(`# latitude longitude height
+38 -90 100
+
+-12.25,82.75,1000
+91 0 0
+10	20	-5.5
+`))
+	if nErr != 1 {
+		t.Errorf("expected 1 bad line, got %d", nErr)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	testDiff("comma-separated latitude", rows[1][0].(float64), -12.25, 0, t)
+	testDiff("comma-separated height", rows[1][3].(float64), 1000, 0, t)
+	testDiff("tab-separated height above MSL", rows[2][4].(float64), -5.5-geoidHeight(t, 10, 20), 1e-9, t)
+
+	var b bytes.Buffer
+	writeText(&b, rows[1:2])
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected text output:\n%s", b.String())
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) != 5 || fields[0] != "-12.2500" || fields[1] != "82.7500" || fields[3] != "1000.000" {
+		t.Errorf("unexpected text output:\n%s", b.String())
+	}
+}
@@ -0,0 +1,61 @@
+// geomag_server serves World Magnetic Model calculations over HTTP.
+//
+// Usage is
+//  geomag_server --cof_file=WMM2020.COF --addr=:8080
+//
+// The endpoints and their query parameters follow NOAA's online geomagnetic
+// calculators, so that clients of https://www.ngdc.noaa.gov/geomag-web/calculators/
+// can be pointed at a self-hosted instance.  The endpoints are served both at
+// the root and under /geomag-web/calculators/:
+//  calculateDeclination  the declination of a point at mean sea level on one date
+//  calculateIgrfwmm      all field components of a point over a range of dates
+//  calculateGrid         one field component over a grid of points and dates
+// Responses are JSON, XML or CSV, chosen with the resultFormat parameter; JSON is the
+// default.  The NOAA key parameter is accepted and ignored.
+//
+// For example
+//  curl 'http://localhost:8080/calculateDeclination?lat1=40&lon1=105.25&lon1Hemisphere=W&startYear=2022&startMonth=6&startDay=1'
+//
+// An OpenAPI description of the service is served at /openapi.yaml.
+// Only the WMM model is available; the model parameter is ignored.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	cofUsage  = "COF coefficients file to use, empty for the built-in one"
+	addrUsage = "Address to listen on"
+)
+
+var (
+	cofFile string
+	addr    string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&addr, "addr", ":8080", addrUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if cofFile!="" {
+		if err := wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	log.Printf("Serving %s on %s", wmm.COFName, addr)
+	log.Fatal(http.ListenAndServe(addr, newHandler()))
+}
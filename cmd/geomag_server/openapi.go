@@ -0,0 +1,229 @@
+package main
+
+// openAPI is the OpenAPI description of the service, served at /openapi.yaml.
+const openAPI = `openapi: 3.0.3
+info:
+  title: geomag_server
+  description: >
+    World Magnetic Model calculations, compatible with the NOAA geomagnetic
+    calculators at https://www.ngdc.noaa.gov/geomag-web/calculators/.
+    The same endpoints are also served under /geomag-web/calculators/.
+  version: "1.0"
+paths:
+  /calculateDeclination:
+    get:
+      summary: Declination of a point at mean sea level on one date
+      parameters:
+        - $ref: '#/components/parameters/lat1'
+        - $ref: '#/components/parameters/lat1Hemisphere'
+        - $ref: '#/components/parameters/lon1'
+        - $ref: '#/components/parameters/lon1Hemisphere'
+        - $ref: '#/components/parameters/startYear'
+        - $ref: '#/components/parameters/startMonth'
+        - $ref: '#/components/parameters/startDay'
+        - $ref: '#/components/parameters/resultFormat'
+        - $ref: '#/components/parameters/key'
+        - $ref: '#/components/parameters/model'
+      responses:
+        '200':
+          $ref: '#/components/responses/Result'
+        '400':
+          $ref: '#/components/responses/BadRequest'
+  /calculateIgrfwmm:
+    get:
+      summary: All field components of a point over a range of dates
+      parameters:
+        - $ref: '#/components/parameters/lat1'
+        - $ref: '#/components/parameters/lat1Hemisphere'
+        - $ref: '#/components/parameters/lon1'
+        - $ref: '#/components/parameters/lon1Hemisphere'
+        - $ref: '#/components/parameters/elevation'
+        - $ref: '#/components/parameters/elevationUnits'
+        - $ref: '#/components/parameters/coordinateSystem'
+        - $ref: '#/components/parameters/startYear'
+        - $ref: '#/components/parameters/startMonth'
+        - $ref: '#/components/parameters/startDay'
+        - $ref: '#/components/parameters/endYear'
+        - $ref: '#/components/parameters/endMonth'
+        - $ref: '#/components/parameters/endDay'
+        - $ref: '#/components/parameters/dateStepSize'
+        - $ref: '#/components/parameters/resultFormat'
+        - $ref: '#/components/parameters/key'
+        - $ref: '#/components/parameters/model'
+      responses:
+        '200':
+          $ref: '#/components/responses/Result'
+        '400':
+          $ref: '#/components/responses/BadRequest'
+  /calculateGrid:
+    get:
+      summary: One field component over a grid of points and a range of dates
+      parameters:
+        - $ref: '#/components/parameters/lat1'
+        - $ref: '#/components/parameters/lat1Hemisphere'
+        - name: lat2
+          in: query
+          description: Last latitude of the grid, in degrees
+          schema: {type: number, minimum: -90, maximum: 90}
+        - name: lat2Hemisphere
+          in: query
+          schema: {type: string, enum: [N, S]}
+        - name: latStepSize
+          in: query
+          description: Latitude step in degrees
+          schema: {type: number, exclusiveMinimum: true, minimum: 0}
+        - $ref: '#/components/parameters/lon1'
+        - $ref: '#/components/parameters/lon1Hemisphere'
+        - name: lon2
+          in: query
+          description: Last longitude of the grid, in degrees
+          schema: {type: number, minimum: -180, maximum: 180}
+        - name: lon2Hemisphere
+          in: query
+          schema: {type: string, enum: [E, W]}
+        - name: lonStepSize
+          in: query
+          description: Longitude step in degrees
+          schema: {type: number, exclusiveMinimum: true, minimum: 0}
+        - $ref: '#/components/parameters/elevation'
+        - $ref: '#/components/parameters/elevationUnits'
+        - $ref: '#/components/parameters/coordinateSystem'
+        - $ref: '#/components/parameters/startYear'
+        - $ref: '#/components/parameters/startMonth'
+        - $ref: '#/components/parameters/startDay'
+        - $ref: '#/components/parameters/endYear'
+        - $ref: '#/components/parameters/endMonth'
+        - $ref: '#/components/parameters/endDay'
+        - $ref: '#/components/parameters/dateStepSize'
+        - name: magneticComponent
+          in: query
+          description: >
+            The component to calculate: d (declination), i (inclination), x, y, z,
+            h (horizontal intensity), f (total intensity) or gv (grid variation)
+          schema: {type: string, enum: [d, i, x, y, z, h, f, gv], default: d}
+        - $ref: '#/components/parameters/resultFormat'
+        - $ref: '#/components/parameters/key'
+        - $ref: '#/components/parameters/model'
+      responses:
+        '200':
+          $ref: '#/components/responses/Result'
+        '400':
+          $ref: '#/components/responses/BadRequest'
+components:
+  parameters:
+    lat1:
+      name: lat1
+      in: query
+      required: true
+      description: Latitude in decimal degrees or D M S, north positive
+      schema: {type: string}
+    lat1Hemisphere:
+      name: lat1Hemisphere
+      in: query
+      description: S to make the latitude south
+      schema: {type: string, enum: [N, S]}
+    lon1:
+      name: lon1
+      in: query
+      required: true
+      description: Longitude in decimal degrees or D M S, east positive
+      schema: {type: string}
+    lon1Hemisphere:
+      name: lon1Hemisphere
+      in: query
+      description: W to make the longitude west
+      schema: {type: string, enum: [E, W]}
+    elevation:
+      name: elevation
+      in: query
+      description: Elevation in elevationUnits
+      schema: {type: number, default: 0}
+    elevationUnits:
+      name: elevationUnits
+      in: query
+      description: K for kilometers, M for meters or F for feet
+      schema: {type: string, enum: [K, M, F], default: K}
+    coordinateSystem:
+      name: coordinateSystem
+      in: query
+      description: M for elevation above mean sea level, D for above the WGS84 ellipsoid
+      schema: {type: string, enum: [M, D], default: M}
+    startYear:
+      name: startYear
+      in: query
+      description: Year of the (first) date, today by default
+      schema: {type: integer}
+    startMonth:
+      name: startMonth
+      in: query
+      schema: {type: integer, minimum: 1, maximum: 12}
+    startDay:
+      name: startDay
+      in: query
+      schema: {type: integer, minimum: 1, maximum: 31}
+    endYear:
+      name: endYear
+      in: query
+      description: Year of the last date, if a range of dates is wanted
+      schema: {type: integer}
+    endMonth:
+      name: endMonth
+      in: query
+      schema: {type: integer, minimum: 1, maximum: 12}
+    endDay:
+      name: endDay
+      in: query
+      schema: {type: integer, minimum: 1, maximum: 31}
+    dateStepSize:
+      name: dateStepSize
+      in: query
+      description: Step between dates in years
+      schema: {type: number, exclusiveMinimum: true, minimum: 0}
+    resultFormat:
+      name: resultFormat
+      in: query
+      schema: {type: string, enum: [json, xml, csv], default: json}
+    key:
+      name: key
+      in: query
+      description: Accepted for compatibility and ignored
+      schema: {type: string}
+    model:
+      name: model
+      in: query
+      description: Accepted for compatibility and ignored; the loaded WMM is always used
+      schema: {type: string}
+  responses:
+    Result:
+      description: >
+        The results, one per point and date.  Each result has the date as a decimal
+        year, the latitude, longitude and elevation (in km), and for each component
+        its value, secular variation (suffix _sv) and, except for grids, uncertainty
+        (suffix _uncertainty).
+      content:
+        application/json:
+          schema:
+            type: object
+            properties:
+              result:
+                type: array
+                items:
+                  type: object
+                  additionalProperties: {type: number}
+              model: {type: string}
+              units:
+                type: object
+                additionalProperties: {type: string}
+              version: {type: string}
+        application/xml:
+          schema:
+            type: object
+            xml: {name: maggridresult}
+        text/csv:
+          schema: {type: string}
+    BadRequest:
+      description: The parameters were invalid, with the problems listed one per line
+      content:
+        text/plain:
+          schema: {type: string}
+`
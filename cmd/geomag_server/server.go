@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	version   = "1.0"
+	maxPoints = 100000 // Largest number of results returned by one request
+)
+
+// units holds the units of each result field, as reported in the responses.
+var units = map[string]string{
+	"latitude":                   "degrees",
+	"longitude":                  "degrees",
+	"elevation":                  "km",
+	"declination":                "degrees",
+	"declination_sv":             "degrees/year",
+	"declination_uncertainty":    "degrees",
+	"inclination":                "degrees",
+	"inclination_sv":             "degrees/year",
+	"inclination_uncertainty":    "degrees",
+	"xcomponent":                 "nT",
+	"xcomponent_sv":              "nT/year",
+	"xcomponent_uncertainty":     "nT",
+	"ycomponent":                 "nT",
+	"ycomponent_sv":              "nT/year",
+	"ycomponent_uncertainty":     "nT",
+	"zcomponent":                 "nT",
+	"zcomponent_sv":              "nT/year",
+	"zcomponent_uncertainty":     "nT",
+	"horintensity":               "nT",
+	"horintensity_sv":            "nT/year",
+	"horintensity_uncertainty":   "nT",
+	"totalintensity":             "nT",
+	"totalintensity_sv":          "nT/year",
+	"totalintensity_uncertainty": "nT",
+	"gridvariation":              "degrees",
+	"gridvariation_sv":           "degrees/year",
+	"gridvariation_uncertainty":  "degrees",
+}
+
+// element is a field component reported by the calculators, with the functions
+// giving its value, secular variation and uncertainty.
+type element struct {
+	name        string
+	value       func(mf wmm.MagneticField) float64
+	sv          func(mf wmm.MagneticField) float64
+	uncertainty func(mf wmm.MagneticField) float64
+}
+
+// elements maps the magneticComponent parameter of calculateGrid to the element it selects.
+// They are also the elements of calculateIgrfwmm, in the order of elementOrder.
+var elements = map[string]element{
+	"d": {"declination", wmm.MagneticField.D, wmm.MagneticField.DD, wmm.MagneticField.ErrD},
+	"i": {"inclination", wmm.MagneticField.I, wmm.MagneticField.DI, wmm.MagneticField.ErrI},
+	"x": {"xcomponent",
+		func(mf wmm.MagneticField) float64 { x, _, _, _, _, _ := mf.Ellipsoidal(); return x },
+		func(mf wmm.MagneticField) float64 { _, _, _, dx, _, _ := mf.Ellipsoidal(); return dx },
+		wmm.MagneticField.ErrX},
+	"y": {"ycomponent",
+		func(mf wmm.MagneticField) float64 { _, y, _, _, _, _ := mf.Ellipsoidal(); return y },
+		func(mf wmm.MagneticField) float64 { _, _, _, _, dy, _ := mf.Ellipsoidal(); return dy },
+		wmm.MagneticField.ErrY},
+	"z": {"zcomponent",
+		func(mf wmm.MagneticField) float64 { _, _, z, _, _, _ := mf.Ellipsoidal(); return z },
+		func(mf wmm.MagneticField) float64 { _, _, _, _, _, dz := mf.Ellipsoidal(); return dz },
+		wmm.MagneticField.ErrZ},
+	"h": {"horintensity", wmm.MagneticField.H, wmm.MagneticField.DH, wmm.MagneticField.ErrH},
+	"f": {"totalintensity", wmm.MagneticField.F, wmm.MagneticField.DF, wmm.MagneticField.ErrF},
+	"gv": {"gridvariation", func(mf wmm.MagneticField) float64 { return mf.GV(mf.Location()) },
+		wmm.MagneticField.DGV, wmm.MagneticField.ErrD},
+}
+
+var elementOrder = []string{"d", "i", "x", "y", "z", "h", "f"}
+
+// newHandler returns the handler serving the calculators, both at the root
+// and under NOAA's /geomag-web/calculators/ path.
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, prefix := range []string{"/", "/geomag-web/calculators/"} {
+		mux.HandleFunc(prefix+"calculateDeclination", handleDeclination)
+		mux.HandleFunc(prefix+"calculateIgrfwmm", handleIgrfwmm)
+		mux.HandleFunc(prefix+"calculateGrid", handleGrid)
+	}
+	mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(openAPI))
+	})
+	return mux
+}
+
+// handleDeclination serves the declination of a single point on one date,
+// at mean sea level.
+func handleDeclination(w http.ResponseWriter, r *http.Request) {
+	q := query{Values: r.URL.Query()}
+	lat := q.latLng("lat1", "lat1Hemisphere", 90)
+	lng := q.latLng("lon1", "lon1Hemisphere", 180)
+	date := q.date("start")
+	if q.failed(w) {
+		return
+	}
+	res := newResult([]element{elements["d"]}, true)
+	if err := res.add(lat, lng, 0, false, []float64{date}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.write(w, q.resultFormat())
+}
+
+// handleIgrfwmm serves all the field elements of a single point over a range of dates.
+func handleIgrfwmm(w http.ResponseWriter, r *http.Request) {
+	q := query{Values: r.URL.Query()}
+	lat := q.latLng("lat1", "lat1Hemisphere", 90)
+	lng := q.latLng("lon1", "lon1Hemisphere", 180)
+	alt, hae := q.elevation()
+	dates := q.dates()
+	if q.failed(w) {
+		return
+	}
+	var es []element
+	for _, name := range elementOrder {
+		es = append(es, elements[name])
+	}
+	res := newResult(es, true)
+	if err := res.add(lat, lng, alt, hae, dates); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.write(w, q.resultFormat())
+}
+
+// handleGrid serves one field element over a grid of points and a range of dates.
+func handleGrid(w http.ResponseWriter, r *http.Request) {
+	q := query{Values: r.URL.Query()}
+	lats := q.latLngRange("lat1", "lat2", "latStepSize", 90)
+	lngs := q.latLngRange("lon1", "lon2", "lonStepSize", 180)
+	alt, hae := q.elevation()
+	dates := q.dates()
+	comp := strings.ToLower(q.Get("magneticComponent"))
+	if comp == "" {
+		comp = "d"
+	}
+	e, ok := elements[comp]
+	if !ok {
+		q.errs = append(q.errs, fmt.Sprintf("unknown magneticComponent %s", q.Get("magneticComponent")))
+	}
+	if len(lats)*len(lngs)*len(dates) > maxPoints {
+		q.errs = append(q.errs, fmt.Sprintf("the grid has more than %d points", maxPoints))
+	}
+	if q.failed(w) {
+		return
+	}
+	res := newResult([]element{e}, false)
+	for _, lat := range lats {
+		for _, lng := range lngs {
+			if err := res.add(lat, lng, alt, hae, dates); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	res.write(w, q.resultFormat())
+}
+
+// query parses the calculator query parameters, collecting any errors.
+type query struct {
+	url.Values
+	errs []string
+}
+
+// failed writes a Bad Request response listing the errors, if there were any.
+func (q *query) failed(w http.ResponseWriter) bool {
+	if len(q.errs) == 0 {
+		return false
+	}
+	http.Error(w, strings.Join(q.errs, "\n"), http.StatusBadRequest)
+	return true
+}
+
+// latLng returns the latitude or longitude in parameter name, negated if the
+// hemisphere parameter is S or W.
+func (q *query) latLng(name, hemisphere string, limit float64) (v float64) {
+	s := q.Get(name)
+	if s == "" {
+		q.errs = append(q.errs, fmt.Sprintf("%s is required", name))
+		return 0
+	}
+	v, err := parsing.ParseLatLng(s)
+	if err != nil {
+		q.errs = append(q.errs, fmt.Sprintf("invalid %s %s: %s", name, s, err))
+		return 0
+	}
+	switch strings.ToUpper(q.Get(hemisphere)) {
+	case "S", "W":
+		v = -math.Abs(v)
+	}
+	if v < -limit || v > limit {
+		q.errs = append(q.errs, fmt.Sprintf("%s %s is outside the range -%v to %v", name, s, limit, limit))
+	}
+	return v
+}
+
+// latLngRange returns the latitudes or longitudes from parameter first to last in steps of step.
+func (q *query) latLngRange(first, last, step string, limit float64) (vs []float64) {
+	v1 := q.latLng(first, first+"Hemisphere", limit)
+	if q.Get(last) == "" {
+		return []float64{v1}
+	}
+	v2 := q.latLng(last, last+"Hemisphere", limit)
+	dv := q.float(step, math.Abs(v2-v1))
+	if len(q.errs) > 0 {
+		return nil
+	}
+	vs, err := parsing.ParseRange(fmt.Sprintf("%v:%v:%v", v1, v2, dv), parsing.ParseLatLng)
+	if err != nil {
+		q.errs = append(q.errs, err.Error())
+	}
+	return vs
+}
+
+// float returns the value of parameter name, or def if it is not given.
+func (q *query) float(name string, def float64) (v float64) {
+	s := q.Get(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		q.errs = append(q.errs, fmt.Sprintf("invalid %s %s", name, s))
+	}
+	return v
+}
+
+// elevation returns the elevation in meters, and whether it is above the
+// WGS84 ellipsoid (coordinateSystem=D) rather than mean sea level (M, the default).
+func (q *query) elevation() (alt float64, hae bool) {
+	alt = q.float("elevation", 0)
+	switch strings.ToUpper(q.Get("elevationUnits")) {
+	case "", "K":
+		alt *= 1000
+	case "M":
+	case "F":
+		alt *= egm96.Ft
+	default:
+		q.errs = append(q.errs, fmt.Sprintf("unknown elevationUnits %s, must be K, M or F", q.Get("elevationUnits")))
+	}
+	switch strings.ToUpper(q.Get("coordinateSystem")) {
+	case "", "M":
+	case "D":
+		hae = true
+	default:
+		q.errs = append(q.errs, fmt.Sprintf("unknown coordinateSystem %s, must be M or D", q.Get("coordinateSystem")))
+	}
+	return alt, hae
+}
+
+// date returns the date given by the Year, Month and Day parameters with the
+// prefix as a decimal year.  Missing parameters default to today's date.
+func (q *query) date(prefix string) (dYear float64) {
+	now := time.Now().UTC()
+	y := q.int(prefix+"Year", now.Year())
+	m := q.int(prefix+"Month", int(now.Month()))
+	d := q.int(prefix+"Day", now.Day())
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes days past the end of the month into the next one
+	if ty, tm, td := t.Date(); ty != y || int(tm) != m || td != d {
+		q.errs = append(q.errs, fmt.Sprintf("invalid %s date %d-%d-%d", prefix, y, m, d))
+	}
+	return float64(wmm.TimeToDecimalYears(t))
+}
+
+// dates returns the dates from the start date to the end date, if given, in steps
+// of dateStepSize years.
+func (q *query) dates() (ds []float64) {
+	start := q.date("start")
+	if q.Get("endYear") == "" {
+		return []float64{start}
+	}
+	end := q.date("end")
+	step := q.float("dateStepSize", end-start)
+	if len(q.errs) > 0 {
+		return nil
+	}
+	if end == start {
+		return []float64{start}
+	}
+	ds, err := parsing.ParseRange(fmt.Sprintf("%v:%v:%v", start, end, step), parsing.ParseTime)
+	if err != nil {
+		q.errs = append(q.errs, err.Error())
+	}
+	return ds
+}
+
+// int returns the integer value of parameter name, or def if it is not given.
+func (q *query) int(name string, def int) (v int) {
+	s := q.Get(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		q.errs = append(q.errs, fmt.Sprintf("invalid %s %s", name, s))
+	}
+	return v
+}
+
+// resultFormat returns the requested response format, json by default.
+func (q *query) resultFormat() (f string) {
+	f = strings.ToLower(q.Get("resultFormat"))
+	if f == "" {
+		f = "json"
+	}
+	return f
+}
+
+// result accumulates the rows of a calculator response.
+type result struct {
+	elements    []element
+	uncertainty bool
+	fields      []string
+	rows        [][]float64
+}
+
+func newResult(es []element, uncertainty bool) (res *result) {
+	res = &result{elements: es, uncertainty: uncertainty,
+		fields: []string{"date", "latitude", "longitude", "elevation"}}
+	for _, e := range es {
+		res.fields = append(res.fields, e.name, e.name+"_sv")
+		if uncertainty {
+			res.fields = append(res.fields, e.name+"_uncertainty")
+		}
+	}
+	return res
+}
+
+// add calculates the field at the point for each date and adds the rows to the result.
+// The elevation alt is in meters.
+func (res *result) add(lat, lng, alt float64, hae bool, dates []float64) (err error) {
+	var loc egm96.Location
+	lng360 := lng
+	if lng360 < 0 {
+		lng360 += 360
+	}
+	if hae {
+		loc = egm96.NewLocationGeodetic(lat, lng360, alt)
+	} else if loc, err = egm96.NewLocationMSL(lat, lng360, alt); err != nil {
+		return err
+	}
+	for _, date := range dates {
+		if date < float64(wmm.TimeToDecimalYears(wmm.ValidDate)) || date > float64(wmm.Epoch)+5 {
+			return fmt.Errorf("date %.3f is outside the validity of %s from %.3f to %.3f",
+				date, wmm.COFName, wmm.TimeToDecimalYears(wmm.ValidDate), wmm.Epoch+5)
+		}
+		mf, _ := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(date).ToTime())
+		row := []float64{date, lat, lng, alt / 1000}
+		for _, e := range res.elements {
+			row = append(row, e.value(mf), e.sv(mf))
+			if res.uncertainty {
+				row = append(row, e.uncertainty(mf))
+			}
+		}
+		res.rows = append(res.rows, row)
+	}
+	return nil
+}
+
+// write writes the result to w in the format f, one of json, xml or csv.
+func (res *result) write(w http.ResponseWriter, f string) {
+	var b bytes.Buffer
+	switch f {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		res.writeJSON(&b)
+	case "xml":
+		w.Header().Set("Content-Type", "application/xml")
+		res.writeXML(&b)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		res.writeCSV(&b)
+	default:
+		http.Error(w, fmt.Sprintf("unknown resultFormat %s, must be json, xml or csv", f), http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write(b.Bytes())
+}
+
+// number formats a result value rounded to 5 decimal places.
+func number(v float64) (s string) {
+	return strconv.FormatFloat(math.Round(v*1e5)/1e5, 'f', -1, 64)
+}
+
+func (res *result) writeJSON(b *bytes.Buffer) {
+	b.WriteString("{\n  \"result\": [")
+	for i, row := range res.rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n    {")
+		for j, v := range row {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(b, "\n      %q: %s", res.fields[j], number(v))
+		}
+		b.WriteString("\n    }")
+	}
+	fmt.Fprintf(b, "\n  ],\n  \"model\": %q,\n  \"units\": {", wmm.COFName)
+	names := append([]string(nil), res.fields[1:]...)
+	sort.Strings(names)
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(b, "\n    %q: %q", name, units[name])
+	}
+	fmt.Fprintf(b, "\n  },\n  \"version\": %q\n}\n", version)
+}
+
+func (res *result) writeXML(b *bytes.Buffer) {
+	b.WriteString(xml.Header)
+	b.WriteString("<maggridresult>\n")
+	for _, row := range res.rows {
+		b.WriteString("  <result>\n")
+		for j, v := range row {
+			if u := units[res.fields[j]]; u != "" {
+				fmt.Fprintf(b, "    <%s units=\"%s\">%s</%s>\n", res.fields[j], u, number(v), res.fields[j])
+			} else {
+				fmt.Fprintf(b, "    <%s>%s</%s>\n", res.fields[j], number(v), res.fields[j])
+			}
+		}
+		b.WriteString("  </result>\n")
+	}
+	fmt.Fprintf(b, "  <model>%s</model>\n  <version>%s</version>\n</maggridresult>\n", wmm.COFName, version)
+}
+
+func (res *result) writeCSV(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# Model: %s\n# Version: %s\n# Units:", wmm.COFName, version)
+	for _, name := range res.fields[1:] {
+		fmt.Fprintf(b, " %s (%s)", name, units[name])
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Join(res.fields, ","))
+	b.WriteString("\n")
+	for _, row := range res.rows {
+		for j, v := range row {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(number(v))
+		}
+		b.WriteString("\n")
+	}
+}
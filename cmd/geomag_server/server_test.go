@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+type jsonResponse struct {
+	Result  []map[string]float64 `json:"result"`
+	Model   string               `json:"model"`
+	Units   map[string]string    `json:"units"`
+	Version string               `json:"version"`
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (code int, body []byte) {
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func newTestServer(t *testing.T) (srv *httptest.Server) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(newHandler())
+}
+
+func TestIgrfwmm(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	code, body := get(t, srv, "/geomag-web/calculators/calculateIgrfwmm?lat1=80&lon1=96&lon1Hemisphere=W"+
+		"&elevation=48&coordinateSystem=D&startYear=2020&startMonth=1&startDay=1&key=abc&resultFormat=json")
+	if code != http.StatusOK {
+		t.Fatalf("calculateIgrfwmm returned %d: %s", code, body)
+	}
+	var resp jsonResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Result) != 1 || resp.Model != "WMM-2020" || resp.Units["totalintensity"] != "nT" {
+		t.Fatalf("calculateIgrfwmm returned %s", body)
+	}
+	// Values from the WMM2020 test values
+	r := resp.Result[0]
+	for k, v := range map[string]float64{"date": 2020, "latitude": 80, "longitude": -96, "elevation": 48,
+		"declination": -37.40, "inclination": 88.03, "horintensity": 1910.8, "xcomponent": 1518.0,
+		"ycomponent": -1160.5, "zcomponent": 55671.9, "totalintensity": 55704.7,
+		"declination_sv": 1.95, "horintensity_sv": 41.6, "xcomponent_sv": 72.5, "ycomponent_sv": 26.3,
+		"zcomponent_sv": -11.3, "totalintensity_sv": -9.8, "totalintensity_uncertainty": 148} {
+		testDiff(k, r[k], v, 0.06, t)
+	}
+
+	// A range of dates
+	code, body = get(t, srv, "/calculateIgrfwmm?lat1=80&lon1=96&lon1Hemisphere=W&elevation=48000&elevationUnits=M"+
+		"&coordinateSystem=D&startYear=2020&startMonth=1&startDay=1&endYear=2022&endMonth=1&endDay=1&dateStepSize=0.5")
+	if code != http.StatusOK {
+		t.Fatalf("calculateIgrfwmm returned %d: %s", code, body)
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Result) != 5 {
+		t.Fatalf("calculateIgrfwmm returned %d results for 5 dates", len(resp.Result))
+	}
+	testDiff("last date", resp.Result[4]["date"], 2022, 1e-9, t)
+	testDiff("elevation in meters", resp.Result[4]["elevation"], 48, 1e-9, t)
+}
+
+func TestDeclination(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	code, body := get(t, srv, "/calculateDeclination?lat1=40&lon1=105.25&lon1Hemisphere=W"+
+		"&startYear=2022&startMonth=6&startDay=1&resultFormat=xml")
+	if code != http.StatusOK {
+		t.Fatalf("calculateDeclination returned %d: %s", code, body)
+	}
+	var resp struct {
+		Result []struct {
+			Date        float64 `xml:"date"`
+			Longitude   float64 `xml:"longitude"`
+			Declination struct {
+				Units string  `xml:"units,attr"`
+				Value float64 `xml:",chardata"`
+			} `xml:"declination"`
+			DeclinationSV float64 `xml:"declination_sv"`
+		} `xml:"result"`
+		Model string `xml:"model"`
+	}
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Result) != 1 || resp.Model != "WMM-2020" || resp.Result[0].Declination.Units != "degrees" {
+		t.Fatalf("calculateDeclination returned %s", body)
+	}
+	testDiff("longitude", resp.Result[0].Longitude, -105.25, 1e-9, t)
+	testDiff("date", resp.Result[0].Date, 2022.41, 0.01, t)
+	// Boulder's declination is about 8 degrees east, decreasing by about 0.1 degrees a year
+	testDiff("declination", resp.Result[0].Declination.Value, 8, 0.5, t)
+	testDiff("declination_sv", resp.Result[0].DeclinationSV, -0.1, 0.05, t)
+}
+
+func TestGrid(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	code, body := get(t, srv, "/calculateGrid?lat1=10&lat1Hemisphere=S&lat2=10&latStepSize=10"+
+		"&lon1=0&lon2=20&lonStepSize=5&coordinateSystem=D&startYear=2020&startMonth=1&startDay=1"+
+		"&endYear=2021&endMonth=1&endDay=1&dateStepSize=0.5&magneticComponent=f&resultFormat=csv")
+	if code != http.StatusOK {
+		t.Fatalf("calculateGrid returned %d: %s", code, body)
+	}
+	cr := csv.NewReader(strings.NewReader(string(body)))
+	cr.Comment = '#'
+	rows, err := cr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rows[0], ",") != "date,latitude,longitude,elevation,totalintensity,totalintensity_sv" {
+		t.Errorf("calculateGrid returned header %v", rows[0])
+	}
+	if len(rows) != 1+3*5*3 {
+		t.Fatalf("calculateGrid returned %d rows for 45 points", len(rows)-1)
+	}
+	lat, _ := strconv.ParseFloat(rows[1][1], 64)
+	testDiff("first latitude", lat, -10, 1e-9, t)
+	lng, _ := strconv.ParseFloat(rows[len(rows)-1][2], 64)
+	testDiff("last longitude", lng, 20, 1e-9, t)
+}
+
+func TestBadRequests(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	for _, path := range []string{
+		"/calculateDeclination?lon1=10",
+		"/calculateDeclination?lat1=95&lon1=10",
+		"/calculateDeclination?lat1=45&lon1=10&startMonth=13",
+		"/calculateDeclination?lat1=45&lon1=10&startYear=2021&startMonth=2&startDay=31",
+		"/calculateDeclination?lat1=45&lon1=10&startYear=2021&startMonth=2&startDay=29",
+		"/calculateDeclination?lat1=45&lon1=10&startYear=2021&startMonth=4&startDay=0",
+		"/calculateIgrfwmm?lat1=45&lon1=10&startYear=2021&startMonth=1&startDay=1&endYear=2021&endMonth=6&endDay=31",
+		"/calculateDeclination?lat1=45&lon1=10&resultFormat=html",
+		"/calculateDeclination?lat1=45&lon1=10&startYear=2030",
+		"/calculateIgrfwmm?lat1=45&lon1=10&elevationUnits=X",
+		"/calculateGrid?lat1=45&lon1=10&magneticComponent=q",
+		"/calculateGrid?lat1=-90&lat2=90&latStepSize=0.001&lon1=-180&lon2=180&lonStepSize=0.001",
+	} {
+		if code, body := get(t, srv, path); code != http.StatusBadRequest {
+			t.Errorf("%s returned %d: %s", path, code, body)
+		}
+	}
+
+	// The last day of February is valid in a leap year
+	path := "/calculateDeclination?lat1=45&lon1=10&startYear=2020&startMonth=2&startDay=29"
+	if code, body := get(t, srv, path); code != http.StatusOK {
+		t.Errorf("%s returned %d: %s", path, code, body)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	code, body := get(t, srv, "/openapi.yaml")
+	if code != http.StatusOK || !strings.HasPrefix(string(body), "openapi: 3") {
+		t.Errorf("openapi.yaml returned %d: %.40s", code, body)
+	}
+	for _, path := range []string{"/calculateDeclination:", "/calculateIgrfwmm:", "/calculateGrid:"} {
+		if !strings.Contains(string(body), path) {
+			t.Errorf("openapi.yaml does not describe %s", path)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// nmea_variation reads a stream of NMEA 0183 sentences and adds the magnetic
+// variation calculated with the World Magnetic Model.
+//
+// Usage is
+//  nmea_variation --cof_file=WMM2020.COF --date=[date] --overwrite --talker=HC [input] [output]
+//
+// The input is read from standard input if it is - or not given, and may be a
+// recorded log or a live device such as /dev/ttyUSB0 already configured for the
+// right baud rate.  The output is written to standard output if no output file
+// is given, one sentence per line with CR LF line endings.
+//
+// The position and height are taken from GGA and RMC sentences and the date from
+// RMC sentences, or from --date (a decimal year or MM/DD/YYYY) until the first RMC
+// sentence is received.  Then
+//  - RMC sentences have their blank magnetic variation fields filled in;
+//  - HDG sentences have their blank magnetic variation fields filled in, and are
+//    followed by HDT (true heading) and HDM (magnetic heading) sentences;
+//  - HDM sentences are replaced by HDG, HDT and HDM sentences.
+// With --overwrite, variations already present are replaced too.  The derived
+// heading sentences use the talker ID of their input unless --talker is given.
+// All other sentences, and any that cannot be interpreted, are passed through
+// unchanged, with a warning on standard error for those with errors.
+//
+// For example, the input
+//  $GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230322,,,A*71
+//  $HCHDM,98.3,M*1B
+// gives
+//  $GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230322,3.8,E,A*11
+//  $HCHDG,98.3,,,3.8,E*10
+//  $HCHDT,102.1,T*2B
+//  $HCHDM,98.3,M*1B
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/nmea"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "nmea_variation --cof_file=WMM2020.COF --date=[date] --overwrite --talker=HC [input] [output]"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	dateUsage = "Date to use until an RMC sentence is received, as a decimal year or MM/DD/YYYY"
+	overwriteUsage = "Replace magnetic variations already present in the input"
+	talkerUsage = "Talker ID of the derived heading sentences, empty for that of the input"
+)
+
+var (
+	cofFile   string
+	date      string
+	overwrite bool
+	talker    string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.BoolVar(&overwrite, "overwrite", false, overwriteUsage)
+	flag.StringVar(&talker, "talker", "", talkerUsage)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	if flag.NArg()>2 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if talker!="" && len(talker)!=2 {
+		_, _ = fmt.Fprintf(os.Stderr, "talker ID %s must be two characters\n", talker)
+		os.Exit(2)
+	}
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	a := &nmea.Annotator{Overwrite: overwrite, Talker: talker}
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		a.Date = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	in := os.Stdin
+	if name := flag.Arg(0); name!="" && name!="-" {
+		if in, err = os.Open(name); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer in.Close()
+	}
+
+	out := os.Stdout
+	if name := flag.Arg(1); name!="" {
+		if out, err = os.Create(name); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+
+	// Flush each sentence as it is written, so that live streams are not delayed.
+	w := bufio.NewWriter(out)
+	var warned bool
+	scanner := bufio.NewScanner(in)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line=="" {
+			continue
+		}
+		s, err := nmea.Parse(line)
+		if err!=nil {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: %s\n", lineNo, err)
+			_, _ = fmt.Fprint(w, line, "\r\n")
+			_ = w.Flush()
+			continue
+		}
+		ss, err := a.Process(s)
+		if err!=nil && err!=nmea.ErrNoFix && !warned {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: Warning: %s\n", lineNo, err)
+			warned = true
+		}
+		for _, s := range ss {
+			_, _ = fmt.Fprint(w, s, "\r\n")
+		}
+		if err = w.Flush(); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if err = scanner.Err(); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
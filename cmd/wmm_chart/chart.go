@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/westphae/geomag/pkg/contour"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	blackoutH    = 2000 // Horizontal intensity below which the declination is unreliable, nT
+	cautionH     = 6000 // Horizontal intensity below which the declination should be used with caution, nT
+	labelSpacing = 300  // Pixels between contour labels along a line
+	minLabelLen  = 80   // Shortest line in pixels that is labelled
+	maxLevels    = 500  // Most contour levels drawn
+)
+
+// component is a field component that can be charted, with its default contour interval.
+type component struct {
+	title, units string
+	interval     float64
+	angle        bool // The component is an angle that wraps around ±180°
+	value        func(mf wmm.MagneticField) float64
+}
+
+var components = map[string]component{
+	"d": {"Declination", "degrees", 2, true, wmm.MagneticField.D},
+	"i": {"Inclination", "degrees", 2, false, wmm.MagneticField.I},
+	"h": {"Horizontal intensity", "nT", 1000, false, wmm.MagneticField.H},
+	"f": {"Total intensity", "nT", 1000, false, wmm.MagneticField.F},
+	"x": {"North component", "nT", 2000, false,
+		func(mf wmm.MagneticField) float64 { x, _, _, _, _, _ := mf.Ellipsoidal(); return x }},
+	"y": {"East component", "nT", 2000, false,
+		func(mf wmm.MagneticField) float64 { _, y, _, _, _, _ := mf.Ellipsoidal(); return y }},
+	"z": {"Down component", "nT", 5000, false,
+		func(mf wmm.MagneticField) float64 { _, _, z, _, _, _ := mf.Ellipsoidal(); return z }},
+	"gv": {"Grid variation", "degrees", 10, true, func(mf wmm.MagneticField) float64 { return mf.GV(mf.Location()) }},
+	"dd": {"Declination secular variation", "degrees/year", 0.05, false, wmm.MagneticField.DD},
+	"di": {"Inclination secular variation", "degrees/year", 0.05, false, wmm.MagneticField.DI},
+	"dh": {"Horizontal intensity secular variation", "nT/year", 10, false, wmm.MagneticField.DH},
+	"df": {"Total intensity secular variation", "nT/year", 10, false, wmm.MagneticField.DF},
+}
+
+// chart is a contour chart of a field component.
+type chart struct {
+	comp     component
+	t        time.Time
+	proj     projection
+	res      float64        // Spacing of the points at which the model is evaluated, degrees
+	interval float64        // Contour interval
+	title    string         // Title, or empty for a default one
+	coast    [][][2]float64 // Coastlines or other lines to draw, as latitudes and longitudes
+}
+
+// grid is the component and horizontal intensity sampled over the chart.
+type grid struct {
+	latMin, lngMin, dLat, dLng float64
+	v, h                       [][]float64
+}
+
+// sample evaluates the model over the area of the chart.
+func (c *chart) sample() (g grid) {
+	latMin, latMax, lngMin, lngMax := c.proj.bounds()
+	nLat := int(math.Ceil((latMax-latMin)/c.res-1e-9)) + 1
+	nLng := int(math.Ceil((lngMax-lngMin)/c.res-1e-9)) + 1
+	g = grid{latMin: latMin, lngMin: lngMin, dLat: (latMax - latMin) / float64(nLat-1), dLng: (lngMax - lngMin) / float64(nLng-1)}
+	for r := 0; r < nLat; r++ {
+		v, h := make([]float64, nLng), make([]float64, nLng)
+		for k := range v {
+			mf, _ := lookup.Field(latMin+float64(r)*g.dLat, lngMin+float64(k)*g.dLng, 0, c.t)
+			v[k], h[k] = c.comp.value(mf), mf.H()
+		}
+		g.v, g.h = append(g.v, v), append(g.h, h)
+	}
+	return g
+}
+
+// latLng returns the latitude and longitude of a point in grid coordinates.
+func (g grid) latLng(p contour.Point) (lat, lng float64) {
+	return g.latMin + p.Y*g.dLat, g.lngMin + p.X*g.dLng
+}
+
+// svg accumulates the SVG document.
+type svg struct {
+	*bufio.Writer
+	proj   projection
+	dx, dy float64 // Offset of the map area
+}
+
+// point returns the chart position of a latitude and longitude as an SVG coordinate pair.
+func (s *svg) point(lat, lng float64) (xy string, x, y float64, ok bool) {
+	x, y, ok = s.proj.project(lat, lng)
+	x, y = x+s.dx, y+s.dy
+	return fmt.Sprintf("%.1f,%.1f", x, y), x, y, ok
+}
+
+// path returns the SVG path data of a line of latitudes and longitudes, broken
+// where it leaves the map or jumps across it, such as at the antimeridian.
+func (s *svg) path(line [][2]float64) string {
+	var b strings.Builder
+	w, _ := s.proj.size()
+	var px float64
+	pen := false
+	for _, ll := range line {
+		xy, x, _, ok := s.point(ll[0], ll[1])
+		if !ok {
+			pen = false
+			continue
+		}
+		if pen && math.Abs(x-px) < w/2 {
+			b.WriteString("L" + xy)
+		} else {
+			b.WriteString("M" + xy)
+		}
+		px, pen = x, true
+	}
+	return b.String()
+}
+
+// formatLevel formats a contour level without rounding noise.
+func formatLevel(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+// write renders the chart as an SVG document.
+func (c *chart) write(out io.Writer) (err error) {
+	const margin, top, bottom = 40.0, 44.0, 56.0
+	w, h := c.proj.size()
+	s := &svg{Writer: bufio.NewWriter(out), proj: c.proj, dx: margin, dy: top}
+	g := c.sample()
+	latMin, latMax, lngMin, lngMax := c.proj.bounds()
+	dYear := float64(wmm.TimeToDecimalYears(c.t))
+
+	title := c.title
+	if title == "" {
+		title = fmt.Sprintf("%s, %s, %.1f", c.comp.title, wmm.COFName, dYear)
+	}
+	fmt.Fprintf(s, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">
+<title>%s</title>
+<style>
+text { font-family: Helvetica, Arial, sans-serif; fill: #222; }
+.title { font-size: 18px; font-weight: bold; }
+.caption, .graticule-label { font-size: 11px; }
+.map { fill: #fff; }
+.frame { fill: none; stroke: #222; stroke-width: 1; }
+.caution { fill: #e8e8e8; stroke: #e8e8e8; stroke-width: 0.5; }
+.blackout { fill: #c4c4c4; stroke: #c4c4c4; stroke-width: 0.5; }
+.coast { fill: none; stroke: #777; stroke-width: 0.6; }
+.graticule { fill: none; stroke: #bbb; stroke-width: 0.4; stroke-dasharray: 2,2; }
+.contour { fill: none; stroke-width: 0.8; stroke-linejoin: round; }
+.contour.major { stroke-width: 1.5; }
+.pos { stroke: #c62828; } .neg { stroke: #1565c0; } .zero { stroke: #2e7d32; stroke-width: 1.8; }
+.label { font-size: 10px; text-anchor: middle; dominant-baseline: central; paint-order: stroke; stroke: #fff; stroke-width: 3px; }
+.label.pos { fill: #c62828; } .label.neg { fill: #1565c0; } .label.zero { fill: #2e7d32; }
+.pole { fill: #222; stroke: #fff; stroke-width: 1; }
+.pole-label { font-size: 11px; font-weight: bold; paint-order: stroke; stroke: #fff; stroke-width: 3px; }
+</style>
+<defs><clipPath id="map"><path transform="translate(%.1f,%.1f)" d="%s"/></clipPath></defs>
+<text class="title" x="%.1f" y="26">%s</text>
+<path class="map" transform="translate(%.1f,%.1f)" d="%s"/>
+<g clip-path="url(#map)">
+`, w+2*margin, h+top+bottom, w+2*margin, h+top+bottom, html.EscapeString(title),
+		margin, top, c.proj.outline(), margin, html.EscapeString(title), margin, top, c.proj.outline())
+
+	// Blackout and caution zones, filled cell by cell within the threshold contour
+	for _, zone := range []struct {
+		class string
+		h     float64
+	}{{"caution", cautionH}, {"blackout", blackoutH}} {
+		if d := c.zonePath(s, g, zone.h); d != "" {
+			fmt.Fprintf(s, "<path class=\"%s\" d=\"%s\"/>\n", zone.class, d)
+		}
+	}
+
+	for _, line := range c.coast {
+		if d := s.path(line); d != "" {
+			fmt.Fprintf(s, "<path class=\"coast\" d=\"%s\"/>\n", d)
+		}
+	}
+
+	c.writeGraticule(s, latMin, latMax, lngMin, lngMax)
+
+	// Contours and their labels
+	var maxStep float64
+	if c.comp.angle {
+		maxStep = 180
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range g.v {
+		for _, v := range row {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	levels := contour.Levels(lo, hi, c.interval)
+	if len(levels) > maxLevels {
+		return fmt.Errorf("contour interval %v gives more than %d contours from %v to %v", c.interval, maxLevels, lo, hi)
+	}
+	var labels strings.Builder
+	for _, level := range levels {
+		class := "pos"
+		if level < 0 {
+			class = "neg"
+		} else if level == 0 {
+			class = "zero"
+		}
+		major := ""
+		if n := level / c.interval; math.Abs(n-5*math.Round(n/5)) < 1e-9 {
+			major = " major"
+		}
+		for _, line := range contour.Lines(g.v, level, maxStep) {
+			lls := make([][2]float64, len(line))
+			for i, p := range line {
+				lls[i][0], lls[i][1] = g.latLng(p)
+			}
+			d := s.path(lls)
+			if d == "" {
+				continue
+			}
+			fmt.Fprintf(s, "<path class=\"contour %s%s\" d=\"%s\"/>\n", class, major, d)
+			writeLabels(&labels, s, lls, class, formatLevel(level))
+		}
+	}
+	s.WriteString(labels.String())
+
+	// Dip poles
+	for _, north := range []bool{true, false} {
+		lat, lng := dipPole(north, c.t)
+		if _, x, y, ok := s.point(lat, lng); ok {
+			name := map[bool]string{true: "North", false: "South"}[north]
+			fmt.Fprintf(s, "<g><title>%s dip pole %.2f, %.2f</title><circle class=\"pole\" cx=\"%.1f\" cy=\"%.1f\" r=\"4\"/>"+
+				"<text class=\"pole-label\" x=\"%.1f\" y=\"%.1f\">%s dip pole</text></g>\n", name, lat, lng, x, y, x+7, y-7, name)
+		}
+	}
+	s.WriteString("</g>\n")
+
+	fmt.Fprintf(s, "<path class=\"frame\" transform=\"translate(%.1f,%.1f)\" d=\"%s\"/>\n", margin, top, c.proj.outline())
+	fmt.Fprintf(s, "<text class=\"caption\" x=\"%.1f\" y=\"%.1f\">Contour interval %s %s. Red positive, blue negative, green zero. "+
+		"Shaded: blackout zone (H &lt; %d nT) and caution zone (H &lt; %d nT).</text>\n",
+		margin, h+top+bottom-12, formatLevel(c.interval), html.EscapeString(c.comp.units), blackoutH, cautionH)
+	s.WriteString("</svg>\n")
+	return s.Flush()
+}
+
+// zonePath returns the SVG path data filling the area where the horizontal intensity is below limit.
+// Each grid cell contributes the polygon of its corners below the limit and the edge crossings between.
+func (c *chart) zonePath(s *svg, g grid, limit float64) string {
+	var b strings.Builder
+	for r := 0; r < len(g.h)-1; r++ {
+		for k := 0; k < len(g.h[r])-1; k++ {
+			corners := [4][2]int{{r, k}, {r, k + 1}, {r + 1, k + 1}, {r + 1, k}}
+			var poly []contour.Point
+			for i, cn := range corners {
+				next := corners[(i+1)%4]
+				v0, v1 := g.h[cn[0]][cn[1]], g.h[next[0]][next[1]]
+				if v0 < limit {
+					poly = append(poly, contour.Point{X: float64(cn[1]), Y: float64(cn[0])})
+				}
+				if (v0 < limit) != (v1 < limit) {
+					f := (limit - v0) / (v1 - v0)
+					poly = append(poly, contour.Point{X: float64(cn[1]) + f*float64(next[1]-cn[1]),
+						Y: float64(cn[0]) + f*float64(next[0]-cn[0])})
+				}
+			}
+			if len(poly) < 3 {
+				continue
+			}
+			for i, p := range poly {
+				xy, _, _, _ := s.point(g.latLng(p))
+				if i == 0 {
+					b.WriteString("M" + xy)
+				} else {
+					b.WriteString("L" + xy)
+				}
+			}
+			b.WriteString("Z")
+		}
+	}
+	return b.String()
+}
+
+// writeGraticule draws the parallels and meridians with their labels.
+func (c *chart) writeGraticule(s *svg, latMin, latMax, lngMin, lngMax float64) {
+	span := math.Max(latMax-latMin, (lngMax-lngMin)/2)
+	step := 30.0
+	for _, st := range []float64{1, 2, 5, 10, 15} {
+		if span/st <= 8 {
+			step = st
+			break
+		}
+	}
+	_, polar := c.proj.(*stereographic)
+	var b strings.Builder
+	for lat := math.Ceil(latMin/step) * step; lat <= latMax; lat += step {
+		if math.Abs(lat) == 90 {
+			continue
+		}
+		var line [][2]float64
+		for lng := lngMin; lng <= lngMax+1e-9; lng += math.Min(1, step) {
+			line = append(line, [2]float64{lat, lng})
+		}
+		fmt.Fprintf(&b, "<path class=\"graticule\" d=\"%s\"/>\n", s.path(line))
+		if !polar {
+			_, _, y, _ := s.point(lat, lngMin)
+			fmt.Fprintf(&b, "<text class=\"graticule-label\" x=\"%.1f\" y=\"%.1f\" text-anchor=\"end\" dominant-baseline=\"central\">%s</text>\n",
+				s.dx-4, y, latLabel(lat))
+		}
+	}
+	mStep := step
+	if polar {
+		mStep = 30
+	}
+	for lng := math.Ceil(lngMin/mStep) * mStep; lng <= lngMax+1e-9; lng += mStep {
+		if polar && lng == lngMax && lngMax-lngMin == 360 {
+			continue
+		}
+		var line [][2]float64
+		for lat := latMin; lat <= latMax+1e-9; lat += math.Min(1, step) {
+			line = append(line, [2]float64{lat, lng})
+		}
+		fmt.Fprintf(&b, "<path class=\"graticule\" d=\"%s\"/>\n", s.path(line))
+		if polar {
+			// Labels sit just outside the edge of the chart
+			p := c.proj.(*stereographic)
+			_, x, y, _ := s.point(p.boundary, lng)
+			cx, cy := s.dx+p.radius, s.dy+p.radius
+			d := math.Hypot(x-cx, y-cy)
+			fmt.Fprintf(&b, "<text class=\"graticule-label\" x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text>\n",
+				cx+(x-cx)*(d+14)/d, cy+(y-cy)*(d+14)/d, lngLabel(lng))
+		} else {
+			_, x, _, _ := s.point(latMin, lng)
+			_, h := c.proj.size()
+			fmt.Fprintf(&b, "<text class=\"graticule-label\" x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n",
+				x, s.dy+h+16, lngLabel(lng))
+		}
+	}
+	// The labels lie outside the clipped map area, so the graticule is written after it
+	s.WriteString("</g>\n" + b.String() + "<g clip-path=\"url(#map)\">\n")
+}
+
+// latLabel returns a label for a parallel, such as 30°N.
+func latLabel(lat float64) string {
+	switch {
+	case lat > 0:
+		return formatLevel(lat) + "°N"
+	case lat < 0:
+		return formatLevel(-lat) + "°S"
+	}
+	return "0°"
+}
+
+// lngLabel returns a label for a meridian, such as 120°W.
+func lngLabel(lng float64) string {
+	lng = lookup.AngleDiff(lng, 0)
+	switch {
+	case lng == 180 || lng == -180:
+		return "180°"
+	case lng > 0:
+		return formatLevel(lng) + "°E"
+	case lng < 0:
+		return formatLevel(-lng) + "°W"
+	}
+	return "0°"
+}
+
+// writeLabels writes labels of the contour value along a line every labelSpacing pixels,
+// rotated to follow the line and kept upright.
+func writeLabels(b *strings.Builder, s *svg, line [][2]float64, class, text string) {
+	type pt struct{ x, y float64 }
+	var pts []pt
+	var length float64
+	for _, ll := range line {
+		_, x, y, ok := s.point(ll[0], ll[1])
+		if !ok {
+			continue
+		}
+		if n := len(pts); n > 0 {
+			length += math.Hypot(x-pts[n-1].x, y-pts[n-1].y)
+		}
+		pts = append(pts, pt{x, y})
+	}
+	if length < minLabelLen {
+		return
+	}
+	w, _ := s.proj.size()
+	next, along := math.Min(labelSpacing/2, length/2), 0.0
+	for i := 1; i < len(pts); i++ {
+		seg := math.Hypot(pts[i].x-pts[i-1].x, pts[i].y-pts[i-1].y)
+		if seg > w/2 {
+			along += seg
+			continue
+		}
+		for next <= along+seg {
+			f := (next - along) / seg
+			x, y := pts[i-1].x+f*(pts[i].x-pts[i-1].x), pts[i-1].y+f*(pts[i].y-pts[i-1].y)
+			a := math.Atan2(pts[i].y-pts[i-1].y, pts[i].x-pts[i-1].x) * 180 / math.Pi
+			if a > 90 {
+				a -= 180
+			} else if a < -90 {
+				a += 180
+			}
+			fmt.Fprintf(b, "<text class=\"label %s\" x=\"%.1f\" y=\"%.1f\" transform=\"rotate(%.1f %.1f %.1f)\">%s</text>\n",
+				class, x, y, a, x, y, text)
+			next += labelSpacing
+		}
+		along += seg
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+func loadCOF(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProjections(t *testing.T) {
+	p, err := newEquirectangular(-60, 60, 120, 240, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y, ok := p.project(60, 120)
+	testDiff("top left x", x, 0, 1e-9, t)
+	testDiff("top left y", y, 0, 1e-9, t)
+	x, y, ok = p.project(0, -150)
+	testDiff("antimeridian region x", x, 450, 1e-9, t)
+	testDiff("antimeridian region y", y, 300, 1e-9, t)
+	if !ok {
+		t.Error("expected a point across the antimeridian to be on the chart")
+	}
+	if _, _, ok = p.project(0, 0); ok {
+		t.Error("expected a point outside the region to be off the chart")
+	}
+	if _, err = newEquirectangular(-60, 60, 120, 500, 600); err == nil {
+		t.Error("expected an error for a region wider than 360 degrees")
+	}
+
+	s, err := newStereographic(true, 50, 0, 800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y, _ = s.project(90, 0)
+	testDiff("pole x", x, 400, 1e-9, t)
+	testDiff("pole y", y, 400, 1e-9, t)
+	x, y, ok = s.project(50, 0)
+	testDiff("central meridian x", x, 400, 1e-9, t)
+	testDiff("central meridian y", y, 800, 1e-9, t)
+	if !ok {
+		t.Error("expected the boundary to be on the chart")
+	}
+	x, y, _ = s.project(50, 90)
+	testDiff("east x", x, 800, 1e-9, t)
+	testDiff("east y", y, 400, 1e-9, t)
+	if _, _, ok = s.project(40, 0); ok {
+		t.Error("expected a point beyond the boundary to be off the chart")
+	}
+
+	s, _ = newStereographic(false, -60, 0, 800)
+	x, y, _ = s.project(-60, 0)
+	testDiff("south central meridian x", x, 400, 1e-9, t)
+	testDiff("south central meridian y", y, 0, 1e-9, t)
+	if _, err = newStereographic(true, -10, 0, 800); err == nil {
+		t.Error("expected an error for a northern chart with a southern boundary")
+	}
+}
+
+func TestDipPoles(t *testing.T) {
+	loadCOF(t)
+	// From the WMM2020 technical report, which rounds them to about a kilometer
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range []struct {
+		north    bool
+		lat, lng float64
+	}{{true, 86.494, 162.867}, {false, -64.081, 135.866}} {
+		lat, lng := dipPole(p.north, ts)
+		testDiff("dip pole latitude", lat, p.lat, 0.02, t)
+		testDiff("dip pole longitude on the ground", lookup.AngleDiff(lng, p.lng)*math.Cos(lat*math.Pi/180), 0, 0.1, t)
+		mf, _ := lookup.Field(lat, lng, 0, ts)
+		testDiff("horizontal intensity at dip pole", mf.H(), 0, 1, t)
+	}
+}
+
+// svgElements returns the number of elements of each class in the SVG document,
+// failing if it is not well-formed.
+func svgElements(t *testing.T, doc []byte) (classes map[string]int) {
+	classes = map[string]int{}
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return classes
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %s", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			for _, a := range se.Attr {
+				if a.Name.Local == "class" {
+					for _, c := range strings.Fields(a.Value) {
+						classes[se.Name.Local+"."+c]++
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestChart(t *testing.T) {
+	loadCOF(t)
+	ts := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	p, _ := newEquirectangular(20, 60, -130, -60, 700)
+	c := &chart{comp: components["d"], t: ts, proj: p, res: 1, interval: 2}
+	var b bytes.Buffer
+	if err := c.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	classes := svgElements(t, b.Bytes())
+	// Declination across North America runs from about +20 in the west to -20 in the east
+	if classes["path.pos"] < 5 || classes["path.neg"] < 5 || classes["path.zero"] < 1 {
+		t.Errorf("expected positive, negative and zero contours, got %v", classes)
+	}
+	if classes["text.label"] < 10 {
+		t.Errorf("expected contour labels, got %v", classes)
+	}
+	if classes["circle.pole"] != 0 || classes["path.blackout"] != 0 {
+		t.Errorf("expected no dip poles or blackout zones in the region, got %v", classes)
+	}
+	if !strings.Contains(b.String(), "Declination, WMM-2020, 2022.5") {
+		t.Error("expected a default title")
+	}
+
+	s, _ := newStereographic(false, -50, 0, 600)
+	c = &chart{comp: components["i"], t: ts, proj: s, res: 2, interval: 5, title: "South <polar>"}
+	b.Reset()
+	if err := c.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	classes = svgElements(t, b.Bytes())
+	if classes["circle.pole"] != 1 || classes["path.blackout"] != 1 || classes["path.caution"] != 1 {
+		t.Errorf("expected the south dip pole and its blackout and caution zones, got %v", classes)
+	}
+	if classes["path.neg"] < 3 {
+		t.Errorf("expected negative inclination contours, got %v", classes)
+	}
+	if !strings.Contains(b.String(), "South &lt;polar&gt;") {
+		t.Error("expected the title to be escaped")
+	}
+
+	c.interval = 0.001
+	if err := c.write(ioutil.Discard); err == nil {
+		t.Error("expected an error for too many contours")
+	}
+}
+
+func TestCoastlines(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "chart")
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "coast.geojson")
+	_ = ioutil.WriteFile(fn, []byte(`{"type": "FeatureCollection", "features": [
+  {"type": "Feature", "properties": {}, "geometry": {"type": "LineString", "coordinates": [[-10, 50], [-5, 52], [0, 51]]}},
+  {"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [
+    [[[10, 40], [12, 40], [12, 42], [10, 40]]], [[[20, 30], [22, 30], [22, 32], [20, 30]], [[20.5, 30.5], [21, 30.5], [21, 31], [20.5, 30.5]]]]}},
+  {"type": "Feature", "properties": {}, "geometry": null}]}`), 0644)
+	lines, err := readLines(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+	testDiff("first latitude", lines[0][0][0], 50, 0, t)
+	testDiff("first longitude", lines[0][0][1], -10, 0, t)
+
+	_ = ioutil.WriteFile(fn, []byte(`{"type": "Sphere"}`), 0644)
+	if _, err = readLines(fn); err == nil {
+		t.Error("expected an error for an unknown GeoJSON type")
+	}
+}
+
+func TestLabels(t *testing.T) {
+	for v, expected := range map[float64]string{0.1 + 0.2: "0.3", -12: "-12", 2000: "2000", 0.05 * 3: "0.15"} {
+		if s := formatLevel(v); s != expected {
+			t.Errorf("expected %s, got %s", expected, s)
+		}
+	}
+	for lng, expected := range map[float64]string{-180: "180°", 180: "180°", 210: "150°W", -90: "90°W", 30: "30°E", 0: "0°"} {
+		if s := lngLabel(lng); s != expected {
+			t.Errorf("expected %s for %v, got %s", expected, lng, s)
+		}
+	}
+	if s := latLabel(-45); s != "45°S" {
+		t.Errorf("expected 45°S, got %s", s)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// geoJSON is the part of a GeoJSON object needed to read its lines.
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Features    []geoJSON       `json:"features"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Geometries  []geoJSON       `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// readLines reads the lines and polygon rings of a GeoJSON file, such as
+// Natural Earth coastlines, as latitudes and longitudes.
+func readLines(fn string) (lines [][][2]float64, err error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var g geoJSON
+	if err = json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	if lines, err = g.lines(nil); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	return lines, nil
+}
+
+// lines appends the lines of the object to lines.
+func (g *geoJSON) lines(lines [][][2]float64) ([][][2]float64, error) {
+	var err error
+	switch g.Type {
+	case "FeatureCollection":
+		for i := range g.Features {
+			if lines, err = g.Features[i].lines(lines); err != nil {
+				return nil, err
+			}
+		}
+	case "Feature":
+		if g.Geometry != nil {
+			return g.Geometry.lines(lines)
+		}
+	case "GeometryCollection":
+		for i := range g.Geometries {
+			if lines, err = g.Geometries[i].lines(lines); err != nil {
+				return nil, err
+			}
+		}
+	case "LineString":
+		var c [][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		lines = append(lines, toLatLng(c))
+	case "MultiLineString", "Polygon":
+		var c [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		for _, l := range c {
+			lines = append(lines, toLatLng(l))
+		}
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err = json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		for _, p := range c {
+			for _, l := range p {
+				lines = append(lines, toLatLng(l))
+			}
+		}
+	case "Point", "MultiPoint":
+	default:
+		return nil, fmt.Errorf("unknown GeoJSON type %q", g.Type)
+	}
+	return lines, nil
+}
+
+// toLatLng converts GeoJSON positions of longitude and latitude to latitudes and longitudes.
+func toLatLng(c [][]float64) (line [][2]float64) {
+	for _, p := range c {
+		if len(p) >= 2 {
+			line = append(line, [2]float64{p[1], p[0]})
+		}
+	}
+	return line
+}
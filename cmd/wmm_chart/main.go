@@ -0,0 +1,209 @@
+// wmm_chart draws a chart of a component of the World Magnetic Model as an SVG
+// document, in the style of the NOAA/BGS WMM charts, for use in reports and
+// publications.
+//
+// Usage is
+//  wmm_chart --cof_file=WMM2020.COF --component=d --date=2022.5 --projection=equirectangular \
+//    --lat=-90:90 --lng=-180:180 --interval=2 --coastlines=coast.geojson -o declination.svg
+//
+// The component is one of
+//  d, i      declination and inclination, degrees
+//  h, f      horizontal and total intensity, nT
+//  x, y, z   north, east and down components, nT
+//  gv        grid variation, degrees
+//  dd, di    secular variation of the declination and inclination, degrees/year
+//  dh, df    secular variation of the horizontal and total intensity, nT/year
+// Contours are drawn at multiples of the interval, which defaults to a spacing
+// suiting the component, and labelled with their values: red for positive,
+// blue for negative and green for zero, with every fifth line heavier.
+// The dip poles are marked and the blackout and caution zones, where the
+// horizontal intensity is below 2000 and 6000 nT, are shaded.
+//
+// The projection is equirectangular, for the region given by --lat and --lng
+// (the longitudes may run past 180 to span the antimeridian), or north or south
+// for a polar stereographic chart of the cap beyond the --boundary latitude,
+// with the --center meridian running down from the north pole or up from the south pole.
+// The chart width in pixels is set by --width.
+//
+// The model is evaluated at mean sea level every --res degrees and contoured
+// between.  No coastlines are built in: give --coastlines a GeoJSON file, such
+// as the Natural Earth coastlines, to draw its lines and polygon outlines under the contours.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_chart --cof_file=WMM2020.COF --component=d --date=2022.5 --projection=equirectangular " +
+		"--lat=-90:90 --lng=-180:180 --interval=2 --coastlines=coast.geojson -o declination.svg"
+	cofUsage        = "COF coefficients file to use, empty for the built-in one"
+	componentUsage  = "Component to chart: d, i, h, f, x, y, z, gv, dd, di, dh or df"
+	dateUsage       = "Date of the chart, as a decimal year or MM/DD/YYYY; empty for today"
+	projectionUsage = "Projection: equirectangular, north or south (polar stereographic)"
+	latUsage        = "Latitude range of an equirectangular chart, min:max"
+	lngUsage        = "Longitude range of an equirectangular chart, min:max"
+	boundaryUsage   = "Edge latitude of a polar chart; default 50 north or -50 south"
+	centerUsage     = "Central meridian of a polar chart"
+	intervalUsage   = "Contour interval, 0 for the default of the component"
+	resUsage        = "Spacing in degrees of the points at which the model is evaluated"
+	widthUsage      = "Width of the map in pixels"
+	titleUsage      = "Title of the chart, empty for one describing it"
+	coastUsage      = "GeoJSON file of coastlines or other lines to draw"
+	outputUsage     = "Output file, empty for standard output"
+)
+
+var (
+	cofFile    string
+	comp       string
+	date       string
+	projName   string
+	latRange   string
+	lngRange   string
+	boundary   float64
+	center     float64
+	interval   float64
+	res        float64
+	width      float64
+	title      string
+	coastFile  string
+	outputFile string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&comp, "component", "d", componentUsage)
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.StringVar(&projName, "projection", "equirectangular", projectionUsage)
+	flag.StringVar(&latRange, "lat", "-90:90", latUsage)
+	flag.StringVar(&lngRange, "lng", "-180:180", lngUsage)
+	flag.Float64Var(&boundary, "boundary", 0, boundaryUsage)
+	flag.Float64Var(&center, "center", 0, centerUsage)
+	flag.Float64Var(&interval, "interval", 0, intervalUsage)
+	flag.Float64Var(&res, "res", 1, resUsage)
+	flag.Float64Var(&width, "width", 1000, widthUsage)
+	flag.StringVar(&title, "title", "", titleUsage)
+	flag.StringVar(&coastFile, "coastlines", "", coastUsage)
+	flag.StringVar(&outputFile, "output", "", outputUsage)
+	flag.StringVar(&outputFile, "o", "", outputUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg()!=0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if cofFile!="" {
+		if err := wmm.LoadWMMCOF(cofFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	c, err := newChart()
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if coastFile!="" {
+		if c.coast, err = readLines(coastFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	out := os.Stdout
+	if outputFile!="" {
+		if out, err = os.Create(outputFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if err = c.write(w); err==nil {
+		err = w.Flush()
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newChart returns the chart described by the flags.
+func newChart() (c *chart, err error) {
+	cp, ok := components[comp]
+	if !ok {
+		return nil, fmt.Errorf("unknown component %s", comp)
+	}
+	c = &chart{comp: cp, t: time.Now().UTC(), res: res, interval: interval, title: title}
+	if c.interval==0 {
+		c.interval = cp.interval
+	}
+	if c.interval<0 {
+		return nil, fmt.Errorf("contour interval %v must be positive", c.interval)
+	}
+	if res<=0 || res>10 {
+		return nil, fmt.Errorf("resolution %v must be between 0 and 10 degrees", res)
+	}
+	if width<100 || width>20000 {
+		return nil, fmt.Errorf("width %v must be between 100 and 20000 pixels", width)
+	}
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			return nil, err
+		}
+		c.t = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	switch projName {
+	case "equirectangular":
+		lat0, lat1, err := parseRange(latRange)
+		if err!=nil {
+			return nil, fmt.Errorf("invalid latitude range %s", latRange)
+		}
+		lng0, lng1, err := parseRange(lngRange)
+		if err!=nil {
+			return nil, fmt.Errorf("invalid longitude range %s", lngRange)
+		}
+		c.proj, err = newEquirectangular(lat0, lat1, lng0, lng1, width)
+	case "north", "south":
+		b := boundary
+		if b==0 {
+			b = 50
+			if projName=="south" {
+				b = -50
+			}
+		}
+		c.proj, err = newStereographic(projName=="north", b, center, width)
+	default:
+		return nil, fmt.Errorf("unknown projection %s, must be equirectangular, north or south", projName)
+	}
+	return c, err
+}
+
+// parseRange parses a range of degrees given as min:max.
+func parseRange(s string) (min, max float64, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts)!=2 {
+		return 0, 0, fmt.Errorf("invalid range %s", s)
+	}
+	if min, err = strconv.ParseFloat(parts[0], 64); err==nil {
+		max, err = strconv.ParseFloat(parts[1], 64)
+	}
+	return min, max, err
+}
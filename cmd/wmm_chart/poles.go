@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/westphae/geomag/pkg/lookup"
+)
+
+// dipPole returns the latitude and longitude in degrees of the north or south
+// dip pole, where the inclination is ±90°, at mean sea level at time t.
+// The horizontal intensity vanishes at the dip pole, so it is found by
+// minimizing the horizontal intensity with a pattern search, starting from the
+// smallest value on a coarse grid of the polar cap.
+func dipPole(north bool, t time.Time) (lat, lng float64) {
+	sign := 1.0
+	if !north {
+		sign = -1
+	}
+	h := func(lat, lng float64) float64 {
+		if math.Abs(lat) > 90 {
+			return math.Inf(1)
+		}
+		mf, _ := lookup.Field(lat, lng, 0, t)
+		return mf.H()
+	}
+
+	best := math.Inf(1)
+	for a := 50.0; a < 90; a += 2 {
+		for b := -180.0; b < 180; b += 4 {
+			if v := h(sign*a, b); v < best {
+				best, lat, lng = v, sign*a, b
+			}
+		}
+	}
+	for step := 2.0; step > 1e-5; {
+		improved := false
+		for _, d := range [][2]float64{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			// Longitude steps are widened towards the geographic pole to keep them even on the ground
+			a, b := lat+d[0]*step, lng+d[1]*step/math.Max(math.Cos(lat*math.Pi/180), 0.05)
+			if v := h(a, b); v < best {
+				best, lat, lng, improved = v, a, b, true
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+	return lat, lookup.AngleDiff(lng, 0)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// projection maps latitudes and longitudes in degrees to chart coordinates in pixels.
+type projection interface {
+	// project returns the chart position of a point, and whether it is on the chart.
+	project(lat, lng float64) (x, y float64, ok bool)
+	// bounds returns the range of latitudes and longitudes the chart covers.
+	bounds() (latMin, latMax, lngMin, lngMax float64)
+	// size returns the width and height of the map area.
+	size() (w, h float64)
+	// outline returns the SVG path of the edge of the map area.
+	outline() string
+}
+
+// equirectangular is a plate carrée projection of a latitude and longitude box.
+type equirectangular struct {
+	latMin, latMax, lngMin, lngMax float64
+	scale                          float64 // Pixels per degree
+}
+
+// newEquirectangular returns the projection of the box at the given map width in pixels.
+// lngMax may exceed 180 for a region spanning the antimeridian.
+func newEquirectangular(latMin, latMax, lngMin, lngMax, width float64) (p *equirectangular, err error) {
+	if latMin < -90 || latMax > 90 || latMin >= latMax {
+		return nil, fmt.Errorf("invalid latitude range %v to %v", latMin, latMax)
+	}
+	if lngMin < -180 || lngMax <= lngMin || lngMax-lngMin > 360 {
+		return nil, fmt.Errorf("invalid longitude range %v to %v", lngMin, lngMax)
+	}
+	return &equirectangular{latMin, latMax, lngMin, lngMax, width / (lngMax - lngMin)}, nil
+}
+
+func (p *equirectangular) project(lat, lng float64) (x, y float64, ok bool) {
+	for lng < p.lngMin {
+		lng += 360
+	}
+	for lng > p.lngMin+360 {
+		lng -= 360
+	}
+	const eps = 1e-9
+	ok = lat >= p.latMin-eps && lat <= p.latMax+eps && lng <= p.lngMax+eps
+	return (lng - p.lngMin) * p.scale, (p.latMax - lat) * p.scale, ok
+}
+
+func (p *equirectangular) bounds() (latMin, latMax, lngMin, lngMax float64) {
+	return p.latMin, p.latMax, p.lngMin, p.lngMax
+}
+
+func (p *equirectangular) size() (w, h float64) {
+	return (p.lngMax - p.lngMin) * p.scale, (p.latMax - p.latMin) * p.scale
+}
+
+func (p *equirectangular) outline() string {
+	w, h := p.size()
+	return fmt.Sprintf("M0,0H%.1fV%.1fH0Z", w, h)
+}
+
+// stereographic is a polar stereographic projection of the cap poleward of a boundary latitude,
+// with the central meridian running down from the north pole or up from the south pole.
+type stereographic struct {
+	north    bool
+	boundary float64 // Latitude of the edge of the chart, degrees
+	center   float64 // Central meridian, degrees
+	scale    float64 // Pixels per unit of projected radius
+	radius   float64 // Radius of the chart in pixels
+}
+
+// newStereographic returns the projection of the cap beyond boundary, with the given diameter in pixels.
+func newStereographic(north bool, boundary, center, diameter float64) (p *stereographic, err error) {
+	if boundary <= -90 || boundary >= 90 || (north && boundary <= 0) || (!north && boundary >= 0) {
+		return nil, fmt.Errorf("invalid boundary latitude %v for a %s polar chart", boundary, map[bool]string{true: "north", false: "south"}[north])
+	}
+	p = &stereographic{north: north, boundary: boundary, center: center, radius: diameter / 2}
+	p.scale = p.radius / p.rho(boundary)
+	return p, nil
+}
+
+// rho returns the projected distance of a latitude from the pole, for a unit sphere.
+func (p *stereographic) rho(lat float64) float64 {
+	if p.north {
+		return 2 * math.Tan((90-lat)/2*egm96.Deg)
+	}
+	return 2 * math.Tan((90+lat)/2*egm96.Deg)
+}
+
+func (p *stereographic) project(lat, lng float64) (x, y float64, ok bool) {
+	r := p.rho(lat) * p.scale
+	a := (lng - p.center) * egm96.Deg
+	x = p.radius + r*math.Sin(a)
+	if p.north {
+		y = p.radius + r*math.Cos(a)
+	} else {
+		y = p.radius - r*math.Cos(a)
+	}
+	return x, y, r <= p.radius*(1+1e-9)
+}
+
+func (p *stereographic) bounds() (latMin, latMax, lngMin, lngMax float64) {
+	if p.north {
+		return p.boundary, 90, -180, 180
+	}
+	return -90, p.boundary, -180, 180
+}
+
+func (p *stereographic) size() (w, h float64) {
+	return 2 * p.radius, 2 * p.radius
+}
+
+func (p *stereographic) outline() string {
+	r := p.radius
+	return fmt.Sprintf("M0,%.1fA%.1f,%.1f 0 1,0 %.1f,%.1fA%.1f,%.1f 0 1,0 0,%.1fZ", r, r, r, 2*r, r, r, r, r)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/utm"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// parseBearing parses a bearing in degrees, and optionally minutes and seconds,
+// returning its azimuth clockwise from north in degrees.  The bearing is either
+// a quadrant bearing such as N 45°30' E, S12-15-30W or N 45.5 E, a cardinal
+// direction N, E, S or W, or an azimuth such as 225°30'.  Degrees, minutes and
+// seconds may be separated by spaces, dashes, colons or the symbols ° ' " or d m s.
+func parseBearing(s string) (az float64, err error) {
+	b := strings.ToUpper(strings.TrimSpace(s))
+	if c := strings.Index("NESW", b); len(b) == 1 && c >= 0 {
+		return float64(c) * 90, nil
+	}
+	quadrant := ""
+	if len(b) > 2 && strings.ContainsAny(b[:1], "NS") && strings.ContainsAny(b[len(b)-1:], "EW") {
+		quadrant, b = b[:1]+b[len(b)-1:], b[1:len(b)-1]
+	}
+	parts := strings.FieldsFunc(b, func(r rune) bool {
+		return strings.ContainsRune(" -:°º'\"′″DMS", r)
+	})
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid bearing %s", s)
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || (i > 0 && v >= 60) || (i < len(parts)-1 && v != math.Trunc(v)) {
+			return 0, fmt.Errorf("invalid bearing %s", s)
+		}
+		az += v / math.Pow(60, float64(i))
+	}
+	if quadrant == "" {
+		if az >= 360 {
+			return 0, fmt.Errorf("invalid bearing %s", s)
+		}
+		return az, nil
+	}
+	if az > 90 {
+		return 0, fmt.Errorf("invalid bearing %s, the angle must not exceed 90°", s)
+	}
+	switch quadrant {
+	case "NE":
+		return az, nil
+	case "SE":
+		return 180 - az, nil
+	case "SW":
+		return 180 + az, nil
+	}
+	return course(360 - az), nil
+}
+
+// formatBearing returns the quadrant bearing of an azimuth in degrees,
+// rounded to the second, such as N 45°30'15" E.
+func formatBearing(az float64) string {
+	az = course(az)
+	ns, ew, a := "N", "E", az
+	switch {
+	case az > 270:
+		ns, ew, a = "N", "W", 360-az
+	case az > 180:
+		ns, ew, a = "S", "W", az-180
+	case az > 90:
+		ns, ew, a = "S", "E", 180-az
+	}
+	sec := int(math.Round(a * 3600))
+	return fmt.Sprintf("%s %d°%02d'%02d\" %s", ns, sec/3600, sec/60%60, sec%60, ew)
+}
+
+// course returns a course in degrees in the range 0 to 360.
+func course(c float64) float64 {
+	c = math.Mod(c, 360)
+	if c < 0 {
+		c += 360
+	}
+	return c
+}
+
+// call is a bearing recorded in a deed, with its date and location.
+type call struct {
+	id       string    // Identifier of the call, such as a parcel and course number
+	date     string    // Date as recorded, a decimal year or MM/DD/YYYY
+	t        time.Time // Date as a time
+	lat, lng float64   // Location in degrees
+	bearing  string    // Magnetic bearing as recorded
+	magnetic float64   // Magnetic azimuth, degrees
+}
+
+// parseCall parses a line of an id, date, latitude, longitude and bearing
+// separated by spaces, where the bearing is the rest of the line.
+func parseCall(line string) (c call, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return c, fmt.Errorf("expected id, date, latitude, longitude and bearing")
+	}
+	c.id, c.date = fields[0], fields[1]
+	dYear, err := parsing.ParseTime(c.date)
+	if err != nil {
+		return c, err
+	}
+	c.t = wmm.DecimalYear(dYear).ToTime()
+	if c.lat, err = parsing.ParseLatLng(fields[2]); err != nil {
+		return c, err
+	}
+	if c.lng, err = parsing.ParseLatLng(fields[3]); err != nil {
+		return c, err
+	}
+	if c.lat < -90 || c.lat > 90 || c.lng < -180 || c.lng >= 360 {
+		return c, fmt.Errorf("invalid position %s %s", fields[2], fields[3])
+	}
+	c.bearing = strings.Join(fields[4:], " ")
+	c.magnetic, err = parseBearing(c.bearing)
+	return c, err
+}
+
+// location returns the location of the call at mean sea level.
+func (c call) location() (egm96.Location, error) {
+	return parsing.NewLocation(c.lat, c.lng, 0, false)
+}
+
+// models chooses the model for each date: the WMM within its validity period
+// and otherwise the IGRF for the five-year interval containing the date.
+type models struct {
+	cof        string    // WMM coefficients file, empty for the built-in one
+	igrf       string    // IGRF coefficients table, empty for none
+	valid, end time.Time // Validity period of the WMM
+	wmm        bool      // Whether the WMM is loaded rather than the IGRF
+}
+
+// newModels loads the WMM coefficients file cof, empty for the built-in one,
+// to be used within its validity period, and the IGRF coefficients table igrf
+// to be used otherwise, if it is not empty.
+func newModels(cof, igrf string) (m *models, err error) {
+	if err = wmm.LoadWMMCOF(cof); err != nil {
+		return nil, err
+	}
+	return &models{cof: cof, igrf: igrf, valid: wmm.ValidDate,
+		end: wmm.DecimalYear(wmm.Epoch + 5).ToTime(), wmm: true}, nil
+}
+
+// load loads the model for the time t.
+func (m *models) load(t time.Time) (err error) {
+	if !t.Before(m.valid) && !t.After(m.end) {
+		if !m.wmm {
+			if err = wmm.LoadWMMCOF(m.cof); err != nil {
+				return err
+			}
+			m.wmm = true
+		}
+		return nil
+	}
+	if m.igrf == "" {
+		return fmt.Errorf("date %s is outside the validity period of %s, an IGRF coefficients table is needed",
+			t.Format("2006-01-02"), wmm.COFName)
+	}
+	if !m.wmm && !t.Before(wmm.ValidDate) && wmm.TimeToDecimalYears(t) < wmm.Epoch+5 {
+		return nil
+	}
+	if err = wmm.LoadIGRF(m.igrf, t); err != nil {
+		return err
+	}
+	m.wmm = false
+	return nil
+}
+
+// conversion is a recorded magnetic bearing converted to true and grid bearings.
+type conversion struct {
+	call
+	model       string  // Model used, such as WMM-2020 or IGRF 1935
+	d, errD     float64 // Declination at the date and its uncertainty, degrees
+	trueAz      float64 // True azimuth, degrees
+	convergence float64 // UTM or UPS meridian convergence, degrees, NaN if the grid is not available
+	gridAz      float64 // Grid azimuth, degrees, NaN if the grid is not available
+}
+
+// convert converts the call with the model for its date.
+// The warning is set if the date is outside the validity period of the model.
+func convert(c call, m *models) (r conversion, warning, err error) {
+	if err = m.load(c.t); err != nil {
+		return r, nil, err
+	}
+	loc, err := c.location()
+	if err != nil {
+		return r, nil, err
+	}
+	mf, warning := wmm.CalculateWMMMagneticField(loc, c.t)
+	r.call, r.d, r.errD = c, mf.D(), mf.ErrD()
+	r.model = wmm.COFName
+	if !m.wmm {
+		r.model = fmt.Sprintf("%s %.0f", wmm.COFName, float64(wmm.Epoch))
+	}
+	r.trueAz = course(c.magnetic + r.d)
+	r.convergence, r.gridAz = math.NaN(), math.NaN()
+	if uc, err := utm.NewCoord(loc); err == nil {
+		r.convergence = uc.Convergence()
+		r.gridAz = course(r.trueAz - r.convergence)
+	}
+	return r, warning, nil
+}
+
+// columns are the names of the values of a conversion written in JSON, CSV and TSV.
+var columns = []string{"id", "date", "latitude", "longitude", "magnetic_bearing", "magnetic_azimuth", "model",
+	"d", "err_d", "true_azimuth", "true_bearing", "convergence", "grid_azimuth", "grid_bearing"}
+
+// values returns the values of the columns of the conversion.
+// The grid values are empty where the grid is not available.
+func (r conversion) values() []interface{} {
+	var convergence, grid, gridBearing interface{} = "", "", ""
+	if !math.IsNaN(r.gridAz) {
+		convergence, grid, gridBearing = r.convergence, r.gridAz, formatBearing(r.gridAz)
+	}
+	return []interface{}{r.id, r.date, r.lat, r.lng, r.bearing, r.magnetic, r.model,
+		r.d, r.errD, r.trueAz, formatBearing(r.trueAz), convergence, grid, gridBearing}
+}
+
+// writeText writes a table of the conversions.
+func writeText(w io.Writer, results []conversion) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-10s %-10s %-18s %-10s %7s %5s %-18s %-18s\n", "ID", "Date", "Magnetic", "Model",
+		"D", "ErrD", "True", "Grid")
+	for _, r := range results {
+		grid := ""
+		if !math.IsNaN(r.gridAz) {
+			grid = formatBearing(r.gridAz)
+		}
+		fmt.Fprintf(bw, "%-10s %-10s %-18s %-10s %7.2f %5.2f %-18s %-18s\n", r.id, r.date, r.bearing, r.model,
+			r.d, r.errD, formatBearing(r.trueAz), grid)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/utm"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+const (
+	cof2020  = "../../pkg/wmm/testdata/WMM2020.COF"
+	igrfTest = "../../pkg/wmm/testdata/IGRF_TEST.txt"
+	igrf14   = "../../pkg/wmm/testdata/igrf14coeffs.txt"
+)
+
+func TestParseBearing(t *testing.T) {
+	for s, expected := range map[string]float64{
+		"N 45°30' E":     45.5,
+		"n45-30e":        45.5,
+		"S 12°15'30\" W": 192 + 15.0/60 + 30.0/3600,
+		"S12d15m30sE":    180 - 12 - 15.0/60 - 30.0/3600,
+		"N 45.5 W":       314.5,
+		"N 0 W":          0,
+		"S 90 W":         270,
+		"W":              270,
+		"225°30'":        225.5,
+		"  N 10 30 E  ":  10.5,
+		"S 1:02:03 E":    180 - 1 - 2.0/60 - 3.0/3600,
+		"N 89°59′59″ E":  89 + 59.0/60 + 59.0/3600,
+		"359.75":         359.75,
+	} {
+		az, err := parseBearing(s)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", s, err)
+			continue
+		}
+		testDiff(s, az, expected, 1e-9, t)
+	}
+	for _, s := range []string{"", "NE", "N 91 E", "N 45 60 E", "N 45.5 30 E", "360", "E 45 N", "N 1 2 3 4 E", "N abc E"} {
+		if _, err := parseBearing(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestFormatBearing(t *testing.T) {
+	for az, expected := range map[float64]string{
+		45.5:                     `N 45°30'00" E`,
+		314.5:                    `N 45°30'00" W`,
+		192 + 15.0/60 + 0.5/3600: `S 12°15'01" W`,
+		135:                      `S 45°00'00" E`,
+		0:                        `N 0°00'00" E`,
+		359.99999:                `N 0°00'00" W`,
+		-90:                      `S 90°00'00" W`,
+		29.99999:                 `N 30°00'00" E`,
+	} {
+		if s := formatBearing(az); s != expected {
+			t.Errorf("expected %s for %v, got %s", expected, az, s)
+		}
+		if az >= 0 && az < 360 {
+			back, _ := parseBearing(formatBearing(az))
+			testDiff("round trip of "+formatBearing(az), math.Abs(math.Remainder(back-az, 360)), 0, 0.5/3600+1e-9, t)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	m, err := newModels(cof2020, igrfTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the validity of the WMM
+	c, err := parseCall("lot7-1 06/14/2021 42.3601 -71.0589 N 45°30' E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.id != "lot7-1" || c.bearing != "N 45°30' E" {
+		t.Errorf("unexpected call %+v", c)
+	}
+	r, warning, err := convert(c, m)
+	if err != nil || warning != nil {
+		t.Fatalf("unexpected errors %v, %v", err, warning)
+	}
+	loc, _ := egm96.NewLocationMSL(42.3601, 360-71.0589, 0)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, c.t)
+	if r.model != "WMM-2020" {
+		t.Errorf("expected WMM-2020, got %s", r.model)
+	}
+	testDiff("declination", r.d, mf.D(), 1e-9, t)
+	testDiff("declination uncertainty", r.errD, mf.ErrD(), 1e-9, t)
+	testDiff("true azimuth", r.trueAz, 45.5+mf.D(), 1e-9, t)
+	uc, _ := utm.NewCoord(loc)
+	testDiff("grid azimuth", r.gridAz, r.trueAz-uc.Convergence(), 1e-9, t)
+	// Boston is west of the central meridian of zone 19, so grid north is west of true north
+	if r.convergence >= 0 {
+		t.Errorf("expected a negative convergence, got %v", r.convergence)
+	}
+
+	// Before the WMM, with the IGRF, whose test table has the WMM2015 main field at 2015
+	c, _ = parseCall("lot7-2 2015.0 42.3601 -71.0589 S 10 W")
+	if r, warning, err = convert(c, m); err != nil || warning != nil {
+		t.Fatalf("unexpected errors %v, %v", err, warning)
+	}
+	if r.model != "IGRF 2015" {
+		t.Errorf("expected IGRF 2015, got %s", r.model)
+	}
+	_ = wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2015v1.COF")
+	mf, _ = wmm.CalculateWMMMagneticField(loc, c.t)
+	testDiff("IGRF declination", r.d, mf.D(), 1e-9, t)
+	testDiff("IGRF true azimuth", r.trueAz, 190+mf.D(), 1e-9, t)
+
+	// The models are switched back and forth as the dates require
+	c, _ = parseCall("lot7-3 2022.5 42.3601 -71.0589 N 10 W")
+	if r, _, _ = convert(c, m); r.model != "WMM-2020" {
+		t.Errorf("expected WMM-2020, got %s", r.model)
+	}
+	c, _ = parseCall("lot7-4 2017.5 42.3601 -71.0589 N 10 W")
+	if r, _, _ = convert(c, m); r.model != "IGRF 2015" {
+		t.Errorf("expected IGRF 2015, got %s", r.model)
+	}
+
+	c, _ = parseCall("lot7-5 1850.0 42.3601 -71.0589 N 10 W")
+	if _, _, err = convert(c, m); err == nil {
+		t.Error("expected an error for a date before the IGRF")
+	}
+	if _, _, err = convert(c, &models{cof: cof2020, valid: m.valid, end: m.end, wmm: true}); err == nil ||
+		!strings.Contains(err.Error(), "IGRF") {
+		t.Errorf("expected an error asking for the IGRF, got %v", err)
+	}
+	for _, bad := range []string{"lot 2020", "lot 2020 42 -71 N 100 E", "lot 2020 95 -71 N 10 E", "lot 20x20 42 -71 N 10 E"} {
+		if _, err = parseCall(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+
+	// Near the pole there is no UTM grid but UPS
+	c, _ = parseCall("pole 2021 85 10 N 10 E")
+	r, _, _ = convert(c, m)
+	if math.IsNaN(r.gridAz) {
+		t.Error("expected a UPS grid bearing")
+	}
+	vals := r.values()
+	if len(vals) != len(columns) {
+		t.Fatalf("expected %d values, got %d", len(columns), len(vals))
+	}
+	var b bytes.Buffer
+	if err = writeText(&b, []conversion{r}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], formatBearing(r.trueAz)) {
+		t.Errorf("unexpected text output:\n%s", b.String())
+	}
+}
+
+func TestConvertHistorical(t *testing.T) {
+	m, err := newModels(cof2020, igrf14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The IGRF reference program gives a declination of 7.54° at 59.9°N 39.9°E
+	// in mid-1921, from the testdata of github.com/proway2/go-igrf.
+	c, err := parseCall("hist 1921.5 59.9 39.9 N 10 E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, warning, err := convert(c, m)
+	if err != nil || warning != nil {
+		t.Fatalf("unexpected errors %v, %v", err, warning)
+	}
+	if r.model != "IGRF 1920" {
+		t.Errorf("expected IGRF 1920, got %s", r.model)
+	}
+	testDiff("1921 declination", r.d, 7.54, 0.01, t)
+	testDiff("1921 true azimuth", r.trueAz, 10+7.54, 0.01, t)
+}
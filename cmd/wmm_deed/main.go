@@ -0,0 +1,158 @@
+// wmm_deed converts the magnetic bearings recorded in historical deeds and
+// surveys to true and grid bearings, for surveyors retracing old boundaries.
+//
+// Usage is
+//  wmm_deed --cof_file=WMM2020.COF --igrf=igrf13coeffs.txt --format=text [input file]
+//
+// The calls are read from the input file, or standard input if it is - or not
+// given, one per line as
+//  id date latitude longitude bearing
+// where the id identifies the call, such as a parcel and course number, the date
+// is a decimal year or MM/DD/YYYY, the latitude and longitude are given as for
+// wmm_point, and the bearing is the rest of the line.  Bearings are quadrant
+// bearings such as N 45°30' E, S12-15-30W or N 45.5 E, or azimuths clockwise
+// from magnetic north such as 225°30'.  For example
+//  lot7-1 06/14/1921 42.3601 -71.0589 N 45°30' E
+// Blank lines and lines starting with # are skipped.
+//
+// The declination at the date and location is added to each bearing to give the
+// true bearing, and the UTM or UPS meridian convergence is then subtracted to
+// give the grid bearing.  The WMM is used within its validity period.  Other
+// dates need the International Geomagnetic Reference Field, whose coefficients
+// table, such as igrf13coeffs.txt from IAGA, is given with --igrf; it covers
+// dates from 1900, and earlier dates cannot be converted.
+//
+// The uncertainty of the declination is that of the WMM, from ErrD, which grows
+// near the magnetic poles.  The IGRF is less certain before about 1945, and
+// local anomalies and the daily variation of the field, which can each amount to
+// several minutes of arc, are not modeled, nor are the errors of old compasses.
+//
+// The text output has a line per call with the columns
+//  ID Date Magnetic Model D ErrD True Grid
+// with the bearings in degrees, minutes and seconds, and --format=json, csv or
+// tsv writes the columns
+//  id date latitude longitude magnetic_bearing magnetic_azimuth model d err_d
+//  true_azimuth true_bearing convergence grid_azimuth grid_bearing
+// with angles in degrees.
+//
+// Lines that cannot be converted are reported on standard error with their line
+// number and skipped, and wmm_deed exits with status 1 once the rest of the file
+// has been processed.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/westphae/geomag/internal/format"
+)
+
+const (
+	usage = "wmm_deed --cof_file=WMM2020.COF --igrf=igrf13coeffs.txt --format=text [input file]"
+	cofUsage = "COF coefficients file to use within its validity period, empty for the built-in one"
+	igrfUsage = "IGRF coefficients table to use for dates outside the validity period of the WMM"
+	formatUsage = "Output format: text, json, csv or tsv"
+)
+
+var (
+	cofFile   string
+	igrfFile  string
+	outFormat string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&igrfFile, "igrf", "", igrfUsage)
+
+	flag.StringVar(&outFormat, "format", "text", formatUsage)
+	flag.StringVar(&outFormat, "f", "text", formatUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg()>1 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if outFormat!="text" && outFormat!="json" && outFormat!="csv" && outFormat!="tsv" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format %s, must be text, json, csv or tsv\n", outFormat)
+		os.Exit(2)
+	}
+
+	m, err := newModels(cofFile, igrfFile)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	in := os.Stdin
+	if name := flag.Arg(0); name!="" && name!="-" {
+		if in, err = os.Open(name); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer in.Close()
+	}
+
+	var (
+		results []conversion
+		nErr    int
+		warned  bool
+	)
+	scanner := bufio.NewScanner(in)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line=="" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c, err := parseCall(line)
+		if err!=nil {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: %s\n", lineNo, err)
+			nErr++
+			continue
+		}
+		r, warning, err := convert(c, m)
+		if err!=nil {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: %s\n", lineNo, err)
+			nErr++
+			continue
+		}
+		if warning!=nil && !warned {
+			_, _ = fmt.Fprintf(os.Stderr, "line %d: Warning: %s\n", lineNo, warning)
+			warned = true
+		}
+		results = append(results, r)
+	}
+	if err = scanner.Err(); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		nErr++
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if outFormat=="text" {
+		err = writeText(w, results)
+	} else {
+		rows := make([][]interface{}, len(results))
+		for i, r := range results {
+			rows[i] = r.values()
+		}
+		err = format.WriteTable(w, outFormat, columns, rows...)
+	}
+	if err==nil {
+		err = w.Flush()
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		nErr++
+	}
+	if nErr>0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%d lines could not be processed\n", nErr)
+		os.Exit(1)
+	}
+}
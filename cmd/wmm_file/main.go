@@ -0,0 +1,231 @@
+// wmm_file estimates the strength and direction of Earth's main Magnetic field
+// for each point in an input file.
+//
+// Usage is
+//  wmm_file --cof_file=WMM2020.COF --format=noaa [input file] [output file]
+//
+// The input file is read from standard input if it is - or not given, and the
+// output is written to standard output if no output file is given.
+//
+// Each line of the input describes one point with the fields
+//  date coord-system altitude latitude longitude [id]
+// separated by whitespace as in the NOAA wmm_file program, or by commas
+// in CSV format.  The format is CSV if --format=csv or the input file name
+// ends in .csv, and a CSV header line starting with "date" is skipped.
+// Blank lines and lines starting with # are ignored.
+//
+// The date is a decimal year or YYYY,MM,DD.  The coordinate system is D for
+// geodetic coordinates with altitude above mean sea level, E for geodetic
+// coordinates with altitude above the WGS-84 ellipsoid, or C for geocentric
+// coordinates with altitude measured from the center of the Earth.
+// The altitude is prefixed with K for kilometers, M for meters or F for feet.
+// For example
+//  2020.5 D K10 30,30,0 -100.5 station1
+//  2022,3,14 E M250 -33.87 151.21
+//
+// Each output line repeats the input fields and adds the columns
+//  D I H X Y Z F dD dI dH dX dY dZ dF
+// with angles in degrees, field strengths in nT, secular changes per year,
+// and X, Y and Z on the ellipsoidal axes.
+//
+// Lines that cannot be parsed are reported on standard error with their line
+// number and skipped, and wmm_file exits with status 1 once the rest of the file
+// has been processed.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_file --cof_file=WMM2020.COF --format=noaa [input file] [output file]"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	formatUsage = "Input and output format, noaa or csv; empty to choose by the input file extension"
+)
+
+var header = []string{"date", "coord", "altitude", "latitude", "longitude", "id",
+	"D", "I", "H", "X", "Y", "Z", "F", "dD", "dI", "dH", "dX", "dY", "dZ", "dF"}
+
+var (
+	cofFile string
+	format  string
+	errOut  io.Writer = os.Stderr // Where bad lines and warnings are reported
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&format, "format", "", formatUsage)
+	flag.StringVar(&format, "f", "", formatUsage)
+}
+
+func main() {
+	flag.Parse()
+	os.Exit(run(flag.Args()))
+}
+
+// run processes the input file named by args[0] into the output file named by
+// args[1], as described above, and returns the exit status.
+func run(args []string) (status int) {
+	var err error
+	if len(args)>2 {
+		_, _ = fmt.Fprintln(errOut, usage)
+		return 2
+	}
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+
+	in := os.Stdin
+	if len(args)>0 && args[0]!="" && args[0]!="-" {
+		if in, err = os.Open(args[0]); err!=nil {
+			_, _ = fmt.Fprintln(errOut, err)
+			return 1
+		}
+		defer in.Close()
+		if format=="" && strings.HasSuffix(strings.ToLower(args[0]), ".csv") {
+			format = "csv"
+		}
+	}
+	if format=="" {
+		format = "noaa"
+	}
+	if format!="noaa" && format!="csv" {
+		_, _ = fmt.Fprintf(errOut, "unknown format %s, must be noaa or csv\n", format)
+		return 2
+	}
+
+	out := os.Stdout
+	if len(args)>1 && args[1]!="" {
+		if out, err = os.Create(args[1]); err!=nil {
+			_, _ = fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+	w := bufio.NewWriter(out)
+
+	nErr := processFile(in, w)
+	if err = w.Flush(); err!=nil {
+		_, _ = fmt.Fprintln(errOut, err)
+		nErr++
+	}
+	if out!=os.Stdout {
+		if err = out.Close(); err!=nil {
+			_, _ = fmt.Fprintln(errOut, err)
+			nErr++
+		}
+	}
+	if nErr>0 {
+		_, _ = fmt.Fprintf(errOut, "%d lines could not be processed\n", nErr)
+		return 1
+	}
+	return 0
+}
+
+// processFile computes the field for each point read from r and writes the results to w.
+// It returns the number of lines that could not be processed.
+func processFile(r io.Reader, w io.Writer) (nErr int) {
+	var (
+		cw     *csv.Writer
+		warned bool
+		first  = true
+	)
+	if format=="csv" {
+		cw = csv.NewWriter(w)
+		_ = cw.Write(header)
+	} else {
+		_, _ = fmt.Fprintln(w, "# "+strings.Join(header, " "))
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line=="" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var (
+			fields []string
+			err    error
+		)
+		if format=="csv" {
+			if fields, err = csv.NewReader(strings.NewReader(line)).Read(); err!=nil {
+				_, _ = fmt.Fprintf(errOut, "line %d: %s\n", lineNo, err)
+				nErr++
+				continue
+			}
+			if first && strings.EqualFold(strings.TrimSpace(fields[0]), "date") {
+				first = false
+				continue
+			}
+			for i := range fields {
+				fields[i] = strings.TrimSpace(fields[i])
+			}
+		} else {
+			fields = strings.Fields(line)
+		}
+		first = false
+		if len(fields)<5 || len(fields)>6 {
+			_, _ = fmt.Fprintf(errOut, "line %d: expected date, coord-system, altitude, latitude, longitude " +
+				"and an optional id, got %d fields\n", lineNo, len(fields))
+			nErr++
+			continue
+		}
+
+		loc, dYear, err := parsing.ParsePoint(fields[0], fields[1], fields[2], fields[3], fields[4])
+		if err!=nil {
+			_, _ = fmt.Fprintf(errOut, "line %d: %s\n", lineNo, err)
+			nErr++
+			continue
+		}
+		mf, err := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(dYear).ToTime())
+		if err!=nil && !warned {
+			_, _ = fmt.Fprintf(errOut, "line %d: Warning: %s\n", lineNo, err)
+			warned = true
+		}
+
+		x, y, z, dx, dy, dz := mf.Ellipsoidal()
+		vals := []float64{mf.D(), mf.I(), mf.H(), x, y, z, mf.F(),
+			mf.DD(), mf.DI(), mf.DH(), dx, dy, dz, mf.DF()}
+		if len(fields)==5 {
+			fields = append(fields, "")
+		}
+		if format=="csv" {
+			for _, v := range vals {
+				fields = append(fields, fmt.Sprintf("%.2f", v))
+			}
+			_ = cw.Write(fields)
+			continue
+		}
+		if fields[5]=="" {
+			fields[5] = "-"
+		}
+		_, _ = fmt.Fprint(w, strings.Join(fields, " "))
+		for _, v := range vals {
+			_, _ = fmt.Fprintf(w, " %9.2f", v)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if err := scanner.Err(); err!=nil {
+		_, _ = fmt.Fprintln(errOut, err)
+		nErr++
+	}
+	if cw!=nil {
+		cw.Flush()
+	}
+	return nErr
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+const cof2020 = "../../pkg/wmm/testdata/WMM2020.COF"
+
+// setFormat sets the format and the error output for a test, loads the WMM2020
+// coefficients and returns a function restoring them.
+func setFormat(t *testing.T, f string, e *bytes.Buffer) func() {
+	if err := wmm.LoadWMMCOF(cof2020); err != nil {
+		t.Fatal(err)
+	}
+	oldFormat, oldErrOut := format, errOut
+	format, errOut = f, e
+	return func() {
+		format, errOut = oldFormat, oldErrOut
+		_ = wmm.LoadWMMCOF("")
+	}
+}
+
+// checkValues checks the field columns of an output line against the field at loc and date.
+func checkValues(name string, fields []string, loc egm96.Location, date float64, t *testing.T) {
+	mf, _ := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(date).ToTime())
+	x, y, z, dx, dy, dz := mf.Ellipsoidal()
+	expected := []float64{mf.D(), mf.I(), mf.H(), x, y, z, mf.F(),
+		mf.DD(), mf.DI(), mf.DH(), dx, dy, dz, mf.DF()}
+	for i, v := range expected {
+		actual, err := strconv.ParseFloat(fields[6+i], 64)
+		if err != nil {
+			t.Errorf("%s %s: %v", name, header[6+i], err)
+			continue
+		}
+		testDiff(name+" "+header[6+i], actual, v, 0.005, t)
+	}
+}
+
+func TestProcessFileNOAA(t *testing.T) {
+	var e bytes.Buffer
+	defer setFormat(t, "noaa", &e)()
+
+	var b bytes.Buffer
+	nErr := processFile(strings.NewReader(`# date coord altitude latitude longitude id
+2022.5 E K0 30 -100 station1
+2022.5 E K0 30
+
+2022.5 X K0 30 -100
+2021.0 E M1000 -33.87 151.21
+2026.0 E K0 30 -100 late
+`), &b)
+	if nErr != 2 {
+		t.Errorf("expected 2 bad lines, got %d", nErr)
+	}
+	for _, msg := range []string{"line 3: expected date", "line 5: ", "line 7: Warning: "} {
+		if !strings.Contains(e.String(), msg) {
+			t.Errorf("expected %q to be reported, got:\n%s", msg, e.String())
+		}
+	}
+	if strings.Count(e.String(), "Warning") != 1 {
+		t.Errorf("expected a single warning, got:\n%s", e.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 lines, got:\n%s", b.String())
+	}
+	if lines[0] != "# "+strings.Join(header, " ") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	for _, l := range lines[1:] {
+		if fields := strings.Fields(l); len(fields) != len(header) {
+			t.Errorf("expected %d columns, got %d in %q", len(header), len(fields), l)
+		}
+	}
+	fields := strings.Fields(lines[1])
+	if strings.Join(fields[:6], " ") != "2022.5 E K0 30 -100 station1" {
+		t.Errorf("expected the input fields to be repeated, got %q", lines[1])
+	}
+	checkValues("station1", fields, egm96.NewLocationGeodetic(30, 260, 0), 2022.5, t)
+	if fields = strings.Fields(lines[2]); fields[5] != "-" {
+		t.Errorf("expected - for a missing id, got %q", fields[5])
+	}
+	checkValues("Sydney", fields, egm96.NewLocationGeodetic(-33.87, 151.21, 1000), 2021.0, t)
+
+	// Points outside the validity of the model are still written, with a warning
+	checkValues("late", strings.Fields(lines[3]), egm96.NewLocationGeodetic(30, 260, 0), 2026.0, t)
+}
+
+func TestProcessFileCSV(t *testing.T) {
+	var e bytes.Buffer
+	defer setFormat(t, "csv", &e)()
+
+	var b bytes.Buffer
+	nErr := processFile(strings.NewReader(`date,coord,altitude,latitude,longitude,id
+2022.5, E, K0, 30, -100
+2022.5,E,K0,30,-100,"a,b"
+`), &b)
+	if nErr != 0 {
+		t.Errorf("expected no bad lines, got %d:\n%s", nErr, e.String())
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 lines, got:\n%s", b.String())
+	}
+	if lines[0] != strings.Join(header, ",") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "2022.5,E,K0,30,-100,,") {
+		t.Errorf("expected the input fields without spaces and an empty id, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `2022.5,E,K0,30,-100,"a,b",`) {
+		t.Errorf("expected the quoted id to be kept, got %q", lines[2])
+	}
+	checkValues("CSV", strings.Split(lines[1], ","), egm96.NewLocationGeodetic(30, 260, 0), 2022.5, t)
+}
+
+func TestRun(t *testing.T) {
+	var e bytes.Buffer
+	defer setFormat(t, "", &e)()
+
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "points.CSV"), filepath.Join(dir, "out.csv")
+	if err := ioutil.WriteFile(in, []byte("2022.5,E,K0,30,-100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := run([]string{in, out}); status != 0 {
+		t.Errorf("expected exit status 0, got %d:\n%s", status, e.String())
+	}
+	if b, _ := ioutil.ReadFile(out); !strings.HasPrefix(string(b), strings.Join(header, ",")+"\n2022.5,E,K0,30,-100,,") {
+		t.Errorf("expected CSV output for a .csv input file, got:\n%s", b)
+	}
+
+	// Bad lines are skipped, but give an exit status of 1
+	format = ""
+	if err := ioutil.WriteFile(in, []byte("2022.5,E,K0,30,-100\n2022.5,E,K0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := run([]string{in, out}); status != 1 {
+		t.Errorf("expected exit status 1, got %d", status)
+	}
+	if !strings.Contains(e.String(), "line 2: ") || !strings.Contains(e.String(), "1 lines could not be processed") {
+		t.Errorf("expected the bad line to be reported, got:\n%s", e.String())
+	}
+	if b, _ := ioutil.ReadFile(out); strings.Count(string(b), "\n") != 2 {
+		t.Errorf("expected the good line to be written, got:\n%s", b)
+	}
+
+	if status := run([]string{in, out, "extra"}); status != 2 {
+		t.Errorf("expected exit status 2 for too many arguments, got %d", status)
+	}
+}
@@ -0,0 +1,310 @@
+// wmm_grid estimates the strength and direction of Earth's main Magnetic field
+// over a grid of locations and a span of times.
+//
+// Usage is
+//  wmm_grid --cof_file=WMM2020.COF --spherical --component=D --secular --output=grid.txt \
+//    --lat=[range] --lng=[range] --alt=[range] --date=[range]
+//
+// Each range is either a single value or start:end:step, where the start, end
+// and step are in the formats accepted by wmm_point.  For example
+//  wmm_grid --lat=-80:80:10 --lng=-180:180:10 --alt=0 --date=2020:2025:0.5
+// computes the field every 10 degrees at mean sea level, every six months from
+// 2020 to 2025.  Altitudes are in kilometers above mean sea level, or above
+// the WGS-84 ellipsoid if the start is prefixed with E.  Any ranges not given
+// on the command line are prompted for.
+//
+// The component is one of D (declination), I (inclination), GV (grid variation),
+// X, Y, Z, H or F, or all.  For a single component the main field value is
+// written, or its secular change with --secular.  For all components both the
+// main field and secular change of each are written, in the columns
+//  Lat Lon Height Date D I H X Y Z F GV dD dI dH dX dY dZ dF dGV
+// as in the NOAA grid program.  Angles are in degrees and field strengths in nT,
+// and their secular changes in minutes and nT per year.  With --spherical, X, Y
+// and Z are on the spherical rather than the ellipsoidal axes.
+//
+// The output is written to standard output unless a file is given with --output.
+// Points outside the validity of the model are computed anyway, with a warning.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_grid --cof_file=WMM2020.COF --spherical --component=D --secular --output=grid.txt " +
+		"--lat=[range] --lng=[range] --alt=[range] --date=[range]"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	sphericalUsage = "Output spherical values of X, Y and Z instead of ellipsoidal"
+	componentUsage = "Component to output: D, I, GV, X, Y, Z, H, F or all"
+	secularUsage = "Output the secular change of a single component instead of its value"
+	outputUsage = "File to write the grid to, empty for standard output"
+	rangeUsage = "Range of %s as start:end:step, or a single value"
+)
+
+var prompt = map[string]string{
+	"latitude": "Please enter the latitude range as start:end:step, North Latitude positive. " +
+		"For example: -80:80:10 or 30.5 for a single latitude. ",
+	"longitude": "Please enter the longitude range as start:end:step, East longitude positive, West negative. " +
+		"For example: -180:180:10 or -100.5 for a single longitude. ",
+	"altitude": "Please enter the height range above mean sea level (in kilometers) as start:end:step. " +
+		"[For height above WGS-84 Ellipsoid prefix E, for example (E0:20:5)]. ",
+	"date": "Please enter the decimal year range as start:end:step, for example 2020:2025:0.5. ",
+	"component": "Please enter the component to output (D, I, GV, X, Y, Z, H, F or all). ",
+}
+
+// component is a field component that can be written to the grid.
+type component struct {
+	name     string
+	value    func(mf wmm.MagneticField) float64
+	variation func(mf wmm.MagneticField) float64 // In minutes per year for angles
+}
+
+var components = []component{
+	{"D", wmm.MagneticField.D, func(mf wmm.MagneticField) float64 { return 60*mf.DD() }},
+	{"I", wmm.MagneticField.I, func(mf wmm.MagneticField) float64 { return 60*mf.DI() }},
+	{"H", wmm.MagneticField.H, wmm.MagneticField.DH},
+	{"X", func(mf wmm.MagneticField) float64 { x, _, _, _, _, _ := xyz(mf); return x },
+		func(mf wmm.MagneticField) float64 { _, _, _, dx, _, _ := xyz(mf); return dx }},
+	{"Y", func(mf wmm.MagneticField) float64 { _, y, _, _, _, _ := xyz(mf); return y },
+		func(mf wmm.MagneticField) float64 { _, _, _, _, dy, _ := xyz(mf); return dy }},
+	{"Z", func(mf wmm.MagneticField) float64 { _, _, z, _, _, _ := xyz(mf); return z },
+		func(mf wmm.MagneticField) float64 { _, _, _, _, _, dz := xyz(mf); return dz }},
+	{"F", wmm.MagneticField.F, wmm.MagneticField.DF},
+	{"GV", func(mf wmm.MagneticField) float64 { return mf.GV(mf.Location()) },
+		func(mf wmm.MagneticField) float64 { return 60*mf.DGV() }},
+}
+
+var (
+	cofFile   string
+	spherical bool
+	compName  string
+	secular   bool
+	outFile   string
+	ranges    = map[string]*string{"latitude": new(string), "longitude": new(string),
+		"altitude": new(string), "date": new(string)}
+	latitudes  []float64
+	longitudes []float64
+	altitudes  []float64
+	hae        bool
+	dates      []float64
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.BoolVar(&spherical, "spherical", false, sphericalUsage)
+	flag.BoolVar(&spherical, "s", false, sphericalUsage)
+
+	flag.StringVar(&compName, "component", "", componentUsage)
+	flag.BoolVar(&secular, "secular", false, secularUsage)
+	flag.StringVar(&outFile, "output", "", outputUsage)
+	flag.StringVar(&outFile, "o", "", outputUsage)
+
+	flag.StringVar(ranges["latitude"], "lat", "", fmt.Sprintf(rangeUsage, "latitudes"))
+	flag.StringVar(ranges["longitude"], "lng", "", fmt.Sprintf(rangeUsage, "longitudes"))
+	flag.StringVar(ranges["altitude"], "alt", "", fmt.Sprintf(rangeUsage, "altitudes in km"))
+	flag.StringVar(ranges["date"], "date", "", fmt.Sprintf(rangeUsage, "decimal years"))
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	if flag.NArg()!=0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	for _, name := range []string{"latitude", "longitude", "altitude", "date"} {
+		for {
+			if *ranges[name]=="" {
+				*ranges[name] = readUserInput(prompt[name])
+				if *ranges[name]=="q" {
+					fmt.Println("Goodbye")
+					os.Exit(1)
+				}
+			}
+			if err = parseRange(name, *ranges[name]); err==nil {
+				break
+			}
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			*ranges[name] = ""
+		}
+	}
+
+	var selected []component
+	for selected==nil {
+		if compName=="" {
+			compName = readUserInput(prompt["component"])
+			if compName=="q" {
+				fmt.Println("Goodbye")
+				os.Exit(1)
+			}
+		}
+		if selected, err = selectComponents(compName); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			compName = ""
+		}
+	}
+
+	out := os.Stdout
+	if outFile!="" {
+		if out, err = os.Create(outFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	if err = writeGrid(w, selected); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// parseRange parses the input range for the named quantity into its list of values.
+func parseRange(name, inp string) (err error) {
+	switch name {
+	case "latitude":
+		latitudes, err = parsing.ParseRange(inp, parsing.ParseLatLng)
+		for _, lat := range latitudes {
+			if lat < -90 || lat > 90 {
+				return fmt.Errorf("latitude %v is outside the range -90 to 90", lat)
+			}
+		}
+	case "longitude":
+		longitudes, err = parsing.ParseRange(inp, parsing.ParseLatLng)
+		for _, lng := range longitudes {
+			if lng < -180 || lng >= 360 {
+				return fmt.Errorf("longitude %v is outside the range -180 to 360", lng)
+			}
+		}
+	case "altitude":
+		hae = strings.HasPrefix(strings.TrimSpace(inp), "E")
+		altitudes, err = parsing.ParseRange(strings.TrimPrefix(strings.TrimSpace(inp), "E"),
+			func(s string) (h float64, err error) {
+				var e bool
+				if h, e, err = parsing.ParseAltitude(s); e {
+					return 0, fmt.Errorf("only the start of an altitude range may be prefixed with E")
+				}
+				return h, err
+			})
+	case "date":
+		dates, err = parsing.ParseRange(inp, parsing.ParseTime)
+	}
+	return err
+}
+
+// selectComponents returns the components named by inp.
+func selectComponents(inp string) (selected []component, err error) {
+	if strings.EqualFold(inp, "all") {
+		return components, nil
+	}
+	for _, c := range components {
+		if strings.EqualFold(inp, c.name) {
+			return []component{c}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown component %s, must be one of D, I, GV, X, Y, Z, H, F or all", inp)
+}
+
+// writeGrid writes the header and a line for each grid point to w.
+// The innermost loop is over time, so that the field calculation is cached
+// for each location.
+func writeGrid(w io.Writer, selected []component) (err error) {
+	all := len(selected)>1
+	heightRef := "MSL"
+	if hae {
+		heightRef = "HAE"
+	}
+	fmt.Fprintf(w, "%8s %9s %9s %9s", "Lat", "Lon", "Height"+heightRef, "Date")
+	for _, c := range selected {
+		if all || !secular {
+			fmt.Fprintf(w, " %10s", c.name)
+		}
+	}
+	for _, c := range selected {
+		if all || secular {
+			fmt.Fprintf(w, " %10s", "d"+c.name)
+		}
+	}
+	fmt.Fprintln(w)
+
+	var warned bool
+	for _, lng := range longitudes {
+		for _, lat := range latitudes {
+			for _, alt := range altitudes {
+				loc, err := location(lat, lng, alt)
+				if err!=nil {
+					return err
+				}
+				for _, date := range dates {
+					mf, errField := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(date).ToTime())
+					if errField!=nil && !warned {
+						_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", errField)
+						warned = true
+					}
+					fmt.Fprintf(w, "%8.3f %9.3f %9.3f %9.4f", lat, lng, alt, date)
+					for _, c := range selected {
+						if all || !secular {
+							fmt.Fprintf(w, " %10.2f", c.value(mf))
+						}
+					}
+					for _, c := range selected {
+						if all || secular {
+							fmt.Fprintf(w, " %10.2f", c.variation(mf))
+						}
+					}
+					if _, err = fmt.Fprintln(w); err!=nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// location returns the Location of a grid point, with the altitude in km.
+func location(lat, lng, alt float64) (loc egm96.Location, err error) {
+	for lng<0 {
+		lng += 360
+	}
+	if hae {
+		return egm96.NewLocationGeodetic(lat, lng, alt*1000), nil
+	}
+	return egm96.NewLocationMSL(lat, lng, alt*1000)
+}
+
+// xyz returns the field components on the axes chosen by the spherical flag.
+func xyz(mf wmm.MagneticField) (x, y, z, dx, dy, dz float64) {
+	if spherical {
+		return mf.Spherical()
+	}
+	return mf.Ellipsoidal()
+}
+
+func readUserInput(prompt string) (inp string) {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print(prompt)
+	inp, _ = reader.ReadString('\n')
+	inp = strings.TrimSpace(inp)
+	return inp
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+// setGrid parses the ranges of a test grid and returns a function restoring the flags.
+func setGrid(t *testing.T, lat, lng, alt, date string, sec bool) func() {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	oldSecular, oldHAE := secular, hae
+	secular = sec
+	for name, inp := range map[string]string{"latitude": lat, "longitude": lng, "altitude": alt, "date": date} {
+		if err := parseRange(name, inp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		secular, hae = oldSecular, oldHAE
+		_ = wmm.LoadWMMCOF("")
+	}
+}
+
+func checkValues(name string, actual, expected []float64, t *testing.T) {
+	if len(actual) != len(expected) {
+		t.Errorf("%s: expected %v, got %v", name, expected, actual)
+		return
+	}
+	for i := range expected {
+		testDiff(fmt.Sprintf("%s[%d]", name, i), actual[i], expected[i], 1e-9, t)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	defer setGrid(t, "-80:80:40", "180:-180:90", "E0:20:10", "2020:2021.5:0.5", false)()
+	checkValues("latitudes", latitudes, []float64{-80, -40, 0, 40, 80}, t)
+	checkValues("longitudes", longitudes, []float64{180, 90, 0, -90, -180}, t)
+	checkValues("altitudes", altitudes, []float64{0, 10, 20}, t)
+	if !hae {
+		t.Error("expected heights above the ellipsoid")
+	}
+	checkValues("dates", dates, []float64{2020, 2020.5, 2021, 2021.5}, t)
+
+	if err := parseRange("date", "2020.3"); err != nil {
+		t.Fatal(err)
+	}
+	checkValues("single date", dates, []float64{2020.3}, t)
+	if err := parseRange("altitude", "0:10:2.5"); err != nil || hae {
+		t.Errorf("expected heights above mean sea level, got %v, %v", hae, err)
+	}
+	checkValues("altitudes", altitudes, []float64{0, 2.5, 5, 7.5, 10}, t)
+
+	for name, inp := range map[string]string{"latitude": "0:100:10", "longitude": "0:360:90",
+		"altitude": "0:E10:5", "date": "2020:2025:0"} {
+		if err := parseRange(name, inp); err == nil {
+			t.Errorf("expected an error for %s %s", name, inp)
+		}
+	}
+}
+
+func TestWriteGrid(t *testing.T) {
+	defer setGrid(t, "0:30:30", "-100:-90:10", "0", "2020:2021:1", false)()
+	var b bytes.Buffer
+	if err := writeGrid(&b, components); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if strings.Join(strings.Fields(lines[0]), " ") !=
+		"Lat Lon HeightMSL Date D I H X Y Z F GV dD dI dH dX dY dZ dF dGV" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if len(lines) != 1+2*2*2 {
+		t.Fatalf("expected 8 grid lines, got:\n%s", b.String())
+	}
+
+	// Time is the innermost loop, then latitude, then longitude
+	for i, p := range [][3]float64{{0, -100, 2020}, {0, -100, 2021}, {30, -100, 2020}, {30, -100, 2021},
+		{0, -90, 2020}} {
+		fields := strings.Fields(lines[i+1])
+		if len(fields) != 4+2*len(components) {
+			t.Fatalf("expected %d columns, got %q", 4+2*len(components), lines[i+1])
+		}
+		vals := make([]float64, len(fields))
+		for j, f := range fields {
+			vals[j], _ = strconv.ParseFloat(f, 64)
+		}
+		checkValues(fmt.Sprintf("line %d point", i+1), vals[:4], []float64{p[0], p[1], 0, p[2]}, t)
+
+		loc, _ := egm96.NewLocationMSL(p[0], p[1]+360, 0)
+		mf, _ := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(p[2]).ToTime())
+		x, _, _, dx, _, _ := mf.Ellipsoidal()
+		testDiff("D", vals[4], mf.D(), 0.005, t)
+		testDiff("X", vals[7], x, 0.005, t)
+		testDiff("GV", vals[11], mf.GV(loc), 0.005, t)
+		// The secular change of angles is in minutes per year
+		testDiff("dD", vals[12], 60*mf.DD(), 0.005, t)
+		testDiff("dI", vals[13], 60*mf.DI(), 0.005, t)
+		testDiff("dX", vals[15], dx, 0.005, t)
+		testDiff("dF", vals[18], mf.DF(), 0.005, t)
+		testDiff("dGV", vals[19], 60*mf.DGV(), 0.005, t)
+	}
+}
+
+func TestWriteGridSecular(t *testing.T) {
+	defer setGrid(t, "45", "10", "E1", "2022.5", true)()
+	selected, err := selectComponents("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err = writeGrid(&b, selected); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[0]), " ") != "Lat Lon HeightHAE Date dD" {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) != 5 {
+		t.Fatalf("expected 5 columns, got %q", lines[1])
+	}
+	dD, _ := strconv.ParseFloat(fields[4], 64)
+	mf, _ := wmm.CalculateWMMMagneticField(egm96.NewLocationGeodetic(45, 10, 1000), wmm.DecimalYear(2022.5).ToTime())
+	testDiff("dD", dD, 60*mf.DD(), 0.005, t)
+
+	if _, err = selectComponents("Q"); err == nil {
+		t.Error("expected an error for an unknown component")
+	}
+}
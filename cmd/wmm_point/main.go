@@ -1,7 +1,8 @@
 // wmm_point estimates the strength and direction of Earth's main Magnetic field for a given point/area.
 //
 // Usage is
-//  wmm_point --cof_file=WMM2020.COF --spherical [latitude] [longitude] [altitude] [date]
+//  wmm_point --cof_file=WMM2020.COF --spherical --format=text [latitude] [longitude] [altitude] [date]
+//  wmm_point --cof_file=WMM2020.COF --spherical --format=text [grid reference] [altitude] [date]
 //
 // The World Magnetic Model (WMM) for 2020
 // is a model of Earth's main Magnetic field.  The WMM
@@ -12,8 +13,13 @@
 //
 // Input required is the location in geodetic latitude and
 // longitude (positive for northern latitudes and eastern
-// longitudes), geodetic altitude in meters, and the date of
-// interest in years.
+// longitudes), altitude in kilometers, and the date of
+// interest in years.  The altitude may instead be given in feet,
+// e.g. 35000ft, or as a flight level such as FL350, which is
+// converted to a height using the ICAO Standard Atmosphere.
+// The location may instead be given as a single
+// UTM or UPS grid reference such as "38n 444141 3684706", or an MGRS
+// reference such as 38SMB4414084706.
 //
 // The program computes the estimated Magnetic Declination
 // (Decl) which is sometimes called MagneticVAR, Inclination (Incl), Total
@@ -55,6 +61,8 @@
 //  
 //  Latitude:       30.00N
 //  Longitude:      88.51W
+//  UTM/UPS:        16n 354356 3319745
+//  MGRS:           16RCU5435519745
 //  Altitude:        0.010 kilometers above mean sea level
 //  Date:           2019.5
 //  
@@ -68,43 +76,48 @@
 //         Incl =     59º  9' ± 13'         -4.6'/yr
 //  
 //         Grid Variation =  -1º 59'
+//         UTM/UPS Grid Variation =  -1º 14'
+//
+// The first Grid Variation follows the NOAA software, which reports the
+// declination equatorward of 55° and approximates the UPS grid poleward of it.
+// The UTM/UPS Grid Variation is measured from grid north of the UTM zone
+// or UPS grid which applies at the location.
+//
+// With --format=json, csv or tsv the results are instead written in a
+// machine-readable form with every component, secular change and uncertainty,
+// the model name and epoch, e.g.
+//  wmm_point --format=csv 30 -88.51 0.01 2019.5
+// Warnings are then written to standard error.
 package main
 
 import (
-	"bufio"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strings"
 
+	"github.com/westphae/geomag/internal/format"
 	"github.com/westphae/geomag/internal/util"
 	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/utm"
 	"github.com/westphae/geomag/pkg/wmm"
 )
 
 const (
-	usage = "wmm_point --cof_file=WMM2020.COF --spherical [latitude] [longitude] [altitude] [date]"
+	usage = "wmm_point --cof_file=WMM2020.COF --spherical --format=text [latitude] [longitude] [altitude] [date]\n" +
+		"wmm_point --cof_file=WMM2020.COF --spherical --format=text [grid reference] [altitude] [date]"
 	cofUsage = "COF coefficients file to use, empty for the built-in one"
 	sphericalUsage = "Output spherical values instead of ellipsoidal"
+	formatUsage = "Output format: text, json, csv or tsv"
 	lngErr = "Error: Degree input is outside legal range. The legal range is from -180 to 360."
 	fieldWarn = "Warning: The Horizontal Field strength at this location is only 0.000000. " +
 		"Compass readings have VERY LARGE uncertainties in areas where where H is smaller than 1000 nT"
 )
 
-var prompt = map[string]string{
-	"latitude": "Please enter latitude North Latitude positive. " +
-		"For example: 30, 30, 30 (D,M,S) or 30.508 (Decimal Degrees) (both are north). ",
-	"longitude": "Please enter longitude East longitude positive, West negative. " +
-		"For example: -100.5 or -100, 30, 0 for 100.5 degrees west. ",
-	"altitude": "Please enter height above mean sea level (in kilometers). " +
-		"[For height above WGS-84 Ellipsoid prefix E, for example (E20.1)]. ",
-	"date": "Please enter the decimal year or calendar date (YYYY.yyy, MM DD YYYY or MM/DD/YYYY) ",
-}
-
 var (
 	cofFile    string
 	spherical  bool
+	outFormat  string
 	latitude   float64
 	longitude  float64
 	altitude   float64
@@ -124,6 +137,9 @@ func init() {
 	flag.BoolVar(&spherical, "spherical", false, sphericalUsage)
 	flag.BoolVar(&spherical, "s", false, sphericalUsage)
 
+	flag.StringVar(&outFormat, "format", "text", formatUsage)
+	flag.StringVar(&outFormat, "f", "text", formatUsage)
+
 	ErrHelp = errors.New(usage)
 }
 
@@ -136,11 +152,18 @@ func main() {
 			return
 		}
 	}
-	fmt.Printf("COF File: %v, Epoch: %v, Valid Date: %d/%d/%d\n", wmm.COFName, wmm.Epoch,
-		wmm.ValidDate.Month(), wmm.ValidDate.Day(), wmm.ValidDate.Year())
+	if outFormat!="text" && outFormat!="json" && outFormat!="csv" && outFormat!="tsv" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format %s, must be text, json, csv or tsv\n", outFormat)
+		return
+	}
+	if outFormat=="text" {
+		fmt.Printf("COF File: %v, Epoch: %v, Valid Date: %d/%d/%d\n", wmm.COFName, wmm.Epoch,
+			wmm.ValidDate.Month(), wmm.ValidDate.Day(), wmm.ValidDate.Year())
+	}
 
 	if flag.NArg() == 0 {
-		userInput()
+		latitude, longitude, altitude, hae = parsing.PromptPoint()
+		dYear = parsing.PromptTime()
 	} else if flag.NArg() == 4 {
 		if latitude, err = parsing.ParseLatLng(flag.Arg(0)); err!=nil {
 			_, _ = fmt.Fprintln(os.Stderr, err)
@@ -158,8 +181,22 @@ func main() {
 			_, _ = fmt.Fprintln(os.Stderr, err)
 			return
 		}
+	} else if flag.NArg() == 3 {
+		if latitude, longitude, err = parsing.ParseGridRef(flag.Arg(0)); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if altitude, hae, err = parsing.ParseAltitude(flag.Arg(1)); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if dYear, err = parsing.ParseTime(flag.Arg(2)); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return
+		}
 	} else {
-		_, _ = fmt.Fprintf(os.Stderr, "You must specify a latitude, longitude, altitude and date in that order")
+		_, _ = fmt.Fprintf(os.Stderr, "You must specify a latitude, longitude, altitude and date in that order, " +
+			"or a grid reference, altitude and date")
 		return
 	}
 	for longitude < 0 {
@@ -183,6 +220,16 @@ func main() {
 		wmm.DecimalYear(dYear).ToTime(),
 		)
 
+	if outFormat!="text" {
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
+		if err = format.Write(os.Stdout, outFormat, format.NewRecord(mf, dYear, spherical)); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
 	fmt.Println("Results For")
 	fmt.Println()
 	lat, lng, hh := loc.Geodetic()
@@ -202,6 +249,13 @@ func main() {
 	}
 	fmt.Printf("Longitude:\t%4.2f%s\n", quantity, qualifier)
 
+	if c, errGrid := utm.NewCoord(loc); errGrid==nil {
+		fmt.Printf("UTM/UPS:\t%s\n", c)
+	}
+	if ref, errGrid := utm.MGRS(loc, 5); errGrid==nil {
+		fmt.Printf("MGRS:\t\t%s\n", ref)
+	}
+
 	relationship := "above"
 	quantity = hh
 	qualifier = "the WGS-84 ellipsoid"
@@ -249,73 +303,9 @@ func main() {
 		fmt.Printf("Incl =    %3.0fº %2.0f' ± %2.0f'         %4.1f'/yr\n", iD, iM+iS/60, mf.ErrI()*60, mf.DI()*60)
 		fmt.Println()
 		fmt.Printf("Grid Variation =  %2.0fº %2.0f'\n", gvD, gvM+gvS/60)
-	}
-}
-
-func userInput() {
-	var (
-		input string
-		err   error
-	)
-
-	err = fmt.Errorf("")
-	for err!=nil {
-		input = readUserInput(prompt["latitude"])
-		if input == "q" {
-			fmt.Println("Goodbye")
-			os.Exit(1)
-		}
-		latitude, err = parsing.ParseLatLng(input)
-		if err!=nil {
-			fmt.Println(err)
+		if gv, errGrid := utm.GridVariation(mf.D(), loc); errGrid==nil {
+			gvD, gvM, gvS = egm96.DegreesToDMS(gv)
+			fmt.Printf("UTM/UPS Grid Variation =  %2.0fº %2.0f'\n", gvD, gvM+gvS/60)
 		}
 	}
-
-	err = fmt.Errorf("")
-	for err!=nil {
-		input = readUserInput(prompt["longitude"])
-		if input == "q" {
-			fmt.Println("Goodbye")
-			os.Exit(1)
-		}
-		longitude, err = parsing.ParseLatLng(input)
-		if err!=nil {
-			fmt.Println(err)
-		}
-	}
-
-	err = fmt.Errorf("")
-	for err!=nil {
-		input = readUserInput(prompt["altitude"])
-		if input == "q" {
-			fmt.Println("Goodbye")
-			os.Exit(1)
-		}
-		altitude, hae, err = parsing.ParseAltitude(input)
-		if err!=nil {
-			fmt.Println(err)
-		}
-	}
-
-	err = fmt.Errorf("")
-	for err!=nil {
-		input = readUserInput(prompt["date"])
-		if input == "q" {
-			fmt.Println("Goodbye")
-			os.Exit(1)
-		}
-		dYear, err = parsing.ParseTime(input)
-		if err!=nil {
-			fmt.Println(err)
-		}
-	}
-
-}
-
-func readUserInput(prompt string) (inp string) {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(prompt)
-	inp, _ = reader.ReadString('\n')
-	inp = strings.TrimSpace(inp)
-	return inp
 }
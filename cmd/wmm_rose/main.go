@@ -0,0 +1,144 @@
+// wmm_rose draws a compass rose as printed on nautical and aeronautical charts,
+// as an SVG document, for a location and date.
+//
+// Usage is
+//  wmm_rose --cof_file=WMM2020.COF --date=2024.0 --size=600 --points -o rose.svg [latitude] [longitude] [altitude]
+//  wmm_rose --cof_file=WMM2020.COF --date=2024.0 --size=600 --points -o rose.svg [grid reference] [altitude]
+//
+// The location and optional altitude are given as for wmm_point; the altitude
+// defaults to mean sea level and the date to today.
+//
+// The outer ring of the rose is graduated in degrees true, with a star at true
+// north.  The inner ring is graduated in degrees magnetic and turned by the
+// declination, with an arrow at magnetic north, and with --points a ring of
+// compass points is drawn inside it.  Across the center the variation and its
+// annual change are written in degrees and minutes in the style of the charts, for example
+//  VAR 5°30'W (2024) ANNUAL DECREASE 8'
+// where the change is an increase or decrease of the size of the variation.
+// The annotation is also written to standard error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_rose --cof_file=WMM2020.COF --date=2024.0 --size=600 --points -o rose.svg [latitude] [longitude] [altitude]\n" +
+		"wmm_rose --cof_file=WMM2020.COF --date=2024.0 --size=600 --points -o rose.svg [grid reference] [altitude]"
+	cofUsage    = "COF coefficients file to use, empty for the built-in one"
+	dateUsage   = "Date of the variation, as a decimal year or MM/DD/YYYY; empty for today"
+	sizeUsage   = "Width and height of the rose in pixels"
+	pointsUsage = "Draw a ring of compass points inside the magnetic ring"
+	outputUsage = "Output file, empty for standard output"
+)
+
+var (
+	cofFile    string
+	date       string
+	size       float64
+	points     bool
+	outputFile string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.Float64Var(&size, "size", 600, sizeUsage)
+	flag.BoolVar(&points, "points", false, pointsUsage)
+	flag.StringVar(&outputFile, "output", "", outputUsage)
+	flag.StringVar(&outputFile, "o", "", outputUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if cofFile!="" {
+		if err := wmm.LoadWMMCOF(cofFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var (
+		lat, lng, alt float64
+		hae           bool
+		err           error
+	)
+	switch flag.NArg() {
+	case 2, 3:
+		if lat, err = parsing.ParseLatLng(flag.Arg(0)); err==nil {
+			if lng, err = parsing.ParseLatLng(flag.Arg(1)); err==nil && flag.NArg()==3 {
+				alt, hae, err = parsing.ParseAltitude(flag.Arg(2))
+			}
+		}
+		if err!=nil && flag.NArg()==2 {
+			// A grid reference and altitude
+			if lat, lng, err = parsing.ParseGridRef(flag.Arg(0)); err==nil {
+				alt, hae, err = parsing.ParseAltitude(flag.Arg(1))
+			}
+		}
+	case 1:
+		lat, lng, err = parsing.ParseGridRef(flag.Arg(0))
+	default:
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err==nil && (size<100 || size>10000) {
+		err = fmt.Errorf("size %v must be between 100 and 10000 pixels", size)
+	}
+	t := time.Now().UTC()
+	if err==nil && date!="" {
+		var dYear float64
+		if dYear, err = parsing.ParseTime(date); err==nil {
+			t = wmm.DecimalYear(dYear).ToTime()
+		}
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for lng<0 {
+		lng += 360
+	}
+	for lng>=360 {
+		lng -= 360
+	}
+	var loc egm96.Location
+	if hae {
+		loc = egm96.NewLocationGeodetic(lat, lng, alt*1000)
+	} else if loc, err = egm96.NewLocationMSL(lat, lng, alt*1000); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	mf, err := wmm.CalculateWMMMagneticField(loc, t)
+	if err!=nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+
+	r := &rose{d: mf.D(), dd: mf.DD(), year: t.Year(), size: size, points: points,
+		title: fmt.Sprintf("Compass rose at %.4f, %.4f on %s", lat, lng, t.Format("2006-01-02"))}
+	_, _ = fmt.Fprintln(os.Stderr, r.annotation())
+
+	out := os.Stdout
+	if outputFile!="" {
+		if out, err = os.Create(outputFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if err = r.write(out); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
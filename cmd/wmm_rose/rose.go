@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// rose is a compass rose for a location and date.
+type rose struct {
+	d, dd  float64 // Declination, degrees, and its annual change, degrees/year
+	year   int     // Year of the variation
+	size   float64 // Width and height of the drawing, pixels
+	points bool    // Draw a ring of compass points inside the magnetic ring
+	title  string  // Description of the location and date, for the document title
+}
+
+// degreesMinutes returns a positive angle in degrees rounded to whole degrees
+// and minutes, carrying 60 minutes into the degrees.
+func degreesMinutes(a float64) (d, m int) {
+	dd, mm, ss := egm96.DegreesToDMS(math.Abs(a))
+	d, m = int(dd), int(math.Round(mm+ss/60))
+	if m == 60 {
+		d, m = d+1, 0
+	}
+	return d, m
+}
+
+// annotation returns the chart annotation of the variation and its annual change,
+// such as VAR 5°30'W (2024) ANNUAL DECREASE 8'.
+// The change is an increase or decrease of the size of the variation, or for a
+// variation of 0°00' a change east or west.
+func (r *rose) annotation() string {
+	d, m := degreesMinutes(r.d)
+	v := fmt.Sprintf("VAR %d°%02d'", d, m)
+	if d != 0 || m != 0 {
+		v += map[bool]string{true: "E", false: "W"}[r.d > 0]
+	}
+	v += fmt.Sprintf(" (%d)", r.year)
+
+	cd, cm := degreesMinutes(r.dd)
+	change := fmt.Sprintf("%d'", cm)
+	if cd > 0 {
+		change = fmt.Sprintf("%d°%02d'", cd, cm)
+	}
+	switch {
+	case cd == 0 && cm == 0:
+		return v + " ANNUAL CHANGE 0'"
+	case d == 0 && m == 0:
+		return v + " ANNUAL CHANGE " + change + map[bool]string{true: "E", false: "W"}[r.dd > 0]
+	case (r.dd > 0) == (r.d > 0):
+		return v + " ANNUAL INCREASE " + change
+	}
+	return v + " ANNUAL DECREASE " + change
+}
+
+// ring draws the ticks and labels of a ring of bearings between radii r0 and r1 about the center c:
+// a tick every minor degrees, longer ones every mid and major degrees, and a label every label degrees.
+func ring(w io.Writer, c, r0, r1, minor, mid, major, label, fontSize float64, names map[int]string) {
+	var b strings.Builder
+	for a := 0.0; a < 360-1e-9; a += minor {
+		l := 0.2
+		if math.Mod(a+1e-9, major) < 1e-6 {
+			l = 0.55
+		} else if math.Mod(a+1e-9, mid) < 1e-6 {
+			l = 0.35
+		}
+		s, co := math.Sincos(a * egm96.Deg)
+		fmt.Fprintf(&b, "M%.2f,%.2fL%.2f,%.2f", c+r1*s, c-r1*co, c+(r1-l*(r1-r0))*s, c-(r1-l*(r1-r0))*co)
+	}
+	fmt.Fprintf(w, "<path class=\"tick\" d=\"%s\"/>\n", b.String())
+	fmt.Fprintf(w, "<circle class=\"ring\" cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"/>\n<circle class=\"ring\" cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"/>\n",
+		c, c, r0, c, c, r1)
+	for a := 0.0; a < 360-1e-9; a += label {
+		text, ok := names[int(math.Round(a))]
+		if names == nil {
+			text, ok = fmt.Sprintf("%.0f", a), true
+		}
+		if !ok {
+			continue
+		}
+		// Labels are written upright at the top and turn with the ring, as on charts
+		fmt.Fprintf(w, "<text class=\"label\" x=\"%.2f\" y=\"%.2f\" font-size=\"%.1f\" transform=\"rotate(%.0f %.2f %.2f)\">%s</text>\n",
+			c, c-r0-0.05*(r1-r0), fontSize, a, c, c, text)
+	}
+}
+
+// compassPoints are the names of the principal points of the compass, by bearing.
+var compassPoints = map[int]string{0: "N", 45: "NE", 90: "E", 135: "SE", 180: "S", 225: "SW", 270: "W", 315: "NW"}
+
+// write draws the compass rose as an SVG document.
+func (r *rose) write(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	s := r.size
+	c := s / 2
+	rTrue0, rTrue1 := 0.37*s, 0.44*s
+	rMag0, rMag1 := 0.28*s, 0.35*s
+	rPts0, rPts1 := 0.21*s, 0.26*s
+
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">
+<title>%s</title>
+<style>
+.ring { fill: none; stroke: #7a1f5c; stroke-width: 1; }
+.tick { fill: none; stroke: #7a1f5c; stroke-width: 0.8; }
+.label { fill: #7a1f5c; font-family: Helvetica, Arial, sans-serif; text-anchor: middle; }
+.annotation { fill: #7a1f5c; font-family: Helvetica, Arial, sans-serif; font-weight: bold; text-anchor: middle; }
+.north { fill: #7a1f5c; }
+</style>
+`, s, s, s, s, html.EscapeString(r.title+": "+r.annotation()))
+
+	// The true ring, with a star at true north
+	ring(w, c, rTrue0, rTrue1, 1, 5, 10, 10, 0.025*s, nil)
+	var star strings.Builder
+	for i := 0; i < 10; i++ {
+		rad := 0.022 * s
+		if i%2 == 1 {
+			rad *= 0.4
+		}
+		sn, co := math.Sincos(float64(i) * 36 * egm96.Deg)
+		star.WriteString(fmt.Sprintf("%.2f,%.2f ", c+rad*sn, c-rTrue1-0.025*s-rad*co))
+	}
+	fmt.Fprintf(w, "<polygon class=\"north\" points=\"%s\"/>\n", strings.TrimSpace(star.String()))
+
+	// The magnetic ring, turned by the declination, with an arrow at magnetic north
+	fmt.Fprintf(w, "<g class=\"magnetic\" transform=\"rotate(%.4f %.2f %.2f)\">\n", r.d, c, c)
+	ring(w, c, rMag0, rMag1, 1, 5, 10, 30, 0.022*s, nil)
+	a := 0.015 * s
+	fmt.Fprintf(w, "<polygon class=\"north\" points=\"%.2f,%.2f %.2f,%.2f %.2f,%.2f\"/>\n",
+		c, c-rMag1, c-a, c-rMag1+2.2*a, c+a, c-rMag1+2.2*a)
+	if r.points {
+		ring(w, c, rPts0, rPts1, 11.25, 22.5, 45, 45, 0.022*s, compassPoints)
+	}
+	w.WriteString("</g>\n")
+
+	// The annotation across the center, on a line each for the variation and its change
+	text := r.annotation()
+	i := strings.Index(text, " ANNUAL")
+	fs := 0.028 * s
+	fmt.Fprintf(w, "<text class=\"annotation\" font-size=\"%.1f\"><tspan x=\"%.2f\" y=\"%.2f\">%s</tspan>"+
+		"<tspan x=\"%.2f\" y=\"%.2f\">%s</tspan></text>\n</svg>\n",
+		fs, c, c-0.4*fs, html.EscapeString(text[:i]), c, c+1.2*fs, html.EscapeString(text[i+1:]))
+	return w.Flush()
+}
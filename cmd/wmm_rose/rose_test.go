@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+func TestAnnotation(t *testing.T) {
+	for _, c := range []struct {
+		d, dd    float64
+		expected string
+	}{
+		{-5.5, 8.0 / 60, "VAR 5°30'W (2024) ANNUAL DECREASE 8'"},
+		{-5.5, -8.0 / 60, "VAR 5°30'W (2024) ANNUAL INCREASE 8'"},
+		{14.25, 3.0 / 60, "VAR 14°15'E (2024) ANNUAL INCREASE 3'"},
+		{14.25, -0.2, "VAR 14°15'E (2024) ANNUAL DECREASE 12'"},
+		{-5.9999, 0.001, "VAR 6°00'W (2024) ANNUAL CHANGE 0'"},
+		{0.004, -0.1, "VAR 0°00' (2024) ANNUAL CHANGE 6'W"},
+		{-0.004, 0.1, "VAR 0°00' (2024) ANNUAL CHANGE 6'E"},
+		{100.1, 1.1, "VAR 100°06'E (2024) ANNUAL INCREASE 1°06'"},
+	} {
+		r := &rose{d: c.d, dd: c.dd, year: 2024}
+		if a := r.annotation(); a != c.expected {
+			t.Errorf("expected %q for %v, %v, got %q", c.expected, c.d, c.dd, a)
+		}
+	}
+}
+
+func TestRose(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	// Boulder, Colorado, where the easterly variation is decreasing
+	loc, _ := egm96.NewLocationMSL(40.015, 360-105.27, 1655)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := &rose{d: mf.D(), dd: mf.DD(), year: 2022, size: 600, points: true, title: "Boulder"}
+	if a := r.annotation(); a != "VAR 8°02'E (2022) ANNUAL DECREASE 6'" {
+		t.Errorf("unexpected annotation for Boulder: %s", a)
+	}
+
+	var b bytes.Buffer
+	if err := r.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		texts    []string
+		rotation float64
+		nPoints  int
+	)
+	d := xml.NewDecoder(&b)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %s", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			for _, a := range tok.Attr {
+				if tok.Name.Local == "g" && a.Name.Local == "transform" {
+					rotation, _ = strconv.ParseFloat(strings.Fields(strings.TrimPrefix(a.Value, "rotate("))[0], 64)
+				}
+			}
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				texts = append(texts, s)
+				if compassPoints[45] == s || compassPoints[0] == s {
+					nPoints++
+				}
+			}
+		}
+	}
+	testDiff("magnetic ring rotation", rotation, mf.D(), 1e-4, t)
+	if nPoints != 2 {
+		t.Errorf("expected the N and NE points, got %d", nPoints)
+	}
+	// 36 true labels, 12 magnetic labels, 8 points, the title, the style sheet and the two annotation lines
+	if len(texts) != 36+12+8+4 {
+		t.Errorf("expected %d texts, got %d", 36+12+8+4, len(texts))
+	}
+	if joined := strings.Join(texts[len(texts)-2:], " "); joined != r.annotation() {
+		t.Errorf("expected the annotation %q, got %q", r.annotation(), joined)
+	}
+}
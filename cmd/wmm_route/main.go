@@ -0,0 +1,143 @@
+// wmm_route calculates the true and magnetic courses of each leg of a route
+// and the magnetic declination along it, for flight and voyage planning.
+//
+// Usage is
+//  wmm_route --cof_file=WMM2020.COF --date=2024.0 --spacing=50 --units=nm --format=text --profile -o route.txt [route file]
+//
+// The route is read from the file, or standard input if none is given, as
+// waypoints, one per line:
+//  latitude longitude altitude [time] [name]
+// The latitude, longitude and altitude are given as for wmm_point, and the
+// planned time as RFC 3339 (2024-05-01T12:30:00Z), a decimal year or MM/DD/YYYY.
+// A waypoint without a time is reached at the time of the previous one, and
+// the first at the date given, or now.  Lines starting with # are skipped.
+//
+// For each leg the distance, the initial and final true courses and the
+// magnetic courses at those times and places are reported, along with the
+// least and greatest declination along the geodesic between the waypoints
+// and their difference, the greatest change of declination on the leg.
+// The declination is sampled every spacing distance units along the leg and
+// at its end, at times and altitudes interpolated by distance; with --profile
+// the samples are also listed.  With --format=json the legs and their
+// profiles are written as a JSON array.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage        = "wmm_route --cof_file=WMM2020.COF --date=2024.0 --spacing=50 --units=nm --format=text --profile -o route.txt [route file]"
+	cofUsage     = "COF coefficients file to use, empty for the built-in one"
+	dateUsage    = "Date of waypoints without a time, as a decimal year or MM/DD/YYYY; empty for now"
+	spacingUsage = "Distance between declination samples along each leg, in the distance units"
+	unitsUsage   = "Distance units, nm (nautical miles), km or mi (statute miles)"
+	formatUsage  = "Output format, text or json"
+	profileUsage = "List the declination samples in the text output"
+	outputUsage  = "Output file, empty for standard output"
+)
+
+// units are the lengths of the distance units, in meters.
+var units = map[string]float64{"nm": 1852, "km": 1000, "mi": 1609.344}
+
+var (
+	cofFile    string
+	date       string
+	spacing    float64
+	unitName   string
+	format     string
+	profile    bool
+	outputFile string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.Float64Var(&spacing, "spacing", 50, spacingUsage)
+	flag.StringVar(&unitName, "units", "nm", unitsUsage)
+	flag.StringVar(&format, "format", "text", formatUsage)
+	flag.BoolVar(&profile, "profile", false, profileUsage)
+	flag.StringVar(&outputFile, "output", "", outputUsage)
+	flag.StringVar(&outputFile, "o", "", outputUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if cofFile!="" {
+		if err := wmm.LoadWMMCOF(cofFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	unit, ok := units[unitName]
+	if !ok || spacing<=0 || (format!="text" && format!="json") || flag.NArg()>1 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	t := time.Now().UTC()
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		t = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg()==1 {
+		f, err := os.Open(flag.Arg(0))
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	wps, err := parseRoute(in, t)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	legs, warning, err := planRoute(wps, spacing*unit, unit)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if warning!=nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	out := os.Stdout
+	if outputFile!="" {
+		if out, err = os.Create(outputFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if format=="json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(legs)
+	} else {
+		err = writeText(out, legs, unitName, profile)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/geodesic"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// waypoint is a point of the route.
+type waypoint struct {
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  float64   `json:"altitude"` // km, above mean sea level or the ellipsoid if hae
+	Time      time.Time `json:"time"`
+	hae       bool
+}
+
+// sample is a point along a leg at which the declination is calculated.
+type sample struct {
+	Distance    float64   `json:"distance"` // From the start of the route
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Time        time.Time `json:"time"`
+	Declination float64   `json:"declination"`
+}
+
+// leg is the courses and declination profile between two waypoints.
+type leg struct {
+	From                  string   `json:"from"`
+	To                    string   `json:"to"`
+	Distance              float64  `json:"distance"`
+	InitialTrueCourse     float64  `json:"initial_true_course"`
+	FinalTrueCourse       float64  `json:"final_true_course"`
+	InitialMagneticCourse float64  `json:"initial_magnetic_course"`
+	FinalMagneticCourse   float64  `json:"final_magnetic_course"`
+	MinDeclination        float64  `json:"min_declination"`
+	MaxDeclination        float64  `json:"max_declination"`
+	MaxDeclinationChange  float64  `json:"max_declination_change"`
+	Profile               []sample `json:"profile"`
+}
+
+// parseRoute reads waypoints, one per line, as a latitude, longitude, altitude,
+// optional time and optional name separated by spaces, with the latitude, longitude and altitude as for wmm_point and the time as
+// RFC 3339 (2024-05-01T12:00:00Z), a decimal year or MM/DD/YYYY.  Blank lines
+// and lines starting with # are skipped.  Waypoints without a time are given
+// the time of the previous waypoint, or t for those before any timed waypoint.
+func parseRoute(r io.Reader, t time.Time) (wps []waypoint, err error) {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected latitude, longitude and altitude", n)
+		}
+		wp := waypoint{Name: fmt.Sprintf("WP%d", len(wps)+1), Time: t}
+		if wp.Latitude, err = parsing.ParseLatLng(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if wp.Latitude < -90 || wp.Latitude > 90 {
+			return nil, fmt.Errorf("line %d: latitude %s is outside the range -90 to 90", n, fields[0])
+		}
+		if wp.Longitude, err = parsing.ParseLatLng(fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if wp.Longitude < -180 || wp.Longitude >= 360 {
+			return nil, fmt.Errorf("line %d: longitude %s is outside the range -180 to 360", n, fields[1])
+		}
+		if wp.Altitude, wp.hae, err = parsing.ParseAltitude(fields[2]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if len(wps) > 0 {
+			wp.Time = wps[len(wps)-1].Time
+		}
+		rest := fields[3:]
+		if len(rest) > 0 {
+			if ts, ok := parseWaypointTime(rest[0]); ok {
+				wp.Time, rest = ts, rest[1:]
+			}
+		}
+		if len(wps) > 0 && wp.Time.Before(wps[len(wps)-1].Time) {
+			return nil, fmt.Errorf("line %d: time %s is before the previous waypoint", n, wp.Time.Format(time.RFC3339))
+		}
+		if len(rest) > 0 {
+			wp.Name = strings.Join(rest, " ")
+		}
+		wps = append(wps, wp)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(wps) < 2 {
+		return nil, fmt.Errorf("a route needs at least two waypoints")
+	}
+	return wps, nil
+}
+
+// parseWaypointTime parses a waypoint time, reporting whether it is one.
+func parseWaypointTime(s string) (t time.Time, ok bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	if strings.Count(s, "/") == 2 || strings.Count(s, ".") == 1 {
+		if dYear, err := parsing.ParseTime(s); err == nil && dYear > 1000 && dYear < 3000 {
+			return wmm.DecimalYear(dYear).ToTime(), true
+		}
+	}
+	return t, false
+}
+
+// course returns a course in degrees in the range 0 to 360.
+func course(c float64) float64 {
+	c = math.Mod(c, 360)
+	if c < 0 {
+		c += 360
+	}
+	return c
+}
+
+// planRoute calculates the legs of the route with the declination every spacing
+// meters along each leg, and at its ends.  Positions between waypoints follow
+// the geodesic, and times and heights above the ellipsoid are interpolated by distance.
+// Distances are returned in meters divided by unit.
+// The first warning for a time outside the validity of the model is returned with the legs,
+// and an error for a point whose height above mean sea level cannot be converted.
+func planRoute(wps []waypoint, spacing, unit float64) (legs []leg, warning, err error) {
+	var total float64
+	for i := 1; i < len(wps); i++ {
+		a, b := wps[i-1], wps[i]
+		la, err := parsing.NewLocation(a.Latitude, a.Longitude, a.Altitude*1000, a.hae)
+		if err != nil {
+			return nil, warning, err
+		}
+		lb, err := parsing.NewLocation(b.Latitude, b.Longitude, b.Altitude*1000, b.hae)
+		if err != nil {
+			return nil, warning, err
+		}
+		s12, azi1, azi2 := geodesic.Inverse(la, lb)
+		// The waypoint altitudes may be above different references
+		_, _, ha := la.Geodetic()
+		_, _, hb := lb.Geodetic()
+		l := leg{From: a.Name, To: b.Name, Distance: s12 / unit, InitialTrueCourse: course(azi1), FinalTrueCourse: course(azi2),
+			MinDeclination: math.Inf(1), MaxDeclination: math.Inf(-1)}
+
+		n := int(math.Ceil(s12/spacing - 1e-9))
+		if n < 1 {
+			n = 1
+		}
+		for k := 0; k <= n; k++ {
+			s := math.Min(float64(k)*spacing, s12)
+			f := 0.0
+			if s12 > 0 {
+				f = s / s12
+			}
+			p, _ := geodesic.Direct(la, azi1, s)
+			lat, lng, _ := p.Geodetic()
+			lat, lng = lat/egm96.Deg, lookup.AngleDiff(lng/egm96.Deg, 0)
+			t := a.Time.Add(time.Duration(f * float64(b.Time.Sub(a.Time))))
+			loc, _ := parsing.NewLocation(lat, lng, ha+f*(hb-ha), true)
+			mf, err := wmm.CalculateWMMMagneticField(loc, t)
+			if err != nil && warning == nil {
+				warning = err
+			}
+			d := mf.D()
+			l.Profile = append(l.Profile, sample{Distance: (total + s) / unit, Latitude: lat, Longitude: lng, Time: t, Declination: d})
+			l.MinDeclination, l.MaxDeclination = math.Min(l.MinDeclination, d), math.Max(l.MaxDeclination, d)
+		}
+		l.InitialMagneticCourse = course(l.InitialTrueCourse - l.Profile[0].Declination)
+		l.FinalMagneticCourse = course(l.FinalTrueCourse - l.Profile[len(l.Profile)-1].Declination)
+		l.MaxDeclinationChange = l.MaxDeclination - l.MinDeclination
+		legs = append(legs, l)
+		total += s12
+	}
+	return legs, warning, nil
+}
+
+// writeText writes a table of the legs, followed by the declination profile if profile is set.
+func writeText(w io.Writer, legs []leg, units string, profile bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-10s %-10s %9s %6s %6s %6s %6s %7s %7s %6s\n", "From", "To", "Dist("+units+")",
+		"TC1", "TC2", "MC1", "MC2", "Dmin", "Dmax", "dD")
+	for _, l := range legs {
+		fmt.Fprintf(bw, "%-10s %-10s %9.1f %6.1f %6.1f %6.1f %6.1f %7.2f %7.2f %6.2f\n", l.From, l.To, l.Distance,
+			l.InitialTrueCourse, l.FinalTrueCourse, l.InitialMagneticCourse, l.FinalMagneticCourse,
+			l.MinDeclination, l.MaxDeclination, l.MaxDeclinationChange)
+	}
+	if profile {
+		fmt.Fprintf(bw, "\n%-10s %9s %9s %10s %-20s %7s\n", "Leg", "Dist("+units+")", "Lat", "Lng", "Time", "D")
+		for _, l := range legs {
+			for _, s := range l.Profile {
+				fmt.Fprintf(bw, "%-10s %9.1f %9.4f %10.4f %-20s %7.2f\n", l.From, s.Distance, s.Latitude, s.Longitude,
+					s.Time.Format(time.RFC3339), s.Declination)
+			}
+		}
+	}
+	return bw.Flush()
+}
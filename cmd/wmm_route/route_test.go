@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+var testDate = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestParseRoute(t *testing.T) {
+	wps, err := parseRoute(strings.NewReader(`# Denver to Boston
+39.8617 -104.6731 5431ft 2022-03-01T14:00:00Z KDEN
+41.9786 -87.9048 0.2 Chicago O'Hare
+
+42.3656 -71.0096 0 2022-03-01T19:30:00Z
+`), testDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wps) != 3 {
+		t.Fatalf("expected 3 waypoints, got %d", len(wps))
+	}
+	for i, name := range []string{"KDEN", "Chicago O'Hare", "WP3"} {
+		if wps[i].Name != name {
+			t.Errorf("expected waypoint %d to be %s, got %s", i, name, wps[i].Name)
+		}
+	}
+	testDiff("altitude in feet", wps[0].Altitude, 5431*0.3048/1000, 1e-9, t)
+	if !wps[1].Time.Equal(wps[0].Time) {
+		t.Errorf("expected an untimed waypoint to take the previous time, got %s", wps[1].Time)
+	}
+	if !wps[2].Time.Equal(time.Date(2022, 3, 1, 19, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %s", wps[2].Time)
+	}
+
+	wps, _ = parseRoute(strings.NewReader("10 20 0 2021.5\n11 20 0\n"), testDate)
+	testDiff("decimal year", float64(wmm.TimeToDecimalYears(wps[1].Time)), 2021.5, 1e-6, t)
+	wps, _ = parseRoute(strings.NewReader("10 20 0\n11 20 0\n"), testDate)
+	if !wps[0].Time.Equal(testDate) {
+		t.Errorf("expected the default date, got %s", wps[0].Time)
+	}
+
+	for _, bad := range []string{
+		"10 20 0\n",
+		"10 20\n11 20 0\n",
+		"100 20 0\n11 20 0\n",
+		"10 -200 0\n11 20 0\n",
+		"10 360 0\n11 20 0\n",
+		"10 20 0 2022-03-01T14:00:00Z\n11 20 0 2022-03-01T13:00:00Z\n",
+	} {
+		if _, err = parseRoute(strings.NewReader(bad), testDate); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestPlanRoute(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	t1 := testDate.Add(2 * time.Hour)
+	wps := []waypoint{
+		{Name: "A", Latitude: 40, Longitude: -100, Time: testDate},
+		{Name: "B", Latitude: 45, Longitude: -100, Time: t1},
+		{Name: "C", Latitude: 45, Longitude: -80, Time: t1},
+	}
+	legs, warning, err := planRoute(wps, 100*1852, 1852)
+	if err != nil || warning != nil {
+		t.Fatalf("unexpected errors %v, %v", err, warning)
+	}
+	if len(legs) != 2 {
+		t.Fatalf("expected 2 legs, got %d", len(legs))
+	}
+
+	// Due north along a meridian
+	l := legs[0]
+	testDiff("meridian distance", l.Distance, 299.8, 0.2, t)
+	testDiff("meridian initial true course", l.InitialTrueCourse, 0, 1e-6, t)
+	testDiff("meridian final true course", l.FinalTrueCourse, 0, 1e-6, t)
+	if len(l.Profile) != 4 {
+		t.Errorf("expected samples every 100nm and at the end, got %d", len(l.Profile))
+	}
+	loc, _ := egm96.NewLocationMSL(45, 260, 0)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, t1)
+	end := l.Profile[len(l.Profile)-1]
+	testDiff("declination at the end", end.Declination, mf.D(), 1e-6, t)
+	testDiff("final magnetic course", l.FinalMagneticCourse, 360-mf.D(), 1e-6, t)
+	testDiff("distance at the end", end.Distance, l.Distance, 1e-6, t)
+	mid := l.Profile[len(l.Profile)/2]
+	testDiff("interpolated time", mid.Time.Sub(testDate).Hours(), 2*mid.Distance/l.Distance, 1e-6, t)
+	testDiff("declination change", l.MaxDeclinationChange, l.MaxDeclination-l.MinDeclination, 0, t)
+
+	// Eastward along a parallel, the great circle bends north of it and turns south
+	l = legs[1]
+	if l.InitialTrueCourse > 90 || l.FinalTrueCourse < 90 {
+		t.Errorf("expected the courses to turn through east, got %.2f and %.2f", l.InitialTrueCourse, l.FinalTrueCourse)
+	}
+	testDiff("start of second leg", l.Profile[0].Distance, legs[0].Distance, 1e-6, t)
+	// The declination goes from about +7 in the west to about -7 in the east
+	if l.MaxDeclinationChange < 10 {
+		t.Errorf("expected a large change of declination, got %.2f", l.MaxDeclinationChange)
+	}
+	testDiff("initial magnetic course", l.InitialMagneticCourse,
+		math.Mod(l.InitialTrueCourse-l.Profile[0].Declination+360, 360), 1e-9, t)
+
+	var b bytes.Buffer
+	if err = writeText(&b, legs, "nm", true); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 1+2+2+len(legs[0].Profile)+len(legs[1].Profile) {
+		t.Errorf("unexpected text output:\n%s", b.String())
+	}
+	js, _ := json.Marshal(legs)
+	var decoded []map[string]interface{}
+	if err = json.Unmarshal(js, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded[0]["max_declination_change"]; !ok {
+		t.Errorf("expected max_declination_change in the JSON, got %s", js)
+	}
+}
+
+func TestPlanRouteWarning(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	// A route flown after the end of the model is still planned, with a warning
+	late := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	wps := []waypoint{
+		{Name: "A", Latitude: 40, Longitude: -100, Time: late},
+		{Name: "B", Latitude: 45, Longitude: -100, Time: late.Add(2 * time.Hour)},
+	}
+	legs, warning, err := planRoute(wps, 100*1852, 1852)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning == nil || !strings.Contains(warning.Error(), "outside of validity period") {
+		t.Errorf("expected a warning for a route outside the model, got %v", warning)
+	}
+	if len(legs) != 1 || len(legs[0].Profile) != 4 {
+		t.Fatalf("expected the leg to be planned regardless, got %+v", legs)
+	}
+
+	// A route starting before the model and ending within it
+	wps[0].Time, wps[1].Time = time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC), testDate
+	if _, warning, _ = planRoute(wps, 100*1852, 1852); warning == nil {
+		t.Error("expected a warning for a route starting before the model")
+	}
+	wps[0].Time = testDate
+	if _, warning, _ = planRoute(wps, 100*1852, 1852); warning != nil {
+		t.Errorf("unexpected warning %s", warning)
+	}
+
+	// A height above mean sea level that cannot be converted is an error
+	wps[1].Latitude = 95
+	if _, _, err = planRoute(wps, 100*1852, 1852); err == nil {
+		t.Error("expected an error for a point beyond the pole")
+	}
+}
+
+func TestPlanRouteReferences(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	// Altitudes above mean sea level and the ellipsoid are interpolated above the ellipsoid
+	wps := []waypoint{
+		{Name: "A", Latitude: 40, Longitude: -100, Altitude: 10, Time: testDate},
+		{Name: "B", Latitude: 45, Longitude: -100, Altitude: 0, Time: testDate, hae: true},
+	}
+	legs, _, err := planRoute(wps, 100*1852, 1852)
+	if err != nil {
+		t.Fatal(err)
+	}
+	la, _ := egm96.NewLocationMSL(40, 260, 10000)
+	_, _, ha := la.Geodetic()
+	p := legs[0].Profile[1]
+	f := p.Distance / legs[0].Distance
+	mf, _ := wmm.CalculateWMMMagneticField(egm96.NewLocationGeodetic(p.Latitude, p.Longitude+360, ha*(1-f)), p.Time)
+	testDiff("declination between references", p.Declination, mf.D(), 1e-9, t)
+}
@@ -0,0 +1,151 @@
+// wmm_runway checks the magnetic alignment of runways and navaids and
+// forecasts when runways must be renumbered and navaids realigned as the
+// magnetic declination drifts.
+//
+// Usage is
+//  wmm_runway --cof_file=WMM2020.COF,WMM2025.COF --date=2024.0 --horizon=20 --runway_threshold=5 \
+//    --navaid_threshold=1 --format=text [input file]
+//
+// The sites are read from the input file, or standard input if none is given,
+// one per line as
+//  runway id latitude longitude altitude true-heading [designator]
+//  navaid id latitude longitude altitude station-declination
+// with the position given as for wmm_point.  A runway's designator is its
+// published number with any L, C or R suffix, such as 16L, and defaults to the
+// one nearest its current magnetic heading.  A navaid's station declination is
+// the declination it was aligned to, in degrees east, or with an E or W prefix
+// or suffix such as 11E.  Blank lines and lines starting with # are skipped.
+//
+// For each site the declination D and its annual change dD at the date are
+// reported with its alignment error: for a runway its magnetic heading less
+// ten times its designator, and for a navaid its station declination less D.
+// The forecast steps monthly through the horizon and reports the first date
+// at which the size of the error exceeds the threshold, with the designator
+// the runway should then be given.  Several comma-separated coefficients files
+// may be given, and each date uses the latest model valid by then, so that the
+// forecast carries on with the next model as each expires.  Dates beyond the
+// last model are extrapolated with its secular variation, with a warning.
+//
+// The text output has a line per site with the columns
+//  Type ID Lat Lng Ref D dD MH Des Error Limit Crossing Next Model
+// and --format=json, csv or tsv writes the same values with the column names
+//  type id latitude longitude reference d dd magnetic_heading designator error
+//  threshold crossing crossing_date next_designator model
+// where the crossing is a decimal year and values that do not apply are empty.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/westphae/geomag/internal/format"
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_runway --cof_file=WMM2020.COF,WMM2025.COF --date=2024.0 --horizon=20 --runway_threshold=5 " +
+		"--navaid_threshold=1 --format=text [input file]"
+	cofUsage = "Comma-separated COF coefficients files to use in turn, empty for the built-in one"
+	dateUsage = "Date of the current alignment and start of the forecast, as a decimal year or MM/DD/YYYY; empty for today"
+	horizonUsage = "Number of years to forecast"
+	runwayUsage = "Largest difference in degrees between a runway's magnetic heading and its designator before it is renumbered"
+	navaidUsage = "Largest difference in degrees between a navaid's station declination and the declination before it is realigned"
+	formatUsage = "Output format: text, json, csv or tsv"
+	step = 1.0/12 // Forecast step, years
+)
+
+var (
+	cofFiles        string
+	date            string
+	horizon         float64
+	runwayThreshold float64
+	navaidThreshold float64
+	outFormat       string
+)
+
+func init() {
+	flag.StringVar(&cofFiles, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFiles, "c", "", cofUsage)
+
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.Float64Var(&horizon, "horizon", 20, horizonUsage)
+	flag.Float64Var(&runwayThreshold, "runway_threshold", 5, runwayUsage)
+	flag.Float64Var(&navaidThreshold, "navaid_threshold", 1, navaidUsage)
+
+	flag.StringVar(&outFormat, "format", "text", formatUsage)
+	flag.StringVar(&outFormat, "f", "text", formatUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg()>1 || horizon<=0 || horizon>100 || runwayThreshold<=0 || navaidThreshold<=0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if outFormat!="text" && outFormat!="json" && outFormat!="csv" && outFormat!="tsv" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format %s, must be text, json, csv or tsv\n", outFormat)
+		os.Exit(2)
+	}
+	t := time.Now().UTC()
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		t = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	models, err := loadModels(strings.Split(cofFiles, ","))
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg()==1 && flag.Arg(0)!="-" {
+		f, err := os.Open(flag.Arg(0))
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	sites, err := parseSites(in, runwayThreshold, navaidThreshold)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	results, warning, err := forecast(sites, models, t, horizon, step)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if warning!=nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if outFormat=="text" {
+		err = writeText(w, results)
+	} else {
+		rows := make([][]interface{}, len(results))
+		for i, r := range results {
+			rows[i] = r.values()
+		}
+		err = format.WriteTable(w, outFormat, columns, rows...)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	_ = w.Flush()
+}
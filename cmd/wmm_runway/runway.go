@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// site is a runway or navaid whose magnetic alignment is checked.
+type site struct {
+	runway        bool    // A runway rather than a navaid
+	id            string  // Identifier, such as KDEN-16L or DEN
+	lat, lng, alt float64 // Position in degrees and altitude in km
+	hae           bool    // The altitude is above the ellipsoid rather than mean sea level
+	value         float64 // True heading of a runway or published station declination of a navaid, degrees
+	designator    int     // Published runway designator 1 to 36, or 0 to use the current one
+	suffix        string  // Runway designator suffix: L, C, R or empty
+	threshold     float64 // Largest alignment error allowed before renumbering or realigning, degrees
+}
+
+// parseSites reads runways and navaids, one per line, as
+//
+//	runway id latitude longitude altitude true-heading [designator]
+//	navaid id latitude longitude altitude station-declination
+//
+// with the position as for wmm_point.  The designator is the published runway
+// number with any L, C or R suffix, such as 16L.  The station declination is
+// in degrees, east positive, or with an E or W prefix or suffix, such as 11E.
+// Blank lines and lines starting with # are skipped.  Runways are allowed an
+// alignment error of runwayThreshold and navaids of navaidThreshold degrees.
+func parseSites(r io.Reader, runwayThreshold, navaidThreshold float64) (sites []site, err error) {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		var s site
+		switch strings.ToLower(fields[0]) {
+		case "runway":
+			s.runway, s.threshold = true, runwayThreshold
+			if len(fields) != 6 && len(fields) != 7 {
+				return nil, fmt.Errorf("line %d: expected runway id latitude longitude altitude true-heading [designator]", n)
+			}
+		case "navaid":
+			s.threshold = navaidThreshold
+			if len(fields) != 6 {
+				return nil, fmt.Errorf("line %d: expected navaid id latitude longitude altitude station-declination", n)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown site type %s, must be runway or navaid", n, fields[0])
+		}
+		s.id = fields[1]
+		if s.lat, err = parsing.ParseLatLng(fields[2]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if s.lng, err = parsing.ParseLatLng(fields[3]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if s.lat < -90 || s.lat > 90 || s.lng < -180 || s.lng >= 360 {
+			return nil, fmt.Errorf("line %d: invalid position %s %s", n, fields[2], fields[3])
+		}
+		if s.alt, s.hae, err = parsing.ParseAltitude(fields[4]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if s.runway {
+			if s.value, err = strconv.ParseFloat(fields[5], 64); err != nil || s.value < 0 || s.value > 360 {
+				return nil, fmt.Errorf("line %d: invalid true heading %s", n, fields[5])
+			}
+			if len(fields) == 7 {
+				if s.designator, s.suffix, err = parseDesignator(fields[6]); err != nil {
+					return nil, fmt.Errorf("line %d: %s", n, err)
+				}
+			}
+		} else {
+			if s.value, err = parseDeclination(fields[5]); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+		}
+		sites = append(sites, s)
+	}
+	return sites, scanner.Err()
+}
+
+// parseDesignator parses a runway designator such as 09, 16L or 36C.
+func parseDesignator(s string) (n int, suffix string, err error) {
+	num := strings.TrimRight(strings.ToUpper(s), "LCR")
+	if len(s)-len(num) > 1 {
+		return 0, "", fmt.Errorf("invalid runway designator %s", s)
+	}
+	if n, err = strconv.Atoi(num); err != nil || n < 1 || n > 36 {
+		return 0, "", fmt.Errorf("invalid runway designator %s", s)
+	}
+	return n, strings.ToUpper(s[len(num):]), nil
+}
+
+// parseDeclination parses a declination in degrees such as -3.5, W3.5 or 3.5W.
+func parseDeclination(s string) (d float64, err error) {
+	if i := len(s) - 1; i > 0 && strings.ContainsAny(s[i:], "EWew") {
+		s = strings.ToUpper(s[i:]) + s[:i]
+	}
+	if d, err = parsing.ParseLatLng(strings.ToUpper(s[:1]) + s[1:]); err != nil || strings.ContainsAny(s[:1], "NS") {
+		return 0, fmt.Errorf("invalid station declination %s", s)
+	}
+	return d, nil
+}
+
+// location returns the location of the site.
+func (s site) location() (egm96.Location, error) {
+	return parsing.NewLocation(s.lat, s.lng, s.alt*1000, s.hae)
+}
+
+// alignment returns the alignment error of the site in degrees where the
+// declination is d: the magnetic heading of a runway less its designator
+// heading, or the station declination of a navaid less the declination.
+func (s site) alignment(designator int, d float64) float64 {
+	if s.runway {
+		return lookup.AngleDiff(s.value-d, float64(designator*10))
+	}
+	return lookup.AngleDiff(s.value, d)
+}
+
+// designatorFor returns the runway designator for a magnetic heading, from 1 to 36.
+func designatorFor(heading float64) int {
+	n := int(math.Round(course(heading)/10)) % 36
+	if n == 0 {
+		n = 36
+	}
+	return n
+}
+
+// model is a coefficients file and the period it is used for.
+type model struct {
+	file  string    // COF file name, empty for the built-in one
+	name  string    // Model name from the file header, such as WMM-2020
+	valid time.Time // Beginning of the validity period
+	end   time.Time // End of the validity period, five years after the epoch
+}
+
+// loadModels loads each of the coefficients files in turn and returns them in
+// order of their validity periods.  An empty file name is the built-in model.
+func loadModels(files []string) (models []model, err error) {
+	for _, fn := range files {
+		if err = wmm.LoadWMMCOF(fn); err != nil {
+			return nil, err
+		}
+		models = append(models, model{file: fn, name: wmm.COFName, valid: wmm.ValidDate,
+			end: wmm.DecimalYear(wmm.Epoch + 5).ToTime()})
+	}
+	sort.SliceStable(models, func(i, j int) bool { return models[i].valid.Before(models[j].valid) })
+	return models, nil
+}
+
+// result is the current alignment of a site and its forecast.
+type result struct {
+	site
+	d, dd      float64 // Declination and its annual change at the date, degrees
+	heading    float64 // Magnetic heading of a runway, degrees
+	designator int     // Published or current designator of a runway
+	error      float64 // Alignment error at the date, degrees
+	crossing   float64 // Decimal year the alignment error first exceeds the threshold, NaN if not within the horizon
+	next       int     // Designator of a runway after the crossing
+	model      string  // Model used at the crossing, or at the date if there is none
+}
+
+// forecast calculates the alignment of each site at t0 and the first date
+// within horizon years at which its alignment error exceeds its threshold,
+// checking every step years and interpolating between them.  Each date uses
+// the latest of the models valid by then, so that a forecast carries on with
+// the next model once the current one expires.  The models are loaded in turn.
+// The warning reports dates outside the validity periods of the models, and
+// the error a model that could not be loaded.
+func forecast(sites []site, models []model, t0 time.Time, horizon, step float64) (results []result, warning, err error) {
+	y0 := float64(wmm.TimeToDecimalYears(t0))
+	ts := make([]time.Time, int(horizon/step+1e-9)+1)
+	use := make([]int, len(ts)) // The model used for each date
+	for k := range ts {
+		ts[k] = wmm.DecimalYear(y0 + float64(k)*step).ToTime()
+		for i, m := range models {
+			if i == 0 || !ts[k].Before(m.valid) {
+				use[k] = i
+			}
+		}
+	}
+	if last := models[len(models)-1]; ts[len(ts)-1].After(last.end) {
+		warning = fmt.Errorf("dates after %s are beyond the validity period of %s and are extrapolated",
+			last.end.Format("2006-01-02"), last.name)
+	}
+	if t0.Before(models[0].valid) {
+		warning = fmt.Errorf("date %s is before the validity period of %s", t0.Format("2006-01-02"), models[0].name)
+	}
+
+	d := make([][]float64, len(sites))
+	for i := range d {
+		d[i] = make([]float64, len(ts))
+	}
+	results = make([]result, len(sites))
+	for mi, m := range models {
+		var ks []int
+		var mts []time.Time
+		for k := range ts {
+			if use[k] == mi {
+				ks, mts = append(ks, k), append(mts, ts[k])
+			}
+		}
+		if len(ks) == 0 {
+			continue
+		}
+		if err = wmm.LoadWMMCOF(m.file); err != nil {
+			return nil, warning, err
+		}
+		for i, s := range sites {
+			loc, err := s.location()
+			if err != nil {
+				return nil, warning, fmt.Errorf("%s: %v", s.id, err)
+			}
+			fields, _ := wmm.CalculateWMMMagneticFieldSeries(loc, mts)
+			for j, k := range ks {
+				d[i][k] = fields[j].D()
+				if k == 0 {
+					results[i].dd = fields[j].DD()
+				}
+			}
+		}
+	}
+
+	for i, s := range sites {
+		r := &results[i]
+		r.site, r.d, r.crossing, r.model = s, d[i][0], math.NaN(), models[use[0]].name
+		if s.runway {
+			r.heading = course(s.value - r.d)
+			r.designator = s.designator
+			if r.designator == 0 {
+				r.designator = designatorFor(r.heading)
+			}
+		}
+		r.error = s.alignment(r.designator, r.d)
+		prev := r.error
+		for k := range ts {
+			e := s.alignment(r.designator, d[i][k])
+			if math.Abs(e) > s.threshold {
+				r.crossing, r.model = y0, models[use[k]].name
+				if k > 0 {
+					limit := math.Copysign(s.threshold, e)
+					r.crossing += (float64(k-1) + (limit-prev)/(e-prev)) * step
+				}
+				if s.runway {
+					r.next = (r.designator+int(math.Copysign(1, e))+35)%36 + 1
+				}
+				break
+			}
+			prev = e
+		}
+	}
+	return results, warning, nil
+}
+
+// course returns a course in degrees in the range 0 to 360.
+func course(c float64) float64 {
+	c = math.Mod(c, 360)
+	if c < 0 {
+		c += 360
+	}
+	return c
+}
+
+// columns are the names of the values of a result written in JSON, CSV and TSV.
+var columns = []string{"type", "id", "latitude", "longitude", "reference", "d", "dd", "magnetic_heading",
+	"designator", "error", "threshold", "crossing", "crossing_date", "next_designator", "model"}
+
+// values returns the values of the columns of the result.  Values that do not
+// apply to the site, or a crossing beyond the horizon, are empty.
+func (r result) values() []interface{} {
+	kind, heading, designator, next := "navaid", interface{}(""), "", ""
+	if r.runway {
+		kind, heading, designator = "runway", r.heading, formatDesignator(r.designator, r.suffix)
+		if r.next > 0 {
+			next = formatDesignator(r.next, r.suffix)
+		}
+	}
+	var crossing, date interface{} = "", ""
+	if !math.IsNaN(r.crossing) {
+		crossing, date = r.crossing, wmm.DecimalYear(r.crossing).ToTime().Format("2006-01-02")
+	}
+	return []interface{}{kind, r.id, r.lat, r.lng, r.value, r.d, r.dd, heading,
+		designator, r.error, r.threshold, crossing, date, next, r.model}
+}
+
+// formatDesignator returns a runway designator such as 09 or 16L.
+func formatDesignator(n int, suffix string) string {
+	return fmt.Sprintf("%02d%s", n, suffix)
+}
+
+// writeText writes a table of the results.
+func writeText(w io.Writer, results []result) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-6s %-10s %9s %10s %7s %7s %6s %6s %4s %6s %5s %-10s %4s  %s\n", "Type", "ID", "Lat", "Lng",
+		"Ref", "D", "dD", "MH", "Des", "Error", "Limit", "Crossing", "Next", "Model")
+	for _, r := range results {
+		vals, heading := r.values(), ""
+		if r.runway {
+			heading = fmt.Sprintf("%.1f", r.heading)
+		}
+		fmt.Fprintf(bw, "%-6s %-10s %9.4f %10.4f %7.2f %7.2f %6.2f %6s %4s %6.2f %5.1f %-10s %4s  %s\n",
+			vals[0], r.id, r.lat, r.lng, r.value, r.d, r.dd, heading, vals[8], r.error, r.threshold, vals[12], vals[13], r.model)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+const (
+	cof2015 = "../../pkg/wmm/testdata/WMM2015v1.COF"
+	cof2020 = "../../pkg/wmm/testdata/WMM2020.COF"
+)
+
+// declination returns the declination at the site at the decimal year y with the coefficients file.
+func declination(t *testing.T, fn string, s site, y float64) float64 {
+	if err := wmm.LoadWMMCOF(fn); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := s.location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, _ := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(y).ToTime())
+	return mf.D()
+}
+
+func TestParseSites(t *testing.T) {
+	sites, err := parseSites(strings.NewReader(`# Denver
+runway KDEN-16L 39.8617 -104.6731 5431ft 173.4 16L
+RUNWAY KDEN-34R 39.8617 -104.6731 5431ft 353.4
+
+navaid DEN 39.8123 -104.6608 5431ft 11E
+navaid XYZ 10 20 0 W3.5
+`), 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 4 {
+		t.Fatalf("expected 4 sites, got %d", len(sites))
+	}
+	if !sites[0].runway || sites[0].designator != 16 || sites[0].suffix != "L" || sites[0].threshold != 5 {
+		t.Errorf("unexpected runway %+v", sites[0])
+	}
+	if sites[1].designator != 0 || sites[1].id != "KDEN-34R" {
+		t.Errorf("expected no designator, got %+v", sites[1])
+	}
+	if sites[2].runway || sites[2].threshold != 1 {
+		t.Errorf("unexpected navaid %+v", sites[2])
+	}
+	testDiff("east declination", sites[2].value, 11, 0, t)
+	testDiff("west declination", sites[3].value, -3.5, 0, t)
+
+	for _, bad := range []string{
+		"runway X 10 20 0\n",
+		"runway X 10 20 0 400\n",
+		"runway X 10 20 0 90 37\n",
+		"runway X 10 20 0 90 09LR\n",
+		"navaid X 10 20 0 N3\n",
+		"navaid X 100 20 0 3\n",
+		"ndb X 10 20 0 3\n",
+	} {
+		if _, err = parseSites(strings.NewReader(bad), 5, 1); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestDesignators(t *testing.T) {
+	for heading, expected := range map[float64]int{354.9: 35, 355: 36, 4.9: 36, 5: 1, -10: 35, 184.9: 18, 185: 19} {
+		if n := designatorFor(heading); n != expected {
+			t.Errorf("expected designator %d for %v, got %d", expected, heading, n)
+		}
+	}
+	if s := formatDesignator(9, "R"); s != "09R" {
+		t.Errorf("expected 09R, got %s", s)
+	}
+}
+
+func TestForecast(t *testing.T) {
+	models, err := loadModels([]string{cof2020, cof2015})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if models[0].name != "WMM-2015" || models[1].name != "WMM-2020" {
+		t.Fatalf("expected the models in order of validity, got %v", models)
+	}
+
+	// Near Denver the easterly declination decreases by about 0.1 degree a year,
+	// turning the magnetic headings of runways clockwise
+	const y0 = 2018.0
+	rwy := site{runway: true, id: "RWY", lat: 39.86, lng: -104.67, designator: 17, threshold: 5}
+	rwy.value = 175 - 0.3 + declination(t, cof2015, rwy, y0)
+	nav := site{id: "NAV", lat: 39.86, lng: -104.67, threshold: 1}
+	nav.value = declination(t, cof2015, nav, y0) + 0.95
+	west := site{runway: true, id: "WEST", lat: 39.86, lng: -104.67, value: 270, suffix: "L", threshold: 5}
+
+	results, warning, err := forecast([]site{rwy, nav, west}, models, wmm.DecimalYear(y0).ToTime(), 6, step)
+	if err != nil || warning != nil {
+		t.Fatalf("unexpected errors %v, %v", err, warning)
+	}
+
+	r := results[0]
+	testDiff("runway magnetic heading", r.heading, 174.7, 1e-6, t)
+	testDiff("runway alignment error", r.error, 4.7, 1e-6, t)
+	if r.dd > -0.05 {
+		t.Errorf("expected a decreasing declination, got %.3f", r.dd)
+	}
+	if r.crossing < 2019.95 || r.next != 18 || r.model != "WMM-2020" {
+		t.Errorf("expected renumbering to 18 with WMM-2020, got %v, %d, %s", r.crossing, r.next, r.model)
+	}
+	// The heading is ten degrees from the designator plus the threshold at the crossing
+	testDiff("runway heading at crossing", course(rwy.value-declination(t, cof2020, rwy, r.crossing)), 175, 0.002, t)
+
+	r = results[1]
+	testDiff("navaid alignment error", r.error, 0.95, 1e-6, t)
+	if r.crossing > 2019.95 || r.model != "WMM-2015" {
+		t.Errorf("expected realignment with WMM-2015, got %v, %s", r.crossing, r.model)
+	}
+	testDiff("navaid error at crossing", nav.value-declination(t, cof2015, nav, r.crossing), 1, 0.002, t)
+
+	r = results[2]
+	if r.designator != designatorFor(270-r.d) || !math.IsNaN(r.crossing) || r.next != 0 {
+		t.Errorf("expected the current designator and no crossing, got %+v", r)
+	}
+
+	if _, warning, err = forecast([]site{rwy}, models, wmm.DecimalYear(y0).ToTime(), 20, step); err != nil || warning == nil {
+		t.Errorf("expected a warning for dates beyond the last model, got %v, %v", err, warning)
+	}
+	if _, warning, err = forecast([]site{rwy}, models, time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), 1, step); err != nil || warning == nil {
+		t.Errorf("expected a warning for dates before the first model, got %v, %v", err, warning)
+	}
+
+	// A model that can no longer be loaded is an error, not a warning
+	missing := []model{models[0], models[1]}
+	missing[1].file = "missing.COF"
+	if _, warning, err = forecast([]site{rwy}, missing, wmm.DecimalYear(y0).ToTime(), 6, step); err == nil || warning != nil {
+		t.Errorf("expected an error for a missing model, got %v, %v", err, warning)
+	}
+
+	vals := results[0].values()
+	if len(vals) != len(columns) {
+		t.Fatalf("expected %d values, got %d", len(columns), len(vals))
+	}
+	if vals[8] != "17" || vals[13] != "18" {
+		t.Errorf("expected designators 17 and 18, got %v and %v", vals[8], vals[13])
+	}
+	if vals = results[2].values(); vals[11] != "" || vals[12] != "" || vals[13] != "" || vals[8] != formatDesignator(results[2].designator, "L") {
+		t.Errorf("expected no crossing, got %v", vals)
+	}
+	var b bytes.Buffer
+	if err = writeText(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[1], " 18 ") {
+		t.Errorf("unexpected text output:\n%s", b.String())
+	}
+}
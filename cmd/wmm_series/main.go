@@ -0,0 +1,284 @@
+// wmm_series estimates the strength and direction of Earth's main Magnetic field
+// at a single location over a span of dates, for example to follow how the
+// declination and its rate of change evolve over the life of a model.
+//
+// Usage is
+//  wmm_series --cof_file=WMM2020.COF --spherical --format=text --start=[date] --end=[date] --step=1m \
+//    [latitude] [longitude] [altitude]
+//  wmm_series --cof_file=WMM2020.COF --spherical --format=text --start=[date] --end=[date] --step=1m \
+//    [grid reference] [altitude]
+//
+// The location and altitude are given as for wmm_point, and any not given on
+// the command line are prompted for.  The start and end dates are decimal years
+// or calendar dates MM/DD/YYYY, and default to the beginning and end of the
+// validity period of the model.  The step is a number of months, days or years
+// such as 1m, 14d or 1y, which step through the calendar, or a decimal number
+// of years such as 0.25.  The default is monthly.  For example
+//  wmm_series --start=2021 --end=2023 --step=3m 30 -88.51 0.01
+// computes the field every three months during 2021 and 2022.
+//
+// The spherical harmonic terms of the model are evaluated only once at the
+// location, and the field at each date is extrapolated from them with the
+// secular variation, as the WMM prescribes.
+//
+// The text output has a line per date with the columns
+//  Date Year D dD I dI H dH F dF GV
+// with angles in degrees, field strengths in nT and secular changes per year.
+// GV is the grid variation from the grid north of the UTM zone, or of the UPS
+// grid in the polar regions, at the location.
+// With --format=json, csv or tsv every component, secular change and
+// uncertainty is written for each date as for wmm_point.
+// Dates outside the validity of the model are computed anyway, with a warning
+// on standard error.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/westphae/geomag/internal/format"
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/utm"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_series --cof_file=WMM2020.COF --spherical --format=text --start=[date] --end=[date] --step=1m " +
+		"[latitude] [longitude] [altitude]\n" +
+		"wmm_series --cof_file=WMM2020.COF --spherical --format=text --start=[date] --end=[date] --step=1m " +
+		"[grid reference] [altitude]"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	sphericalUsage = "Output spherical values of X, Y and Z instead of ellipsoidal"
+	formatUsage = "Output format: text, json, csv or tsv"
+	startUsage = "First date as a decimal year or MM/DD/YYYY, empty for the start of the model validity"
+	endUsage = "Last date as a decimal year or MM/DD/YYYY, empty for the end of the model validity"
+	stepUsage = "Step between dates, as months (1m), days (14d), years (1y) or decimal years (0.25)"
+	maxDates = 100000
+)
+
+var (
+	cofFile   string
+	spherical bool
+	outFormat string
+	startDate string
+	endDate   string
+	step      string
+	latitude  float64
+	longitude float64
+	altitude  float64
+	hae       bool
+	ErrHelp   error
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.BoolVar(&spherical, "spherical", false, sphericalUsage)
+	flag.BoolVar(&spherical, "s", false, sphericalUsage)
+
+	flag.StringVar(&outFormat, "format", "text", formatUsage)
+	flag.StringVar(&outFormat, "f", "text", formatUsage)
+
+	flag.StringVar(&startDate, "start", "", startUsage)
+	flag.StringVar(&endDate, "end", "", endUsage)
+	flag.StringVar(&step, "step", "1m", stepUsage)
+
+	ErrHelp = errors.New(usage)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if outFormat!="text" && outFormat!="json" && outFormat!="csv" && outFormat!="tsv" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format %s, must be text, json, csv or tsv\n", outFormat)
+		os.Exit(2)
+	}
+
+	ts, err := seriesDates(startDate, endDate, step)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	switch flag.NArg() {
+	case 0:
+		latitude, longitude, altitude, hae = parsing.PromptPoint()
+	case 3:
+		if latitude, err = parsing.ParseLatLng(flag.Arg(0)); err==nil {
+			if longitude, err = parsing.ParseLatLng(flag.Arg(1)); err==nil {
+				altitude, hae, err = parsing.ParseAltitude(flag.Arg(2))
+			}
+		}
+	case 2:
+		if latitude, longitude, err = parsing.ParseGridRef(flag.Arg(0)); err==nil {
+			altitude, hae, err = parsing.ParseAltitude(flag.Arg(1))
+		}
+	default:
+		err = ErrHelp
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if latitude < -90 || latitude > 90 {
+		_, _ = fmt.Fprintf(os.Stderr, "latitude %v is outside the range -90 to 90\n", latitude)
+		os.Exit(2)
+	}
+	for longitude<0 {
+		longitude += 360
+	}
+	if longitude>=360 {
+		_, _ = fmt.Fprintf(os.Stderr, "longitude %v is outside the range -180 to 360\n", longitude)
+		os.Exit(2)
+	}
+
+	var loc egm96.Location
+	if hae {
+		loc = egm96.NewLocationGeodetic(latitude, longitude, altitude*1000)
+	} else if loc, err = egm96.NewLocationMSL(latitude, longitude, altitude*1000); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fields, err := wmm.CalculateWMMMagneticFieldSeries(loc, ts)
+	if err!=nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if outFormat=="text" {
+		writeText(w, ts, fields)
+	} else {
+		records := make([]format.Record, len(ts))
+		for i, t := range ts {
+			records[i] = format.NewRecord(fields[i], float64(wmm.TimeToDecimalYears(t)), spherical)
+		}
+		if err = format.Write(w, outFormat, records...); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	_ = w.Flush()
+}
+
+// seriesDates returns the dates from start to end inclusive in steps of step.
+// Empty start and end dates default to the validity period of the loaded model.
+// The dates given are rounded to the second, so that calendar dates are not
+// moved to the day before by the rounding of decimal years.
+func seriesDates(start, end, step string) (ts []time.Time, err error) {
+	t0, t1 := wmm.ValidDate, wmm.DecimalYear(wmm.Epoch+5).ToTime()
+	if start!="" {
+		dYear, err := parsing.ParseTime(start)
+		if err!=nil {
+			return nil, fmt.Errorf("invalid start date %s", start)
+		}
+		t0 = wmm.DecimalYear(dYear).ToTime().Round(time.Second)
+	}
+	if end!="" {
+		dYear, err := parsing.ParseTime(end)
+		if err!=nil {
+			return nil, fmt.Errorf("invalid end date %s", end)
+		}
+		t1 = wmm.DecimalYear(dYear).ToTime().Round(time.Second)
+	}
+	if t1.Before(t0) {
+		return nil, fmt.Errorf("end date %s is before start date %s", end, start)
+	}
+
+	next, err := stepper(t0, step)
+	if err!=nil {
+		return nil, err
+	}
+	for k := 0; ; k++ {
+		t := next(k)
+		if t.After(t1) {
+			break
+		}
+		if k>=maxDates {
+			return nil, fmt.Errorf("too many dates, at most %d are allowed", maxDates)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// stepper returns a function giving the k'th date after t0 in steps of step.
+// Calendar steps are counted from t0 rather than accumulated, so that monthly
+// and yearly steps stay on the same day of the month, or the last day of
+// shorter months.
+func stepper(t0 time.Time, step string) (next func(k int) time.Time, err error) {
+	step = strings.ToLower(strings.TrimSpace(step))
+	if step=="" {
+		return nil, fmt.Errorf("a step is required")
+	}
+	if unit := step[len(step)-1]; unit=='y' || unit=='m' || unit=='d' {
+		n, err := strconv.Atoi(step[:len(step)-1])
+		if err!=nil || n<=0 {
+			return nil, fmt.Errorf("invalid step %s, must be a positive whole number of months, days or years", step)
+		}
+		if unit=='d' {
+			return func(k int) time.Time { return t0.AddDate(0, 0, k*n) }, nil
+		}
+		months := n
+		if unit=='y' {
+			months = 12*n
+		}
+		y, m, d := t0.Date()
+		return func(k int) time.Time {
+			first := time.Date(y, m+time.Month(k*months), 1,
+				t0.Hour(), t0.Minute(), t0.Second(), t0.Nanosecond(), t0.Location())
+			if last := first.AddDate(0, 1, -1).Day(); d>last {
+				return first.AddDate(0, 0, last-1)
+			}
+			return first.AddDate(0, 0, d-1)
+		}, nil
+	}
+	dy, err := strconv.ParseFloat(step, 64)
+	if err!=nil {
+		return nil, fmt.Errorf("invalid step %s, must be like 1m, 14d, 1y or 0.25", step)
+	}
+	if dy<=0 {
+		return nil, fmt.Errorf("step %s must be positive", step)
+	}
+	y0 := wmm.TimeToDecimalYears(t0)
+	return func(k int) time.Time {
+		if k==0 {
+			return t0
+		}
+		return (y0 + wmm.DecimalYear(float64(k)*dy)).ToTime()
+	}, nil
+}
+
+// writeText writes a header and a line per date to w.
+func writeText(w io.Writer, ts []time.Time, fields []wmm.MagneticField) {
+	fmt.Fprintf(w, "COF File: %v, Epoch: %v, Valid Date: %d/%d/%d\n", wmm.COFName, wmm.Epoch,
+		wmm.ValidDate.Month(), wmm.ValidDate.Day(), wmm.ValidDate.Year())
+	fmt.Fprintf(w, "%10s %9s %8s %8s %8s %8s %9s %8s %9s %8s %8s\n",
+		"Date", "Year", "D", "dD", "I", "dI", "H", "dH", "F", "dF", "GV")
+	for i, t := range ts {
+		mf := fields[i]
+		gv, err := utm.GridVariation(mf.D(), mf.Location())
+		if err!=nil {
+			gv = math.NaN()
+		}
+		fmt.Fprintf(w, "%10s %9.4f %8.3f %8.3f %8.3f %8.3f %9.1f %8.1f %9.1f %8.1f %8.3f\n",
+			t.Format("2006-01-02"), wmm.TimeToDecimalYears(t), mf.D(), mf.DD(), mf.I(), mf.DI(),
+			mf.H(), mf.DH(), mf.F(), mf.DF(), gv)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+// checkDates checks that the dates of ts, to the nearest second, are expected.
+func checkDates(name string, ts []time.Time, expected []string, t *testing.T) {
+	var actual []string
+	for _, tm := range ts {
+		actual = append(actual, tm.Round(time.Second).Format("2006-01-02"))
+	}
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("%s: expected %v, got %v", name, expected, actual)
+	}
+}
+
+func TestSeriesDates(t *testing.T) {
+	for _, tt := range []struct {
+		start, end, step string
+		expected         []string
+	}{
+		{"01/01/2021", "07/01/2021", "1m", []string{"2021-01-01", "2021-02-01", "2021-03-01",
+			"2021-04-01", "2021-05-01", "2021-06-01", "2021-07-01"}},
+		{"01/01/2021", "02/01/2021", "14d", []string{"2021-01-01", "2021-01-15", "2021-01-29"}},
+		{"2020", "2023.5", "1Y", []string{"2020-01-01", "2021-01-01", "2022-01-01", "2023-01-01"}},
+		{"03/15/2021", "03/15/2021", "3m", []string{"2021-03-15"}},
+		// Monthly steps from the end of a month stay at the end of shorter months
+		{"01/31/2021", "06/30/2021", "1m", []string{"2021-01-31", "2021-02-28", "2021-03-31",
+			"2021-04-30", "2021-05-31", "2021-06-30"}},
+		{"10/31/2020", "05/01/2021", " 2m ", []string{"2020-10-31", "2020-12-31", "2021-02-28", "2021-04-30"}},
+		{"02/29/2020", "03/01/2024", "2y", []string{"2020-02-29", "2022-02-28", "2024-02-29"}},
+	} {
+		ts, err := seriesDates(tt.start, tt.end, tt.step)
+		if err != nil {
+			t.Errorf("%s to %s by %s: %v", tt.start, tt.end, tt.step, err)
+			continue
+		}
+		checkDates(tt.start+" to "+tt.end+" by "+tt.step, ts, tt.expected, t)
+	}
+
+	// Decimal year steps
+	ts, err := seriesDates("2020", "2021", "0.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 5 {
+		t.Fatalf("expected 5 dates, got %v", ts)
+	}
+	for i, tm := range ts {
+		testDiff("decimal year", float64(wmm.TimeToDecimalYears(tm)), 2020+0.25*float64(i), 1e-6, t)
+	}
+
+	for _, bad := range [][3]string{
+		{"2022", "2021", "1m"},
+		{"2020", "2400", "1d"},
+		{"20x0", "2021", "1m"},
+		{"2020", "2021", ""},
+		{"2020", "2021", "0m"},
+		{"2020", "2021", "-1d"},
+		{"2020", "2021", "1.5m"},
+		{"2020", "2021", "0"},
+		{"2020", "2021", "1w"},
+	} {
+		if _, err = seriesDates(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("expected an error for %s to %s by %s", bad[0], bad[1], bad[2])
+		}
+	}
+	if _, err = seriesDates("2020", "2400", "1d"); err == nil || !strings.Contains(err.Error(), "too many dates") {
+		t.Errorf("expected too many dates, got %v", err)
+	}
+	last := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, maxDates-1).Format("01/02/2006")
+	if ts, err = seriesDates("01/01/2020", last, "1d"); err != nil || len(ts) != maxDates {
+		t.Errorf("expected exactly %d dates to be allowed, got %d, %v", maxDates, len(ts), err)
+	}
+}
+
+func TestSeriesDatesDefault(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = wmm.LoadWMMCOF("") }()
+
+	// The dates default to the validity period of the model
+	ts, err := seriesDates("", "", "1y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDates("default", ts, []string{"2019-12-10", "2020-12-10", "2021-12-10", "2022-12-10",
+		"2023-12-10", "2024-12-10"}, t)
+	if !ts[0].Equal(wmm.ValidDate) {
+		t.Errorf("expected the dates to start at %v, got %v", wmm.ValidDate, ts[0])
+	}
+	end := wmm.DecimalYear(wmm.Epoch + 5).ToTime()
+	if ts[len(ts)-1].After(end) {
+		t.Errorf("expected the dates to end by %v, got %v", end, ts[len(ts)-1])
+	}
+}
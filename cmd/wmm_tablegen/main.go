@@ -0,0 +1,316 @@
+// wmm_tablegen generates compact integer tables of the declination, inclination
+// and total intensity of the World Magnetic Model, as a C header or Go source,
+// for firmware such as autopilots that cannot evaluate the full model.
+//
+// Usage is
+//  wmm_tablegen --cof_file=WMM2020.COF --lang=c --res=10 --date=2022.5 \
+//    --angle_scale=0.01 --strength_scale=10 --prefix=geomag --output=geomag_tables.h
+//
+// The tables cover the whole globe at mean sea level, at the given resolution in
+// degrees, which must divide 90, for the given date (a decimal year or MM/DD/YYYY,
+// default today).  Values are stored as int16 multiples of the scale factors:
+// angle_scale degrees for the declination and inclination, and strength_scale nT
+// for the total intensity.
+//
+// The generated code includes a bilinear interpolating lookup function for each
+// table, and a self-check function that compares the lookups with full model
+// values at reference points embedded in the code and reports the worst-case
+// errors.  The C header declares everything static inline, with names starting
+// with the prefix:
+//  float geomag_declination(float lat, float lon);   // degrees
+//  float geomag_inclination(float lat, float lon);   // degrees
+//  float geomag_strength(float lat, float lon);      // nT
+//  int geomag_self_check(float *declination_error, float *inclination_error, float *strength_error);
+// The Go source declares the package named by --package with the functions
+//  func Declination(lat, lng float64) float64
+//  func Inclination(lat, lng float64) float64
+//  func Strength(lat, lng float64) float64
+//  func SelfCheck() (declinationError, inclinationError, strengthError float64, ok bool)
+//
+// The worst-case interpolation and rounding errors against the full model, measured
+// at random points and the center of each cell, are written to standard error
+// and recorded in a comment and constants in the generated code.  Declination
+// errors are not counted in the WMM blackout zones around the magnetic poles,
+// where the horizontal intensity is below 2000 nT.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_tablegen --cof_file=WMM2020.COF --lang=c --res=10 --date=2022.5 " +
+		"--angle_scale=0.01 --strength_scale=10 --prefix=geomag --package=geomag --output=geomag_tables.h"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	langUsage = "Language to generate, c or go"
+	resUsage = "Resolution of the tables in degrees, which must divide 90"
+	dateUsage = "Date to generate the tables for, as a decimal year or MM/DD/YYYY; empty for today"
+	angleScaleUsage = "Degrees per unit of the declination and inclination tables"
+	strengthScaleUsage = "nT per unit of the strength table"
+	prefixUsage = "Prefix of the names in the generated C header"
+	packageUsage = "Package name of the generated Go source"
+	outputUsage = "File to write the generated code to, empty for standard output"
+	checkUsage = "Number of random points at which to measure the worst-case error"
+	nReference = 32 // Number of reference points embedded for the self-check
+)
+
+var (
+	cofFile       string
+	lang          string
+	res           float64
+	date          string
+	angleScale    float64
+	strengthScale float64
+	prefix        string
+	pkg           string
+	outFile       string
+	nCheck        int
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&lang, "lang", "c", langUsage)
+	flag.Float64Var(&res, "res", 10, resUsage)
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.Float64Var(&angleScale, "angle_scale", 0.01, angleScaleUsage)
+	flag.Float64Var(&strengthScale, "strength_scale", 10, strengthScaleUsage)
+	flag.StringVar(&prefix, "prefix", "geomag", prefixUsage)
+	flag.StringVar(&pkg, "package", "geomag", packageUsage)
+	flag.StringVar(&outFile, "output", "", outputUsage)
+	flag.StringVar(&outFile, "o", "", outputUsage)
+	flag.IntVar(&nCheck, "check", 10000, checkUsage)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	if flag.NArg()!=0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if lang!="c" && lang!="go" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown language %s, must be c or go\n", lang)
+		os.Exit(2)
+	}
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	t := time.Now().UTC()
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		t = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	tb, err := newTables(res, angleScale, strengthScale, t)
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	tb.check(nCheck, rand.New(rand.NewSource(1)))
+	tb.addReferences(nReference, rand.New(rand.NewSource(2)))
+	_, _ = fmt.Fprintf(os.Stderr, "Worst-case errors: declination %.3f° at %.1f, %.1f, inclination %.3f°, strength %.1f nT\n",
+		tb.Errors.D, tb.Errors.DAt[0], tb.Errors.DAt[1], tb.Errors.I, tb.Errors.F)
+
+	out := os.Stdout
+	if outFile!="" {
+		if out, err = os.Create(outFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if lang=="c" {
+		err = tb.writeC(w, prefix)
+	} else {
+		err = tb.writeGo(w, pkg)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = w.Flush(); err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// reference is a point at which the full model values are embedded for the self-check.
+type reference struct {
+	Lat, Lng float64
+	lookup.Values
+}
+
+// tables are the integer tables of the field values and their accuracy.
+type tables struct {
+	Res, AngleScale, StrengthScale float64
+	LatDim, LngDim                 int
+	Date                           time.Time
+	Model                          string
+	D, I, F                        [][]int16
+	Errors                         lookup.Errors
+	References                     []reference
+	grid                           *lookup.Grid // The table values, for lookups as by the generated code
+}
+
+// newTables calculates the tables at resolution res degrees for time t,
+// with the values stored in units of the scales.
+func newTables(res, angleScale, strengthScale float64, t time.Time) (tb *tables, err error) {
+	if res<=0 || res>90 || math.Abs(90/res-math.Round(90/res))>1e-9 {
+		return nil, fmt.Errorf("resolution %v must divide 90", res)
+	}
+	if angleScale<=0 || strengthScale<=0 {
+		return nil, fmt.Errorf("scales must be positive")
+	}
+	g, err := lookup.Build(lookup.Global(res), t)
+	if g==nil {
+		return nil, err
+	}
+	tb = &tables{Res: res, AngleScale: angleScale, StrengthScale: strengthScale, Date: t, Model: wmm.COFName}
+	tb.LatDim, tb.LngDim = g.Size()
+	for j := 0; j<tb.LatDim; j++ {
+		var d, i, f []int16
+		for k := 0; k<tb.LngDim; k++ {
+			v := g.Node(j, k)
+			vals := make([]int16, 3)
+			for n, x := range []float64{v.D/angleScale, v.I/angleScale, v.F/strengthScale} {
+				x = math.Round(x)
+				if x<math.MinInt16 || x>math.MaxInt16 {
+					return nil, fmt.Errorf("value %v does not fit in an int16, increase the scale", x)
+				}
+				vals[n] = int16(x)
+			}
+			d, i, f = append(d, vals[0]), append(i, vals[1]), append(f, vals[2])
+		}
+		tb.D, tb.I, tb.F = append(tb.D, d), append(tb.I, i), append(tb.F, f)
+	}
+	tb.grid = g.Map(func(v lookup.Values) lookup.Values {
+		return lookup.Values{D: math.Round(v.D/angleScale)*angleScale, I: math.Round(v.I/angleScale)*angleScale,
+			F: math.Round(v.F/strengthScale)*strengthScale}
+	})
+	return tb, nil
+}
+
+// lookup returns the values interpolated from the tables at a latitude and
+// longitude in degrees, in the same way as the generated lookup functions.
+func (tb *tables) lookup(lat, lng float64) (v lookup.Values) {
+	v, _ = tb.grid.Lookup(math.Max(-90, math.Min(90, lat)), lng)
+	return v
+}
+
+// check measures the worst-case errors of the tables against the full model at
+// n random points, uniform by area, and the center of each cell.
+func (tb *tables) check(n int, r *rand.Rand) {
+	tb.Errors = tb.grid.MaxError(n, r)
+	for j := 0; j<tb.LatDim-1; j++ {
+		for k := 0; k<tb.LngDim-1; k++ {
+			tb.Errors.Add(tb.grid, -90+(float64(j)+0.5)*tb.Res, -180+(float64(k)+0.5)*tb.Res)
+		}
+	}
+}
+
+// addReferences chooses n random reference points outside the blackout zones
+// and records the full model values at them.
+func (tb *tables) addReferences(n int, r *rand.Rand) {
+	for len(tb.References)<n {
+		lat := math.Round(math.Asin(2*r.Float64()-1)/math.Pi*180*100)/100
+		lng := math.Round((-180+360*r.Float64())*100)/100
+		if m := full(lat, lng, tb.Date); m.H()>=lookup.BlackoutH {
+			tb.References = append(tb.References, reference{lat, lng, m})
+		}
+	}
+}
+
+// full returns the field values from the full model at mean sea level.
+func full(lat, lng float64, t time.Time) lookup.Values {
+	v, _ := lookup.Calculate(lat, lng, 0, t)
+	return v
+}
+
+// DecimalYear returns the date of the tables as a decimal year.
+func (tb *tables) DecimalYear() float64 {
+	return float64(wmm.TimeToDecimalYears(tb.Date))
+}
+
+// Tolerance returns the errors the self-check allows: the worst-case errors
+// plus a margin for the rounding of the reference values and float arithmetic.
+func (tb *tables) Tolerance() lookup.Values {
+	return lookup.Values{D: tb.Errors.D+0.01, I: tb.Errors.I+0.01, F: tb.Errors.F+1}
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	// cfloat formats a float constant for C, e.g. 10.0f
+	"cfloat": func(x float64) string {
+		s := strconv.FormatFloat(x, 'g', -1, 32)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s + "f"
+	},
+	"rows": func(table [][]int16, indent string) string {
+		var b strings.Builder
+		for _, row := range table {
+			b.WriteString(indent + "{")
+			for k, v := range row {
+				if k>0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprint(&b, v)
+			}
+			b.WriteString("},\n")
+		}
+		return b.String()
+	},
+}
+
+// writeC writes the tables and functions as a C header with names starting with prefix.
+func (tb *tables) writeC(w io.Writer, prefix string) error {
+	return cTemplate.Execute(w, struct {
+		*tables
+		P string
+	}{tb, prefix})
+}
+
+// writeGo writes the tables and functions as Go source in package pkg.
+func (tb *tables) writeGo(w io.Writer, pkg string) error {
+	var b strings.Builder
+	if err := goTemplate.Execute(&b, struct {
+		*tables
+		Package string
+	}{tb, pkg}); err!=nil {
+		return err
+	}
+	src, err := format.Source([]byte(b.String()))
+	if err!=nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
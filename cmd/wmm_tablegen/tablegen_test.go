@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/lookup"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+var testDate = time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestTables(t *testing.T, res float64) *tables {
+	tb, err := newTables(res, 0.01, 10, testDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.check(1000, rand.New(rand.NewSource(1)))
+	tb.addReferences(nReference, rand.New(rand.NewSource(2)))
+	t.Logf("%d degree tables: %s", int(res), tb.Errors)
+	return tb
+}
+
+func TestTables(t *testing.T) {
+	tb := newTestTables(t, 10)
+	if tb.LatDim != 19 || tb.LngDim != 37 || len(tb.D) != 19 || len(tb.D[0]) != 37 {
+		t.Errorf("expected 19x37 tables, got %dx%d", len(tb.D), len(tb.D[0]))
+	}
+	// At the nodes the lookups are the rounded full model values, held as float32
+	for _, p := range [][2]float64{{40, -100}, {-30, 150}, {0, 0}, {20, 180}} {
+		v, m := tb.lookup(p[0], p[1]), full(p[0], p[1], testDate)
+		testDiff("node D", v.D, m.D, 0.005+1e-5, t)
+		testDiff("node I", v.I, m.I, 0.005+1e-5, t)
+		testDiff("node F", v.F, m.F, 5+1e-9, t)
+	}
+	if len(tb.References) != nReference {
+		t.Errorf("expected %d reference points, got %d", nReference, len(tb.References))
+	}
+	for _, r := range tb.References {
+		v := tb.lookup(r.Lat, r.Lng)
+		if math.Abs(lookup.AngleDiff(v.D, r.D)) > tb.Errors.D+1e-6 {
+			t.Errorf("reference point %v error %v exceeds worst case %v", r, v.D-r.D, tb.Errors.D)
+		}
+	}
+
+	fine := newTestTables(t, 2)
+	if fine.Errors.D >= tb.Errors.D || fine.Errors.I >= tb.Errors.I || fine.Errors.F >= tb.Errors.F {
+		t.Errorf("finer tables should be more accurate: %s, %s", fine.Errors, tb.Errors)
+	}
+
+	for _, res := range []float64{0, 7, 100} {
+		if _, err := newTables(res, 0.01, 10, testDate); err == nil {
+			t.Errorf("expected an error for resolution %v", res)
+		}
+	}
+	if _, err := newTables(10, 0.001, 10, testDate); err == nil {
+		t.Error("expected an error for a scale too small for int16")
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	tb := newTestTables(t, 10)
+	var b bytes.Buffer
+	if err := tb.writeGo(&b, "main"); err != nil {
+		t.Fatal(err)
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir, _ := ioutil.TempDir("", "tablegen")
+	src := filepath.Join(dir, "tables.go")
+	main := filepath.Join(dir, "main.go")
+	_ = ioutil.WriteFile(src, b.Bytes(), 0644)
+	_ = ioutil.WriteFile(main, []byte(`package main
+
+import "fmt"
+
+func main() {
+	d, i, f, ok := SelfCheck()
+	fmt.Println(ok, d, i, f, Declination(40, -100))
+}
+`), 0644)
+	cmd := exec.Command(goCmd, "run", src, main)
+	cmd.Env = append(cmd.Environ(), "GO111MODULE=off")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 5 || fields[0] != "true" {
+		t.Errorf("self-check failed: %s", out)
+	}
+	t.Log(string(out))
+}
+
+func TestGenerateC(t *testing.T) {
+	tb := newTestTables(t, 10)
+	var b bytes.Buffer
+	if err := tb.writeC(&b, "geomag"); err != nil {
+		t.Fatal(err)
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not found")
+	}
+	dir, _ := ioutil.TempDir("", "tablegen")
+	_ = ioutil.WriteFile(filepath.Join(dir, "geomag_tables.h"), b.Bytes(), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "main.c"), []byte(`#include <stdio.h>
+#include "geomag_tables.h"
+
+int main(void)
+{
+	float d, i, f;
+	int ok = geomag_self_check(&d, &i, &f);
+	printf("%d %f %f %f %f\n", ok, d, i, f, geomag_declination(40.0f, -100.0f));
+	return !ok;
+}
+`), 0644)
+	exe := filepath.Join(dir, "check")
+	if out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", exe, filepath.Join(dir, "main.c"), "-lm").CombinedOutput(); err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	out, err := exec.Command(exe).CombinedOutput()
+	if err != nil {
+		t.Errorf("self-check failed: %s %s", err, out)
+	}
+	t.Log(string(out))
+}
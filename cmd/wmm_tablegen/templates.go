@@ -0,0 +1,229 @@
+package main
+
+import "text/template"
+
+var cTemplate = template.Must(template.New("c").Funcs(funcs).Parse(`// Magnetic field tables generated by wmm_tablegen from {{.Model}} for {{printf "%.3f" .DecimalYear}}
+// at {{.Res}}° resolution.  DO NOT EDIT.
+//
+// Worst-case errors against the full model: declination {{printf "%.3f" .Errors.D}}°
+// (outside the blackout zones), inclination {{printf "%.3f" .Errors.I}}°, strength {{printf "%.1f" .Errors.F}} nT.
+#ifndef {{upper .P}}_TABLES_H
+#define {{upper .P}}_TABLES_H
+
+#include <math.h>
+#include <stdint.h>
+
+#define {{upper .P}}_SAMPLING_RES {{cfloat .Res}}
+#define {{upper .P}}_SAMPLING_MIN_LAT -90.0f
+#define {{upper .P}}_SAMPLING_MIN_LON -180.0f
+#define {{upper .P}}_LAT_DIM {{.LatDim}}
+#define {{upper .P}}_LON_DIM {{.LngDim}}
+#define {{upper .P}}_ANGLE_SCALE {{cfloat .AngleScale}}    // degrees per unit
+#define {{upper .P}}_STRENGTH_SCALE {{cfloat .StrengthScale}} // nT per unit
+#define {{upper .P}}_MAX_DECLINATION_ERROR {{printf "%.3f" .Tolerance.D}}f
+#define {{upper .P}}_MAX_INCLINATION_ERROR {{printf "%.3f" .Tolerance.I}}f
+#define {{upper .P}}_MAX_STRENGTH_ERROR {{printf "%.1f" .Tolerance.F}}f
+
+// Declination in units of {{upper .P}}_ANGLE_SCALE degrees
+static const int16_t {{.P}}_declination_table[{{upper .P}}_LAT_DIM][{{upper .P}}_LON_DIM] = {
+{{rows .D "\t"}}};
+
+// Inclination in units of {{upper .P}}_ANGLE_SCALE degrees
+static const int16_t {{.P}}_inclination_table[{{upper .P}}_LAT_DIM][{{upper .P}}_LON_DIM] = {
+{{rows .I "\t"}}};
+
+// Total intensity in units of {{upper .P}}_STRENGTH_SCALE nT
+static const int16_t {{.P}}_strength_table[{{upper .P}}_LAT_DIM][{{upper .P}}_LON_DIM] = {
+{{rows .F "\t"}}};
+
+// {{.P}}_interpolate returns the value of a table at a latitude and longitude in degrees,
+// interpolated bilinearly, in table units.  An angle is interpolated allowing for it wrapping around ±180°.
+static inline float {{.P}}_interpolate(const int16_t table[{{upper .P}}_LAT_DIM][{{upper .P}}_LON_DIM],
+		float lat, float lon, int angle)
+{
+	const float full = roundf(360.0f / {{upper .P}}_ANGLE_SCALE);
+	if (lat < -90.0f) lat = -90.0f;
+	if (lat > 90.0f) lat = 90.0f;
+	lon = fmodf(lon + 180.0f, 360.0f);
+	if (lon < 0.0f) lon += 360.0f;
+	float x = (lat - {{upper .P}}_SAMPLING_MIN_LAT) / {{upper .P}}_SAMPLING_RES;
+	float y = lon / {{upper .P}}_SAMPLING_RES;
+	int j = (int)floorf(x), k = (int)floorf(y);
+	if (j < 0) j = 0;
+	if (j > {{upper .P}}_LAT_DIM - 2) j = {{upper .P}}_LAT_DIM - 2;
+	if (k < 0) k = 0;
+	if (k > {{upper .P}}_LON_DIM - 2) k = {{upper .P}}_LON_DIM - 2;
+	float u = x - (float)j, w = y - (float)k;
+
+	float v00 = table[j][k], v01 = table[j][k + 1], v10 = table[j + 1][k], v11 = table[j + 1][k + 1];
+	if (angle) {
+		if (v01 - v00 > full / 2) v01 -= full; else if (v01 - v00 < -full / 2) v01 += full;
+		if (v10 - v00 > full / 2) v10 -= full; else if (v10 - v00 < -full / 2) v10 += full;
+		if (v11 - v00 > full / 2) v11 -= full; else if (v11 - v00 < -full / 2) v11 += full;
+	}
+	float v = (1 - u) * ((1 - w) * v00 + w * v01) + u * ((1 - w) * v10 + w * v11);
+	if (angle) {
+		if (v > full / 2) v -= full; else if (v <= -full / 2) v += full;
+	}
+	return v;
+}
+
+// {{.P}}_declination returns the declination in degrees, east positive.
+static inline float {{.P}}_declination(float lat, float lon)
+{
+	return {{.P}}_interpolate({{.P}}_declination_table, lat, lon, 1) * {{upper .P}}_ANGLE_SCALE;
+}
+
+// {{.P}}_inclination returns the inclination in degrees, down positive.
+static inline float {{.P}}_inclination(float lat, float lon)
+{
+	return {{.P}}_interpolate({{.P}}_inclination_table, lat, lon, 0) * {{upper .P}}_ANGLE_SCALE;
+}
+
+// {{.P}}_strength returns the total intensity in nT.
+static inline float {{.P}}_strength(float lat, float lon)
+{
+	return {{.P}}_interpolate({{.P}}_strength_table, lat, lon, 0) * {{upper .P}}_STRENGTH_SCALE;
+}
+
+// Full model values at reference points: latitude, longitude, declination, inclination, strength.
+static const float {{.P}}_reference_points[{{len .References}}][5] = {
+{{range .References}}	{ {{cfloat .Lat}}, {{cfloat .Lng}}, {{printf "%.4f" .D}}f, {{printf "%.4f" .I}}f, {{printf "%.1f" .F}}f },
+{{end}}};
+
+// {{.P}}_self_check compares the lookups with the full model at the reference points,
+// sets the worst-case errors found, and returns 1 if they are within the expected maximum errors.
+static inline int {{.P}}_self_check(float *declination_error, float *inclination_error, float *strength_error)
+{
+	float ed = 0, ei = 0, ef = 0;
+	for (int n = 0; n < {{len .References}}; n++) {
+		const float *r = {{.P}}_reference_points[n];
+		float d = fabsf({{.P}}_declination(r[0], r[1]) - r[2]);
+		if (d > 180.0f) d = 360.0f - d;
+		float i = fabsf({{.P}}_inclination(r[0], r[1]) - r[3]);
+		float f = fabsf({{.P}}_strength(r[0], r[1]) - r[4]);
+		if (d > ed) ed = d;
+		if (i > ei) ei = i;
+		if (f > ef) ef = f;
+	}
+	*declination_error = ed;
+	*inclination_error = ei;
+	*strength_error = ef;
+	return ed <= {{upper .P}}_MAX_DECLINATION_ERROR && ei <= {{upper .P}}_MAX_INCLINATION_ERROR &&
+		ef <= {{upper .P}}_MAX_STRENGTH_ERROR;
+}
+
+#endif // {{upper .P}}_TABLES_H
+`))
+
+var goTemplate = template.Must(template.New("go").Funcs(funcs).Parse(`// Code generated by wmm_tablegen from {{.Model}} for {{printf "%.3f" .DecimalYear}} at {{.Res}}° resolution. DO NOT EDIT.
+
+// Package {{.Package}} looks up the magnetic declination, inclination and strength
+// from tables generated from the World Magnetic Model.
+//
+// Worst-case errors against the full model: declination {{printf "%.3f" .Errors.D}}°
+// (outside the blackout zones), inclination {{printf "%.3f" .Errors.I}}°, strength {{printf "%.1f" .Errors.F}} nT.
+package {{.Package}}
+
+import "math"
+
+const (
+	samplingRes   = {{.Res}}
+	latDim        = {{.LatDim}}
+	lngDim        = {{.LngDim}}
+	angleScale    = {{.AngleScale}} // degrees per unit
+	strengthScale = {{.StrengthScale}} // nT per unit
+)
+
+// Maximum errors of the lookups against the full model, as checked by SelfCheck.
+const (
+	MaxDeclinationError = {{printf "%.3f" .Tolerance.D}}
+	MaxInclinationError = {{printf "%.3f" .Tolerance.I}}
+	MaxStrengthError    = {{printf "%.1f" .Tolerance.F}}
+)
+
+// declinationTable is the declination in units of angleScale degrees.
+var declinationTable = [latDim][lngDim]int16{
+{{rows .D "\t"}}}
+
+// inclinationTable is the inclination in units of angleScale degrees.
+var inclinationTable = [latDim][lngDim]int16{
+{{rows .I "\t"}}}
+
+// strengthTable is the total intensity in units of strengthScale nT.
+var strengthTable = [latDim][lngDim]int16{
+{{rows .F "\t"}}}
+
+// interpolate returns the value of a table at a latitude and longitude in degrees,
+// interpolated bilinearly, in table units.  An angle is interpolated allowing for it wrapping around ±180°.
+func interpolate(table *[latDim][lngDim]int16, lat, lng float64, angle bool) float64 {
+	full := math.Round(360 / angleScale)
+	lat = math.Max(-90, math.Min(90, lat))
+	lng = math.Mod(lng+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	x, y := (lat+90)/samplingRes, lng/samplingRes
+	j := int(math.Min(math.Max(math.Floor(x), 0), latDim-2))
+	k := int(math.Min(math.Max(math.Floor(y), 0), lngDim-2))
+	u, w := x-float64(j), y-float64(k)
+
+	v00 := float64(table[j][k])
+	vs := [3]float64{float64(table[j][k+1]), float64(table[j+1][k]), float64(table[j+1][k+1])}
+	if angle {
+		for n := range vs {
+			if vs[n]-v00 > full/2 {
+				vs[n] -= full
+			} else if vs[n]-v00 < -full/2 {
+				vs[n] += full
+			}
+		}
+	}
+	v := (1-u)*((1-w)*v00+w*vs[0]) + u*((1-w)*vs[1]+w*vs[2])
+	if angle {
+		if v > full/2 {
+			v -= full
+		} else if v <= -full/2 {
+			v += full
+		}
+	}
+	return v
+}
+
+// Declination returns the declination in degrees, east positive.
+func Declination(lat, lng float64) float64 {
+	return interpolate(&declinationTable, lat, lng, true) * angleScale
+}
+
+// Inclination returns the inclination in degrees, down positive.
+func Inclination(lat, lng float64) float64 {
+	return interpolate(&inclinationTable, lat, lng, false) * angleScale
+}
+
+// Strength returns the total intensity in nT.
+func Strength(lat, lng float64) float64 {
+	return interpolate(&strengthTable, lat, lng, false) * strengthScale
+}
+
+// referencePoints are full model values: latitude, longitude, declination, inclination, strength.
+var referencePoints = [][5]float64{
+{{range .References}}	{ {{.Lat}}, {{.Lng}}, {{printf "%.4f" .D}}, {{printf "%.4f" .I}}, {{printf "%.1f" .F}} },
+{{end}}}
+
+// SelfCheck compares the lookups with the full model at the reference points,
+// returning the worst-case errors found and whether they are within the expected maximum errors.
+func SelfCheck() (declinationError, inclinationError, strengthError float64, ok bool) {
+	for _, r := range referencePoints {
+		d := math.Abs(Declination(r[0], r[1]) - r[2])
+		if d > 180 {
+			d = 360 - d
+		}
+		declinationError = math.Max(declinationError, d)
+		inclinationError = math.Max(inclinationError, math.Abs(Inclination(r[0], r[1])-r[3]))
+		strengthError = math.Max(strengthError, math.Abs(Strength(r[0], r[1])-r[4]))
+	}
+	ok = declinationError <= MaxDeclinationError && inclinationError <= MaxInclinationError &&
+		strengthError <= MaxStrengthError
+	return declinationError, inclinationError, strengthError, ok
+}
+`))
@@ -0,0 +1,83 @@
+// wmm_tiles serves XYZ (Web Mercator) PNG map tiles colouring a component of
+// the World Magnetic Model, so that web maps can show a magnetic layer without
+// a GIS stack.  It works entirely offline.
+//
+// Usage is
+//  wmm_tiles --cof_file=WMM2020.COF --addr=:8081 --date=2022.5
+//
+// Tiles are served at /{component}/{z}/{x}/{y}.png, where component is one of
+//  d   declination, degrees
+//  i   inclination, degrees
+//  h   horizontal intensity, nT
+//  f   total intensity, nT
+//  gv  grid variation, degrees
+//  dd, di, dh, df  the secular variation of d, i, h or f per year
+// The query parameters are
+//  date      the date as a decimal year or MM/DD/YYYY, defaulting to --date
+//  ramp      a colour ramp: diverging, viridis, magma, grey or spectral, or a comma-separated
+//            list of hex colours such as 0000ff,ffffff,ff0000; each component has a default
+//  min, max  the values at the ends of the ramp, defaulting to a range suiting the component
+//  contours  the interval between contour lines to draw over the colours, none if absent or 0
+//
+// For example, a Leaflet layer of declination with 5 degree contours:
+//  L.tileLayer('http://localhost:8081/d/{z}/{x}/{y}.png?date=2022.5&contours=5').addTo(map)
+//
+// The field is calculated at mean sea level.  /components lists the components
+// and their defaults as JSON.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	cofUsage  = "COF coefficients file to use, empty for the built-in one"
+	addrUsage = "Address to listen on"
+	dateUsage = "Default date of the tiles, as a decimal year or MM/DD/YYYY; empty for the time of each request"
+)
+
+var (
+	cofFile string
+	addr    string
+	date    string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&addr, "addr", ":8081", addrUsage)
+	flag.StringVar(&date, "date", "", dateUsage)
+}
+
+func main() {
+	flag.Parse()
+
+	if cofFile!="" {
+		if err := wmm.LoadWMMCOF(cofFile); err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	s := &server{now: time.Now}
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		s.date = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	log.Printf("Serving %s tiles on %s", wmm.COFName, addr)
+	log.Fatal(http.ListenAndServe(addr, s.handler()))
+}
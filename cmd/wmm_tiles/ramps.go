@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ramp is a colour ramp of evenly spaced colour stops.
+type ramp []color.RGBA
+
+// ramps are the named colour ramps.
+var ramps = map[string]ramp{
+	"diverging": {{0x21, 0x66, 0xac, 0xff}, {0x67, 0xa9, 0xcf, 0xff}, {0xd1, 0xe5, 0xf0, 0xff},
+		{0xf7, 0xf7, 0xf7, 0xff}, {0xfd, 0xdb, 0xc7, 0xff}, {0xef, 0x8a, 0x62, 0xff}, {0xb2, 0x18, 0x2b, 0xff}},
+	"viridis": {{0x44, 0x01, 0x54, 0xff}, {0x41, 0x44, 0x87, 0xff}, {0x2a, 0x78, 0x8e, 0xff},
+		{0x22, 0xa8, 0x84, 0xff}, {0x7a, 0xd1, 0x51, 0xff}, {0xfd, 0xe7, 0x25, 0xff}},
+	"magma": {{0x00, 0x00, 0x04, 0xff}, {0x3b, 0x0f, 0x70, 0xff}, {0x8c, 0x29, 0x81, 0xff},
+		{0xde, 0x49, 0x68, 0xff}, {0xfe, 0x9f, 0x6d, 0xff}, {0xfc, 0xfd, 0xbf, 0xff}},
+	"grey": {{0x00, 0x00, 0x00, 0xff}, {0xff, 0xff, 0xff, 0xff}},
+	"spectral": {{0x5e, 0x4f, 0xa2, 0xff}, {0x32, 0x88, 0xbd, 0xff}, {0x66, 0xc2, 0xa5, 0xff},
+		{0xab, 0xdd, 0xa4, 0xff}, {0xe6, 0xf5, 0x98, 0xff}, {0xfe, 0xe0, 0x8b, 0xff},
+		{0xfd, 0xae, 0x61, 0xff}, {0xf4, 0x6d, 0x43, 0xff}, {0xd5, 0x3e, 0x4f, 0xff}},
+}
+
+// parseRamp returns the named ramp, or the ramp of a comma-separated list of
+// at least two hex colours such as 0000ff,ffffff,ff0000.
+func parseRamp(s string) (r ramp, err error) {
+	if r, ok := ramps[s]; ok {
+		return r, nil
+	}
+	cs := strings.Split(s, ",")
+	if len(cs)<2 {
+		return nil, fmt.Errorf("unknown ramp %s", s)
+	}
+	for _, c := range cs {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "#")
+		v, err := strconv.ParseUint(c, 16, 32)
+		if err!=nil || len(c)!=6 {
+			return nil, fmt.Errorf("invalid ramp colour %s", c)
+		}
+		r = append(r, color.RGBA{uint8(v>>16), uint8(v>>8), uint8(v), 0xff})
+	}
+	return r, nil
+}
+
+// at returns the colour at position t from 0 to 1 along the ramp,
+// interpolated between the stops; t is clamped to the ends.
+func (r ramp) at(t float64) color.RGBA {
+	if math.IsNaN(t) || t<=0 {
+		return r[0]
+	}
+	if t>=1 {
+		return r[len(r)-1]
+	}
+	x := t*float64(len(r)-1)
+	i := int(x)
+	u := x-float64(i)
+	c0, c1 := r[i], r[i+1]
+	mix := func(a, b uint8) uint8 { return uint8(math.Round(float64(a)+u*(float64(b)-float64(a)))) }
+	return color.RGBA{mix(c0.R, c1.R), mix(c0.G, c1.G), mix(c0.B, c1.B), 0xff}
+}
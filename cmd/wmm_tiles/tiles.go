@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/contour"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	tileSize   = 256
+	sampleStep = 8   // Pixels between the points at which the model is evaluated
+	maxZoom    = 24
+	maxLevels  = 200 // Most contour levels drawn on a tile
+)
+
+// component is a field component that can be drawn, with its default ramp and range.
+type component struct {
+	Component string  `json:"component"`
+	Name      string  `json:"name"`
+	Units     string  `json:"units"`
+	Ramp      string  `json:"ramp"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	angle     bool // The component is an angle that wraps around ±180°
+	value     func(mf wmm.MagneticField) float64
+}
+
+var components = map[string]component{
+	"d": {"d", "declination", "degrees", "diverging", -30, 30, true, wmm.MagneticField.D},
+	"i": {"i", "inclination", "degrees", "diverging", -90, 90, false, wmm.MagneticField.I},
+	"h": {"h", "horintensity", "nT", "viridis", 0, 42000, false, wmm.MagneticField.H},
+	"f": {"f", "totalintensity", "nT", "viridis", 22000, 66000, false, wmm.MagneticField.F},
+	"gv": {"gv", "gridvariation", "degrees", "diverging", -180, 180, true,
+		func(mf wmm.MagneticField) float64 { return mf.GV(mf.Location()) }},
+	"dd": {"dd", "declination_sv", "degrees/year", "diverging", -0.5, 0.5, false, wmm.MagneticField.DD},
+	"di": {"di", "inclination_sv", "degrees/year", "diverging", -0.5, 0.5, false, wmm.MagneticField.DI},
+	"dh": {"dh", "horintensity_sv", "nT/year", "diverging", -150, 150, false, wmm.MagneticField.DH},
+	"df": {"df", "totalintensity_sv", "nT/year", "diverging", -150, 150, false, wmm.MagneticField.DF},
+}
+
+var componentOrder = []string{"d", "i", "h", "f", "gv", "dd", "di", "dh", "df"}
+
+// server serves the tiles.
+type server struct {
+	date time.Time        // Default date of the tiles, or zero for the time of each request
+	now  func() time.Time // Clock for the default date
+}
+
+// handler returns the handler serving the tiles and the component list.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/components", func(w http.ResponseWriter, r *http.Request) {
+		var cs []component
+		for _, name := range componentOrder {
+			cs = append(cs, components[name])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cs)
+	})
+	mux.HandleFunc("/", s.handleTile)
+	return mux
+}
+
+// options are the rendering options of a tile request.
+type options struct {
+	t                  time.Time
+	ramp               ramp
+	min, max, contours float64
+}
+
+// handleTile serves a tile at /{component}/{z}/{x}/{y}.png.
+func (s *server) handleTile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts)!=4 || !strings.HasSuffix(parts[3], ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	comp, ok := components[parts[0]]
+	z, errZ := strconv.Atoi(parts[1])
+	x, errX := strconv.Atoi(parts[2])
+	y, errY := strconv.Atoi(strings.TrimSuffix(parts[3], ".png"))
+	if !ok || errZ!=nil || errX!=nil || errY!=nil || z<0 || z>maxZoom || x<0 || x>=1<<z || y<0 || y>=1<<z {
+		http.NotFound(w, r)
+		return
+	}
+	o, err := s.options(comp, r.URL.Query())
+	if err!=nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var b bytes.Buffer
+	if err = png.Encode(&b, render(comp, o, z, x, y)); err!=nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(b.Bytes())
+}
+
+// options parses the query parameters of a tile request.
+func (s *server) options(comp component, q url.Values) (o options, err error) {
+	o.t = s.date
+	if o.t.IsZero() {
+		o.t = s.now()
+	}
+	if d := q.Get("date"); d!="" {
+		dYear, err := parsing.ParseTime(d)
+		if err!=nil {
+			return o, fmt.Errorf("invalid date %s", d)
+		}
+		o.t = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	rampName := comp.Ramp
+	if q.Get("ramp")!="" {
+		rampName = q.Get("ramp")
+	}
+	if o.ramp, err = parseRamp(rampName); err!=nil {
+		return o, err
+	}
+
+	o.min, o.max = comp.Min, comp.Max
+	for _, p := range []struct {
+		name string
+		v    *float64
+	}{{"min", &o.min}, {"max", &o.max}, {"contours", &o.contours}} {
+		if v := q.Get(p.name); v!="" {
+			if *p.v, err = strconv.ParseFloat(v, 64); err!=nil || math.IsNaN(*p.v) || math.IsInf(*p.v, 0) {
+				return o, fmt.Errorf("invalid %s %s", p.name, v)
+			}
+		}
+	}
+	if o.max<=o.min {
+		return o, fmt.Errorf("max %v must be greater than min %v", o.max, o.min)
+	}
+	if o.contours<0 {
+		return o, fmt.Errorf("contours %v must not be negative", o.contours)
+	}
+	if o.contours>0 && (o.max-o.min)/o.contours>maxLevels {
+		return o, fmt.Errorf("contour interval %v is too small for the range %v to %v", o.contours, o.min, o.max)
+	}
+	return o, nil
+}
+
+// tileLatLng returns the latitude and longitude in degrees of the pixel
+// position px, py within tile x, y at zoom z.
+func tileLatLng(z, x, y int, px, py float64) (lat, lng float64) {
+	n := float64(tileSize)*math.Exp2(float64(z))
+	lng = (float64(x*tileSize)+px)/n*360-180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*(float64(y*tileSize)+py)/n)))/egm96.Deg
+	return lat, lng
+}
+
+// render draws a tile.  The component is evaluated every sampleStep pixels and
+// interpolated bilinearly between, and contour lines are traced through the samples.
+func render(comp component, o options, z, x, y int) *image.RGBA {
+	n := tileSize/sampleStep+1
+	vals := make([][]float64, n)
+	for r := range vals {
+		vals[r] = make([]float64, n)
+		for c := range vals[r] {
+			lat, lng := tileLatLng(z, x, y, float64(c*sampleStep), float64(r*sampleStep))
+			mf, _ := lookup.Field(lat, lng, 0, o.t)
+			vals[r][c] = comp.value(mf)
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	for py := 0; py<tileSize; py++ {
+		fy := (float64(py)+0.5)/sampleStep
+		r := int(fy)
+		u := fy-float64(r)
+		for px := 0; px<tileSize; px++ {
+			fx := (float64(px)+0.5)/sampleStep
+			c := int(fx)
+			w := fx-float64(c)
+			v00, v01, v10, v11 := vals[r][c], vals[r][c+1], vals[r+1][c], vals[r+1][c+1]
+			var v float64
+			if comp.angle {
+				v = v00+(1-u)*w*lookup.AngleDiff(v01, v00)+u*(1-w)*lookup.AngleDiff(v10, v00)+u*w*lookup.AngleDiff(v11, v00)
+				v = lookup.AngleDiff(v, 0)
+			} else {
+				v = (1-u)*((1-w)*v00+w*v01)+u*((1-w)*v10+w*v11)
+			}
+			img.SetRGBA(px, py, o.ramp.at((v-o.min)/(o.max-o.min)))
+		}
+	}
+
+	if o.contours>0 {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, row := range vals {
+			for _, v := range row {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+		var maxStep float64
+		if comp.angle {
+			maxStep = 180
+		}
+		levels := contour.Levels(lo, hi, o.contours)
+		if len(levels)>maxLevels {
+			levels = nil
+		}
+		for _, level := range levels {
+			width := 1
+			if level==0 {
+				width = 2
+			}
+			for _, line := range contour.Lines(vals, level, maxStep) {
+				for i := 1; i<len(line); i++ {
+					drawLine(img, line[i-1].X*sampleStep, line[i-1].Y*sampleStep,
+						line[i].X*sampleStep, line[i].Y*sampleStep, width)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// contourColor is the colour contour lines are blended onto the tile with.
+var contourColor = color.RGBA{0x20, 0x20, 0x20, 0xb0}
+
+// drawLine blends a line of the given width in pixels from x0, y0 to x1, y1 onto img.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, width int) {
+	n := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))+1
+	a := float64(contourColor.A)/0xff
+	done := map[image.Point]bool{}
+	for i := 0; i<=n; i++ {
+		t := float64(i)/float64(n)
+		cx, cy := int(math.Floor(x0+t*(x1-x0))), int(math.Floor(y0+t*(y1-y0)))
+		for dy := 0; dy<width; dy++ {
+			for dx := 0; dx<width; dx++ {
+				p := image.Point{cx+dx, cy+dy}
+				if done[p] || !p.In(img.Rect) {
+					continue
+				}
+				done[p] = true
+				c := img.RGBAAt(p.X, p.Y)
+				blend := func(v, over uint8) uint8 { return uint8(math.Round((1-a)*float64(v)+a*float64(over))) }
+				img.SetRGBA(p.X, p.Y, color.RGBA{blend(c.R, contourColor.R), blend(c.G, contourColor.G),
+					blend(c.B, contourColor.B), 0xff})
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+var testDate = time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+func get(t *testing.T, srv *httptest.Server, path string) (code int, body []byte) {
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func newTestServer(t *testing.T) (srv *httptest.Server) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{now: func() time.Time { return testDate }}
+	return httptest.NewServer(s.handler())
+}
+
+func TestTileLatLng(t *testing.T) {
+	lat, lng := tileLatLng(0, 0, 0, 128, 128)
+	testDiff("center latitude", lat, 0, 1e-9, t)
+	testDiff("center longitude", lng, 0, 1e-9, t)
+	lat, lng = tileLatLng(0, 0, 0, 0, 0)
+	testDiff("corner latitude", lat, 85.0511, 1e-4, t)
+	testDiff("corner longitude", lng, -180, 1e-9, t)
+	lat, lng = tileLatLng(3, 2, 5, 256, 256)
+	testDiff("tile corner latitude", lat, -66.5133, 1e-4, t)
+	testDiff("tile corner longitude", lng, -45, 1e-9, t)
+}
+
+func TestRender(t *testing.T) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	o := options{t: testDate, ramp: ramps["diverging"], min: -30, max: 30}
+	img := render(components["d"], o, 3, 1, 2)
+	for _, p := range [][2]int{{0, 0}, {100, 37}, {200, 211}, {255, 255}} {
+		lat, lng := tileLatLng(3, 1, 2, float64(p[0])+0.5, float64(p[1])+0.5)
+		mf, _ := lookup.Field(lat, lng, 0, testDate)
+		expected := o.ramp.at((mf.D() + 30) / 60)
+		actual := img.RGBAAt(p[0], p[1])
+		testDiff("pixel red", float64(actual.R), float64(expected.R), 2, t)
+		testDiff("pixel green", float64(actual.G), float64(expected.G), 2, t)
+		testDiff("pixel blue", float64(actual.B), float64(expected.B), 2, t)
+	}
+
+	o.contours = 2
+	lined := render(components["d"], o, 3, 1, 2)
+	var darker int
+	for py := 0; py < tileSize; py++ {
+		for px := 0; px < tileSize; px++ {
+			if c0, c1 := img.RGBAAt(px, py), lined.RGBAAt(px, py); c1 != c0 {
+				if c1.R > c0.R || c1.G > c0.G || c1.B > c0.B {
+					t.Fatalf("contour pixel %d, %d is lighter than the background", px, py)
+				}
+				darker++
+			}
+		}
+	}
+	if darker < tileSize || darker > tileSize*tileSize/4 {
+		t.Errorf("expected contour lines across the tile, got %d contour pixels", darker)
+	}
+}
+
+func TestTiles(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	for _, path := range []string{"/d/0/0/0.png", "/f/2/3/1.png?date=2023.0&ramp=magma&contours=2000",
+		"/dd/1/0/1.png?ramp=ff0000,00ff00&min=-1&max=1", "/gv/4/8/1.png?contours=10"} {
+		code, body := get(t, srv, path)
+		if code != http.StatusOK {
+			t.Errorf("%s returned %d: %s", path, code, body)
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != tileSize || b.Dy() != tileSize {
+			t.Errorf("%s: expected a %d pixel tile, got %v", path, tileSize, b)
+		}
+	}
+
+	// The declination is near zero through the Greenwich meridian in Europe
+	code, body := get(t, srv, "/d/2/2/1.png?date=2022.5&ramp=grey&min=-180&max=180")
+	if code != http.StatusOK {
+		t.Fatalf("returned %d: %s", code, body)
+	}
+	img, _ := png.Decode(bytes.NewReader(body))
+	c := color.RGBAModel.Convert(img.At(0, 100)).(color.RGBA)
+	testDiff("grey level near zero declination", float64(c.R), 127.5, 3, t)
+
+	var cs []component
+	code, body = get(t, srv, "/components")
+	if err := json.Unmarshal(body, &cs); code != http.StatusOK || err != nil || len(cs) != len(componentOrder) {
+		t.Errorf("/components returned %d: %s", code, body)
+	}
+}
+
+func TestBadTiles(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	for path, expected := range map[string]int{
+		"/q/0/0/0.png":                http.StatusNotFound,
+		"/d/1/2/0.png":                http.StatusNotFound,
+		"/d/1/0/-1.png":               http.StatusNotFound,
+		"/d/0/0/0.jpg":                http.StatusNotFound,
+		"/d/0/0.png":                  http.StatusNotFound,
+		"/d/0/0/0.png?ramp=plaid":     http.StatusBadRequest,
+		"/d/0/0/0.png?ramp=ff0000,zz": http.StatusBadRequest,
+		"/d/0/0/0.png?min=5&max=1":    http.StatusBadRequest,
+		"/d/0/0/0.png?contours=0.001": http.StatusBadRequest,
+		"/d/0/0/0.png?contours=-1":    http.StatusBadRequest,
+		"/d/0/0/0.png?date=yesterday": http.StatusBadRequest,
+		"/d/0/0/0.png?max=Inf":        http.StatusBadRequest,
+	} {
+		if code, body := get(t, srv, path); code != expected {
+			t.Errorf("%s: expected %d, got %d: %s", path, expected, code, body)
+		}
+	}
+}
+
+func TestParseRamp(t *testing.T) {
+	r, err := parseRamp("#000000, ffffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDiff("ramp middle", float64(r.at(0.5).R), 128, 1, t)
+	testDiff("ramp below", float64(r.at(-1).R), 0, 0, t)
+	testDiff("ramp above", float64(r.at(2).R), 255, 0, t)
+	c := ramps["diverging"].at(0.5)
+	testDiff("diverging middle", float64(c.G), 0xf7, 0, t)
+}
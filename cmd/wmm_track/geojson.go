@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// annotateGeoJSON returns the GeoJSON file data with the values added as
+// properties of each Feature.  The rest of the file is unchanged.
+func annotateGeoJSON(data []byte, c *calculator) (out []byte, err error) {
+	root, _, err := jsonMembers(data, 0)
+	if err!=nil {
+		return nil, err
+	}
+	var (
+		typ   string
+		edits []edit
+	)
+	for _, m := range root {
+		if m.key=="type" {
+			_ = json.Unmarshal(m.raw, &typ)
+		}
+	}
+
+	switch typ {
+	case "FeatureCollection":
+		for _, m := range root {
+			if m.key!="features" || len(m.raw)==0 || m.raw[0]!='[' {
+				continue
+			}
+			features, _, err := jsonMembers(m.raw, m.start)
+			if err!=nil {
+				return nil, err
+			}
+			for i, f := range features {
+				if f.raw[0]!='{' {
+					return nil, fmt.Errorf("feature %d is not an object", i)
+				}
+				es, err := annotateFeature(f.raw, f.start, c)
+				if err!=nil {
+					return nil, fmt.Errorf("feature %d: %s", i, err)
+				}
+				edits = append(edits, es...)
+			}
+		}
+	case "Feature":
+		if edits, err = annotateFeature(data, 0, c); err!=nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("GeoJSON type %q is not a Feature or FeatureCollection", typ)
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start<edits[j].start })
+	return applyEdits(data, edits), nil
+}
+
+// annotateFeature returns the edits adding the values for the positions of the
+// geometry of the Feature object data, at offset base of the file, to its properties.
+func annotateFeature(data []byte, base int64, c *calculator) (edits []edit, err error) {
+	var feature map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err = d.Decode(&feature); err!=nil {
+		return nil, err
+	}
+	geom, _ := feature["geometry"].(map[string]interface{})
+	if geom==nil {
+		return nil, nil
+	}
+	var positions [][]interface{}
+	if positions, err = geometryPositions(geom, positions); err!=nil {
+		return nil, err
+	}
+	props, _ := feature["properties"].(map[string]interface{})
+
+	var times []interface{}
+	for _, key := range []string{"coordTimes", "times"} {
+		if ts, ok := props[key].([]interface{}); ok {
+			times = flatten(ts, nil)
+			if len(times)!=len(positions) {
+				return nil, fmt.Errorf("%s has %d times for %d positions", key, len(times), len(positions))
+			}
+			break
+		}
+	}
+
+	values := make([][]string, len(names))
+	for i, pos := range positions {
+		var coord [3]float64
+		if len(pos)<2 {
+			return nil, fmt.Errorf("position %v has fewer than 2 coordinates", pos)
+		}
+		for j := 0; j<len(pos) && j<3; j++ {
+			n, ok := pos[j].(json.Number)
+			if !ok {
+				return nil, fmt.Errorf("invalid position %v", pos)
+			}
+			if coord[j], err = n.Float64(); err!=nil {
+				return nil, fmt.Errorf("invalid position %v", pos)
+			}
+		}
+		when, _ := props["time"].(string)
+		if times!=nil {
+			when, _ = times[i].(string)
+		}
+		var t time.Time
+		if t, err = parseTime(when); err!=nil {
+			return nil, err
+		}
+		vals, err := c.values(coord[1], coord[0], coord[2], true, t)
+		if err!=nil {
+			return nil, err
+		}
+		for j, v := range vals {
+			values[j] = append(values[j], formatValue(j, v))
+		}
+	}
+
+	encoded := make([]string, len(names))
+	for j := range names {
+		if geom["type"]=="Point" && len(values[j])==1 {
+			encoded[j] = values[j][0]
+		} else {
+			encoded[j] = "[" + strings.Join(values[j], ", ") + "]"
+		}
+	}
+	return propertiesEdits(data, base, encoded)
+}
+
+// propertiesEdits returns the edits setting the properties named by names to
+// the encoded values in the Feature object data, at offset base of the file.
+// Existing properties are replaced in place and new ones added after the last
+// property, laid out like it.
+func propertiesEdits(data []byte, base int64, encoded []string) (edits []edit, err error) {
+	members, _, err := jsonMembers(data, base)
+	if err!=nil {
+		return nil, err
+	}
+	var props *jsonMember
+	for i := range members {
+		if members[i].key=="properties" {
+			props = &members[i]
+		}
+	}
+
+	// Without a properties object, add a new one.
+	if props==nil || props.raw[0]!='{' {
+		var b strings.Builder
+		b.WriteString("{")
+		for j, name := range names {
+			if j>0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%q: %s", name, encoded[j])
+		}
+		b.WriteString("}")
+		if props!=nil {
+			return []edit{{props.start, props.end, b.String()}}, nil
+		}
+		last := members[len(members)-1]
+		return []edit{{last.end, last.end, "," + nextSpace(members) + `"properties"` + last.colon + b.String()}}, nil
+	}
+
+	existing, end, err := jsonMembers(props.raw, props.start)
+	if err!=nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for j, name := range names {
+		found := false
+		for _, m := range existing {
+			if m.key==name {
+				edits = append(edits, edit{m.start, m.end, encoded[j]})
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		if len(existing)==0 {
+			if b.Len()>0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%q: %s", name, encoded[j])
+			continue
+		}
+		last := existing[len(existing)-1]
+		fmt.Fprintf(&b, ",%s%q%s%s", nextSpace(existing), name, last.colon, encoded[j])
+	}
+	pos := end
+	if len(existing)>0 {
+		pos = existing[len(existing)-1].end
+	}
+	return append(edits, edit{pos, pos, b.String()}), nil
+}
+
+// nextSpace returns the space to put before a member added after the members:
+// the space before the last one, or a single space if there is only one on the
+// same line as the bracket.
+func nextSpace(members []jsonMember) string {
+	space := members[len(members)-1].space
+	if len(members)==1 && !strings.Contains(space, "\n") {
+		return " "
+	}
+	return space
+}
+
+// jsonMember is a member of a JSON object or an element of a JSON array in a file.
+type jsonMember struct {
+	key        string          // Empty for an array element
+	raw        json.RawMessage // The value
+	start, end int64           // Offsets of the start and end of the value in the file
+	space      string          // The space between the preceding comma or bracket and the member
+	colon      string          // The text between the key and the value, including the colon
+}
+
+// jsonMembers returns the members of the JSON object or the elements of the
+// JSON array data, at offset base of the file, and the offset of its closing bracket.
+func jsonMembers(data []byte, base int64) (members []jsonMember, end int64, err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	tok, err := d.Token()
+	if err!=nil {
+		return nil, 0, err
+	}
+	if tok!=json.Delim('{') && tok!=json.Delim('[') {
+		return nil, 0, fmt.Errorf("expected an object or array, got %v", tok)
+	}
+	for {
+		var m jsonMember
+		pos := d.InputOffset()
+		if !d.More() {
+			break
+		}
+		for pos<int64(len(data)) && (data[pos]==',' || isSpace(data[pos])) {
+			if data[pos]==',' {
+				m.space = ""
+			} else {
+				m.space += string(data[pos])
+			}
+			pos++
+		}
+		if tok==json.Delim('{') {
+			key, err := d.Token()
+			if err!=nil {
+				return nil, 0, err
+			}
+			m.key, _ = key.(string)
+			pos = d.InputOffset()
+		}
+		if err = d.Decode(&m.raw); err!=nil {
+			return nil, 0, err
+		}
+		m.start, m.end = base+d.InputOffset()-int64(len(m.raw)), base+d.InputOffset()
+		m.colon = string(data[pos:m.start-base])
+		members = append(members, m)
+	}
+	if _, err = d.Token(); err!=nil {
+		return nil, 0, err
+	}
+	return members, base+d.InputOffset()-1, nil
+}
+
+// isSpace returns whether c is JSON whitespace.
+func isSpace(c byte) bool {
+	return c==' ' || c=='\t' || c=='\n' || c=='\r'
+}
+
+// geometryPositions appends the positions of the geometry to positions, in order.
+func geometryPositions(geom map[string]interface{}, positions [][]interface{}) ([][]interface{}, error) {
+	if geom["type"]=="GeometryCollection" {
+		geoms, _ := geom["geometries"].([]interface{})
+		for _, g := range geoms {
+			g, ok := g.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("geometry is not an object")
+			}
+			var err error
+			if positions, err = geometryPositions(g, positions); err!=nil {
+				return nil, err
+			}
+		}
+		return positions, nil
+	}
+	coords, ok := geom["coordinates"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("geometry %v has no coordinates", geom["type"])
+	}
+	return coordPositions(coords, positions), nil
+}
+
+// coordPositions appends the positions in the nested coordinates array to positions, in order.
+func coordPositions(coords []interface{}, positions [][]interface{}) [][]interface{} {
+	if len(coords)>0 {
+		if _, ok := coords[0].(json.Number); ok {
+			return append(positions, coords)
+		}
+	}
+	for _, c := range coords {
+		if c, ok := c.([]interface{}); ok {
+			positions = coordPositions(c, positions)
+		}
+	}
+	return positions
+}
+
+// flatten appends the values in the nested array vs to flat, in order.
+func flatten(vs []interface{}, flat []interface{}) []interface{} {
+	for _, v := range vs {
+		if a, ok := v.([]interface{}); ok {
+			flat = flatten(a, flat)
+		} else {
+			flat = append(flat, v)
+		}
+	}
+	return flat
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geomagNS is the XML namespace of the GPX extension elements.
+const geomagNS = "http://github.com/westphae/geomag"
+
+// gpxPoint is a GPX wpt, rtept or trkpt element being read.
+type gpxPoint struct {
+	name     string
+	depth    int     // Depth of the element in the document
+	lat, lng float64 // Degrees
+	ele      float64 // Meters above mean sea level
+	time     string
+	extEnd   int64 // Offset of the end tag of its extensions element, or -1
+	line     int
+}
+
+// annotateGPX returns the GPX file data with the values added as extension
+// elements to each waypoint, route point and track point.
+func annotateGPX(data []byte, c *calculator) (out []byte, err error) {
+	var (
+		edits []edit
+		depth int
+		pt    *gpxPoint
+		text  bytes.Buffer
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		start := d.InputOffset()
+		tok, err := d.Token()
+		if err==io.EOF {
+			break
+		}
+		if err!=nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			text.Reset()
+			if depth==1 {
+				if tok.Name.Local!="gpx" {
+					return nil, fmt.Errorf("root element is %s, not gpx", tok.Name.Local)
+				}
+				if !declaresGeomag(tok.Attr) {
+					pos := d.InputOffset()-1
+					if data[pos-1]=='/' {
+						pos--
+					}
+					edits = append(edits, edit{pos, pos, ` xmlns:geomag="` + geomagNS + `"`})
+				}
+			}
+			switch tok.Name.Local {
+			case "wpt", "rtept", "trkpt":
+				if pt!=nil {
+					break
+				}
+				pt = &gpxPoint{name: tok.Name.Local, depth: depth, extEnd: -1, line: lineOf(data, start)}
+				for _, a := range tok.Attr {
+					switch a.Name.Local {
+					case "lat":
+						pt.lat, err = strconv.ParseFloat(a.Value, 64)
+					case "lon":
+						pt.lng, err = strconv.ParseFloat(a.Value, 64)
+					}
+					if err!=nil {
+						return nil, fmt.Errorf("line %d: invalid %s %q", pt.line, a.Name.Local, a.Value)
+					}
+				}
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if pt!=nil && depth==pt.depth+1 {
+				switch tok.Name.Local {
+				case "ele":
+					if pt.ele, err = strconv.ParseFloat(strings.TrimSpace(text.String()), 64); err!=nil {
+						return nil, fmt.Errorf("line %d: invalid ele %q", pt.line, text.String())
+					}
+				case "time":
+					pt.time = text.String()
+				case "extensions":
+					pt.extEnd = start
+				}
+			}
+			if pt!=nil && depth==pt.depth {
+				t, err := parseTime(pt.time)
+				if err!=nil {
+					return nil, fmt.Errorf("line %d: %s", pt.line, err)
+				}
+				vals, err := c.values(pt.lat, pt.lng, pt.ele, false, t)
+				if err!=nil {
+					return nil, fmt.Errorf("line %d: %s", pt.line, err)
+				}
+				var ext strings.Builder
+				for i, v := range vals {
+					fmt.Fprintf(&ext, "<geomag:%s>%s</geomag:%s>", names[i], formatValue(i, v), names[i])
+				}
+				if pt.extEnd>=0 {
+					edits = append(edits, closeEdit(data, pt.extEnd, "extensions", ext.String()))
+				} else {
+					edits = append(edits, closeEdit(data, start, tok.Name.Local,
+						"<extensions>"+ext.String()+"</extensions>"))
+				}
+				pt = nil
+			}
+			depth--
+			text.Reset()
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start<edits[j].start })
+	return applyEdits(data, edits), nil
+}
+
+// declaresGeomag returns whether the attributes declare the geomag namespace prefix.
+func declaresGeomag(attrs []xml.Attr) bool {
+	for _, a := range attrs {
+		if a.Name.Space=="xmlns" && a.Name.Local=="geomag" {
+			return true
+		}
+	}
+	return false
+}
+
+// closeEdit returns an edit inserting text at the end of the element named
+// local whose end tag starts at offset end, expanding it if it is self-closing.
+func closeEdit(data []byte, end int64, local, text string) edit {
+	if end>=2 && string(data[end-2:end])=="/>" {
+		return edit{end-2, end, ">" + text + "</" + local + ">"}
+	}
+	return edit{end, end, text}
+}
+
+// lineOf returns the line number of the offset in data.
+func lineOf(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n"))+1
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kmlPlacemark is a KML Placemark element being read.
+type kmlPlacemark struct {
+	depth     int          // Depth of the element in the document
+	geomStart int64        // Offset of the start tag of its geometry, or -1
+	extEnd    int64        // Offset of the end tag of its ExtendedData element, or -1
+	coords    [][3]float64 // Longitude, latitude and altitude of each coordinate
+	when      string       // Time of its TimeStamp or the beginning of its TimeSpan
+	whens     []string     // Times of a gx:Track
+	line      int
+}
+
+// kmlGeometries are the KML elements that can be the geometry of a Placemark.
+var kmlGeometries = map[string]bool{"Point": true, "LineString": true, "LinearRing": true, "Polygon": true,
+	"MultiGeometry": true, "Model": true, "Track": true, "MultiTrack": true}
+
+// annotateKML returns the KML file data with the values added as ExtendedData to each Placemark.
+func annotateKML(data []byte, c *calculator) (out []byte, err error) {
+	var (
+		edits []edit
+		stack []string
+		pm    *kmlPlacemark
+		text  bytes.Buffer
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		start := d.InputOffset()
+		tok, err := d.Token()
+		if err==io.EOF {
+			break
+		}
+		if err!=nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, tok.Name.Local)
+			text.Reset()
+			if tok.Name.Local=="Placemark" && pm==nil {
+				pm = &kmlPlacemark{depth: len(stack), geomStart: -1, extEnd: -1, line: lineOf(data, start)}
+			} else if pm!=nil && len(stack)==pm.depth+1 && kmlGeometries[tok.Name.Local] && pm.geomStart<0 {
+				pm.geomStart = start
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if pm!=nil {
+				var parent string
+				if len(stack)>1 {
+					parent = stack[len(stack)-2]
+				}
+				switch tok.Name.Local {
+				case "ExtendedData":
+					if len(stack)==pm.depth+1 {
+						pm.extEnd = start
+					}
+				case "coordinates":
+					for _, tuple := range strings.Fields(text.String()) {
+						coord, err := parseCoord(strings.Split(tuple, ","))
+						if err!=nil {
+							return nil, fmt.Errorf("line %d: %s", pm.line, err)
+						}
+						pm.coords = append(pm.coords, coord)
+					}
+				case "coord":
+					coord, err := parseCoord(strings.Fields(text.String()))
+					if err!=nil {
+						return nil, fmt.Errorf("line %d: %s", pm.line, err)
+					}
+					pm.coords = append(pm.coords, coord)
+				case "when":
+					if parent=="Track" {
+						pm.whens = append(pm.whens, text.String())
+					} else if parent=="TimeStamp" {
+						pm.when = text.String()
+					}
+				case "begin":
+					if parent=="TimeSpan" {
+						pm.when = text.String()
+					}
+				case "Placemark":
+					if len(stack)==pm.depth {
+						e, err := placemarkEdit(data, start, pm, c)
+						if err!=nil {
+							return nil, fmt.Errorf("line %d: %s", pm.line, err)
+						}
+						if e!=nil {
+							edits = append(edits, *e)
+						}
+						pm = nil
+					}
+				}
+			}
+			stack = stack[:len(stack)-1]
+			text.Reset()
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start<edits[j].start })
+	return applyEdits(data, edits), nil
+}
+
+// placemarkEdit returns the edit adding the values for the coordinates of the
+// Placemark pm, whose end tag starts at offset end, or nil if it has no coordinates.
+func placemarkEdit(data []byte, end int64, pm *kmlPlacemark, c *calculator) (e *edit, err error) {
+	if len(pm.coords)==0 {
+		return nil, nil
+	}
+	if len(pm.whens)>0 && len(pm.whens)!=len(pm.coords) {
+		return nil, fmt.Errorf("gx:Track has %d times for %d coordinates", len(pm.whens), len(pm.coords))
+	}
+	values := make([][]string, len(names))
+	for i, coord := range pm.coords {
+		when := pm.when
+		if len(pm.whens)>0 {
+			when = pm.whens[i]
+		}
+		var t time.Time
+		if t, err = parseTime(when); err!=nil {
+			return nil, err
+		}
+		vals, err := c.values(coord[1], coord[0], coord[2], false, t)
+		if err!=nil {
+			return nil, err
+		}
+		for j, v := range vals {
+			values[j] = append(values[j], formatValue(j, v))
+		}
+	}
+
+	var b strings.Builder
+	for j, name := range names {
+		fmt.Fprintf(&b, `<Data name="%s"><value>%s</value></Data>`, name, strings.Join(values[j], " "))
+	}
+	switch {
+	case pm.extEnd>=0:
+		ed := closeEdit(data, pm.extEnd, "ExtendedData", b.String())
+		return &ed, nil
+	case pm.geomStart>=0:
+		// ExtendedData must come before the geometry of a Placemark
+		return &edit{pm.geomStart, pm.geomStart, "<ExtendedData>" + b.String() + "</ExtendedData>"}, nil
+	}
+	ed := closeEdit(data, end, "Placemark", "<ExtendedData>"+b.String()+"</ExtendedData>")
+	return &ed, nil
+}
+
+// parseCoord parses a KML coordinate of longitude, latitude and an optional altitude.
+func parseCoord(fields []string) (coord [3]float64, err error) {
+	if len(fields)<2 || len(fields)>3 {
+		return coord, fmt.Errorf("invalid coordinate %q", strings.Join(fields, ","))
+	}
+	for i, f := range fields {
+		if coord[i], err = strconv.ParseFloat(f, 64); err!=nil {
+			return coord, fmt.Errorf("invalid coordinate %q", strings.Join(fields, ","))
+		}
+	}
+	return coord, nil
+}
@@ -0,0 +1,251 @@
+// wmm_track annotates the points of GPX tracks, KML placemarks and GeoJSON
+// features with the magnetic field calculated by the World Magnetic Model.
+//
+// Usage is
+//  wmm_track --cof_file=WMM2020.COF --date=[date] --format=gpx [input file] [output file]
+//
+// The input is read from standard input if it is - or not given, and the
+// annotated file is written to standard output if no output file is given.
+// The format is gpx, kml or geojson, chosen by the extension of the input file
+// name (.gpx, .kml, .geojson or .json) unless given with --format.
+//
+// For each point the declination D, inclination I, total intensity F and grid
+// variation GV are calculated at the point's own height and time, or at the
+// --date (a decimal year or MM/DD/YYYY) for all points if it is given.  Points
+// with no time are calculated at the current date, with a warning.
+// The grid variation is from the grid north of the UTM zone, or of the UPS grid
+// in the polar regions, at the point.  Angles are in degrees and the total
+// intensity in nT.
+//
+// The values are added to the file, which is otherwise written back unchanged:
+//  - In GPX files each wpt, rtept and trkpt gets extension elements
+//    <geomag:declination>, <geomag:inclination>, <geomag:totalintensity> and
+//    <geomag:gridvariation> in the namespace http://github.com/westphae/geomag,
+//    using its <ele> as the height above mean sea level and its <time>.
+//  - In KML files each Placemark gets ExtendedData Data elements named
+//    declination, inclination, totalintensity and gridvariation, holding a
+//    space-separated value for each of its coordinates in order.  Heights are
+//    taken as above mean sea level, and times from the Placemark's TimeStamp or
+//    the <when> elements of a gx:Track.
+//  - In GeoJSON files each Feature gets the properties declination, inclination,
+//    totalintensity and gridvariation, holding a number for a Point or an array
+//    of numbers with one for each position of other geometries.  Heights are
+//    above the WGS-84 ellipsoid as RFC 7946 specifies, and times are taken from
+//    a "time" property, or a "coordTimes" or "times" array property with one time
+//    for each position.  Properties of the same names already in the file are
+//    replaced in place, and new ones are added after the last property.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/utm"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+const (
+	usage = "wmm_track --cof_file=WMM2020.COF --date=[date] --format=gpx [input file] [output file]"
+	cofUsage = "COF coefficients file to use, empty for the built-in one"
+	dateUsage = "Date to calculate all points at, as a decimal year or MM/DD/YYYY; empty to use each point's time"
+	formatUsage = "File format, gpx, kml or geojson; empty to choose by the input file extension"
+)
+
+// names are the names of the values added to each point.
+var names = []string{"declination", "inclination", "totalintensity", "gridvariation"}
+
+var (
+	cofFile string
+	date    string
+	format  string
+)
+
+func init() {
+	flag.StringVar(&cofFile, "cof_file", "", cofUsage)
+	flag.StringVar(&cofFile, "c", "", cofUsage)
+
+	flag.StringVar(&date, "date", "", dateUsage)
+	flag.StringVar(&format, "format", "", formatUsage)
+	flag.StringVar(&format, "f", "", formatUsage)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	if flag.NArg()>2 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if cofFile!="" {
+		if err = wmm.LoadWMMCOF(cofFile); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	c := &calculator{now: time.Now()}
+	if date!="" {
+		dYear, err := parsing.ParseTime(date)
+		if err!=nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		c.date = wmm.DecimalYear(dYear).ToTime()
+	}
+
+	var data []byte
+	name := flag.Arg(0)
+	if name=="" || name=="-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if format=="" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".gpx":
+			format = "gpx"
+		case ".kml":
+			format = "kml"
+		case ".geojson", ".json":
+			format = "geojson"
+		default:
+			_, _ = fmt.Fprintln(os.Stderr, "Cannot tell the format from the file name, please give --format")
+			os.Exit(2)
+		}
+	}
+
+	var out []byte
+	switch format {
+	case "gpx":
+		out, err = annotateGPX(data, c)
+	case "kml":
+		out, err = annotateKML(data, c)
+	case "geojson":
+		out, err = annotateGeoJSON(data, c)
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown format %s, must be gpx, kml or geojson\n", format)
+		os.Exit(2)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if c.warning!=nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", c.warning)
+	}
+
+	if name := flag.Arg(1); name!="" {
+		err = ioutil.WriteFile(name, out, 0644)
+	} else {
+		_, err = os.Stdout.Write(out)
+	}
+	if err!=nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// calculator calculates the values added to each point.
+type calculator struct {
+	date    time.Time // Date to calculate all points at, or zero to use their own times
+	now     time.Time // Date to calculate points without a time at
+	warning error     // The first warning from the calculations
+}
+
+// values returns the declination, inclination, total intensity and grid
+// variation at a point with latitude and longitude in degrees and height in
+// meters, above the ellipsoid if hae and otherwise above mean sea level.
+// The time t is used unless the calculator has a fixed date, and the current
+// date if t is zero.
+func (c *calculator) values(lat, lng, h float64, hae bool, t time.Time) (vals []float64, err error) {
+	if lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %v is outside the range -90 to 90", lat)
+	}
+	if lng < -180 || lng >= 360 {
+		return nil, fmt.Errorf("longitude %v is outside the range -180 to 360", lng)
+	}
+	for lng<0 {
+		lng += 360
+	}
+	var loc egm96.Location
+	if hae {
+		loc = egm96.NewLocationGeodetic(lat, lng, h)
+	} else if loc, err = egm96.NewLocationMSL(lat, lng, h); err!=nil {
+		return nil, err
+	}
+
+	if !c.date.IsZero() {
+		t = c.date
+	} else if t.IsZero() {
+		t = c.now
+		if c.warning==nil {
+			c.warning = fmt.Errorf("points without a time were calculated at the current date")
+		}
+	}
+	mf, errField := wmm.CalculateWMMMagneticField(loc, t)
+	if errField!=nil && c.warning==nil {
+		c.warning = errField
+	}
+	gv, err := utm.GridVariation(mf.D(), loc)
+	if err!=nil {
+		return nil, err
+	}
+	return []float64{mf.D(), mf.I(), mf.F(), gv}, nil
+}
+
+// formatValue formats the i'th of the values named by names.
+func formatValue(i int, v float64) string {
+	if names[i]=="totalintensity" {
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// parseTime parses an ISO 8601 time as used in GPX, KML and GeoJSON files,
+// returning the zero time for an empty string.
+func parseTime(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	if s=="" {
+		return t, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err = time.Parse(layout, s); err==nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("invalid time %q", s)
+}
+
+// edit is a replacement of the bytes from start to end of a file with text.
+type edit struct {
+	start, end int64
+	text       string
+}
+
+// applyEdits returns data with the edits, which must be in order and not overlap, applied.
+func applyEdits(data []byte, edits []edit) []byte {
+	var b bytes.Buffer
+	var pos int64
+	for _, e := range edits {
+		b.Write(data[pos:e.start])
+		b.WriteString(e.text)
+		pos = e.end
+	}
+	b.Write(data[pos:])
+	return b.Bytes()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/lookup"
+	"github.com/westphae/geomag/pkg/utm"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+// declination returns the declination at a point with height above mean sea level.
+func declination(lat, lng, h float64, tm time.Time) float64 {
+	for lng < 0 {
+		lng += 360
+	}
+	loc, _ := egm96.NewLocationMSL(lat, lng, h)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, tm)
+	return mf.D()
+}
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="47.6" lon="-122.3"/>
+  <trk><name>Test &amp; track</name><trkseg>
+    <trkpt lat="40.0" lon="-105.3"><ele>1650.0</ele><time>2021-07-01T12:00:00Z</time></trkpt>
+    <trkpt lat="40.1" lon="-105.2"><ele>1700</ele><time>2022-07-01T12:00:00Z</time><extensions><hr>120</hr></extensions></trkpt>
+  </trkseg></trk>
+</gpx>
+`
+
+func TestGPX(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	out, err := annotateGPX([]byte(gpx), &calculator{now: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	t.Log(s)
+	if !strings.Contains(s, `xmlns:geomag="`+geomagNS+`"`) || !strings.Contains(s, "<name>Test &amp; track</name>") {
+		t.Error("GPX header or content not preserved")
+	}
+	if !strings.Contains(s, "<hr>120</hr><geomag:declination>") {
+		t.Error("values not added to existing extensions")
+	}
+
+	var doc struct {
+		Points []struct {
+			D float64 `xml:"extensions>declination"`
+			F float64 `xml:"extensions>totalintensity"`
+		} `xml:"trk>trkseg>trkpt"`
+		Waypoints []struct {
+			D float64 `xml:"extensions>declination"`
+		} `xml:"wpt"`
+	}
+	if err = xml.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Points) != 2 || len(doc.Waypoints) != 1 {
+		t.Fatalf("expected 2 track points and 1 waypoint, got %d and %d", len(doc.Points), len(doc.Waypoints))
+	}
+	testDiff("trkpt 1 D", doc.Points[0].D, declination(40, -105.3, 1650, time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)), 0.005, t)
+	testDiff("trkpt 2 D", doc.Points[1].D, declination(40.1, -105.2, 1700, time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)), 0.005, t)
+	testDiff("wpt D", doc.Waypoints[0].D, declination(47.6, -122.3, 0, date), 0.005, t)
+	if doc.Points[0].F < 40000 || doc.Points[0].F > 60000 {
+		t.Errorf("unexpected total intensity %v", doc.Points[0].F)
+	}
+
+	// A fixed date overrides the times of the points
+	out, _ = annotateGPX([]byte(gpx), &calculator{date: date})
+	doc.Points, doc.Waypoints = nil, nil
+	_ = xml.Unmarshal(out, &doc)
+	testDiff("fixed date D", doc.Points[0].D, declination(40, -105.3, 1650, date), 0.005, t)
+
+	if _, err = annotateGPX([]byte(`<gpx><wpt lat="91" lon="0"/></gpx>`), &calculator{date: date}); err == nil {
+		t.Error("expected an error for an invalid latitude")
+	}
+}
+
+const kml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+<Document>
+  <Placemark><name>Point</name><TimeStamp><when>2021-07-01</when></TimeStamp>
+    <Point><coordinates>-105.3,40.0,1650</coordinates></Point></Placemark>
+  <Placemark><name>Line</name>
+    <LineString><coordinates>
+      -105.3,40.0 -105.2,40.1
+    </coordinates></LineString></Placemark>
+  <Placemark><ExtendedData><Data name="id"><value>3</value></Data></ExtendedData>
+    <gx:Track><when>2021-07-01T12:00:00Z</when><when>2022-07-01T12:00:00Z</when>
+      <gx:coord>-105.3 40.0 1650</gx:coord><gx:coord>-105.2 40.1 1700</gx:coord></gx:Track></Placemark>
+</Document>
+</kml>
+`
+
+func TestKML(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	out, err := annotateKML([]byte(kml), &calculator{now: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(out))
+
+	var doc struct {
+		Placemarks []struct {
+			Data []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value"`
+			} `xml:"ExtendedData>Data"`
+		} `xml:"Document>Placemark"`
+	}
+	if err = xml.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Placemarks) != 3 {
+		t.Fatalf("expected 3 placemarks, got %d", len(doc.Placemarks))
+	}
+	decl := func(i int) (ds []float64) {
+		for _, d := range doc.Placemarks[i].Data {
+			if d.Name == "declination" {
+				for _, v := range strings.Fields(d.Value) {
+					x, _ := strconv.ParseFloat(v, 64)
+					ds = append(ds, x)
+				}
+			}
+		}
+		return ds
+	}
+	if ds := decl(0); len(ds) != 1 {
+		t.Errorf("expected one declination for a Point, got %v", ds)
+	} else {
+		testDiff("Point D", ds[0], declination(40, -105.3, 1650, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)), 0.005, t)
+	}
+	if ds := decl(1); len(ds) != 2 {
+		t.Errorf("expected two declinations for a LineString, got %v", ds)
+	} else {
+		testDiff("LineString D", ds[1], declination(40.1, -105.2, 0, date), 0.005, t)
+	}
+	if ds := decl(2); len(ds) != 2 || len(doc.Placemarks[2].Data) != 5 {
+		t.Errorf("expected two declinations added to the existing data for a gx:Track, got %v", doc.Placemarks[2].Data)
+	} else {
+		testDiff("gx:Track D", ds[1], declination(40.1, -105.2, 1700, time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)), 0.005, t)
+	}
+	if !strings.Contains(string(out), "<name>Line</name>\n    <ExtendedData>") {
+		t.Error("ExtendedData should be added before the geometry")
+	}
+}
+
+const geojson = `{"type": "FeatureCollection", "features": [
+  {"type": "Feature", "properties": {"name": "Point", "time": "2021-07-01T00:00:00Z"},
+   "geometry": {"type": "Point", "coordinates": [-105.3, 40.0, 1650]}},
+  {"type": "Feature", "properties": {"coordTimes": ["2021-07-01T12:00:00Z", "2022-07-01T12:00:00Z"]},
+   "geometry": {"type": "LineString", "coordinates": [[-105.3, 40.0], [-105.2, 40.1]]}},
+  {"type": "Feature", "properties": null, "geometry": null}
+]}`
+
+func TestGeoJSON(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	out, err := annotateGeoJSON([]byte(geojson), &calculator{now: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(out))
+
+	var doc struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err = json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	p := doc.Features[0].Properties
+	if p["name"] != "Point" {
+		t.Errorf("properties not preserved: %v", p)
+	}
+	// GeoJSON heights are above the ellipsoid
+	loc := egm96.NewLocationGeodetic(40, 360-105.3, 1650)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	if d, ok := p["declination"].(float64); !ok {
+		t.Errorf("expected a single declination for a Point, got %v", p["declination"])
+	} else {
+		testDiff("Point D", d, mf.D(), 0.005, t)
+	}
+	if ds, ok := doc.Features[1].Properties["inclination"].([]interface{}); !ok || len(ds) != 2 {
+		t.Errorf("expected two inclinations for a LineString, got %v", doc.Features[1].Properties["inclination"])
+	}
+	if doc.Features[2].Properties != nil {
+		t.Errorf("feature without geometry should not be annotated")
+	}
+
+	if _, err = annotateGeoJSON([]byte(`{"type": "Point", "coordinates": [0, 0]}`), &calculator{now: date}); err == nil {
+		t.Error("expected an error for a bare geometry")
+	}
+}
+
+func TestGeoJSONLayout(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	out, err := annotateGeoJSON([]byte(geojson), &calculator{now: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is unchanged apart from the added properties
+	for _, s := range []string{
+		`{"type": "FeatureCollection", "features": [` + "\n",
+		`{"type": "Feature", "properties": {"name": "Point", "time": "2021-07-01T00:00:00Z", "declination": `,
+		`"geometry": {"type": "Point", "coordinates": [-105.3, 40.0, 1650]}},` + "\n",
+		`"coordTimes": ["2021-07-01T12:00:00Z", "2022-07-01T12:00:00Z"], "declination": [`,
+		`{"type": "Feature", "properties": null, "geometry": null}` + "\n]}",
+	} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected %s in the output:\n%s", s, out)
+		}
+	}
+	// Annotating again replaces the properties in place
+	again, err := annotateGeoJSON(out, &calculator{now: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(out) {
+		t.Errorf("annotating again changed the output:\n%s", again)
+	}
+
+	// Properties are added to indented files in the same layout
+	feature := `{
+  "type": "Feature",
+  "geometry": {
+    "type": "Point",
+    "coordinates": [-105.3, 40.0]
+  },
+  "properties": {
+    "name": "Point"
+  }
+}
+`
+	if out, err = annotateGeoJSON([]byte(feature), &calculator{now: date}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), feature[:strings.Index(feature, `"name": "Point"`)]+`"name": "Point",
+    "declination": `) || !strings.HasSuffix(string(out), "\n  }\n}\n") {
+		t.Errorf("unexpected layout:\n%s", out)
+	}
+	feature = `{"geometry": {"type": "Point", "coordinates": [-105.3, 40.0]}, "type": "Feature"}`
+	if out, err = annotateGeoJSON([]byte(feature), &calculator{now: date}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), feature[:len(feature)-1]+`, "properties": {"declination": `) {
+		t.Errorf("unexpected layout:\n%s", out)
+	}
+	feature = `{"type": "Feature", "properties": null, "geometry": {"type": "Point", "coordinates": [-105.3, 40.0]}}`
+	if out, err = annotateGeoJSON([]byte(feature), &calculator{now: date}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), `{"type": "Feature", "properties": {"declination": `) {
+		t.Errorf("unexpected layout:\n%s", out)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	if err := wmm.LoadWMMCOF(""); err != nil {
+		t.Fatal(err)
+	}
+	c := &calculator{}
+	if _, err := c.values(40, -105.3, 1650, false, time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if c.warning != nil {
+		t.Errorf("unexpected warning %s", c.warning)
+	}
+
+	// A point dated outside the validity period of the model
+	if _, err := c.values(40, -105.3, 1650, false, time.Date(2031, 7, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if c.warning == nil || !strings.Contains(c.warning.Error(), "outside of validity period") {
+		t.Errorf("expected a warning for a date outside the model, got %v", c.warning)
+	}
+
+	// A whole track calculated at a date before the model
+	c = &calculator{date: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := annotateGPX([]byte(gpx), c); err != nil {
+		t.Fatal(err)
+	}
+	if c.warning == nil {
+		t.Error("expected a warning for a date before the model")
+	}
+}
+
+func TestGridVariation(t *testing.T) {
+	// The grid variation is from the UTM or UPS grid north at the point, also
+	// poleward of 55° where the NOAA GV is from the polar stereographic grid
+	tm := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	c := &calculator{}
+	for _, p := range [][2]float64{{40, -105.3}, {70, -148.5}, {-78, 166.7}, {88, 10}} {
+		vals, err := c.values(p[0], p[1], 0, true, tm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc := egm96.NewLocationGeodetic(p[0], p[1]+360, 0)
+		uc, err := utm.NewCoord(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDiff(fmt.Sprintf("GV at %v", p), vals[3], lookup.AngleDiff(vals[0]-uc.Convergence(), 0), 1e-9, t)
+	}
+}
@@ -0,0 +1,145 @@
+// Package format writes computed magnetic fields and other tables of results in
+// the machine-readable output formats shared by the command line programs:
+// JSON, CSV and TSV.
+//
+// Each row is written as a flat set of named columns, so the JSON keys are the
+// same as the CSV and TSV column headers.  JSON output has one object per line.
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// Formats lists the supported output format names.
+var Formats = []string{"json", "csv", "tsv"}
+
+// Record is a magnetic field together with the model and date it was computed for.
+type Record struct {
+	Model     string  // Name of the coefficients file, e.g. WMM-2020
+	Epoch     float64 // Epoch of the coefficients file as a decimal year
+	Date      float64 // Date the field was computed for as a decimal year
+	Field     wmm.MagneticField
+	Spherical bool // Whether to write X, Y and Z on the spherical rather than ellipsoidal axes
+}
+
+// NewRecord returns a Record for a field computed with the currently loaded
+// WMM coefficients at the decimal year date.
+func NewRecord(mf wmm.MagneticField, date float64, spherical bool) (r Record) {
+	return Record{
+		Model:     wmm.COFName,
+		Epoch:     float64(wmm.Epoch),
+		Date:      date,
+		Field:     mf,
+		Spherical: spherical,
+	}
+}
+
+// Columns lists the names of the columns written for each Record, in order.
+var Columns = []string{"model", "epoch", "date", "latitude", "longitude", "height", "axes",
+	"x", "y", "z", "h", "f", "i", "d", "gv",
+	"dx", "dy", "dz", "dh", "df", "di", "dd", "dgv",
+	"err_x", "err_y", "err_z", "err_h", "err_f", "err_i", "err_d"}
+
+// values returns the values of the columns of the Record, in order.
+// Angles are in degrees, field strengths in nT and rates of change per year.
+// The height is in meters above the WGS84 ellipsoid.
+func (r Record) values() (vals []interface{}) {
+	mf := r.Field
+	loc := mf.Location()
+	lat, lng, h := loc.Geodetic()
+	axes := "ellipsoidal"
+	x, y, z, dx, dy, dz := mf.Ellipsoidal()
+	if r.Spherical {
+		axes = "spherical"
+		x, y, z, dx, dy, dz = mf.Spherical()
+	}
+	return []interface{}{r.Model, r.Epoch, r.Date, lat / egm96.Deg, lng / egm96.Deg, h, axes,
+		x, y, z, mf.H(), mf.F(), mf.I(), mf.D(), mf.GV(loc),
+		dx, dy, dz, mf.DH(), mf.DF(), mf.DI(), mf.DD(), mf.DGV(),
+		mf.ErrX(), mf.ErrY(), mf.ErrZ(), mf.ErrH(), mf.ErrF(), mf.ErrI(), mf.ErrD()}
+}
+
+// MarshalJSON encodes the Record as a flat JSON object keyed by the Columns.
+func (r Record) MarshalJSON() ([]byte, error) {
+	return marshalRow(Columns, r.values())
+}
+
+// marshalRow encodes the values as a JSON object keyed by the columns, in order.
+func marshalRow(columns []string, vals []interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, v := range vals {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%q:%s", columns[i], val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// fields returns the values formatted for CSV or TSV output.
+func fields(vals []interface{}) (ss []string) {
+	for _, v := range vals {
+		switch v := v.(type) {
+		case float64:
+			ss = append(ss, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			ss = append(ss, fmt.Sprint(v))
+		}
+	}
+	return ss
+}
+
+// Write writes the records to w in the named format, one of Formats.
+// CSV and TSV output starts with a header line of the Columns.
+func Write(w io.Writer, format string, records ...Record) (err error) {
+	rows := make([][]interface{}, len(records))
+	for i, r := range records {
+		rows[i] = r.values()
+	}
+	return WriteTable(w, format, Columns, rows...)
+}
+
+// WriteTable writes rows of values in the named columns to w in the named format,
+// one of Formats.  The values are typically float64s or strings.
+// CSV and TSV output starts with a header line of the columns.
+func WriteTable(w io.Writer, format string, columns []string, rows ...[]interface{}) (err error) {
+	switch format {
+	case "json":
+		for _, row := range rows {
+			b, err := marshalRow(columns, row)
+			if err != nil {
+				return err
+			}
+			if _, err = w.Write(append(b, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if format == "tsv" {
+			cw.Comma = '\t'
+		}
+		_ = cw.Write(columns)
+		for _, row := range rows {
+			_ = cw.Write(fields(row))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown output format %s, must be one of %v", format, Formats)
+}
@@ -0,0 +1,108 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+func testRecord(t *testing.T, spherical bool) (r Record) {
+	if err := wmm.LoadWMMCOF("../../pkg/wmm/testdata/WMM2020.COF"); err != nil {
+		t.Fatal(err)
+	}
+	loc := egm96.NewLocationGeodetic(43, 93, 65e3)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, wmm.DecimalYear(2020).ToTime())
+	return NewRecord(mf, 2020, spherical)
+}
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(&b, "json", testRecord(t, false)); err != nil {
+		t.Fatal(err)
+	}
+	var vals map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &vals); err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != len(Columns) {
+		t.Errorf("JSON has %d values, expected %d: %s", len(vals), len(Columns), b.String())
+	}
+	if vals["model"] != "WMM-2020" || vals["axes"] != "ellipsoidal" {
+		t.Errorf("JSON has model %v and axes %v", vals["model"], vals["axes"])
+	}
+	// Values from the WMM2020 test values
+	for k, v := range map[string]float64{"epoch": 2020, "date": 2020, "latitude": 43, "longitude": 93, "height": 65000,
+		"x": 24375.3, "y": 303.2, "z": 49691.4, "f": 55348.7, "d": 0.71, "dz": 101.1, "err_f": 148} {
+		testDiff("JSON "+k, vals[k].(float64), v, 0.06, t)
+	}
+}
+
+func TestDelimited(t *testing.T) {
+	for _, format := range []string{"csv", "tsv"} {
+		var b bytes.Buffer
+		if err := Write(&b, format, testRecord(t, true), testRecord(t, false)); err != nil {
+			t.Fatal(err)
+		}
+		cr := csv.NewReader(&b)
+		if format == "tsv" {
+			cr.Comma = '\t'
+		}
+		rows, err := cr.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(Columns, ",") {
+			t.Fatalf("%s output has the wrong header or number of rows: %v", format, rows)
+		}
+		if rows[1][6] != "spherical" || rows[2][6] != "ellipsoidal" {
+			t.Errorf("%s output has axes %s and %s", format, rows[1][6], rows[2][6])
+		}
+		// Spherical and ellipsoidal Y components agree but X does not
+		xs, _ := strconv.ParseFloat(rows[1][7], 64)
+		xe, _ := strconv.ParseFloat(rows[2][7], 64)
+		ys, _ := strconv.ParseFloat(rows[1][8], 64)
+		ye, _ := strconv.ParseFloat(rows[2][8], 64)
+		testDiff(format+" y", ys, ye, 1e-9, t)
+		if xs-xe < 1 && xe-xs < 1 {
+			t.Errorf("%s spherical x %v is too close to ellipsoidal x %v", format, xs, xe)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", testRecord(t, false)); err == nil {
+		t.Errorf("Write accepted an unknown format")
+	}
+}
+
+func TestTable(t *testing.T) {
+	var b bytes.Buffer
+	rows := [][]interface{}{{"a", 1.5}, {"b", -2.0}}
+	if err := WriteTable(&b, "json", []string{"name", "value"}, rows...); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "{\"name\":\"a\",\"value\":1.5}\n{\"name\":\"b\",\"value\":-2}\n" {
+		t.Errorf("JSON table is %s", b.String())
+	}
+	b.Reset()
+	if err := WriteTable(&b, "tsv", []string{"name", "value"}, rows...); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "name\tvalue\na\t1.5\nb\t-2\n" {
+		t.Errorf("TSV table is %q", b.String())
+	}
+}
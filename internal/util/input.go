@@ -0,0 +1,114 @@
+package parsing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prompts are the prompts for each input of a point and date entered interactively.
+var Prompts = map[string]string{
+	"latitude": "Please enter latitude North Latitude positive. " +
+		"For example: 30, 30, 30 (D,M,S) or 30.508 (Decimal Degrees) (both are north). " +
+		"Or enter a UTM, UPS or MGRS grid reference, for example 38n 444141 3684706 or 38SMB4414084706. ",
+	"longitude": "Please enter longitude East longitude positive, West negative. " +
+		"For example: -100.5 or -100, 30, 0 for 100.5 degrees west. ",
+	"altitude": "Please enter height above mean sea level (in kilometers). " +
+		"[For height above WGS-84 Ellipsoid prefix E, for example (E20.1)]. " +
+		"Feet or a flight level may also be entered, for example 35000ft or FL350. ",
+	"date": "Please enter the decimal year or calendar date (YYYY.yyy, MM DD YYYY or MM/DD/YYYY) ",
+}
+
+var (
+	userIn  *bufio.Reader = bufio.NewReader(os.Stdin) // Where interactive input is read from
+	userOut io.Writer     = os.Stdout                 // Where prompts are written
+)
+
+// ReadUserInput writes the prompt to standard output and returns the next line
+// read from standard input, with surrounding space removed.
+func ReadUserInput(prompt string) (inp string) {
+	inp, _ = readLine(prompt)
+	return inp
+}
+
+// readLine writes the prompt and returns the next line of input, with an error
+// if the input ended before a line was read.
+func readLine(prompt string) (inp string, err error) {
+	fmt.Fprint(userOut, prompt)
+	inp, err = userIn.ReadString('\n')
+	if inp!="" {
+		err = nil
+	}
+	return strings.TrimSpace(inp), err
+}
+
+// PromptPoint asks the user for a latitude and longitude, or a grid reference
+// in place of both, and an altitude, until each can be parsed, and returns them
+// as ParseLatLng and ParseAltitude would.  Entering q, or the end of the input,
+// exits the program.
+func PromptPoint() (lat, lng, alt float64, hae bool) {
+	var (
+		err     error
+		gridRef bool
+	)
+
+	err = fmt.Errorf("")
+	for err!=nil {
+		input := promptOrQuit("latitude")
+		lat, err = ParseLatLng(input)
+		if err!=nil {
+			var errGrid error
+			if lat, lng, errGrid = ParseGridRef(input); errGrid==nil {
+				err = nil
+				gridRef = true
+			} else {
+				fmt.Fprintln(userOut, err)
+			}
+		}
+	}
+
+	err = fmt.Errorf("")
+	if gridRef {
+		err = nil
+	}
+	for err!=nil {
+		lng, err = ParseLatLng(promptOrQuit("longitude"))
+		if err!=nil {
+			fmt.Fprintln(userOut, err)
+		}
+	}
+
+	err = fmt.Errorf("")
+	for err!=nil {
+		alt, hae, err = ParseAltitude(promptOrQuit("altitude"))
+		if err!=nil {
+			fmt.Fprintln(userOut, err)
+		}
+	}
+	return lat, lng, alt, hae
+}
+
+// PromptTime asks the user for a date until it can be parsed, and returns it
+// as ParseTime would.  Entering q, or the end of the input, exits the program.
+func PromptTime() (dYear float64) {
+	err := fmt.Errorf("")
+	for err!=nil {
+		dYear, err = ParseTime(promptOrQuit("date"))
+		if err!=nil {
+			fmt.Fprintln(userOut, err)
+		}
+	}
+	return dYear
+}
+
+// promptOrQuit reads the input named by key, exiting if it is q or the input has ended.
+func promptOrQuit(key string) (inp string) {
+	inp, err := readLine(Prompts[key])
+	if inp=="q" || err!=nil {
+		fmt.Fprintln(userOut, "Goodbye")
+		os.Exit(1)
+	}
+	return inp
+}
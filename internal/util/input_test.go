@@ -0,0 +1,44 @@
+package parsing
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// setUserInput replaces the interactive input and output for a test and returns a function restoring them.
+func setUserInput(input string, out *bytes.Buffer) func() {
+	oldIn, oldOut := userIn, userOut
+	userIn, userOut = bufio.NewReader(strings.NewReader(input)), out
+	return func() {
+		userIn, userOut = oldIn, oldOut
+	}
+}
+
+func TestPromptPoint(t *testing.T) {
+	var out bytes.Buffer
+	defer setUserInput("north\n30.5\n  -100, 30, 0  \nE20.1\n", &out)()
+	lat, lng, alt, hae := PromptPoint()
+	testDiff("latitude", lat, 30.5, eps, t)
+	testDiff("longitude", lng, -100.5, eps, t)
+	testDiff("altitude", alt, 20.1, eps, t)
+	if !hae {
+		t.Errorf("%sexpected a height above the ellipsoid%s", red, reset)
+	}
+	if n := strings.Count(out.String(), Prompts["latitude"]); n != 2 {
+		t.Errorf("%sexpected the latitude to be asked for twice, got %d%s", red, n, reset)
+	}
+
+	// A grid reference gives both the latitude and longitude
+	out.Reset()
+	defer setUserInput("38n 444141 3684706\n35000ft\n03/15/2022\n", &out)()
+	lat, lng, alt, hae = PromptPoint()
+	testDiff("grid latitude", lat, 33.3, 0.01, t)
+	testDiff("grid longitude", lng, 44.4, 0.01, t)
+	testDiff("altitude in feet", alt, 10.668, eps, t)
+	if hae || strings.Contains(out.String(), Prompts["longitude"]) {
+		t.Errorf("%sexpected no longitude prompt and a height above mean sea level%s", red, reset)
+	}
+	testDiff("date", PromptTime(), 2022+(31+28+14)/365.0, 1e-9, t)
+}
@@ -3,6 +3,10 @@ package parsing
 
 import (
 	"fmt"
+	"math"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/isa"
+	"github.com/westphae/geomag/pkg/utm"
 	"github.com/westphae/geomag/pkg/wmm"
 	"strconv"
 	"strings"
@@ -65,13 +69,54 @@ func ParseLatLng(inp string) (l float64, err error) {
 	return sgn*(float64(d)+(float64(m)+s/60)/60), nil
 }
 
+// ParseGridRef takes an input string representing a position in grid coordinates,
+// and returns the latitude and longitude in degrees.
+//
+// Possible formats:
+// ZZh EEEEEE NNNNNNN (UTM, with hemisphere h of n or s)
+// h EEEEEEE NNNNNNN (UPS)
+// ZZBCR[EEEEENNNNN] (MGRS, giving the center of the square)
+func ParseGridRef(inp string) (lat, lng float64, err error) {
+	c, err := utm.Parse(inp)
+	if err!=nil {
+		var errMGRS error
+		if c, _, errMGRS = utm.ParseMGRS(inp); errMGRS!=nil {
+			if len(strings.Fields(inp))>=3 {
+				return 0, 0, err
+			}
+			return 0, 0, errMGRS
+		}
+	}
+	lat, lng, _ = c.Location().Geodetic()
+	return lat/egm96.Deg, lng/egm96.Deg, nil
+}
+
 // ParseAltitude takes an input string in various forms, representing an altitude,
 // and returns the float representation and whether it's height above ellipsoid or
 // height above sea level.
 //
+// The height is always returned in kilometers; feet and flight levels are converted.
+// A flight level is a pressure altitude, and is converted to a height above
+// mean sea level using the ICAO Standard Atmosphere.
+//
 // Possible formats:
 // [E][-]HHH.HHHH
+// [E][-]HHHHH[ ]ft
+// FLnnn
 func ParseAltitude(inp string) (height float64, hae bool, err error) {
+	inp = strings.TrimSpace(inp)
+	if strings.HasPrefix(strings.ToUpper(inp), "FL") {
+		var fl float64
+		fl, err = strconv.ParseFloat(strings.TrimSpace(inp[2:]), 64)
+		if err!=nil {
+			return 0, false, fmt.Errorf("invalid flight level: %s", inp)
+		}
+		return isa.GeopotentialToGeometric(isa.FlightLevel(fl))/1000, false, nil
+	}
+	ft := strings.HasSuffix(strings.ToLower(inp), "ft")
+	if ft {
+		inp = strings.TrimSpace(inp[:len(inp)-2])
+	}
 	ii:=strings.LastIndex(inp, "E")
 	if ii>0 {
 		return 0, false, fmt.Errorf("%s prefix is invalid", inp[0:ii])
@@ -81,6 +126,9 @@ func ParseAltitude(inp string) (height float64, hae bool, err error) {
 		inp = inp[1:]
 	}
 	height, err = strconv.ParseFloat(inp, 64)
+	if ft {
+		height *= egm96.Ft/1000
+	}
 	return
 }
 
@@ -116,4 +164,131 @@ func ParseTime(inp string) (dYear float64, err error) {
 			0, 0, 0, 0, time.UTC))), nil
 	}
 	return
-}
\ No newline at end of file
+}
+// maxRange is the largest number of values ParseRange will return.
+const maxRange = 1000000
+
+// ParseRange takes an input string representing a single value or an evenly spaced
+// range of values, and returns the values in order.  The start, end and step
+// are each parsed with parse, so they may be in any format it accepts.
+// The step must be positive; the range runs downwards if end is less than start.
+// The end is included if it falls on a step.
+//
+// Possible formats:
+// start
+// start:end:step
+func ParseRange(inp string, parse func(string) (float64, error)) (vals []float64, err error) {
+	ls := strings.Split(inp, ":")
+	if len(ls)!=1 && len(ls)!=3 {
+		return nil, fmt.Errorf("%s is not in the format start:end:step", inp)
+	}
+	var v [3]float64
+	for i, s := range ls {
+		if v[i], err = parse(strings.TrimSpace(s)); err!=nil {
+			return nil, err
+		}
+	}
+	if len(ls)==1 {
+		return []float64{v[0]}, nil
+	}
+	start, end, step := v[0], v[1], v[2]
+	if step<=0 {
+		return nil, fmt.Errorf("step %s must be positive", ls[2])
+	}
+	if end<start {
+		step = -step
+	}
+	n := int((end-start)/step*(1+1e-12)) + 1
+	if n>maxRange {
+		return nil, fmt.Errorf("%s has more than %d values", inp, maxRange)
+	}
+	for i:=0; i<n; i++ {
+		vals = append(vals, start+float64(i)*step)
+	}
+	return vals, nil
+}
+
+// ParsePoint takes the fields of a line of a NOAA wmm_file style input file
+// and returns the Location and decimal year they represent.
+//
+// The date is in any format accepted by ParseTime, or YYYY,MM,DD.
+// The coordinate system is D for geodetic coordinates with the altitude above
+// mean sea level, E for geodetic coordinates with the altitude above the
+// WGS-84 ellipsoid, or C for geocentric (spherical) coordinates with the
+// altitude measured from the center of the Earth.
+// The altitude is prefixed with K for kilometers, M for meters or F for feet,
+// e.g. K10.5, and the latitude and longitude are in any format accepted by ParseLatLng.
+func ParsePoint(date, coord, alt, lat, lng string) (loc egm96.Location, dYear float64, err error) {
+	if ds := strings.Split(date, ","); len(ds)==3 {
+		date = strings.Join([]string{ds[1], ds[2], ds[0]}, " ")
+	}
+	if dYear, err = ParseTime(date); err!=nil {
+		return loc, 0, fmt.Errorf("invalid date %s", date)
+	}
+
+	if len(alt)<2 {
+		return loc, 0, fmt.Errorf("invalid altitude %s", alt)
+	}
+	var scale float64
+	switch alt[0] {
+	case 'K', 'k':
+		scale = 1000
+	case 'M', 'm':
+		scale = 1
+	case 'F', 'f':
+		scale = egm96.Ft
+	default:
+		return loc, 0, fmt.Errorf("altitude %s must be prefixed with K, M or F", alt)
+	}
+	h, err := strconv.ParseFloat(alt[1:], 64)
+	if err!=nil {
+		return loc, 0, fmt.Errorf("invalid altitude %s", alt)
+	}
+	h *= scale
+
+	latitude, err := ParseLatLng(lat)
+	if err!=nil {
+		return loc, 0, err
+	}
+	if latitude < -90 || latitude > 90 {
+		return loc, 0, fmt.Errorf("latitude %s is outside the range -90 to 90", lat)
+	}
+	longitude, err := ParseLatLng(lng)
+	if err!=nil {
+		return loc, 0, err
+	}
+	if longitude < -180 || longitude >= 360 {
+		return loc, 0, fmt.Errorf("longitude %s is outside the range -180 to 360", lng)
+	}
+	for longitude<0 {
+		longitude += 360
+	}
+
+	switch strings.ToUpper(coord) {
+	case "D":
+		loc, err = egm96.NewLocationMSL(latitude, longitude, h)
+	case "E":
+		loc = egm96.NewLocationGeodetic(latitude, longitude, h)
+	case "C":
+		phi, lambda := latitude*egm96.Deg, longitude*egm96.Deg
+		loc = egm96.NewLocationECEF(h*math.Cos(phi)*math.Cos(lambda), h*math.Cos(phi)*math.Sin(lambda), h*math.Sin(phi))
+	default:
+		err = fmt.Errorf("coordinate system %s must be D, E or C", coord)
+	}
+	return loc, dYear, err
+}
+
+// NewLocation returns the Location at latitude lat and longitude lng in degrees,
+// east or west, and height h in meters above the WGS-84 ellipsoid if hae and
+// above mean sea level otherwise.  The longitude is reduced to the range
+// [0, 360) of the EGM96 geoid grid.  An error is returned if the height above
+// mean sea level cannot be converted, for example for a latitude beyond the poles.
+func NewLocation(lat, lng, h float64, hae bool) (loc egm96.Location, err error) {
+	if lng = math.Mod(lng, 360); lng<0 {
+		lng += 360
+	}
+	if hae {
+		return egm96.NewLocationGeodetic(lat, lng, h), nil
+	}
+	return egm96.NewLocationMSL(lat, lng, h)
+}
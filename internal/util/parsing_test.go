@@ -1,7 +1,12 @@
 
 package parsing
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
 
 const (
 	eps = 1e-9
@@ -70,18 +75,30 @@ func TestAltitudeGood(t *testing.T) {
 		"-123.45",
 		"E54.22",
 		"E-800.2",
+		"35000ft",
+		"E-1000 ft",
+		"FL350",
+		"fl 100",
 	}
 	outs := []float64{
 		99.95,
 		-123.45,
 		54.22,
 		-800.2,
+		10.668,
+		-0.3048,
+		10.685933259776,
+		3.049462183874,
 	}
 	outh := []bool{
 		false,
 		false,
 		true,
 		true,
+		false,
+		true,
+		false,
+		false,
 	}
 
 	for i, inp := range inps {
@@ -104,6 +121,9 @@ func TestAltitudeBad(t *testing.T) {
 		"EE12",
 		"99E99",
 		"ABC123",
+		"EFL350",
+		"FLABC",
+		"12ftft",
 	}
 
 	for _, inp := range inps {
@@ -160,4 +180,194 @@ func TestTimeBad(t *testing.T) {
 			t.Logf("%sParseTime correctly rejected %s%s", green, inp, reset)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestGridRefGood(t *testing.T) {
+	inps := []string{
+		"38n 444141 3684706",
+		"17T 630084 4833439",
+		"n 2000000 2000000",
+		"38SMB4414084706",
+		"38S MB 44140 84706",
+		"BAN0000000000",
+	}
+	lats := []float64{
+		33.3,
+		43.642567,
+		90,
+		33.3,
+		33.3,
+		-90,
+	}
+	lngs := []float64{
+		44.4,
+		-79.387139,
+		0,
+		44.4,
+		44.4,
+		0,
+	}
+
+	for i, inp := range inps {
+		lat, lng, err := ParseGridRef(inp)
+		if err!=nil {
+			t.Errorf("ParseGridRef got error %s", err)
+		}
+		testDiff(inp+" latitude", lat, lats[i], 1e-4, t)
+		if lats[i]!=90 && lats[i]!=-90 {
+			testDiff(inp+" longitude", lng, lngs[i], 1e-4, t)
+		}
+	}
+}
+
+func TestGridRefBad(t *testing.T) {
+	inps := []string{
+		"38n 444141",
+		"38I 444141 3684706",
+		"38SMB441408470",
+		"30.5",
+		"ABC123",
+	}
+
+	for _, inp := range inps {
+		_, _, err := ParseGridRef(inp)
+		if err==nil {
+			t.Errorf("%sParseGridRef incorrectly thought it could parse %s%s", red, inp, reset)
+		} else {
+			t.Logf("%sParseGridRef correctly rejected %s%s", green, inp, reset)
+		}
+	}
+}
+
+func TestRangeGood(t *testing.T) {
+	inps := []string{
+		"30.5",
+		"-10:10:5",
+		"10:-10:5",
+		"0:1:0.1",
+		"2020.0:2021.0:0.3",
+		"N30,30,0:N31:0.5",
+	}
+	outs := [][]float64{
+		{30.5},
+		{-10, -5, 0, 5, 10},
+		{10, 5, 0, -5, -10},
+		{0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+		{2020, 2020.3, 2020.6, 2020.9},
+		{30.5, 31},
+	}
+
+	for i, inp := range inps {
+		out, err := ParseRange(inp, ParseLatLng)
+		if err!=nil {
+			t.Errorf("%sParseRange got error %s%s", red, err, reset)
+			continue
+		}
+		if len(out)!=len(outs[i]) {
+			t.Errorf("%sParseRange got %d values for %s, expected %d%s", red, len(out), inp, len(outs[i]), reset)
+			continue
+		}
+		for j := range out {
+			testDiff(inp, out[j], outs[i][j], eps, t)
+		}
+	}
+}
+
+func TestRangeBad(t *testing.T) {
+	inps := []string{
+		"",
+		"0:10",
+		"0:10:0",
+		"0:10:-1",
+		"0:10:1:2",
+		"0:ABC:1",
+		"0:1e9:1",
+	}
+
+	for _, inp := range inps {
+		_, err := ParseRange(inp, ParseLatLng)
+		if err==nil {
+			t.Errorf("%sParseRange incorrectly thought it could parse %s%s", red, inp, reset)
+		} else {
+			t.Logf("%sParseRange correctly rejected %s%s", green, inp, reset)
+		}
+	}
+}
+
+func TestPointGood(t *testing.T) {
+	inps := [][]string{
+		{"2020.5", "E", "K28", "89", "-121"},
+		{"2020,7,2", "e", "M28000", "N89", "239"},
+		{"2021.0", "E", "F3000", "30,30,0", "W100 30 0"},
+		{"2022.25", "C", "K6371.2", "-45", "170"},
+	}
+	outs := [][]float64{
+		{2020.5, 89, 239, 28000},
+		{2020.5, 89, 239, 28000},
+		{2021, 30.5, 259.5, 914.4},
+	}
+
+	for i, inp := range inps[:3] {
+		loc, dYear, err := ParsePoint(inp[0], inp[1], inp[2], inp[3], inp[4])
+		if err!=nil {
+			t.Errorf("%sParsePoint got error %s%s", red, err, reset)
+			continue
+		}
+		lat, lng, h := loc.Geodetic()
+		testDiff(strings.Join(inp, " ")+" date", dYear, outs[i][0], 0.002, t)
+		testDiff(strings.Join(inp, " ")+" latitude", lat/egm96.Deg, outs[i][1], eps, t)
+		testDiff(strings.Join(inp, " ")+" longitude", lng/egm96.Deg, outs[i][2], eps, t)
+		testDiff(strings.Join(inp, " ")+" height", h, outs[i][3], eps, t)
+	}
+
+	inp := inps[3]
+	loc, _, err := ParsePoint(inp[0], inp[1], inp[2], inp[3], inp[4])
+	if err!=nil {
+		t.Fatalf("%sParsePoint got error %s%s", red, err, reset)
+	}
+	phi, lambda, r := loc.Spherical()
+	testDiff("geocentric latitude", phi/egm96.Deg, -45, 1e-6, t)
+	testDiff("geocentric longitude", lambda/egm96.Deg, 170, 1e-6, t)
+	testDiff("geocentric radius", r, 6371200, 1e-3, t)
+}
+
+func TestPointBad(t *testing.T) {
+	inps := [][]string{
+		{"2020.5x", "E", "K28", "89", "-121"},
+		{"2020.5", "G", "K28", "89", "-121"},
+		{"2020.5", "E", "28", "89", "-121"},
+		{"2020.5", "E", "Kxx", "89", "-121"},
+		{"2020.5", "E", "K28", "91", "-121"},
+		{"2020.5", "E", "K28", "89", "-181"},
+		{"2020,13,1", "E", "K28", "89", "-121"},
+	}
+
+	for _, inp := range inps {
+		_, _, err := ParsePoint(inp[0], inp[1], inp[2], inp[3], inp[4])
+		if err==nil {
+			t.Errorf("%sParsePoint incorrectly thought it could parse %v%s", red, inp, reset)
+		} else {
+			t.Logf("%sParsePoint correctly rejected %v%s", green, inp, reset)
+		}
+	}
+}
+
+func TestNewLocation(t *testing.T) {
+	for _, lng := range []float64{-105, 255, 615} {
+		loc, err := NewLocation(40, lng, 1000, false)
+		if err!=nil {
+			t.Fatalf("%sNewLocation got error %s%s", red, err, reset)
+		}
+		msl, _ := egm96.NewLocationMSL(40, 255, 1000)
+		if !loc.Equals(msl) {
+			t.Errorf("%sexpected %v for longitude %v, got %v%s", red, msl, lng, loc, reset)
+		}
+	}
+	loc, err := NewLocation(40, -105, 1000, true)
+	if err!=nil || !loc.Equals(egm96.NewLocationGeodetic(40, 255, 1000)) {
+		t.Errorf("%sexpected a height above the ellipsoid, got %v, %v%s", red, loc, err, reset)
+	}
+	if _, err = NewLocation(91, 0, 0, false); err==nil {
+		t.Errorf("%sNewLocation should fail beyond the pole%s", red, reset)
+	}
+}
@@ -0,0 +1,139 @@
+// Package contour traces contour lines through a regular grid of values by
+// marching squares, joining them into polylines that can be drawn onto maps of
+// the magnetic field.
+//
+// Points of the lines are in grid coordinates: X is the fractional column and
+// Y the fractional row of the grid, so that callers can map them to pixels or
+// to latitude and longitude as suits their projection.
+package contour
+
+import "math"
+
+// Point is a position in grid coordinates.
+type Point struct {
+	X, Y float64
+}
+
+// Line is a contour line through the grid.  A closed line ends at its first point.
+type Line []Point
+
+// Closed reports whether the line is a closed loop.
+func (l Line) Closed() bool {
+	return len(l) > 2 && l[0] == l[len(l)-1]
+}
+
+// Levels returns the multiples of interval from lo to hi inclusive.
+func Levels(lo, hi, interval float64) (levels []float64) {
+	if interval <= 0 || math.IsNaN(lo) || math.IsNaN(hi) {
+		return nil
+	}
+	for n := math.Ceil(lo / interval); n*interval <= hi; n++ {
+		levels = append(levels, n*interval)
+	}
+	return levels
+}
+
+// Lines returns the contour lines at level through z, a grid of values by row
+// then column.  Cells with a NaN corner are skipped, as are cells whose corner
+// values differ by more than maxStep if it is positive, so that no lines are
+// drawn across a discontinuity such as the ±180° wrap of the declination.
+func Lines(z [][]float64, level, maxStep float64) (lines []Line) {
+	nr := len(z)
+	if nr < 2 {
+		return nil
+	}
+	nc := len(z[0])
+
+	// Crossings are identified by the grid edge they lie on: the horizontal
+	// edge to the right of node (r, c) is 2*(r*nc+c) and the vertical edge below it is one more.
+	hEdge := func(r, c int) int { return 2 * (r*nc + c) }
+	vEdge := func(r, c int) int { return 2*(r*nc+c) + 1 }
+	var segs [][2]int
+	for r := 0; r < nr-1; r++ {
+		for c := 0; c < nc-1; c++ {
+			a, b, cc, d := z[r][c], z[r][c+1], z[r+1][c+1], z[r+1][c]
+			if math.IsNaN(a) || math.IsNaN(b) || math.IsNaN(cc) || math.IsNaN(d) {
+				continue
+			}
+			if maxStep > 0 && math.Max(math.Max(a, b), math.Max(cc, d))-math.Min(math.Min(a, b), math.Min(cc, d)) > maxStep {
+				continue
+			}
+			// Crossed edges in order around the cell: top, right, bottom, left
+			var crossed []int
+			for _, e := range []struct {
+				v0, v1 float64
+				edge   int
+			}{{a, b, hEdge(r, c)}, {b, cc, vEdge(r, c+1)}, {d, cc, hEdge(r+1, c)}, {a, d, vEdge(r, c)}} {
+				if (e.v0 >= level) != (e.v1 >= level) {
+					crossed = append(crossed, e.edge)
+				}
+			}
+			switch len(crossed) {
+			case 2:
+				segs = append(segs, [2]int{crossed[0], crossed[1]})
+			case 4:
+				// A saddle: the mean of the corners decides which opposite corners are joined
+				top, right, bottom, left := crossed[0], crossed[1], crossed[2], crossed[3]
+				if ((a+b+cc+d)/4 >= level) == (a >= level) {
+					segs = append(segs, [2]int{top, right}, [2]int{bottom, left})
+				} else {
+					segs = append(segs, [2]int{top, left}, [2]int{right, bottom})
+				}
+			}
+		}
+	}
+
+	// point returns the position of the crossing on an edge.
+	point := func(edge int) Point {
+		n := edge / 2
+		r, c := n/nc, n%nc
+		v0 := z[r][c]
+		if edge%2 == 0 {
+			return Point{float64(c) + (level-v0)/(z[r][c+1]-v0), float64(r)}
+		}
+		return Point{float64(c), float64(r) + (level-v0)/(z[r+1][c]-v0)}
+	}
+
+	// Join the segments into lines through their shared crossings,
+	// starting with the open lines, which begin at a crossing on only one segment.
+	at := make(map[int][]int, 2*len(segs))
+	for i, s := range segs {
+		at[s[0]] = append(at[s[0]], i)
+		at[s[1]] = append(at[s[1]], i)
+	}
+	used := make([]bool, len(segs))
+	trace := func(i, start int) {
+		line := Line{point(start)}
+		edge := start
+		for !used[i] {
+			used[i] = true
+			s := segs[i]
+			if s[0] == edge {
+				edge = s[1]
+			} else {
+				edge = s[0]
+			}
+			line = append(line, point(edge))
+			for _, j := range at[edge] {
+				if !used[j] {
+					i = j
+					break
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	for i, s := range segs {
+		for _, e := range s {
+			if !used[i] && len(at[e]) == 1 {
+				trace(i, e)
+			}
+		}
+	}
+	for i, s := range segs {
+		if !used[i] {
+			trace(i, s[0])
+		}
+	}
+	return lines
+}
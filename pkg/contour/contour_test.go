@@ -0,0 +1,120 @@
+package contour
+
+import (
+	"math"
+	"testing"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+// grid returns the values of f at the nodes of an nr by nc grid.
+func grid(nr, nc int, f func(x, y float64) float64) (z [][]float64) {
+	for r := 0; r < nr; r++ {
+		row := make([]float64, nc)
+		for c := range row {
+			row[c] = f(float64(c), float64(r))
+		}
+		z = append(z, row)
+	}
+	return z
+}
+
+func TestPlane(t *testing.T) {
+	z := grid(5, 8, func(x, y float64) float64 { return 2*x + y })
+	lines := Lines(z, 7.5, 0)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(lines))
+	}
+	if lines[0].Closed() {
+		t.Error("expected an open line")
+	}
+	if ys := []float64{lines[0][0].Y, lines[0][len(lines[0])-1].Y}; math.Min(ys[0], ys[1]) != 0 || math.Max(ys[0], ys[1]) != 4 {
+		t.Errorf("expected a line from the first to the last row, got %v", lines[0])
+	}
+	for _, p := range lines[0] {
+		testDiff("plane value", 2*p.X+p.Y, 7.5, 1e-9, t)
+	}
+}
+
+func TestCone(t *testing.T) {
+	z := grid(21, 21, func(x, y float64) float64 { return math.Hypot(x-10, y-10) })
+	for _, level := range []float64{3, 7.5} {
+		lines := Lines(z, level, 0)
+		if len(lines) != 1 || !lines[0].Closed() {
+			t.Fatalf("expected 1 closed line at %v, got %v", level, lines)
+		}
+		for _, p := range lines[0] {
+			testDiff("cone radius", math.Hypot(p.X-10, p.Y-10), level, 0.1, t)
+		}
+	}
+	if lines := Lines(z, 20, 0); len(lines) != 0 {
+		t.Errorf("expected no lines outside the range of the values, got %d", len(lines))
+	}
+}
+
+func TestSaddle(t *testing.T) {
+	// The center of the cell is above the level, so the low corners are cut off
+	z := [][]float64{{1, 0}, {0, 1}}
+	lines := Lines(z, 0.4, 0)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	for _, l := range lines {
+		if len(l) != 2 {
+			t.Errorf("expected a single segment, got %v", l)
+			continue
+		}
+		// Each segment separates a low corner at (1, 0) or (0, 1)
+		cx, cy := math.Round((l[0].X+l[1].X)/2), math.Round((l[0].Y+l[1].Y)/2)
+		if cx+cy != 1 {
+			t.Errorf("segment %v does not cut off a low corner", l)
+		}
+	}
+}
+
+func TestSkippedCells(t *testing.T) {
+	// An angle wrapping from 170 to -170 between the third and fourth columns
+	z := grid(3, 6, func(x, y float64) float64 {
+		v := 150 + 10*x
+		if v > 180 {
+			v -= 360
+		}
+		return v
+	})
+	if lines := Lines(z, 0, 0); len(lines) != 1 {
+		t.Errorf("expected a spurious line across the wrap without maxStep, got %d", len(lines))
+	}
+	if lines := Lines(z, 0, 180); len(lines) != 0 {
+		t.Errorf("expected no lines across the wrap, got %d", len(lines))
+	}
+	if lines := Lines(z, 175, 180); len(lines) != 1 {
+		t.Errorf("expected the 175 line, got %d", len(lines))
+	}
+
+	z = grid(5, 5, func(x, y float64) float64 { return x })
+	z[2][2] = math.NaN()
+	lines := Lines(z, 1.5, 0)
+	if len(lines) != 2 {
+		t.Errorf("expected the line to be broken by the NaN node, got %d lines", len(lines))
+	}
+}
+
+func TestLevels(t *testing.T) {
+	levels := Levels(-12, 21, 5)
+	expected := []float64{-10, -5, 0, 5, 10, 15, 20}
+	if len(levels) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, levels)
+	}
+	for i := range levels {
+		testDiff("level", levels[i], expected[i], 1e-12, t)
+	}
+	if levels := Levels(0, 10, 0); levels != nil {
+		t.Errorf("expected no levels for a zero interval, got %v", levels)
+	}
+}
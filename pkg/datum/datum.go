@@ -0,0 +1,191 @@
+package datum
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// Datum identifies a geodetic datum in the built-in catalogue.
+type Datum string
+
+// The datums in the built-in catalogue.
+const (
+	ITRF2014 Datum = "ITRF2014"    // International Terrestrial Reference Frame 2014
+	ITRF2008 Datum = "ITRF2008"    // International Terrestrial Reference Frame 2008
+	WGS84    Datum = "WGS84"       // World Geodetic System 1984, recent (G1762 and later) realizations
+	NAD83    Datum = "NAD83(2011)" // North American Datum 1983, 2011 realization
+	ETRF2000 Datum = "ETRF2000"    // European Terrestrial Reference Frame 2000
+	ETRF2014 Datum = "ETRF2014"    // European Terrestrial Reference Frame 2014
+	ETRS89   Datum = ETRF2000      // European Terrestrial Reference System 1989, as realized by EUREF's recommended ETRF2000
+	GDA2020  Datum = "GDA2020"     // Geocentric Datum of Australia 2020
+	GDA94    Datum = "GDA94"       // Geocentric Datum of Australia 1994
+	OSGB36   Datum = "OSGB36"      // Ordnance Survey of Great Britain 1936
+	ED50     Datum = "ED50"        // European Datum 1950
+	NAD27    Datum = "NAD27"       // North American Datum 1927
+	Tokyo    Datum = "Tokyo"       // Tokyo datum, used in Japan and Korea before 2002
+)
+
+// link relates a datum to its parent datum in the catalogue: h transforms
+// coordinates in the parent datum to coordinates in the datum, and e is the
+// datum's reference ellipsoid.
+type link struct {
+	parent Datum
+	h      Helmert
+	e      egm96.Ellipsoid
+}
+
+// catalogue holds the transformation from each datum's parent datum.
+// ITRF2014 is the root of the catalogue.
+var catalogue = map[Datum]link{
+	ITRF2014: {e: egm96.GRS80},
+	// WGS84 (G1762) is aligned with ITRF2008, and WGS84 (G2139) with ITRF2014,
+	// to about 1cm, so no transformation is applied.
+	WGS84: {parent: ITRF2014, e: egm96.WGS84},
+	// IERS, ITRF2014 solution
+	ITRF2008: {e: egm96.GRS80, parent: ITRF2014, h: Helmert{
+		Tx: 0.0016, Ty: 0.0019, Tz: 0.0024, S: -0.02,
+		DTz: -0.0001, DS: 0.03,
+		Epoch: 2010,
+	}},
+	// Pearson & Snay, Introducing HTDP 3.1, GPS Solutions 17 (2013),
+	// rotations negated from the published coordinate frame convention
+	NAD83: {e: egm96.GRS80, parent: ITRF2008, h: Helmert{
+		Tx: 0.99343, Ty: -1.90331, Tz: -0.52655,
+		Rx: -25.91467, Ry: -9.42645, Rz: -11.59935,
+		S:   1.71504,
+		DTx: 0.00079, DTy: -0.00060, DTz: -0.00134,
+		DRx: -0.06667, DRy: 0.75744, DRz: 0.05133,
+		DS:    -0.10201,
+		Epoch: 1997,
+	}},
+	// Altamimi, EUREF Technical Note 1: Relationship and Transformation
+	// between the International and the European Terrestrial Reference Systems
+	ETRF2000: {e: egm96.GRS80, parent: ITRF2008, h: Helmert{
+		Tx: 0.0521, Ty: 0.0493, Tz: -0.0585,
+		Rx: 0.891, Ry: 5.390, Rz: -8.712,
+		S:   1.34,
+		DTx: 0.0001, DTy: 0.0001, DTz: -0.0018,
+		DRx: 0.081, DRy: 0.490, DRz: -0.792,
+		DS:    0.08,
+		Epoch: 2000,
+	}},
+	ETRF2014: {e: egm96.GRS80, parent: ITRF2014, h: Helmert{
+		DRx: 0.085, DRy: 0.531, DRz: -0.770,
+		Epoch: 1989,
+	}},
+	// ICSM, GDA2020 Technical Manual: the Australian plate motion model,
+	// rotations negated from the published coordinate frame convention
+	GDA2020: {e: egm96.GRS80, parent: ITRF2014, h: Helmert{
+		DRx: -1.50379, DRy: -1.18346, DRz: -1.20716,
+		Epoch: 2020,
+	}},
+	// ICSM, GDA2020 Technical Manual: the inverse of the GDA94 to GDA2020
+	// transformation, rotations negated from the published coordinate frame convention
+	GDA94: {e: egm96.GRS80, parent: GDA2020, h: Helmert{
+		Tx: -0.06155, Ty: 0.01087, Tz: 0.04019,
+		Rx: -39.4924, Ry: -32.7221, Rz: -32.8979,
+		S:     9.994,
+		Epoch: 2020,
+	}},
+	// The legacy datums are related to WGS84 by published national or regional
+	// average transformations, which are much less accurate than those above.
+	// Ordnance Survey, A guide to coordinate systems in Great Britain: the
+	// national average transformation, good to about 5 m over Great Britain
+	OSGB36: {e: egm96.Airy1830, parent: WGS84, h: Helmert{
+		Tx: -446.448, Ty: 125.157, Tz: -542.060,
+		Rx: -150.2, Ry: -247.0, Rz: -842.1,
+		S: 20489.4,
+	}},
+	// NIMA TR8350.2, western Europe mean: a three-parameter shift, only good
+	// to 5-25 m, and worse outside western Europe
+	ED50: {e: egm96.International1924, parent: WGS84, h: Helmert{
+		Tx: 87, Ty: 98, Tz: 121,
+	}},
+	// NIMA TR8350.2, contiguous United States mean: a three-parameter shift,
+	// only good to 5-25 m, and worse outside the contiguous United States
+	NAD27: {e: egm96.Clarke1866, parent: WGS84, h: Helmert{
+		Tx: 8, Ty: -160, Tz: -176,
+	}},
+	// NIMA TR8350.2, Japan mean: a three-parameter shift, only good to 5-25 m,
+	// and worse outside Japan
+	Tokyo: {e: egm96.Bessel1841, parent: WGS84, h: Helmert{
+		Tx: 148, Ty: -507, Tz: -685,
+	}},
+}
+
+// Datums returns the names of all the datums in the built-in catalogue.
+func Datums() (ds []Datum) {
+	for d := range catalogue {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds
+}
+
+// Ellipsoid returns the reference ellipsoid of the datum, to which the
+// geodetic coordinates of Locations in the datum are referenced.
+// Datums not in the catalogue return the zero Ellipsoid.
+func (d Datum) Ellipsoid() (e egm96.Ellipsoid) {
+	return catalogue[d].e
+}
+
+// path returns the chain of datums from the catalogue root to d, inclusive.
+func path(d Datum) (p []Datum, err error) {
+	for {
+		lk, ok := catalogue[d]
+		if !ok {
+			return nil, fmt.Errorf("datum %s is not in the catalogue", d)
+		}
+		p = append([]Datum{d}, p...)
+		if lk.parent == "" {
+			return p, nil
+		}
+		d = lk.parent
+	}
+}
+
+// ConvertECEF transforms the ECEF coordinates x, y, z in meters, observed at
+// time t in the datum from, to the datum to.
+//
+// The transformation is carried out through the datums' nearest common
+// ancestor in the catalogue, each step being an exact Helmert transformation.
+func ConvertECEF(x, y, z float64, from, to Datum, t time.Time) (x2, y2, z2 float64, err error) {
+	pFrom, err := path(from)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	pTo, err := path(to)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	n := 0
+	for n < len(pFrom) && n < len(pTo) && pFrom[n] == pTo[n] {
+		n++
+	}
+	for i := len(pFrom) - 1; i >= n; i-- {
+		x, y, z = catalogue[pFrom[i]].h.InverseECEF(x, y, z, t)
+	}
+	for i := n; i < len(pTo); i++ {
+		x, y, z = catalogue[pTo[i]].h.TransformECEF(x, y, z, t)
+	}
+	return x, y, z, nil
+}
+
+// Convert transforms the location l, observed at time t in the datum from,
+// to the datum to.  The geodetic coordinates of l are taken as referenced to the
+// ellipsoid of from, and those of the result to the ellipsoid of to.
+//
+// For example, to use a NAD83 location with the WMM:
+//
+//	loc, err := datum.Convert(l, datum.NAD83, datum.WGS84, t)
+func Convert(l egm96.Location, from, to Datum, t time.Time) (loc egm96.Location, err error) {
+	x, y, z := l.ECEFOn(from.Ellipsoid())
+	if x, y, z, err = ConvertECEF(x, y, z, from, to, t); err != nil {
+		return egm96.Location{}, err
+	}
+	return egm96.NewLocationECEFOn(x, y, z, to.Ellipsoid()), nil
+}
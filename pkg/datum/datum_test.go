@@ -0,0 +1,156 @@
+package datum
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+const eps = 1e-6
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.6f, got %8.6f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.6f, got %8.6f", name, expected, actual)
+}
+
+// shift returns the north, east and up displacement in meters from l1 to l2.
+func shift(l1, l2 egm96.Location) (n, e, u float64) {
+	lat1, lng1, h1 := l1.Geodetic()
+	lat2, lng2, h2 := l2.Geodetic()
+	return (lat2 - lat1) * egm96.A, math.Remainder(lng2-lng1, 2*math.Pi) * egm96.A * math.Cos(lat1), h2 - h1
+}
+
+func TestHelmertRoundTrip(t *testing.T) {
+	tt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	x, y, z := 4027893.6719, 307045.9064, 4919475.1704
+	for _, d := range Datums() {
+		h := catalogue[d].h
+		x2, y2, z2 := h.TransformECEF(x, y, z, tt)
+		x1, y1, z1 := h.InverseECEF(x2, y2, z2, tt)
+		testDiff(fmt.Sprintf("%s x", d), x1, x, eps, t)
+		testDiff(fmt.Sprintf("%s y", d), y1, y, eps, t)
+		testDiff(fmt.Sprintf("%s z", d), z1, z, eps, t)
+	}
+}
+
+func TestHelmertParameters(t *testing.T) {
+	h := Helmert{Tx: 1, Rz: 1000, S: 1000, DTx: 0.5, DRz: 100, DS: -10, Epoch: 2010}
+	p := h.At(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	testDiff("Tx", p.Tx, 6, eps, t)
+	testDiff("Rz", p.Rz, 2000, eps, t)
+	testDiff("S", p.S, 900, eps, t)
+
+	// A point on the x axis is moved along y by a rotation about z
+	_, y, _ := h.TransformECEF(egm96.A, 0, 0, time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC))
+	testDiff("rotation", y, egm96.A*1000*mas, eps, t)
+
+	// Halfway through a year the parameters are halfway through their yearly change
+	p = h.At(time.Date(2021, 7, 2, 12, 0, 0, 0, time.UTC))
+	testDiff("decimal year", p.Epoch, 2021.5, 1e-9, t)
+	testDiff("Tx halfway through a year", p.Tx, 6.75, eps, t)
+	p = h.At(time.Date(2020, 7, 1, 12, 0, 0, 0, time.FixedZone("", -12*3600)))
+	testDiff("decimal year of a leap year in another zone", p.Epoch, 2020.5, 1e-9, t)
+}
+
+func TestConvertIdentities(t *testing.T) {
+	tt := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	l := egm96.NewLocationGeodetic(47.2, 8.5, 420)
+	for _, d := range Datums() {
+		l2, err := Convert(l, d, d, tt)
+		if err != nil {
+			t.Error(err)
+		}
+		n, e, u := shift(l, l2)
+		testDiff(fmt.Sprintf("%s to itself", d), math.Abs(n)+math.Abs(e)+math.Abs(u), 0, eps, t)
+
+		l3, _ := Convert(l, WGS84, d, tt)
+		l4, _ := Convert(l3, d, WGS84, tt)
+		n, e, u = shift(l, l4)
+		testDiff(fmt.Sprintf("WGS84 to %s and back", d), math.Abs(n)+math.Abs(e)+math.Abs(u), 0, eps, t)
+	}
+
+	if _, err := Convert(l, "OSGB37", WGS84, tt); err == nil {
+		t.Error("Convert should fail for an unknown datum")
+	}
+}
+
+func TestETRS89Drift(t *testing.T) {
+	// ETRF2014 coincides with ITRF2014 at 1989.0; since then stations on the stable
+	// part of the Eurasian plate have moved about 2.5cm/yr to the north-east in ITRF.
+	l := egm96.NewLocationGeodetic(52, 10, 100)
+	l2, _ := Convert(l, ITRF2014, ETRF2014, time.Date(1989, 1, 1, 0, 0, 0, 0, time.UTC))
+	n, e, u := shift(l, l2)
+	testDiff("ETRF2014 at 1989 north", n, 0, 1e-4, t)
+	testDiff("ETRF2014 at 1989 east", e, 0, 1e-4, t)
+	testDiff("ETRF2014 at 1989 up", u, 0, 1e-4, t)
+
+	l2, _ = Convert(l, ITRF2014, ETRF2014, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	n, e, u = shift(l, l2)
+	testDiff("ETRF2014 at 2019 north", n, -0.45, 0.15, t)
+	testDiff("ETRF2014 at 2019 east", e, -0.6, 0.15, t)
+	testDiff("ETRF2014 at 2019 up", u, 0, 0.01, t)
+}
+
+func TestGDA94ToGDA2020(t *testing.T) {
+	// GDA2020 coordinates are about 1.5m north-north-east of GDA94 coordinates in Canberra
+	l := egm96.NewLocationGeodetic(-35.3, 149.1, 600)
+	l2, _ := Convert(l, GDA94, GDA2020, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	n, e, _ := shift(l, l2)
+	testDiff("GDA2020-GDA94 north", n, 1.4, 0.2, t)
+	testDiff("GDA2020-GDA94 east", e, 0.5, 0.2, t)
+}
+
+func TestNAD83ToWGS84(t *testing.T) {
+	// NAD83(2011) and ITRF differ by roughly 1 to 2 meters across the US
+	l := egm96.NewLocationGeodetic(40, -105, 1600)
+	l2, _ := Convert(l, NAD83, WGS84, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	n, e, u := shift(l, l2)
+	d := math.Sqrt(n*n + e*e + u*u)
+	testDiff("NAD83-WGS84 shift", d, 1.5, 0.7, t)
+}
+
+func TestDatumEllipsoids(t *testing.T) {
+	if WGS84.Ellipsoid() != egm96.WGS84 || NAD83.Ellipsoid() != egm96.GRS80 || NAD27.Ellipsoid() != egm96.Clarke1866 {
+		t.Error("incorrect datum ellipsoids")
+	}
+	for _, d := range Datums() {
+		if d.Ellipsoid().A == 0 {
+			t.Errorf("datum %s has no ellipsoid", d)
+		}
+	}
+}
+
+func TestLegacyDatums(t *testing.T) {
+	tt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The Airy transit circle at Greenwich is on the OSGB36 prime meridian, about
+	// 100m west of the WGS84 prime meridian; the transformation is good to about 5m
+	l := egm96.NewLocationGeodetic(51.477806, -0.001475, 46)
+	l2, _ := Convert(l, WGS84, OSGB36, tt)
+	_, lng, _ := l2.Geodetic()
+	testDiff("Airy transit circle OSGB36 longitude", math.Remainder(lng/egm96.Deg, 360)*egm96.A*math.Cos(51.48*egm96.Deg)*egm96.Deg, 0, 15, t)
+
+	// Tokyo datum coordinates in Tokyo are about 450m from WGS84
+	l = egm96.NewLocationGeodetic(35.68, 139.77, 40)
+	l2, _ = Convert(l, WGS84, Tokyo, tt)
+	n, e, _ := shift(l, l2)
+	testDiff("Tokyo datum shift", math.Hypot(n, e), 450, 50, t)
+
+	// NAD27 coordinates are within about 100m of WGS84 across the contiguous US
+	l = egm96.NewLocationGeodetic(39.74, -104.99, 1600)
+	l2, _ = Convert(l, WGS84, NAD27, tt)
+	n, e, _ = shift(l, l2)
+	testDiff("NAD27 datum shift", math.Hypot(n, e), 60, 40, t)
+
+	// ED50 coordinates are within about 200m of WGS84 across western Europe
+	l = egm96.NewLocationGeodetic(48.85, 2.35, 35)
+	l2, _ = Convert(l, WGS84, ED50, tt)
+	n, e, _ = shift(l, l2)
+	testDiff("ED50 datum shift", math.Hypot(n, e), 120, 80, t)
+}
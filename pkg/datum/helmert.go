@@ -0,0 +1,141 @@
+// Package datum transforms locations between geodetic datums
+// (terrestrial reference frames) such as WGS84, the ITRF series, NAD83,
+// ETRS89 and GDA2020, and legacy datums such as NAD27, ED50 and OSGB36.
+//
+// Transformations are 7-parameter Helmert similarity transformations of
+// Earth-Centered, Earth-Fixed coordinates, optionally with rates of change
+// for each parameter (14-parameter transformations) to account for the
+// motion of the tectonic plates between the frames.
+//
+// A built-in catalogue relates each supported datum to ITRF2014, so that a
+// Location observed in any of them can be converted to WGS84 before being
+// used with the egm96 and wmm packages:
+//
+//	t := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+//	loc, err := datum.Convert(egm96.NewLocationGeodetic(39.5, -105.2, 1650), datum.NAD83, datum.WGS84, t)
+//	field, err := wmm.CalculateWMMMagneticField(loc, t)
+//
+// The geodetic coordinates of a Location are converted to and from ECEF on the
+// reference ellipsoid of its datum: GRS80 for the modern datums, WGS84 for WGS84,
+// and the historical ellipsoids for the legacy datums.  The legacy datums use
+// average transformations that are only good to a few meters, or to 5-25 m for
+// the three-parameter NAD27, ED50 and Tokyo shifts.
+package datum
+
+import (
+	"math"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+const (
+	mas = math.Pi / 180 / 3600 / 1000 // number of radians per milliarcsecond
+	ppb = 1e-9                        // scale factor per part per billion
+)
+
+// Helmert represents a 14-parameter Helmert transformation between two
+// reference frames.
+//
+// The rotations follow the IERS "position vector" convention used for the
+// ITRF, in which a point is transformed by
+//
+//	X2 = X1 + T + S*X1 + R*X1
+//
+// with R the skew-symmetric matrix [[0, -Rz, Ry], [Rz, 0, -Rx], [-Ry, Rx, 0]].
+// Parameters published in the "coordinate frame" convention have rotations
+// of the opposite sign.
+//
+// Each parameter p varies linearly in time as p + Dp*(t-Epoch).  A 7-parameter
+// transformation simply has zero rates.
+type Helmert struct {
+	Tx, Ty, Tz    float64 // Translations, m
+	Rx, Ry, Rz    float64 // Rotations, mas
+	S             float64 // Scale difference, ppb
+	DTx, DTy, DTz float64 // Translation rates, m/yr
+	DRx, DRy, DRz float64 // Rotation rates, mas/yr
+	DS            float64 // Scale difference rate, ppb/yr
+	Epoch         float64 // Reference epoch of the parameters, decimal years
+}
+
+// decimalYear returns the time t as a decimal year, such as 2021.5.
+func decimalYear(t time.Time) float64 {
+	t = t.UTC()
+	start := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(t.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	return float64(t.Year()) + float64(t.Sub(start))/float64(end.Sub(start))
+}
+
+// At returns the 7 parameters of the transformation evaluated at time t,
+// as a Helmert with zero rates.
+func (h Helmert) At(t time.Time) (hh Helmert) {
+	dt := decimalYear(t) - h.Epoch
+	return Helmert{
+		Tx:    h.Tx + dt*h.DTx,
+		Ty:    h.Ty + dt*h.DTy,
+		Tz:    h.Tz + dt*h.DTz,
+		Rx:    h.Rx + dt*h.DRx,
+		Ry:    h.Ry + dt*h.DRy,
+		Rz:    h.Rz + dt*h.DRz,
+		S:     h.S + dt*h.DS,
+		Epoch: h.Epoch + dt,
+	}
+}
+
+// TransformECEF applies the transformation at time t to the ECEF coordinates
+// x, y, z in meters.
+func (h Helmert) TransformECEF(x, y, z float64, t time.Time) (x2, y2, z2 float64) {
+	m, tx, ty, tz := h.matrix(t)
+	x2 = tx + m[0][0]*x + m[0][1]*y + m[0][2]*z
+	y2 = ty + m[1][0]*x + m[1][1]*y + m[1][2]*z
+	z2 = tz + m[2][0]*x + m[2][1]*y + m[2][2]*z
+	return x2, y2, z2
+}
+
+// InverseECEF applies the exact inverse of the transformation at time t
+// to the ECEF coordinates x, y, z in meters.
+func (h Helmert) InverseECEF(x, y, z float64, t time.Time) (x1, y1, z1 float64) {
+	m, tx, ty, tz := h.matrix(t)
+	x, y, z = x-tx, y-ty, z-tz
+
+	// Solve m*X1 = X by Cramer's rule
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	x1 = (x*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(y*m[2][2]-m[1][2]*z) +
+		m[0][2]*(y*m[2][1]-m[1][1]*z)) / det
+	y1 = (m[0][0]*(y*m[2][2]-m[1][2]*z) -
+		x*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*z-y*m[2][0])) / det
+	z1 = (m[0][0]*(m[1][1]*z-y*m[2][1]) -
+		m[0][1]*(m[1][0]*z-y*m[2][0]) +
+		x*(m[1][0]*m[2][1]-m[1][1]*m[2][0])) / det
+	return x1, y1, z1
+}
+
+// Transform applies the transformation at time t to the location l.
+func (h Helmert) Transform(l egm96.Location, t time.Time) (ll egm96.Location) {
+	x, y, z := l.ECEF()
+	return egm96.NewLocationECEF(h.TransformECEF(x, y, z, t))
+}
+
+// Inverse applies the exact inverse of the transformation at time t to the location l.
+func (h Helmert) Inverse(l egm96.Location, t time.Time) (ll egm96.Location) {
+	x, y, z := l.ECEF()
+	return egm96.NewLocationECEF(h.InverseECEF(x, y, z, t))
+}
+
+// matrix returns the combined scale and rotation matrix of the
+// transformation at time t, and its translation.
+func (h Helmert) matrix(t time.Time) (m [3][3]float64, tx, ty, tz float64) {
+	p := h.At(t)
+	s := 1 + p.S*ppb
+	rx, ry, rz := p.Rx*mas, p.Ry*mas, p.Rz*mas
+	m = [3][3]float64{
+		{s, -rz, ry},
+		{rz, s, -rx},
+		{-ry, rx, s},
+	}
+	return m, p.Tx, p.Ty, p.Tz
+}
@@ -0,0 +1,99 @@
+package egm96
+
+import (
+	"fmt"
+	"math"
+)
+
+// ArcSec is the number of radians per arc-second.
+const ArcSec = Deg/3600
+
+// DeflectionOfVertical returns the north-south component xi and the east-west component eta
+// of the deflection of the vertical at the Location, in arc-seconds, computed from the
+// EGM96 spherical harmonic expansion.
+//
+// The deflection of the vertical is the angle between the direction of gravity (the plumb line)
+// and the normal to the WGS84 ellipsoid.  Following the usual convention,
+// xi is positive when the plumb line points further north than the ellipsoidal normal,
+// i.e. astronomic latitude exceeds geodetic latitude, and eta is positive when it
+// points further east.  They are related to the slope of the geoid by
+//  xi = -dN/dy,  eta = -dN/dx
+// for north y and east x.
+//
+// The EGM96 coefficients must first be loaded with LoadEGM96COF.
+// The deflection is undefined at the poles, where an error is returned.
+func (l Location) DeflectionOfVertical() (xi, eta float64, err error) {
+	if len(egm96C)==0 {
+		return 0, 0, fmt.Errorf("EGM96 spherical harmonic coefficients have not been loaded")
+	}
+	phi, lambda, r := l.Spherical()
+	cosPhi := math.Cos(phi)
+	if cosPhi < 1e-10 {
+		return 0, 0, fmt.Errorf("the deflection of the vertical is undefined at the poles")
+	}
+	s := newHarmonicSum(phi, lambda, r)
+	gamma := l.NormalGravity()
+	xi = -s.dtdphi/(gamma*r)
+	eta = -s.dtdlambda/(gamma*r*cosPhi)
+	return xi/ArcSec, eta/ArcSec, nil
+}
+
+// DeflectionOfVerticalGrid returns the north-south component xi and the east-west component
+// eta of the deflection of the vertical at the Location, in arc-seconds, computed from the
+// slope of the interpolated EGM96 geoid height grid.
+//
+// The slope is taken by central differences one grid spacing (15') either side of the
+// Location, so this represents the deflection smoothed over about 30km.
+// See DeflectionOfVertical for the sign conventions.
+func (l Location) DeflectionOfVerticalGrid() (xi, eta float64, err error) {
+	if len(egm96Grid)==0 {
+		loadEGM96Grid()
+	}
+
+	lat := l.latitude/Deg
+	lng := l.longitude/Deg
+	dLat := math.Abs(egm96DY)
+	dLng := math.Abs(egm96DX)
+
+	// Latitude slope, one-sided within a grid spacing of the poles
+	lat0 := math.Max(lat-dLat, -90)
+	lat1 := math.Min(lat+dLat, 90)
+	n0, err := geoidHeight(lat0, wrapLongitude(lng))
+	if err != nil {
+		return 0, 0, err
+	}
+	n1, err := geoidHeight(lat1, wrapLongitude(lng))
+	if err != nil {
+		return 0, 0, err
+	}
+	sinPhi := math.Sin(l.latitude)
+	w := math.Sqrt(1-E2*sinPhi*sinPhi)
+	rm := A*(1-E2)/(w*w*w) // Meridional radius of curvature
+	rn := A/w              // Prime vertical radius of curvature
+	xi = -(n1-n0)/((lat1-lat0)*Deg*(rm+l.height))
+
+	cosPhi := math.Cos(l.latitude)
+	if cosPhi < 1e-10 {
+		return 0, 0, fmt.Errorf("the deflection of the vertical is undefined at the poles")
+	}
+	n0, err = geoidHeight(lat, wrapLongitude(lng-dLng))
+	if err != nil {
+		return 0, 0, err
+	}
+	n1, err = geoidHeight(lat, wrapLongitude(lng+dLng))
+	if err != nil {
+		return 0, 0, err
+	}
+	eta = -(n1-n0)/(2*dLng*Deg*(rn+l.height)*cosPhi)
+
+	return xi/ArcSec, eta/ArcSec, nil
+}
+
+// wrapLongitude returns the longitude in degrees reduced to the range [0, 360).
+func wrapLongitude(lng float64) (l float64) {
+	l = math.Mod(lng, 360)
+	if l < 0 {
+		l += 360
+	}
+	return l
+}
@@ -0,0 +1,87 @@
+package egm96
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDeflectionOfVertical(t *testing.T) {
+	egm96C, egm96S = nil, nil
+	if _, _, err := NewLocationGeodetic(30, 20, 0).DeflectionOfVertical(); err==nil {
+		t.Error("DeflectionOfVertical should fail without coefficients")
+	}
+
+	// A single C(2,2) term, for which T = K*sqrt(15)/2*cos²φ*cos2λ
+	c22 := 2.4e-6
+	if err := LoadEGM96COF(writeNormalCOF(t, 2, 2, c22)); err!=nil {
+		t.Fatal(err)
+	}
+	l := NewLocationGeodetic(30, 20, 0)
+	phi, lambda, r := l.Spherical()
+	k := egm96GM/r*math.Pow(egm96Radius/r, 2)*c22
+	dtdphi := -k*math.Sqrt(15)*math.Cos(phi)*math.Sin(phi)*math.Cos(2*lambda)
+	dtdlambda := -k*math.Sqrt(15)*math.Cos(phi)*math.Cos(phi)*math.Sin(2*lambda)
+	gamma := l.NormalGravity()
+	xi, eta, err := l.DeflectionOfVertical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDiff("C(2,2) xi", xi, -dtdphi/(gamma*r)/ArcSec, 1e-9, t)
+	testDiff("C(2,2) eta", eta, -dtdlambda/(gamma*r*math.Cos(phi))/ArcSec, 1e-9, t)
+
+	if _, _, err := NewLocationGeodetic(90, 0, 0).DeflectionOfVertical(); err==nil {
+		t.Error("DeflectionOfVertical should fail at the pole")
+	}
+
+	egm96C, egm96S = nil, nil
+}
+
+func TestHarmonicDerivatives(t *testing.T) {
+	// Compare the analytic derivatives against numerical derivatives of the potential
+	if err := LoadEGM96COF(writeNormalCOF(t, 7, 3, 1e-6)); err!=nil {
+		t.Fatal(err)
+	}
+	egm96S[7*8/2+3] = -2e-6
+	const d = 1e-6
+	for _, lat := range []float64{-75, -20, 0, 45, 85} {
+		phi, lambda, r := lat*Deg, 37*Deg, 6.4e6
+		s := newHarmonicSum(phi, lambda, r)
+		dphi := (newHarmonicSum(phi+d, lambda, r).t - newHarmonicSum(phi-d, lambda, r).t)/(2*d)
+		dlambda := (newHarmonicSum(phi, lambda+d, r).t - newHarmonicSum(phi, lambda-d, r).t)/(2*d)
+		testDiff(fmt.Sprintf("dT/dφ at %3.0f°", lat), s.dtdphi, dphi, 1e-6, t)
+		testDiff(fmt.Sprintf("dT/dλ at %3.0f°", lat), s.dtdlambda, dlambda, 1e-6, t)
+	}
+	egm96C, egm96S = nil, nil
+}
+
+func TestDeflectionOfVerticalGrid(t *testing.T) {
+	// At a grid point the deflection is the central difference of the neighboring grid heights
+	l := NewLocationGeodetic(40, 250, 0)
+	xi, eta, err := l.DeflectionOfVerticalGrid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nN, _ := NewLocationGeodetic(40.25, 250, 0).NearestEGM96GridPoint()
+	nS, _ := NewLocationGeodetic(39.75, 250, 0).NearestEGM96GridPoint()
+	nE, _ := NewLocationGeodetic(40, 250.25, 0).NearestEGM96GridPoint()
+	nW, _ := NewLocationGeodetic(40, 249.75, 0).NearestEGM96GridPoint()
+	sinPhi := math.Sin(40*Deg)
+	w := math.Sqrt(1-E2*sinPhi*sinPhi)
+	testDiff("grid xi", xi, -(nN.height-nS.height)/(0.5*Deg*A*(1-E2)/(w*w*w))/ArcSec, 1e-6, t)
+	testDiff("grid eta", eta, -(nE.height-nW.height)/(0.5*Deg*A/w*math.Cos(40*Deg))/ArcSec, 1e-6, t)
+
+	// Deflections rarely exceed a minute of arc when smoothed over the grid spacing
+	for _, lat := range []float64{-89.9, -45, 0, 45, 89.9} {
+		for _, lng := range []float64{-180, -0.1, 0, 0.1, 90, 359.9} {
+			xi, eta, err := NewLocationGeodetic(lat, lng, 0).DeflectionOfVerticalGrid()
+			if err != nil {
+				t.Errorf("grid deflection at %4.1f, %5.1f: %v", lat, lng, err)
+				continue
+			}
+			if math.Abs(xi) > 60 || math.Abs(eta) > 60 {
+				t.Errorf("grid deflection at %4.1f, %5.1f too large: %4.1f\", %4.1f\"", lat, lng, xi, eta)
+			}
+		}
+	}
+}
@@ -20,7 +20,6 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
 )
@@ -65,37 +64,28 @@ func NewLocationGeodetic(latitude, longitude, height float64) (loc Location) {
 //
 // Latitude and longitude are specified in decimal degrees and height in meters.
 func NewLocationMSL(latitude, longitude, height float64) (loc Location, err error) {
-	if len(egm96Grid)==0 {
-		loadEGM96Grid()
-	}
-
-	nLng := int((longitude-egm96X0)/egm96DX) // Grid x just below desired x
-	nLat := int((latitude-egm96Y0)/egm96DY) // Grid y just below desired y
-
-	if nLng < 0 || nLng > egm96XN {
-		return Location{}, fmt.Errorf("requested longitude %4.2f lies outside of EGM96 longitude range %4.1f to %4.1f",
-			longitude, egm96X0, egm96X1)
-	}
-	if nLat < 0 || nLat > egm96YN {
-		return Location{}, fmt.Errorf("requested latitude %4.2f lies outside of EGM96 latitude range %4.1f to %4.1f",
-			latitude, egm96Y0, egm96Y1)
+	n, err := geoidHeight(latitude, longitude)
+	if err != nil {
+		return Location{}, err
 	}
 
-	x := (longitude-egm96X0)/egm96DX-float64(nLng)
-	y := (latitude-egm96Y0)/egm96DY-float64(nLat)
-	h00 := egm96Grid[nLat*egm96XN+nLng]
-	h10 := egm96Grid[nLat*egm96XN+nLng+1]
-	h01 := egm96Grid[(nLat+1)*egm96XN+nLng]
-	h11 := egm96Grid[(nLat+1)*egm96XN+nLng+1]
-
-
 	return Location{
 		latitude: latitude*Deg,
 		longitude: longitude*Deg,
-		height: height + ((1-x)*(1-y)*h00 + x*(1-y)*h10 + (1-x)*y*h01 + x*y*h11),
+		height: height + n,
 	}, nil
 }
 
+// NewLocationECEF returns a Location given its Earth-Centered, Earth-Fixed
+// cartesian coordinates x, y, z in meters, with the geodetic latitude and
+// height referenced to the WGS84 ellipsoid.
+//
+// The returned longitude is in the range [0, 360) degrees, as expected by the
+// EGM96 grid lookups.
+func NewLocationECEF(x, y, z float64) (loc Location) {
+	return NewLocationECEFOn(x, y, z, WGS84)
+}
+
 // Equals returns whether the latitude, longitude and height of the input location
 // are equal to those of the caller.
 func (l Location) Equals(ll Location) bool {
@@ -114,14 +104,14 @@ func (l Location) Geodetic() (phi, lambda, r float64) {
 // WGS sphere).  phi and lambda are in radians and r is in meters.
 // Spherical coordinates are the variables φ',λ,r in the WMM paper.
 func (l Location) Spherical() (phi, lambda, r float64) {
-	sinPhi := math.Sin(l.latitude)
-	cosPhi := math.Cos(l.latitude)
-	h := l.height
-	rc := A/math.Sqrt(1-E2*sinPhi*sinPhi)
-	p := (rc+h)*cosPhi
-	z := (rc*(1-E2)+h)*sinPhi
-	r = math.Sqrt(p*p+z*z)
-	return math.Asin(z/r), l.longitude, r
+	return l.SphericalOn(WGS84)
+}
+
+// ECEF returns the location's Earth-Centered, Earth-Fixed cartesian coordinates
+// x, y, z in meters.  The x axis points to latitude 0, longitude 0, the y axis
+// to latitude 0, longitude 90E and the z axis to the North pole.
+func (l Location) ECEF() (x, y, z float64) {
+	return l.ECEFOn(WGS84)
 }
 
 // HeightAboveMSL calculates the height of the EGM96 geoid at the input Location,
@@ -129,12 +119,21 @@ func (l Location) Spherical() (phi, lambda, r float64) {
 // It then subtracts this height from the total height above the WGS84 reference
 // ellipsoid at the input Location, giving the the height above MSL.
 func (l Location) HeightAboveMSL() (h float64, err error) {
+	n, err := geoidHeight(l.latitude/Deg, l.longitude/Deg)
+	if err != nil {
+		return 0, err
+	}
+	return l.height - n, nil
+}
+
+// geoidHeight returns the height in meters of the EGM96 geoid above the WGS84
+// reference ellipsoid at the given latitude and longitude in degrees,
+// by bilinear interpolation of the grid.
+func geoidHeight(lat, lng float64) (h float64, err error) {
 	if len(egm96Grid)==0 {
 		loadEGM96Grid()
 	}
 
-	lng := l.longitude/Deg
-	lat := l.latitude/Deg
 	nLng := int((lng-egm96X0)/egm96DX) // Grid x just below desired x
 	nLat := int((lat-egm96Y0)/egm96DY) // Grid y just below desired y
 
@@ -146,6 +145,13 @@ func (l Location) HeightAboveMSL() (h float64, err error) {
 		return 0, fmt.Errorf("requested latitude %4.2f lies outside of EGM96 latitude range %4.1f to %4.1f",
 			lat, egm96Y0, egm96Y1)
 	}
+	// Points on the last row or column interpolate within the cell before it
+	if nLng == egm96XN-1 {
+		nLng--
+	}
+	if nLat == egm96YN-1 {
+		nLat--
+	}
 
 	x := (lng-egm96X0)/egm96DX-float64(nLng)
 	y := (lat-egm96Y0)/egm96DY-float64(nLat)
@@ -155,9 +161,7 @@ func (l Location) HeightAboveMSL() (h float64, err error) {
 	h11 := egm96Grid[(nLat+1)*egm96XN+nLng+1]
 
 	//TODO: implement spline interpolation to improve on bi-linear
-	h = l.height - ((1-x)*(1-y)*h00 + x*(1-y)*h10 + (1-x)*y*h01 + x*y*h11)
-
-	return h, err
+	return (1-x)*(1-y)*h00 + x*(1-y)*h10 + (1-x)*y*h01 + x*y*h11, nil
 }
 
 var (
@@ -54,6 +54,30 @@ func TestNewLocationMSL(t *testing.T) {
 	}
 }
 
+func TestECEF(t *testing.T) {
+	lats := []float64{0, 0, 90, -90, 45, -33.8568, 89.9999, 51.4778}
+	lngs := []float64{0, 90, 0, 0, 45, 151.2153, 270, 359.9985}
+	hts  := []float64{0, 1000, 0, -500, 35786000, 58, 12, 45.6}
+	xs   := []float64{A, 0, 0, 0, 0, 0, 0, 0}
+	ys   := []float64{0, A+1000, 0, 0, 0, 0, 0, 0}
+	zs   := []float64{0, 0, A*(1-F), -A*(1-F)+500, 0, 0, 0, 0}
+
+	for i:=0; i<len(lats); i++ {
+		x, y, z := NewLocationGeodetic(lats[i], lngs[i], hts[i]).ECEF()
+		if i<4 {
+			testDiff("x", x, xs[i], 1e-6, t)
+			testDiff("y", y, ys[i], 1e-6, t)
+			testDiff("z", z, zs[i], 1e-6, t)
+		}
+		l := NewLocationECEF(x, y, z)
+		testDiff("latitude round trip", l.latitude/Deg, lats[i], 1e-9, t)
+		if lats[i]>-90 && lats[i]<90 {
+			testDiff("longitude round trip", l.longitude/Deg, lngs[i], 1e-9, t)
+		}
+		testDiff("height round trip", l.height, hts[i], 1e-6, t)
+	}
+}
+
 func ExampleNearestEGM96GridPoint() {
 	p, _ := NewLocationGeodetic(-12.25,82.75,0).NearestEGM96GridPoint()
 	fmt.Printf("Lat: %4.2f, Lng: %4.2f, height: %5.3f", p.latitude/Deg, p.longitude/Deg, p.height)
@@ -0,0 +1,109 @@
+package egm96
+
+import "math"
+
+// Ellipsoid represents a reference ellipsoid of revolution, defined by its
+// equatorial radius and flattening.
+//
+// The geoid heights, gravity and magnetic field calculations of this module are
+// all referenced to WGS84, which is the default ellipsoid of the Location conversions.
+// The other ellipsoids are useful for converting coordinates referenced to
+// other geodetic datums, many of which use a different ellipsoid.
+type Ellipsoid struct {
+	A float64 // Equatorial radius in meters
+	F float64 // Flattening
+}
+
+// Commonly used reference ellipsoids.
+var (
+	WGS84             = Ellipsoid{A: A, F: F}                              // World Geodetic System 1984
+	GRS80             = Ellipsoid{A: 6378137, F: 1/298.257222101}          // Geodetic Reference System 1980, used by ITRF, NAD83, ETRS89 and GDA
+	International1924 = Ellipsoid{A: 6378388, F: 1/297.0}                  // Hayford ellipsoid, used by ED50
+	Clarke1866        = Ellipsoid{A: 6378206.4, F: 1/294.978698213898}     // Used by NAD27
+	Airy1830          = Ellipsoid{A: 6377563.396, F: 1/299.3249646}        // Used by OSGB36
+	Bessel1841        = Ellipsoid{A: 6377397.155, F: 1/299.1528128}        // Used by the Tokyo datum and in central Europe
+)
+
+// NewEllipsoid returns a custom Ellipsoid with equatorial radius a in meters
+// and inverse flattening invF.  An inverse flattening of zero defines a sphere.
+func NewEllipsoid(a, invF float64) (e Ellipsoid) {
+	e.A = a
+	if invF != 0 {
+		e.F = 1/invF
+	}
+	return e
+}
+
+// E2 returns the square of the eccentricity of the ellipsoid.
+func (e Ellipsoid) E2() float64 {
+	return e.F*(2-e.F)
+}
+
+// B returns the polar radius of the ellipsoid in meters.
+func (e Ellipsoid) B() float64 {
+	return e.A*(1-e.F)
+}
+
+// NewLocationECEFOn returns a Location given its Earth-Centered, Earth-Fixed
+// cartesian coordinates x, y, z in meters, with the geodetic latitude and height
+// referenced to the ellipsoid e.
+//
+// The returned longitude is in the range [0, 360) degrees, as expected by the
+// EGM96 grid lookups.
+func NewLocationECEFOn(x, y, z float64, e Ellipsoid) (loc Location) {
+	e2 := e.E2()
+	p := math.Hypot(x, y)
+	lng := math.Atan2(y, x)
+	if lng < 0 {
+		lng += 2*math.Pi
+	}
+
+	// Iterate on the latitude, starting from the value for zero height.
+	// Converges to round-off within a few iterations for heights below ~10,000km.
+	lat := math.Atan2(z, p*(1-e2))
+	var h float64
+	for i:=0; i<10; i++ {
+		sinPhi := math.Sin(lat)
+		rc := e.A/math.Sqrt(1-e2*sinPhi*sinPhi)
+		h = p*math.Cos(lat) + z*sinPhi - e.A*e.A/rc
+		next := math.Atan2(z, p*(1-e2*rc/(rc+h)))
+		if math.Abs(next-lat) < 1e-15 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+
+	return Location{
+		latitude: lat,
+		longitude: lng,
+		height: h,
+	}
+}
+
+// ECEFOn returns the Earth-Centered, Earth-Fixed cartesian coordinates x, y, z in
+// meters of the location, treating its geodetic latitude and height as referenced
+// to the ellipsoid e.
+func (l Location) ECEFOn(e Ellipsoid) (x, y, z float64) {
+	e2 := e.E2()
+	sinPhi := math.Sin(l.latitude)
+	cosPhi := math.Cos(l.latitude)
+	rc := e.A/math.Sqrt(1-e2*sinPhi*sinPhi)
+	p := (rc+l.height)*cosPhi
+	return p*math.Cos(l.longitude), p*math.Sin(l.longitude), (rc*(1-e2)+l.height)*sinPhi
+}
+
+// SphericalOn returns the location's spherical latitude phi, longitude lambda and
+// distance r from the center of the ellipsoid, treating its geodetic latitude and
+// height as referenced to the ellipsoid e.  phi and lambda are in radians and r is in meters.
+func (l Location) SphericalOn(e Ellipsoid) (phi, lambda, r float64) {
+	e2 := e.E2()
+	sinPhi := math.Sin(l.latitude)
+	cosPhi := math.Cos(l.latitude)
+	h := l.height
+	rc := e.A/math.Sqrt(1-e2*sinPhi*sinPhi)
+	p := (rc+h)*cosPhi
+	z := (rc*(1-e2)+h)*sinPhi
+	r = math.Sqrt(p*p+z*z)
+	return math.Asin(z/r), l.longitude, r
+}
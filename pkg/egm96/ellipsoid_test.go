@@ -0,0 +1,50 @@
+package egm96
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEllipsoids(t *testing.T) {
+	testDiff("WGS84 polar radius", WGS84.B(), 6356752.314245, 1e-6, t)
+	testDiff("GRS80 polar radius", GRS80.B(), 6356752.314140, 1e-6, t)
+	testDiff("Clarke 1866 polar radius", Clarke1866.B(), 6356583.8, 1e-6, t)
+	testDiff("Airy 1830 polar radius", Airy1830.B(), 6356256.909, 1e-3, t)
+	testDiff("WGS84 eccentricity squared", WGS84.E2(), E2, 1e-18, t)
+
+	e := NewEllipsoid(6371000, 0)
+	testDiff("sphere flattening", e.F, 0, 1e-20, t)
+	e = NewEllipsoid(6378388, 297)
+	if e != International1924 {
+		t.Errorf("custom ellipsoid %v should equal International 1924 %v", e, International1924)
+	}
+}
+
+func TestECEFOn(t *testing.T) {
+	ellipsoids := []Ellipsoid{WGS84, GRS80, International1924, Clarke1866, Airy1830, Bessel1841, NewEllipsoid(6371000, 0)}
+	for _, e := range ellipsoids {
+		// The poles and equator lie on the axes at the ellipsoid's radii
+		x, y, z := NewLocationGeodetic(90, 0, 100).ECEFOn(e)
+		testDiff(fmt.Sprintf("%v pole z", e), z, e.B()+100, 1e-6, t)
+		testDiff(fmt.Sprintf("%v pole x", e), math.Abs(x)+math.Abs(y), 0, 1e-6, t)
+		x, _, _ = NewLocationGeodetic(0, 0, -100).ECEFOn(e)
+		testDiff(fmt.Sprintf("%v equator x", e), x, e.A-100, 1e-6, t)
+
+		for _, lat := range []float64{-80, -33.3, 0.1, 51.5, 89} {
+			l := NewLocationGeodetic(lat, 123.4, 1234.5)
+			x, y, z := l.ECEFOn(e)
+			l2 := NewLocationECEFOn(x, y, z, e)
+			testDiff(fmt.Sprintf("%v latitude %4.1f", e, lat), l2.latitude/Deg, lat, 1e-12, t)
+			testDiff(fmt.Sprintf("%v height %4.1f", e, lat), l2.height, 1234.5, 1e-6, t)
+
+			_, _, r := l.SphericalOn(e)
+			testDiff(fmt.Sprintf("%v radius %4.1f", e, lat), r, math.Sqrt(x*x+y*y+z*z), 1e-6, t)
+		}
+	}
+
+	// The same geodetic coordinates on different ellipsoids are different points
+	x1, _, _ := NewLocationGeodetic(0, 0, 0).ECEFOn(WGS84)
+	x2, _, _ := NewLocationGeodetic(0, 0, 0).ECEFOn(International1924)
+	testDiff("WGS84 to International 1924 equatorial offset", x2-x1, 251, 1e-6, t)
+}
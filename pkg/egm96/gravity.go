@@ -0,0 +1,105 @@
+package egm96
+
+import (
+	"fmt"
+	"math"
+)
+
+// Constants defining the WGS84 normal gravity field,
+// from NIMA TR8350.2, Department of Defense World Geodetic System 1984, 3rd ed.
+const (
+	GM     = 3986004.418e8 // Earth's gravitational constant including the atmosphere, m³/s²
+	Omega  = 7292115e-11   // Angular velocity of the Earth, rad/s
+	GammaE = 9.7803253359  // Normal gravity at the equator, m/s²
+	GammaP = 9.8321849379  // Normal gravity at the poles, m/s²
+	MGal   = 1e-5          // m/s² per milligal
+
+	kSomigliana = 0.00193185265241 // Somigliana's constant (b*γp)/(a*γe)-1
+	mGravity    = 0.00344978650684 // ω²a²b/GM
+)
+
+// NormalGravity returns the magnitude of the normal gravity of the WGS84
+// ellipsoid at the Location, in m/s².
+//
+// On the ellipsoid this is Somigliana's closed formula. Above or below the ellipsoid
+// the value is corrected by the second order expansion in height of
+// NIMA TR8350.2 equation 4-3, which is accurate for heights within a few tens of km.
+func (l Location) NormalGravity() (g float64) {
+	sin2Phi := math.Sin(l.latitude)
+	sin2Phi *= sin2Phi
+	g = GammaE*(1+kSomigliana*sin2Phi)/math.Sqrt(1-E2*sin2Phi)
+	h := l.height
+	return g*(1 - 2.0/A*(1+F+mGravity-2*F*sin2Phi)*h + 3.0/(A*A)*h*h)
+}
+
+// GravityDisturbance returns the gravity disturbance at the Location, the
+// difference between the magnitude of the actual gravity given by the EGM96
+// spherical harmonic expansion and of the normal gravity of the WGS84 ellipsoid
+// at the same point, in m/s².
+//
+// The EGM96 coefficients must first be loaded with LoadEGM96COF.
+func (l Location) GravityDisturbance() (dg float64, err error) {
+	_, dtdr, err := l.disturbingPotential()
+	return -dtdr, err
+}
+
+// GravityAnomaly returns the free-air gravity anomaly at the Location, the difference
+// between the magnitude of the actual gravity at the point and of the normal gravity
+// at the corresponding point of the normal potential, in m/s².
+// It is computed from the EGM96 spherical harmonic expansion in the spherical
+// approximation of the fundamental equation of physical geodesy, Δg = -∂T/∂r - 2T/r.
+//
+// The EGM96 coefficients must first be loaded with LoadEGM96COF.
+func (l Location) GravityAnomaly() (dg float64, err error) {
+	t, dtdr, err := l.disturbingPotential()
+	_, _, r := l.Spherical()
+	return -dtdr - 2*t/r, err
+}
+
+// Gravity returns the magnitude of the Earth's gravity at the Location, in m/s²,
+// as the sum of the WGS84 normal gravity and the EGM96 gravity disturbance.
+//
+// If the EGM96 coefficients have not been loaded with LoadEGM96COF, it returns
+// the normal gravity along with an error.
+func (l Location) Gravity() (g float64, err error) {
+	dg, err := l.GravityDisturbance()
+	if err != nil {
+		return l.NormalGravity(), err
+	}
+	return l.NormalGravity() + dg, nil
+}
+
+// normalZonal returns the fully normalized zonal coefficient C(n,0) of the
+// normal gravity potential of the WGS84 ellipsoid, which is zero for odd n.
+// See Heiskanen & Moritz, Physical Geodesy, section 2-9.
+func normalZonal(n int) (c float64) {
+	if n%2 == 1 {
+		return 0
+	}
+	e2 := E2
+	e := math.Sqrt(e2)
+	ep := e/math.Sqrt(1-e2)
+	q0 := ((1+3/(ep*ep))*math.Atan(ep) - 3/ep)/2
+	b := A*(1-F)
+	m := Omega*Omega*A*A*b/GM
+	j2 := e2/3*(1 - 2.0/15*m*ep/q0)
+
+	nn := float64(n/2)
+	j2n := 3*math.Pow(e2, nn)/((2*nn+1)*(2*nn+3))*(1 - nn + 5*nn*j2/e2)
+	if n/2%2 == 0 {
+		j2n = -j2n
+	}
+	return -j2n/math.Sqrt(float64(2*n+1))
+}
+
+// disturbingPotential returns the disturbing potential T, the difference between the
+// EGM96 gravity potential and the WGS84 normal potential at the Location, in m²/s²,
+// and its radial derivative in m/s².
+func (l Location) disturbingPotential() (t, dtdr float64, err error) {
+	if len(egm96C)==0 {
+		return 0, 0, fmt.Errorf("EGM96 spherical harmonic coefficients have not been loaded")
+	}
+	phi, lambda, r := l.Spherical()
+	s := newHarmonicSum(phi, lambda, r)
+	return s.t, s.dtdr, nil
+}
@@ -0,0 +1,91 @@
+package egm96
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalGravity(t *testing.T) {
+	lats := []float64{0, 90, -90, 45, 0, 45}
+	hts  := []float64{0, 0, 0, 0, 1000, -100}
+	gs   := []float64{GammaE, GammaP, GammaP, 9.8061978, 9.7772384, 9.8065063}
+
+	for i:=0; i<len(lats); i++ {
+		g := NewLocationGeodetic(lats[i], 0, hts[i]).NormalGravity()
+		testDiff(fmt.Sprintf("normal gravity at %4.1f° %5.0fm", lats[i], hts[i]), g, gs[i], 1e-6, t)
+	}
+}
+
+func TestNormalZonals(t *testing.T) {
+	// NIMA TR8350.2 table 3.8
+	testDiff("C(2,0)", normalZonal(2), -0.484166774985e-3, 1e-14, t)
+	testDiff("C(4,0)", normalZonal(4), 0.790303733511e-6, 1e-16, t)
+	testDiff("C(6,0)", normalZonal(6), -0.168724961151e-8, 1e-18, t)
+	testDiff("C(3,0)", normalZonal(3), 0, 1e-20, t)
+}
+
+// writeNormalCOF writes a coefficient file in the EGM96 format which reproduces
+// the WGS84 normal potential, plus the given coefficient C(n,m).
+func writeNormalCOF(t *testing.T, n, m int, c float64) (fn string) {
+	var s string
+	for k:=2; k<=20; k++ {
+		for j:=0; j<=k; j++ {
+			cc := 0.0
+			if j==0 {
+				cc = normalZonal(k)*GM/egm96GM*math.Pow(A/egm96Radius, float64(k))
+			}
+			if k==n && j==m {
+				cc += c
+			}
+			s += fmt.Sprintf("%5d%5d %19.12E %19.12E  0.0  0.0\n", k, j, cc, 0.0)
+		}
+	}
+	fn = filepath.Join(t.TempDir(), "egm96.ascii")
+	if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestGravityDisturbance(t *testing.T) {
+	egm96C, egm96S = nil, nil
+	if _, err := NewLocationGeodetic(0, 0, 0).GravityDisturbance(); err==nil {
+		t.Error("GravityDisturbance should fail without coefficients")
+	}
+	if g, err := NewLocationGeodetic(0, 0, 0).Gravity(); err==nil || g!=GammaE {
+		t.Error("Gravity should return normal gravity and an error without coefficients")
+	}
+
+	// A model equal to the normal potential has only the tiny disturbance from the difference in GM
+	if err := LoadEGM96COF(writeNormalCOF(t, 0, 0, 0)); err!=nil {
+		t.Fatal(err)
+	}
+	for _, lat := range []float64{0, 30, -60, 89} {
+		l := NewLocationGeodetic(lat, 20, 500)
+		_, _, r := l.Spherical()
+		dg, _ := l.GravityDisturbance()
+		testDiff(fmt.Sprintf("normal model disturbance at %4.1f°", lat), dg, (egm96GM-GM)/(r*r), 1e-12, t)
+	}
+
+	// A single C(2,2) term, evaluated on the equator at longitude 0
+	c22 := 2.4e-6
+	if err := LoadEGM96COF(writeNormalCOF(t, 2, 2, c22)); err!=nil {
+		t.Fatal(err)
+	}
+	l := NewLocationGeodetic(0, 0, 0)
+	_, _, r := l.Spherical()
+	p22 := math.Sqrt(15)/2
+	tt := egm96GM/r*math.Pow(egm96Radius/r, 2)*c22*p22
+	t0 := (egm96GM-GM)/r
+	dg, _ := l.GravityDisturbance()
+	testDiff("C(2,2) disturbance", dg/MGal, (3*tt+t0)/r/MGal, 1e-6, t)
+	da, _ := l.GravityAnomaly()
+	testDiff("C(2,2) anomaly", da/MGal, (tt-t0)/r/MGal, 1e-6, t)
+	g, _ := l.Gravity()
+	testDiff("C(2,2) gravity", g, GammaE+dg, 1e-12, t)
+
+	egm96C, egm96S = nil, nil
+}
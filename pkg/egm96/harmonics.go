@@ -0,0 +1,182 @@
+package egm96
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Constants of the EGM96 spherical harmonic expansion, which differ slightly
+// from those of the WGS84 ellipsoid.
+const (
+	egm96GM     = 3986004.415e8 // Gravitational constant of the EGM96 expansion, m³/s²
+	egm96Radius = 6378136.3     // Reference radius of the EGM96 expansion, m
+)
+
+var (
+	egm96NMax int       // Maximum degree of the loaded coefficients
+	egm96C    []float64 // Fully normalized C(n,m) of the disturbing potential, indexed by n(n+1)/2+m
+	egm96S    []float64 // Fully normalized S(n,m), indexed by n(n+1)/2+m
+)
+
+// LoadEGM96COF loads the EGM96 spherical harmonic coefficients from the named file,
+// which must be in the format of the NGA-distributed egm96_to360.ascii file:
+// one line per coefficient holding the degree n, the order m, the fully normalized
+// coefficients C(n,m) and S(n,m), and optionally their standard deviations.
+//
+// The coefficients are needed by the functions that calculate the gravity
+// field, but not for the geoid height, which is interpolated from the built-in grid.
+// The WGS84 normal gravity field is subtracted from the loaded coefficients, which
+// then represent the disturbing potential.
+func LoadEGM96COF(fn string) (err error) {
+	var (
+		n, m, nMax int
+		c, s       float64
+	)
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	type coefficient struct {
+		n, m int
+		c, s float64
+	}
+	var coefs []coefficient
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		dat := strings.Fields(strings.ReplaceAll(scanner.Text(), "D", "E"))
+		if len(dat)<4 {
+			continue
+		}
+		if n, err = strconv.Atoi(dat[0]); err != nil {
+			return fmt.Errorf("bad n value in EGM96 coefficient file %s", fn)
+		}
+		if m, err = strconv.Atoi(dat[1]); err != nil {
+			return fmt.Errorf("bad m value in EGM96 coefficient file %s", fn)
+		}
+		if n<0 || m<0 || m>n {
+			return fmt.Errorf("invalid degree and order (%d,%d) in EGM96 coefficient file %s", n, m, fn)
+		}
+		if c, err = strconv.ParseFloat(dat[2], 64); err != nil {
+			return fmt.Errorf("bad Cnm value in EGM96 coefficient file %s", fn)
+		}
+		if s, err = strconv.ParseFloat(dat[3], 64); err != nil {
+			return fmt.Errorf("bad Snm value in EGM96 coefficient file %s", fn)
+		}
+		coefs = append(coefs, coefficient{n, m, c, s})
+		if n>nMax {
+			nMax = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(coefs)==0 {
+		return fmt.Errorf("no coefficients found in EGM96 coefficient file %s", fn)
+	}
+
+	egm96NMax = nMax
+	egm96C = make([]float64, (nMax+1)*(nMax+2)/2)
+	egm96S = make([]float64, (nMax+1)*(nMax+2)/2)
+	egm96C[0] = 1
+	for _, k := range coefs {
+		egm96C[k.n*(k.n+1)/2+k.m] = k.c
+		egm96S[k.n*(k.n+1)/2+k.m] = k.s
+	}
+
+	// Subtract the normal potential, rescaled to the EGM96 constants
+	for n=0; n<=nMax; n+=2 {
+		scale := GM/egm96GM*math.Pow(A/egm96Radius, float64(n))
+		if n==0 {
+			egm96C[0] -= scale
+		} else {
+			egm96C[n*(n+1)/2] -= normalZonal(n)*scale
+		}
+	}
+	return nil
+}
+
+// harmonicSum holds the disturbing potential and its derivatives at a point.
+type harmonicSum struct {
+	t         float64 // Disturbing potential, m²/s²
+	dtdr      float64 // Radial derivative of the disturbing potential, m/s²
+	dtdphi    float64 // Derivative of the disturbing potential with respect to spherical latitude, m²/s²
+	dtdlambda float64 // Derivative of the disturbing potential with respect to longitude, m²/s²
+}
+
+// newHarmonicSum evaluates the disturbing potential from the loaded coefficients
+// at spherical latitude phi, longitude lambda (both in radians) and radius r in meters.
+//
+// The fully normalized associated Legendre functions are calculated by the standard
+// forward column recursion, which is stable to degree 360 and beyond.
+// The latitude derivative is not defined at the poles, where it is returned as zero.
+func newHarmonicSum(phi, lambda, r float64) (s harmonicSum) {
+	nMax := egm96NMax
+	t := math.Sin(phi)
+	u := math.Cos(phi)
+
+	ratio := egm96Radius/r
+	pow := make([]float64, nMax+1)
+	pow[0] = 1
+	for n:=1; n<=nMax; n++ {
+		pow[n] = pow[n-1]*ratio
+	}
+
+	var pmm float64
+	for m:=0; m<=nMax; m++ {
+		// Sectoral function P(m,m)
+		switch m {
+		case 0:
+			pmm = 1
+		case 1:
+			pmm = math.Sqrt(3)*u
+		default:
+			pmm *= u*math.Sqrt(float64(2*m+1)/float64(2*m))
+		}
+		mf := float64(m)
+		cosML := math.Cos(mf*lambda)
+		sinML := math.Sin(mf*lambda)
+
+		var p, p1, p2 float64 // P(n,m), P(n-1,m), P(n-2,m)
+		for n:=m; n<=nMax; n++ {
+			nf := float64(n)
+			switch n {
+			case m:
+				p = pmm
+			case m+1:
+				p = math.Sqrt(2*mf+3)*t*pmm
+			default:
+				a := math.Sqrt((2*nf-1)*(2*nf+1)/((nf-mf)*(nf+mf)))
+				b := math.Sqrt((2*nf+1)*(nf+mf-1)*(nf-mf-1)/((nf-mf)*(nf+mf)*(2*nf-3)))
+				p = a*t*p1 - b*p2
+			}
+			// dP(n,m)/dphi, from P(n,m) and P(n-1,m)
+			var dp float64
+			if u > 0 {
+				dp = (math.Sqrt((nf*nf-mf*mf)*(2*nf+1)/(2*nf-1))*p1 - nf*t*p)/u
+			}
+			p2, p1 = p1, p
+
+			k := n*(n+1)/2+m
+			cs := egm96C[k]*cosML + egm96S[k]*sinML
+			term := pow[n]*p*cs
+			s.t += term
+			s.dtdr -= (nf+1)*term
+			s.dtdphi += pow[n]*dp*cs
+			s.dtdlambda += pow[n]*p*mf*(egm96S[k]*cosML - egm96C[k]*sinML)
+		}
+	}
+
+	s.t *= egm96GM/r
+	s.dtdr *= egm96GM/(r*r)
+	s.dtdphi *= egm96GM/r
+	s.dtdlambda *= egm96GM/r
+	return s
+}
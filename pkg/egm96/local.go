@@ -0,0 +1,103 @@
+package egm96
+
+import "math"
+
+// Rotation is a 3x3 rotation matrix between two cartesian frames, such as
+// ECEF and a local tangent plane frame.  Row i holds the components, in the
+// source frame, of the i-th axis of the destination frame.
+type Rotation [3][3]float64
+
+// ENUToNED rotates vectors in a local East-North-Up frame to the
+// North-East-Down frame at the same point, and is its own inverse.
+var ENUToNED = Rotation{{0, 1, 0}, {1, 0, 0}, {0, 0, -1}}
+
+// Apply returns the vector x, y, z rotated into the destination frame.
+func (r Rotation) Apply(x, y, z float64) (xx, yy, zz float64) {
+	return r[0][0]*x + r[0][1]*y + r[0][2]*z,
+		r[1][0]*x + r[1][1]*y + r[1][2]*z,
+		r[2][0]*x + r[2][1]*y + r[2][2]*z
+}
+
+// Inverse returns the rotation from the destination frame back to the source
+// frame, which is the transpose of the matrix.
+func (r Rotation) Inverse() (s Rotation) {
+	for i:=0; i<3; i++ {
+		for j:=0; j<3; j++ {
+			s[i][j] = r[j][i]
+		}
+	}
+	return s
+}
+
+// Then returns the rotation that applies r followed by s.
+func (r Rotation) Then(s Rotation) (t Rotation) {
+	for i:=0; i<3; i++ {
+		for j:=0; j<3; j++ {
+			for k:=0; k<3; k++ {
+				t[i][j] += s[i][k]*r[k][j]
+			}
+		}
+	}
+	return t
+}
+
+// ECEFToENU returns the rotation from ECEF axes to the local East-North-Up
+// tangent plane axes at the Location.
+//
+// Up is along the normal to the WGS84 ellipsoid, and North and East are parallel
+// to the ellipsoid, so the frame differs slightly from one based on the local vertical.
+func (l Location) ECEFToENU() (r Rotation) {
+	sinPhi, cosPhi := math.Sin(l.latitude), math.Cos(l.latitude)
+	sinLambda, cosLambda := math.Sin(l.longitude), math.Cos(l.longitude)
+	return Rotation{
+		{-sinLambda, cosLambda, 0},
+		{-sinPhi*cosLambda, -sinPhi*sinLambda, cosPhi},
+		{cosPhi*cosLambda, cosPhi*sinLambda, sinPhi},
+	}
+}
+
+// ECEFToNED returns the rotation from ECEF axes to the local North-East-Down
+// tangent plane axes at the Location.
+func (l Location) ECEFToNED() (r Rotation) {
+	return l.ECEFToENU().Then(ENUToNED)
+}
+
+// ENU returns the east, north and up components in meters of the straight-line
+// vector from the Location to the Location to, in the local tangent plane at the Location.
+func (l Location) ENU(to Location) (e, n, u float64) {
+	x0, y0, z0 := l.ECEF()
+	x1, y1, z1 := to.ECEF()
+	return l.ECEFToENU().Apply(x1-x0, y1-y0, z1-z0)
+}
+
+// NED returns the north, east and down components in meters of the straight-line
+// vector from the Location to the Location to, in the local tangent plane at the Location.
+func (l Location) NED(to Location) (n, e, d float64) {
+	e, n, u := l.ENU(to)
+	return n, e, -u
+}
+
+// OffsetENU returns the Location reached by moving e meters east, n meters north
+// and u meters up from the Location, in straight lines in its local tangent plane.
+//
+// For example, the point 300m north and 50m east of loc and 10m higher is
+//  loc.OffsetENU(50, 300, 10)
+// The offset is a straight line rather than following the curvature of the Earth,
+// so over distances of more than a few km the resulting height will be
+// noticeably greater than loc's height plus u.
+func (l Location) OffsetENU(e, n, u float64) (loc Location) {
+	x, y, z := l.ECEF()
+	dx, dy, dz := l.ECEFToENU().Inverse().Apply(e, n, u)
+	loc = NewLocationECEF(x+dx, y+dy, z+dz)
+	if l.longitude < 0 && loc.longitude > math.Pi {
+		// Keep the longitude convention of the input
+		loc.longitude -= 2*math.Pi
+	}
+	return loc
+}
+
+// OffsetNED returns the Location reached by moving n meters north, e meters east
+// and d meters down from the Location, in straight lines in its local tangent plane.
+func (l Location) OffsetNED(n, e, d float64) (loc Location) {
+	return l.OffsetENU(e, n, -d)
+}
@@ -0,0 +1,65 @@
+package egm96
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRotations(t *testing.T) {
+	l := NewLocationGeodetic(37.5, -122.3, 20)
+	for name, r := range map[string]Rotation{"ENU": l.ECEFToENU(), "NED": l.ECEFToNED()} {
+		// Rotations are orthonormal
+		p := r.Then(r.Inverse())
+		for i:=0; i<3; i++ {
+			for j:=0; j<3; j++ {
+				want := 0.0
+				if i==j {
+					want = 1
+				}
+				testDiff(fmt.Sprintf("%s orthonormal %d%d", name, i, j), p[i][j], want, 1e-15, t)
+			}
+		}
+	}
+
+	// At latitude 0, longitude 0 up is along the x axis and north along the z axis
+	e, n, u := NewLocationGeodetic(0, 0, 0).ECEFToENU().Apply(1, 2, 3)
+	testDiff("equator east", e, 2, 1e-15, t)
+	testDiff("equator north", n, 3, 1e-15, t)
+	testDiff("equator up", u, 1, 1e-15, t)
+	n, e, d := NewLocationGeodetic(90, 0, 0).ECEFToNED().Apply(1, 2, 3)
+	testDiff("pole north", n, -1, 1e-15, t)
+	testDiff("pole east", e, 2, 1e-15, t)
+	testDiff("pole down", d, -3, 1e-15, t)
+}
+
+func TestLocalOffsets(t *testing.T) {
+	for _, lat := range []float64{-89, -45, 0, 30, 89.9} {
+		for _, lng := range []float64{-170, 0, 45} {
+			l := NewLocationGeodetic(lat, lng, 100)
+			name := fmt.Sprintf("%5.1f %6.1f", lat, lng)
+
+			l2 := l.OffsetENU(50, 300, 10)
+			e, n, u := l.ENU(l2)
+			testDiff(name+" east", e, 50, 1e-6, t)
+			testDiff(name+" north", n, 300, 1e-6, t)
+			testDiff(name+" up", u, 10, 1e-6, t)
+
+			n, e, d := l.NED(l.OffsetNED(-20, 70, 5))
+			testDiff(name+" NED north", n, -20, 1e-6, t)
+			testDiff(name+" NED east", e, 70, 1e-6, t)
+			testDiff(name+" NED down", d, 5, 1e-6, t)
+
+			// Over short distances the offset changes height by only the vertical component
+			testDiff(name+" offset height", l2.height, 110, 0.01, t)
+			if (lng < 0) != (l2.longitude < 0) {
+				t.Errorf("%s: offset changed the longitude convention to %6.1f", name, l2.longitude/Deg)
+			}
+		}
+	}
+
+	// 1' of latitude north of the equator is about 1843m, falling 0.27m below the tangent plane
+	n, e, d := NewLocationGeodetic(0, 0, 0).NED(NewLocationGeodetic(1.0/60, 0, 0))
+	testDiff("1' north", n, 1842.9, 0.1, t)
+	testDiff("1' east", e, 0, 1e-6, t)
+	testDiff("1' down", d, 0.27, 0.01, t)
+}
@@ -0,0 +1,107 @@
+package egm96
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// degrees converts an angle in radians to decimal degrees rounded to 1e-9 degrees,
+// about 0.1mm, so that values entered in degrees are written back unchanged.
+func degrees(rad float64) (deg float64) {
+	return math.Round(rad/Deg*1e9) / 1e9
+}
+
+// locationJSON is the JSON representation of a Location, with the latitude
+// and longitude in decimal degrees and the height in meters above the WGS84 ellipsoid.
+type locationJSON struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Height    float64  `json:"height"`
+}
+
+// MarshalJSON encodes the Location as a JSON object such as
+//  {"latitude":47.45,"longitude":-122.31,"height":100}
+// with the latitude and longitude in decimal degrees and the height in meters
+// above the WGS84 ellipsoid.
+func (l Location) MarshalJSON() ([]byte, error) {
+	lat, lng := degrees(l.latitude), degrees(l.longitude)
+	return json.Marshal(locationJSON{Latitude: &lat, Longitude: &lng, Height: l.height})
+}
+
+// UnmarshalJSON decodes a Location from the JSON object produced by MarshalJSON.
+// The height is optional and defaults to zero, but the latitude and longitude are required.
+func (l *Location) UnmarshalJSON(b []byte) error {
+	var lj locationJSON
+	if err := json.Unmarshal(b, &lj); err != nil {
+		return err
+	}
+	if lj.Latitude == nil || lj.Longitude == nil {
+		return fmt.Errorf("a location requires a latitude and longitude")
+	}
+	*l = NewLocationGeodetic(*lj.Latitude, *lj.Longitude, lj.Height)
+	return nil
+}
+
+// MarshalText encodes the Location as "latitude,longitude,height" with the
+// latitude and longitude in decimal degrees and the height in meters above
+// the WGS84 ellipsoid, e.g. "47.45,-122.31,100".
+func (l Location) MarshalText() ([]byte, error) {
+	return []byte(strings.Join([]string{
+		strconv.FormatFloat(degrees(l.latitude), 'f', -1, 64),
+		strconv.FormatFloat(degrees(l.longitude), 'f', -1, 64),
+		strconv.FormatFloat(l.height, 'f', -1, 64),
+	}, ",")), nil
+}
+
+// UnmarshalText decodes a Location from the text produced by MarshalText.
+// The height may be omitted, in which case it is zero.
+func (l *Location) UnmarshalText(b []byte) error {
+	fs := strings.Split(string(b), ",")
+	if len(fs) < 2 || len(fs) > 3 {
+		return fmt.Errorf("location %q is not latitude,longitude[,height]", b)
+	}
+	var v [3]float64
+	for i, f := range fs {
+		var err error
+		if v[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return fmt.Errorf("invalid location %q: %v", b, err)
+		}
+	}
+	*l = NewLocationGeodetic(v[0], v[1], v[2])
+	return nil
+}
+
+// GeoJSONPoint is a GeoJSON Point geometry as defined by RFC 7946.
+// The coordinates are longitude and latitude in decimal degrees, followed by
+// the height in meters above the WGS84 ellipsoid.
+type GeoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// GeoJSONPoint returns the Location as a GeoJSON Point, which can be marshaled
+// directly or used as the geometry of a larger GeoJSON Feature.
+func (l Location) GeoJSONPoint() (p GeoJSONPoint) {
+	return GeoJSONPoint{
+		Type:        "Point",
+		Coordinates: []float64{degrees(l.longitude), degrees(l.latitude), l.height},
+	}
+}
+
+// Location returns the Location of a GeoJSON Point.
+// A Point without a height is taken to be on the WGS84 ellipsoid.
+func (p GeoJSONPoint) Location() (loc Location, err error) {
+	if p.Type != "Point" {
+		return Location{}, fmt.Errorf("GeoJSON geometry type %q is not Point", p.Type)
+	}
+	switch len(p.Coordinates) {
+	case 2:
+		return NewLocationGeodetic(p.Coordinates[1], p.Coordinates[0], 0), nil
+	case 3:
+		return NewLocationGeodetic(p.Coordinates[1], p.Coordinates[0], p.Coordinates[2]), nil
+	}
+	return Location{}, fmt.Errorf("GeoJSON Point has %d coordinates", len(p.Coordinates))
+}
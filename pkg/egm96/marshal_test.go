@@ -0,0 +1,94 @@
+package egm96
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLocationJSON(t *testing.T) {
+	l := NewLocationGeodetic(47.45, -122.31, 100)
+	b, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"latitude":47.45,"longitude":-122.31,"height":100}` {
+		t.Errorf("Location marshaled to JSON as %s", b)
+	}
+
+	var ll Location
+	if err = json.Unmarshal(b, &ll); err != nil {
+		t.Fatal(err)
+	}
+	lat, lng, h := ll.Geodetic()
+	testDiff("JSON latitude", lat/Deg, 47.45, 1e-12, t)
+	testDiff("JSON longitude", lng/Deg, -122.31, 1e-12, t)
+	testDiff("JSON height", h, 100, 1e-12, t)
+
+	for _, s := range []string{`{"latitude":47.45}`, `{"longitude":-122.31,"height":10}`, `[1,2]`} {
+		if err = json.Unmarshal([]byte(s), &ll); err == nil {
+			t.Errorf("Location incorrectly unmarshaled from %s", s)
+		}
+	}
+}
+
+func TestLocationText(t *testing.T) {
+	l := NewLocationGeodetic(-33.8688, 151.2093, 58.5)
+	b, err := l.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "-33.8688,151.2093,58.5" {
+		t.Errorf("Location marshaled to text as %s", b)
+	}
+
+	// Locations as map keys use the text encoding
+	m := map[Location]int{l: 1}
+	if b, err = json.Marshal(m); err != nil || string(b) != `{"-33.8688,151.2093,58.5":1}` {
+		t.Errorf("Location map key marshaled as %s, %v", b, err)
+	}
+
+	var ll Location
+	for _, s := range []string{"-33.8688,151.2093,58.5", "-33.8688, 151.2093"} {
+		if err = ll.UnmarshalText([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		lat, lng, _ := ll.Geodetic()
+		testDiff("text latitude", lat/Deg, -33.8688, 1e-12, t)
+		testDiff("text longitude", lng/Deg, 151.2093, 1e-12, t)
+	}
+	for _, s := range []string{"", "-33.8688", "1,2,3,4", "1,north"} {
+		if err = ll.UnmarshalText([]byte(s)); err == nil {
+			t.Errorf("Location incorrectly unmarshaled from %q", s)
+		}
+	}
+}
+
+func TestGeoJSONPoint(t *testing.T) {
+	l := NewLocationGeodetic(51.4779, -0.0015, 45)
+	b, err := json.Marshal(l.GeoJSONPoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"type":"Point","coordinates":[-0.0015,51.4779,45]}` {
+		t.Errorf("Location marshaled to GeoJSON as %s", b)
+	}
+
+	var p GeoJSONPoint
+	if err = json.Unmarshal([]byte(`{"type":"Point","coordinates":[-0.0015,51.4779]}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	ll, err := p.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, lng, h := ll.Geodetic()
+	testDiff("GeoJSON latitude", lat/Deg, 51.4779, 1e-12, t)
+	testDiff("GeoJSON longitude", lng/Deg, -0.0015, 1e-12, t)
+	testDiff("GeoJSON height", h, 0, 1e-20, t)
+
+	for _, p = range []GeoJSONPoint{{Type: "LineString", Coordinates: []float64{1, 2}}, {Type: "Point", Coordinates: []float64{1}}} {
+		if _, err = p.Location(); err == nil {
+			t.Errorf("Location incorrectly obtained from %v", p)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+// Package geodesic solves the direct and inverse geodesic problems on the
+// WGS84 reference ellipsoid.
+//
+// The inverse problem finds the shortest distance between two locations
+// on the ellipsoid and the azimuths of the geodesic at each end.
+// The direct problem finds the location reached by travelling a given distance
+// along a geodesic from a starting location with a given initial azimuth.
+//
+// The algorithms are those of C. F. F. Karney, Algorithms for geodesics,
+// J. Geodesy 87, 43-55 (2013), https://doi.org/10.1007/s00190-012-0578-z,
+// as implemented in GeographicLib.  They are accurate to round-off
+// (about 15 nm for WGS84) and the inverse solution converges for all pairs
+// of points, including nearly antipodal ones.
+package geodesic
+
+import (
+	"math"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+const (
+	tol0    = 0x1p-52 // Machine epsilon
+	tol1    = 200 * tol0
+	maxit1  = 20
+	maxit2  = maxit1 + 53 + 10
+	degrees = 180 / math.Pi
+)
+
+var (
+	tiny    = math.Sqrt(0x1p-1022) // Square root of the smallest normal float64
+	tol2    = math.Sqrt(tol0)
+	tolb    = tol0 * tol2
+	xthresh = 1000 * tol2
+)
+
+// Geodesic holds the ellipsoid parameters and precomputed series
+// coefficients needed to solve geodesic problems on an ellipsoid.
+type Geodesic struct {
+	a, f           float64 // Equatorial radius and flattening
+	f1, e2, ep2, n float64 // 1-f, eccentricity squared, second eccentricity squared, third flattening
+	b              float64 // Polar semi-axis
+	etol2          float64
+	a3x            [nSeries]float64
+	c3x            [nC3x]float64
+}
+
+// WGS84 is the Geodesic for the WGS84 reference ellipsoid.
+var WGS84 = NewGeodesic(egm96.WGS84)
+
+// NewGeodesic returns a Geodesic for the ellipsoid e.
+func NewGeodesic(e egm96.Ellipsoid) (g Geodesic) {
+	a, f := e.A, e.F
+	g.a = a
+	g.f = f
+	g.f1 = 1 - f
+	g.e2 = f * (2 - f)
+	g.ep2 = g.e2 / (g.f1 * g.f1)
+	g.n = f / (2 - f)
+	g.b = a * g.f1
+	g.etol2 = 0.1 * tol2 / math.Sqrt(math.Max(0.001, math.Abs(f))*math.Min(1, 1-f/2)/2)
+	g.a3x = a3coeff(g.n)
+	g.c3x = c3coeff(g.n)
+	return g
+}
+
+// Inverse returns the distance s12 in meters along the shortest geodesic on the
+// WGS84 ellipsoid from l1 to l2, together with the forward azimuth azi1 at l1
+// and the azimuth azi2 at l2, both in degrees clockwise from true north.
+//
+// azi2 is the direction of travel at l2, so the back azimuth from l2 to l1
+// is azi2±180°.  The heights of the locations are ignored.
+func Inverse(l1, l2 egm96.Location) (s12, azi1, azi2 float64) {
+	return WGS84.Inverse(l1, l2)
+}
+
+// Direct returns the location l2 reached by travelling a distance s12 in meters
+// along a geodesic on the WGS84 ellipsoid from l1 with initial azimuth azi1,
+// together with the azimuth azi2 of the geodesic at l2.
+//
+// Azimuths are in degrees clockwise from true north.
+// The returned location has the same height as l1.
+func Direct(l1 egm96.Location, azi1, s12 float64) (l2 egm96.Location, azi2 float64) {
+	return WGS84.Direct(l1, azi1, s12)
+}
+
+// Inverse solves the inverse geodesic problem on the ellipsoid of g.
+// See the package-level Inverse for details.
+func (g Geodesic) Inverse(l1, l2 egm96.Location) (s12, azi1, azi2 float64) {
+	lat1, lon1 := latLngDegrees(l1)
+	lat2, lon2 := latLngDegrees(l2)
+	return g.inverse(lat1, lon1, lat2, lon2)
+}
+
+// Direct solves the direct geodesic problem on the ellipsoid of g.
+// See the package-level Direct for details.
+func (g Geodesic) Direct(l1 egm96.Location, azi1, s12 float64) (l2 egm96.Location, azi2 float64) {
+	lat1, lon1 := latLngDegrees(l1)
+	_, _, h := l1.Geodetic()
+	lat2, lon2, azi2 := g.direct(lat1, lon1, azi1, s12)
+	return egm96.NewLocationGeodetic(lat2, lon2, h), azi2
+}
+
+// latLngDegrees returns the latitude and longitude of l in degrees,
+// clamping the latitude so that round-off can't push a pole out of range.
+func latLngDegrees(l egm96.Location) (lat, lng float64) {
+	lat, lng, _ = l.Geodetic()
+	return math.Max(-90, math.Min(90, lat/egm96.Deg)), lng / egm96.Deg
+}
+
+// direct solves the direct problem with all angles in degrees.
+func (g Geodesic) direct(lat1, lon1, azi1, s12 float64) (lat2, lon2, azi2 float64) {
+	var c1a, c1pa [nSeries + 1]float64
+	var c3a [nSeries]float64
+
+	lat1 = latFix(lat1)
+	salp1, calp1 := sinCosD(angRound(azi1))
+	sbet1, cbet1 := sinCosD(angRound(lat1))
+	sbet1 *= g.f1
+	sbet1, cbet1 = norm(sbet1, cbet1)
+	cbet1 = math.Max(tiny, cbet1)
+
+	salp0 := salp1 * cbet1
+	calp0 := math.Hypot(calp1, salp1*sbet1)
+	ssig1 := sbet1
+	somg1 := salp0 * sbet1
+	csig1 := 1.0
+	if sbet1 != 0 || calp1 != 0 {
+		csig1 = cbet1 * calp1
+	}
+	comg1 := csig1
+	ssig1, csig1 = norm(ssig1, csig1)
+
+	k2 := calp0 * calp0 * g.ep2
+	eps := k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+	a1m1 := a1m1f(eps)
+	c1f(eps, c1a[:])
+	c1pf(eps, c1pa[:])
+	b11 := sinCosSeries(true, ssig1, csig1, c1a[:])
+	s, c := math.Sin(b11), math.Cos(b11)
+	stau1 := ssig1*c + csig1*s
+	ctau1 := csig1*c - ssig1*s
+	a3c := -g.f * salp0 * g.a3f(eps)
+	g.c3f(eps, c3a[:])
+	b31 := sinCosSeries(true, ssig1, csig1, c3a[:])
+
+	tau12 := s12 / (g.b * (1 + a1m1))
+	s, c = math.Sin(tau12), math.Cos(tau12)
+	b12 := -sinCosSeries(true, stau1*c+ctau1*s, ctau1*c-stau1*s, c1pa[:])
+	sig12 := tau12 - (b12 - b11)
+	ssig12, csig12 := math.Sin(sig12), math.Cos(sig12)
+	if math.Abs(g.f) > 0.01 {
+		// Reverted series is inaccurate for large flattening, so take one Newton step
+		ssig2 := ssig1*csig12 + csig1*ssig12
+		csig2 := csig1*csig12 - ssig1*ssig12
+		b12 = sinCosSeries(true, ssig2, csig2, c1a[:])
+		serr := (1+a1m1)*(sig12+(b12-b11)) - s12/g.b
+		sig12 -= serr / math.Sqrt(1+k2*ssig2*ssig2)
+		ssig12, csig12 = math.Sin(sig12), math.Cos(sig12)
+	}
+
+	ssig2 := ssig1*csig12 + csig1*ssig12
+	csig2 := csig1*csig12 - ssig1*ssig12
+	sbet2 := calp0 * ssig2
+	cbet2 := math.Hypot(salp0, calp0*csig2)
+	if cbet2 == 0 {
+		cbet2, csig2 = tiny, tiny
+	}
+	salp2 := salp0
+	calp2 := calp0 * csig2
+
+	somg2 := salp0 * ssig2
+	comg2 := csig2
+	omg12 := math.Atan2(somg2*comg1-comg2*somg1, comg2*comg1+somg2*somg1)
+	lam12 := omg12 + a3c*(sig12+(sinCosSeries(true, ssig2, csig2, c3a[:])-b31))
+	lon2 = angNormalize(angNormalize(lon1) + angNormalize(lam12*degrees))
+	lat2 = atan2D(sbet2, g.f1*cbet2)
+	azi2 = atan2D(salp2, calp2)
+	return lat2, lon2, azi2
+}
+
+// inverse solves the inverse problem with all angles in degrees.
+func (g Geodesic) inverse(lat1, lon1, lat2, lon2 float64) (s12, azi1, azi2 float64) {
+	var (
+		c1a, c2a                   [nSeries + 1]float64
+		c3a                        [nSeries]float64
+		salp1, calp1, salp2, calp2 float64
+		sig12, s12x, m12x          float64
+	)
+
+	// Reduce to the canonical configuration 0 <= lon12 <= 180, lat1 <= -|lat2|
+	lon12, lon12s := angDiff(lon1, lon2)
+	lonsign := 1.0
+	if lon12 < 0 {
+		lonsign = -1
+	}
+	lon12 = lonsign * angRound(lon12)
+	lon12s = angRound((180 - lon12) - lonsign*lon12s)
+	lam12 := lon12 / degrees
+	var slam12, clam12 float64
+	if lon12 > 90 {
+		slam12, clam12 = sinCosD(lon12s)
+		clam12 = -clam12
+	} else {
+		slam12, clam12 = sinCosD(lon12)
+	}
+
+	lat1 = angRound(latFix(lat1))
+	lat2 = angRound(latFix(lat2))
+	swapp := 1.0
+	if math.Abs(lat1) < math.Abs(lat2) {
+		swapp = -1
+		lonsign *= -1
+		lat1, lat2 = lat2, lat1
+	}
+	latsign := -1.0
+	if lat1 < 0 {
+		latsign = 1
+	}
+	lat1 *= latsign
+	lat2 *= latsign
+
+	sbet1, cbet1 := sinCosD(lat1)
+	sbet1 *= g.f1
+	sbet1, cbet1 = norm(sbet1, cbet1)
+	cbet1 = math.Max(tiny, cbet1)
+	sbet2, cbet2 := sinCosD(lat2)
+	sbet2 *= g.f1
+	sbet2, cbet2 = norm(sbet2, cbet2)
+	cbet2 = math.Max(tiny, cbet2)
+
+	if cbet1 < -sbet1 {
+		if cbet2 == cbet1 {
+			sbet2 = math.Copysign(sbet1, sbet2)
+		}
+	} else if math.Abs(sbet2) == -sbet1 {
+		cbet2 = cbet1
+	}
+
+	dn1 := math.Sqrt(1 + g.ep2*sbet1*sbet1)
+	dn2 := math.Sqrt(1 + g.ep2*sbet2*sbet2)
+
+	meridian := lat1 == -90 || slam12 == 0
+	if meridian {
+		// Endpoints on a single full meridian
+		calp1, salp1 = clam12, slam12
+		calp2, salp2 = 1, 0
+		ssig1, csig1 := sbet1, calp1*cbet1
+		ssig2, csig2 := sbet2, calp2*cbet2
+		sig12 = math.Atan2(math.Max(0, csig1*ssig2-ssig1*csig2), csig1*csig2+ssig1*ssig2)
+		s12x, m12x, _ = g.lengths(g.n, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2, c1a[:], c2a[:])
+		if sig12 < 1 || m12x >= 0 {
+			if sig12 < 3*tiny || (sig12 < tol0 && (s12x < 0 || m12x < 0)) {
+				s12x = 0
+			}
+			s12x *= g.b
+		} else {
+			// m12 < 0, i.e., prolate and too close to anti-podal
+			meridian = false
+		}
+	}
+
+	if !meridian && sbet1 == 0 && (g.f <= 0 || lon12s >= g.f*180) {
+		// Geodesic runs along the equator
+		calp1, calp2 = 0, 0
+		salp1, salp2 = 1, 1
+		s12x = g.a * lam12
+	} else if !meridian {
+		var dnm float64
+		sig12, salp1, calp1, salp2, calp2, dnm = g.inverseStart(sbet1, cbet1, dn1, sbet2, cbet2, dn2,
+			lam12, slam12, clam12)
+		if sig12 >= 0 {
+			// Short lines, solved directly
+			s12x = sig12 * g.b * dnm
+		} else {
+			// Newton's method, falling back to bisection
+			var (
+				ssig1, csig1, ssig2, csig2, eps float64
+				tripn, tripb                    bool
+			)
+			salp1a, calp1a := tiny, 1.0
+			salp1b, calp1b := tiny, -1.0
+			for numit := 0; numit < maxit2; {
+				var v, dv float64
+				v, salp2, calp2, sig12, ssig1, csig1, ssig2, csig2, eps, dv = g.lambda12(
+					sbet1, cbet1, dn1, sbet2, cbet2, dn2, salp1, calp1, slam12, clam12,
+					numit < maxit1, c1a[:], c2a[:], c3a[:])
+				tol := tol0
+				if tripn {
+					tol *= 8
+				}
+				if tripb || !(math.Abs(v) >= tol) {
+					break
+				}
+				if v > 0 && (numit > maxit1 || calp1/salp1 > calp1b/salp1b) {
+					salp1b, calp1b = salp1, calp1
+				} else if v < 0 && (numit > maxit1 || calp1/salp1 < calp1a/salp1a) {
+					salp1a, calp1a = salp1, calp1
+				}
+				numit++
+				if numit < maxit1 && dv > 0 {
+					dalp1 := -v / dv
+					if math.Abs(dalp1) < math.Pi {
+						sdalp1, cdalp1 := math.Sin(dalp1), math.Cos(dalp1)
+						nsalp1 := salp1*cdalp1 + calp1*sdalp1
+						if nsalp1 > 0 {
+							calp1 = calp1*cdalp1 - salp1*sdalp1
+							salp1, calp1 = norm(nsalp1, calp1)
+							tripn = math.Abs(v) <= 16*tol0
+							continue
+						}
+					}
+				}
+				salp1, calp1 = norm((salp1a+salp1b)/2, (calp1a+calp1b)/2)
+				tripn = false
+				tripb = math.Abs(salp1a-salp1)+(calp1a-calp1) < tolb ||
+					math.Abs(salp1-salp1b)+(calp1-calp1b) < tolb
+			}
+			s12x, _, _ = g.lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2, c1a[:], c2a[:])
+			s12x *= g.b
+		}
+	}
+
+	if swapp < 0 {
+		salp1, salp2 = salp2, salp1
+		calp1, calp2 = calp2, calp1
+	}
+	salp1 *= swapp * lonsign
+	calp1 *= swapp * latsign
+	salp2 *= swapp * lonsign
+	calp2 *= swapp * latsign
+
+	return s12x + 0, atan2D(salp1, calp1), atan2D(salp2, calp2)
+}
+
+// a3f evaluates A3 for the given eps.
+func (g Geodesic) a3f(eps float64) (a float64) {
+	return polyval(nSeries-1, g.a3x[:], eps)
+}
+
+// c3f fills c[1..5] with the coefficients C3[l] for the given eps.
+func (g Geodesic) c3f(eps float64, c []float64) {
+	mult := 1.0
+	o := 0
+	for l := 1; l < nSeries; l++ {
+		m := nSeries - l - 1
+		mult *= eps
+		c[l] = mult * polyval(m, g.c3x[o:], eps)
+		o += m + 1
+	}
+}
+
+// lengths returns the scaled distance s12b and reduced length m12b along a
+// geodesic of arc length sig12, and the coefficient m0 of the reduced length.
+func (g Geodesic) lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2 float64,
+	c1a, c2a []float64) (s12b, m12b, m0 float64) {
+	a1 := a1m1f(eps)
+	c1f(eps, c1a)
+	a2 := a2m1f(eps)
+	c2f(eps, c2a)
+	m0 = a1 - a2
+	a1++
+	a2++
+	b1 := sinCosSeries(true, ssig2, csig2, c1a) - sinCosSeries(true, ssig1, csig1, c1a)
+	s12b = a1 * (sig12 + b1)
+	b2 := sinCosSeries(true, ssig2, csig2, c2a) - sinCosSeries(true, ssig1, csig1, c2a)
+	j12 := m0*sig12 + (a1*b1 - a2*b2)
+	m12b = dn2*(csig1*ssig2) - dn1*(ssig1*csig2) - csig1*csig2*j12
+	return s12b, m12b, m0
+}
+
+// astroid solves k^4+2*k^3-(x^2+y^2-1)*k^2-2*y^2*k-y^2 = 0 for its positive root.
+func astroid(x, y float64) (k float64) {
+	p := x * x
+	q := y * y
+	r := (p + q - 1) / 6
+	if q == 0 && r <= 0 {
+		return 0
+	}
+	s := p * q / 4
+	r2 := r * r
+	r3 := r * r2
+	disc := s * (s + 2*r3)
+	u := r
+	if disc >= 0 {
+		t3 := s + r3
+		if t3 < 0 {
+			t3 -= math.Sqrt(disc)
+		} else {
+			t3 += math.Sqrt(disc)
+		}
+		t := math.Cbrt(t3)
+		u += t
+		if t != 0 {
+			u += r2 / t
+		}
+	} else {
+		ang := math.Atan2(math.Sqrt(-disc), -(s + r3))
+		u += 2 * r * math.Cos(ang/3)
+	}
+	v := math.Sqrt(u*u + q)
+	var uv float64
+	if u < 0 {
+		uv = q / (v - u)
+	} else {
+		uv = u + v
+	}
+	w := (uv - q) / (2 * v)
+	return uv / (math.Sqrt(uv+w*w) + w)
+}
+
+// inverseStart returns a starting guess for the azimuth alp1 of the inverse problem.
+// If the points are close enough that the problem can be solved directly,
+// sig12 is non-negative and salp2, calp2 and dnm are also returned.
+func (g Geodesic) inverseStart(sbet1, cbet1, dn1, sbet2, cbet2, dn2, lam12, slam12, clam12 float64) (
+	sig12, salp1, calp1, salp2, calp2, dnm float64) {
+	sig12 = -1
+	sbet12 := sbet2*cbet1 - cbet2*sbet1
+	cbet12 := cbet2*cbet1 + sbet2*sbet1
+	sbet12a := sbet2*cbet1 + cbet2*sbet1
+	shortline := cbet12 >= 0 && sbet12 < 0.5 && cbet2*lam12 < 0.5
+	var somg12, comg12 float64
+	if shortline {
+		sbetm2 := (sbet1 + sbet2) * (sbet1 + sbet2)
+		sbetm2 /= sbetm2 + (cbet1+cbet2)*(cbet1+cbet2)
+		dnm = math.Sqrt(1 + g.ep2*sbetm2)
+		omg12 := lam12 / (g.f1 * dnm)
+		somg12, comg12 = math.Sin(omg12), math.Cos(omg12)
+	} else {
+		somg12, comg12 = slam12, clam12
+	}
+
+	salp1 = cbet2 * somg12
+	if comg12 >= 0 {
+		calp1 = sbet12 + cbet2*sbet1*somg12*somg12/(1+comg12)
+	} else {
+		calp1 = sbet12a - cbet2*sbet1*somg12*somg12/(1-comg12)
+	}
+	ssig12 := math.Hypot(salp1, calp1)
+	csig12 := sbet1*sbet2 + cbet1*cbet2*comg12
+
+	if shortline && ssig12 < g.etol2 {
+		// Really short lines
+		salp2 = cbet1 * somg12
+		if comg12 >= 0 {
+			calp2 = sbet12 - cbet1*sbet2*somg12*somg12/(1+comg12)
+		} else {
+			calp2 = sbet12 - cbet1*sbet2*(1-comg12)
+		}
+		salp2, calp2 = norm(salp2, calp2)
+		sig12 = math.Atan2(ssig12, csig12)
+	} else if math.Abs(g.n) > 0.1 || csig12 >= 0 || ssig12 >= 6*math.Abs(g.n)*math.Pi*cbet1*cbet1 {
+		// Nothing to do, zeroth order spherical approximation is OK
+	} else {
+		// Nearly antipodal points: scale to an astroid problem
+		var x, y, lamscale, betscale float64
+		lam12x := math.Atan2(-slam12, -clam12)
+		if g.f >= 0 {
+			k2 := sbet1 * sbet1 * g.ep2
+			eps := k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+			lamscale = g.f * cbet1 * g.a3f(eps) * math.Pi
+			betscale = lamscale * cbet1
+			x = lam12x / lamscale
+			y = sbet12a / betscale
+		} else {
+			cbet12a := cbet2*cbet1 - sbet2*sbet1
+			bet12a := math.Atan2(sbet12a, cbet12a)
+			var c1a, c2a [nSeries + 1]float64
+			_, m12b, m0 := g.lengths(g.n, math.Pi+bet12a, sbet1, -cbet1, dn1, sbet2, cbet2, dn2, c1a[:], c2a[:])
+			x = -1 + m12b/(cbet1*cbet2*m0*math.Pi)
+			if x < -0.01 {
+				betscale = sbet12a / x
+			} else {
+				betscale = -g.f * cbet1 * cbet1 * math.Pi
+			}
+			lamscale = betscale / cbet1
+			y = lam12x / lamscale
+		}
+
+		if y > -tol1 && x > -1-xthresh {
+			if g.f >= 0 {
+				salp1 = math.Min(1, -x)
+				calp1 = -math.Sqrt(1 - salp1*salp1)
+			} else {
+				if x > -tol1 {
+					calp1 = 0
+				} else {
+					calp1 = -1
+				}
+				calp1 = math.Max(calp1, x)
+				salp1 = math.Sqrt(1 - calp1*calp1)
+			}
+		} else {
+			k := astroid(x, y)
+			var omg12a float64
+			if g.f >= 0 {
+				omg12a = lamscale * (-x * k / (1 + k))
+			} else {
+				omg12a = lamscale * (-y * (1 + k) / k)
+			}
+			somg12, comg12 = math.Sin(omg12a), -math.Cos(omg12a)
+			salp1 = cbet2 * somg12
+			calp1 = sbet12a - cbet2*sbet1*somg12*somg12/(1-comg12)
+		}
+	}
+
+	if !(salp1 <= 0) {
+		salp1, calp1 = norm(salp1, calp1)
+	} else {
+		salp1, calp1 = 1, 0
+	}
+	return sig12, salp1, calp1, salp2, calp2, dnm
+}
+
+// lambda12 returns the longitude error v of the geodesic leaving the first point
+// with azimuth alp1, relative to the target longitude difference lam120, along with
+// the intermediate quantities needed to finish the inverse problem.
+// If diffp, it also returns the derivative dv of v with respect to alp1.
+func (g Geodesic) lambda12(sbet1, cbet1, dn1, sbet2, cbet2, dn2, salp1, calp1, slam120, clam120 float64,
+	diffp bool, c1a, c2a, c3a []float64) (
+	v, salp2, calp2, sig12, ssig1, csig1, ssig2, csig2, eps, dv float64) {
+	if sbet1 == 0 && calp1 == 0 {
+		// Break degeneracy of equatorial line
+		calp1 = -tiny
+	}
+
+	salp0 := salp1 * cbet1
+	calp0 := math.Hypot(calp1, salp1*sbet1)
+
+	ssig1 = sbet1
+	somg1 := salp0 * sbet1
+	csig1 = calp1 * cbet1
+	comg1 := csig1
+	ssig1, csig1 = norm(ssig1, csig1)
+
+	if cbet2 != cbet1 {
+		salp2 = salp0 / cbet2
+	} else {
+		salp2 = salp1
+	}
+	if cbet2 != cbet1 || math.Abs(sbet2) != -sbet1 {
+		var d float64
+		if cbet1 < -sbet1 {
+			d = (cbet2 - cbet1) * (cbet1 + cbet2)
+		} else {
+			d = (sbet1 - sbet2) * (sbet1 + sbet2)
+		}
+		calp2 = math.Sqrt(calp1*cbet1*calp1*cbet1+d) / cbet2
+	} else {
+		calp2 = math.Abs(calp1)
+	}
+
+	ssig2 = sbet2
+	somg2 := salp0 * sbet2
+	csig2 = calp2 * cbet2
+	comg2 := csig2
+	ssig2, csig2 = norm(ssig2, csig2)
+
+	sig12 = math.Atan2(math.Max(0, csig1*ssig2-ssig1*csig2), csig1*csig2+ssig1*ssig2)
+	somg12 := math.Max(0, comg1*somg2-somg1*comg2)
+	comg12 := comg1*comg2 + somg1*somg2
+	eta := math.Atan2(somg12*clam120-comg12*slam120, comg12*clam120+somg12*slam120)
+
+	k2 := calp0 * calp0 * g.ep2
+	eps = k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+	g.c3f(eps, c3a)
+	b312 := sinCosSeries(true, ssig2, csig2, c3a) - sinCosSeries(true, ssig1, csig1, c3a)
+	domg12 := -g.f * g.a3f(eps) * salp0 * (sig12 + b312)
+	v = eta + domg12
+
+	if diffp {
+		if calp2 == 0 {
+			dv = -2 * g.f1 * dn1 / sbet1
+		} else {
+			_, dv, _ = g.lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2, c1a, c2a)
+			dv *= g.f1 / (calp2 * cbet2)
+		}
+	}
+	return v, salp2, calp2, sig12, ssig1, csig1, ssig2, csig2, eps, dv
+}
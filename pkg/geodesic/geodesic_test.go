@@ -0,0 +1,210 @@
+package geodesic
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+const (
+	epsS   = 1e-6 // Distance tolerance, m
+	epsAzi = 1e-9 // Azimuth tolerance, degrees
+	epsLL  = 1e-9 // Latitude/longitude tolerance, degrees
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %12.9f, got %12.9f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %12.9f, got %12.9f", name, expected, actual)
+}
+
+// Reference solutions from Karney (2013) and the GeographicLib documentation,
+// in the field order of the GeodTest data set: lat1, lon1, azi1, lat2, lon2, azi2, s12.
+var geodTest = [][]float64{
+	// Wellington, NZ to Salamanca, Spain: nearly antipodal
+	{-41.32, 174.81, 161.067669986160, 40.96, -5.50, 18.825195123247, 19959679.267354},
+	// Karney (2013) table 4: inverse problem for nearly antipodal points
+	{-30, 0, 161.890524736, 29.9, 179.8, 18.090737246, 19989832.827610},
+	// Karney (2013) table 2: direct problem
+	{40, 0, 30, 41.79331020506, 137.84490004377, 149.09016931807, 10000000},
+}
+
+func TestInverseAgainstReference(t *testing.T) {
+	for _, d := range geodTest {
+		s12, azi1, azi2 := Inverse(
+			egm96.NewLocationGeodetic(d[0], d[1], 0),
+			egm96.NewLocationGeodetic(d[3], d[4], 0),
+		)
+		name := fmt.Sprintf("(%4.2f,%4.2f)-(%4.2f,%4.2f)", d[0], d[1], d[3], d[4])
+		testDiff(name+" s12", s12, d[6], 1e-3, t)
+		testDiff(name+" azi1", azi1, d[2], 1e-8, t)
+		testDiff(name+" azi2", azi2, d[5], 1e-8, t)
+	}
+}
+
+func TestDirectAgainstReference(t *testing.T) {
+	for _, d := range geodTest {
+		l2, azi2 := Direct(egm96.NewLocationGeodetic(d[0], d[1], 0), d[2], d[6])
+		lat2, lon2 := latLngDegrees(l2)
+		name := fmt.Sprintf("(%4.2f,%4.2f) %4.2f°", d[0], d[1], d[2])
+		testDiff(name+" lat2", lat2, d[3], 1e-8, t)
+		testDiff(name+" lon2", lon2, d[4], 1e-8, t)
+		testDiff(name+" azi2", azi2, d[5], 1e-8, t)
+	}
+
+	// Perth, Australia, 20000km to the southwest
+	l2, _ := Direct(egm96.NewLocationGeodetic(-32.06, 115.74, 0), 225, 20000e3)
+	lat2, lon2 := latLngDegrees(l2)
+	testDiff("Perth lat2", lat2, 32.11195529, 1e-8, t)
+	testDiff("Perth lon2", lon2, -63.95925278, 1e-8, t)
+}
+
+// geodTestFile is a sample of Karney's GeodTest.dat, lines of
+// lat1 lon1 azi1 lat2 lon2 azi2 s12 a12 m12 S12; see testdata/README.md.
+const geodTestFile = "testdata/GeodTest-100.dat"
+
+// epsGeodTest is the largest error in a distance or position, in meters, that
+// Karney (2013) finds for the double precision algorithms over GeodTest.dat.
+// An azimuth error is counted as the displacement it causes at the other end,
+// the reduced length m12 times the error.
+const epsGeodTest = 15e-9
+
+// readGeodTest returns the lines of the GeodTest sample.
+func readGeodTest(t *testing.T) (lines [][]float64) {
+	f, err := os.Open(geodTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 10 {
+			t.Fatalf("%s line %d: expected 10 fields, got %d", geodTestFile, n, len(fields))
+		}
+		d := make([]float64, len(fields))
+		for i, s := range fields {
+			if d[i], err = strconv.ParseFloat(s, 64); err != nil {
+				t.Fatalf("%s line %d: %s", geodTestFile, n, err)
+			}
+		}
+		lines = append(lines, d)
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) == 0 {
+		t.Fatalf("%s has no lines", geodTestFile)
+	}
+	return lines
+}
+
+// azimuthError returns the displacement in meters caused by the difference of the
+// azimuths in degrees at the end of a geodesic with reduced length m12.
+func azimuthError(azi, expected, m12 float64) float64 {
+	return math.Abs(angNormalize(azi-expected)/degrees*m12)
+}
+
+func TestGeodTestInverse(t *testing.T) {
+	for n, d := range readGeodTest(t) {
+		s12, azi1, azi2 := Inverse(
+			egm96.NewLocationGeodetic(d[0], d[1], 0),
+			egm96.NewLocationGeodetic(d[3], d[4], 0),
+		)
+		if math.Abs(s12-d[6]) > epsGeodTest || azimuthError(azi1, d[2], d[8]) > epsGeodTest ||
+			azimuthError(azi2, d[5], d[8]) > epsGeodTest {
+			t.Errorf("line %d (%v): got s12 %.9f, azi1 %.15f, azi2 %.15f", n+1, d, s12, azi1, azi2)
+		}
+	}
+}
+
+func TestGeodTestDirect(t *testing.T) {
+	for n, d := range readGeodTest(t) {
+		l2, azi2 := Direct(egm96.NewLocationGeodetic(d[0], d[1], 0), d[2], d[6])
+		lat2, lon2 := latLngDegrees(l2)
+		dx := angNormalize(lon2-d[4]) / degrees * egm96.A * math.Cos(d[3]/degrees)
+		dy := (lat2 - d[3]) / degrees * egm96.A
+		if math.Hypot(dx, dy) > epsGeodTest || azimuthError(azi2, d[5], d[8]) > epsGeodTest {
+			t.Errorf("line %d (%v): got lat2 %.15f, lon2 %.15f, azi2 %.15f", n+1, d, lat2, lon2, azi2)
+		}
+	}
+}
+
+func TestInverseDirectRoundTrips(t *testing.T) {
+	lats := []float64{0, 0, 0, 45, -45, 89.9, -90, 60, 0.5, -30.12345}
+	lngs := []float64{0, 179.5, 90, -120, 60, 10, 0, 30, -0.5, 0}
+	for i, lat1 := range lats {
+		for j, lat2 := range lats {
+			l1 := egm96.NewLocationGeodetic(lat1, lngs[i], 0)
+			l2 := egm96.NewLocationGeodetic(lat2, lngs[j]+float64(i), 0)
+			s12, azi1, azi2 := Inverse(l1, l2)
+			if math.IsNaN(s12) || math.IsNaN(azi1) || math.IsNaN(azi2) {
+				t.Errorf("Inverse from (%f,%f) to (%f,%f) did not converge", lat1, lngs[i], lat2, lngs[j])
+				continue
+			}
+			l3, azi3 := Direct(l1, azi1, s12)
+			// Azimuths at the poles are arbitrary, so only check positions there
+			d, _, _ := Inverse(l2, l3)
+			testDiff(fmt.Sprintf("(%f,%f)-(%f,%f) round trip", lat1, lngs[i], lat2, lngs[j]+float64(i)),
+				d, 0, epsS, t)
+			if math.Abs(lat1) < 89 && math.Abs(lat2) < 89 {
+				testDiff(fmt.Sprintf("(%f,%f)-(%f,%f) azi2", lat1, lngs[i], lat2, lngs[j]+float64(i)),
+					angNormalize(azi3-azi2), 0, epsAzi*1e3, t)
+			}
+		}
+	}
+}
+
+func TestInverseSymmetry(t *testing.T) {
+	l1 := egm96.NewLocationGeodetic(10, 20, 0)
+	l2 := egm96.NewLocationGeodetic(-10.5, 199.5, 0)
+	s12, azi1, azi2 := Inverse(l1, l2)
+	s21, azi21, azi22 := Inverse(l2, l1)
+	testDiff("distance symmetry", s21, s12, epsS, t)
+	testDiff("azimuth symmetry 1", angNormalize(azi21-azi2-180), 0, epsAzi, t)
+	testDiff("azimuth symmetry 2", angNormalize(azi22-azi1-180), 0, epsAzi, t)
+}
+
+func TestMeridianAndEquator(t *testing.T) {
+	// Quarter meridian of WGS84
+	s12, azi1, _ := Inverse(egm96.NewLocationGeodetic(0, 0, 0), egm96.NewLocationGeodetic(90, 0, 0))
+	testDiff("quarter meridian", s12, 10001965.729, 1e-3, t)
+	testDiff("meridian azimuth", azi1, 0, epsAzi, t)
+
+	// Along the equator, distance is a*lambda
+	s12, azi1, _ = Inverse(egm96.NewLocationGeodetic(0, 0, 0), egm96.NewLocationGeodetic(0, 90, 0))
+	testDiff("equator", s12, egm96.A*math.Pi/2, epsS, t)
+	testDiff("equator azimuth", azi1, 90, epsAzi, t)
+}
+
+func TestOtherEllipsoids(t *testing.T) {
+	// On a sphere geodesics are great circles
+	g := NewGeodesic(egm96.NewEllipsoid(6371000, 0))
+	s12, azi1, _ := g.Inverse(egm96.NewLocationGeodetic(0, 0, 0), egm96.NewLocationGeodetic(45, 90, 0))
+	testDiff("sphere distance", s12, 6371000*math.Pi/2, epsS, t)
+	testDiff("sphere azimuth", azi1, 45, epsAzi, t)
+	s12, _, _ = g.Inverse(egm96.NewLocationGeodetic(0, 0, 0), egm96.NewLocationGeodetic(45, 45, 0))
+	testDiff("sphere 60° arc", s12, 6371000*math.Pi/3, epsS, t)
+
+	// Quarter meridian of the International 1924 ellipsoid, for which it was defined
+	g = NewGeodesic(egm96.International1924)
+	s12, _, _ = g.Inverse(egm96.NewLocationGeodetic(0, 0, 0), egm96.NewLocationGeodetic(90, 0, 0))
+	testDiff("International 1924 quarter meridian", s12, 10002288.3, 0.1, t)
+}
+
+func ExampleInverse() {
+	wellington := egm96.NewLocationGeodetic(-41.32, 174.81, 0)
+	salamanca := egm96.NewLocationGeodetic(40.96, -5.50, 0)
+	s12, azi1, azi2 := Inverse(wellington, salamanca)
+	fmt.Printf("Distance: %.3f km, azimuths %.5f° and %.5f°", s12/1000, azi1, azi2)
+	// Output: Distance: 19959.679 km, azimuths 161.06767° and 18.82520°
+}
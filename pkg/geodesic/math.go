@@ -0,0 +1,127 @@
+package geodesic
+
+import "math"
+
+// Helper functions for the geodesic calculations.  Angles passed to and
+// returned from these are in degrees, following the conventions of
+// C. F. F. Karney's GeographicLib, from which the algorithms are taken.
+
+// sumErr returns the sum u+v and its round-off error t.
+func sumErr(u, v float64) (s, t float64) {
+	s = u + v
+	up := s - v
+	vpp := s - up
+	up -= u
+	vpp -= v
+	if s == 0 {
+		return s, s
+	}
+	return s, -(up + vpp)
+}
+
+// angNormalize reduces an angle to the range [-180, 180].
+func angNormalize(x float64) (y float64) {
+	y = math.Remainder(x, 360)
+	if math.Abs(y) == 180 {
+		return math.Copysign(180, x)
+	}
+	return y
+}
+
+// angDiff returns the exact difference y-x of two angles reduced
+// to [-180, 180] and the round-off error of the difference.
+func angDiff(x, y float64) (d, e float64) {
+	d, t := sumErr(angNormalize(-x), angNormalize(y))
+	d = angNormalize(d)
+	if d == 180 && t > 0 {
+		d = -180
+	}
+	return sumErr(d, t)
+}
+
+// angRound coarsens very small angles so that the geodesic calculations
+// are not confused by underflow.
+func angRound(x float64) (y float64) {
+	const z = 1 / 16.0
+	y = math.Abs(x)
+	if y < z {
+		y = z - (z - y)
+	}
+	return math.Copysign(y, x)
+}
+
+// latFix returns NaN for latitudes outside [-90, 90].
+func latFix(x float64) (y float64) {
+	if math.Abs(x) > 90 {
+		return math.NaN()
+	}
+	return x
+}
+
+// sinCosD returns the sine and cosine of x in degrees, reducing the
+// argument exactly so that e.g. sinCosD(90) is exactly (1, 0).
+func sinCosD(x float64) (s, c float64) {
+	r := math.Mod(x, 360)
+	q := 0
+	if !math.IsNaN(r) {
+		q = int(math.Round(r / 90))
+	}
+	r -= 90 * float64(q)
+	r *= math.Pi / 180
+	s, c = math.Sin(r), math.Cos(r)
+	switch q & 3 {
+	case 1:
+		s, c = c, -s
+	case 2:
+		s, c = -s, -c
+	case 3:
+		s, c = -c, s
+	}
+	c += 0
+	if s == 0 {
+		s = math.Copysign(s, x)
+	}
+	return s, c
+}
+
+// atan2D returns atan2(y, x) in degrees, in the range [-180, 180].
+func atan2D(y, x float64) (ang float64) {
+	q := 0
+	if math.Abs(y) > math.Abs(x) {
+		q = 2
+		x, y = y, x
+	}
+	if x < 0 {
+		q++
+		x = -x
+	}
+	ang = math.Atan2(y, x) * 180 / math.Pi
+	switch q {
+	case 1:
+		ang = math.Copysign(180, y) - ang
+	case 2:
+		ang = 90 - ang
+	case 3:
+		ang = -90 + ang
+	}
+	return ang
+}
+
+// norm scales (x, y) to a unit vector.
+func norm(x, y float64) (xx, yy float64) {
+	r := math.Hypot(x, y)
+	return x / r, y / r
+}
+
+// polyval evaluates the polynomial of order n whose coefficients,
+// highest order first, start at p[0].
+func polyval(n int, p []float64, x float64) (y float64) {
+	if n < 0 {
+		return 0
+	}
+	y = p[0]
+	for i := 1; i <= n; i++ {
+		y = y*x + p[i]
+	}
+	return y
+}
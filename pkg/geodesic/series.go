@@ -0,0 +1,165 @@
+package geodesic
+
+// Series expansions in the small quantities eps and n used by the
+// geodesic calculations, carried to sixth order.
+// See C. F. F. Karney, Algorithms for geodesics, J. Geodesy 87, 43-55 (2013),
+// https://doi.org/10.1007/s00190-012-0578-z, equations 17-18, 20-25 and 42.
+
+const (
+	nSeries = 6                           // Order of all the series expansions
+	nC3x    = nSeries * (nSeries - 1) / 2 // Number of coefficients in the C3 expansion
+)
+
+// a1m1f returns the scale factor A1-1, equation 17.
+func a1m1f(eps float64) (a float64) {
+	coeff := []float64{1, 4, 64, 0, 256}
+	m := nSeries / 2
+	t := polyval(m, coeff, eps*eps) / coeff[m+1]
+	return (t + eps) / (1 - eps)
+}
+
+// c1f fills c[1..6] with the coefficients C1[l], equation 18.
+func c1f(eps float64, c []float64) {
+	coeff := []float64{
+		-1, 6, -16, 32,
+		-9, 64, -128, 2048,
+		9, -16, 768,
+		3, -5, 512,
+		-7, 1280,
+		-7, 2048,
+	}
+	fillEvenSeries(eps, coeff, c)
+}
+
+// c1pf fills c[1..6] with the coefficients C1'[l] of the reverted series, equation 21.
+func c1pf(eps float64, c []float64) {
+	coeff := []float64{
+		205, -432, 768, 1536,
+		4005, -4736, 3840, 12288,
+		-225, 116, 384,
+		-7173, 2695, 7680,
+		3467, 7680,
+		38081, 61440,
+	}
+	fillEvenSeries(eps, coeff, c)
+}
+
+// a2m1f returns the scale factor A2-1, equation 42.
+func a2m1f(eps float64) (a float64) {
+	coeff := []float64{-11, -28, -192, 0, 256}
+	m := nSeries / 2
+	t := polyval(m, coeff, eps*eps) / coeff[m+1]
+	return (t - eps) / (1 + eps)
+}
+
+// c2f fills c[1..6] with the coefficients C2[l], equation 43.
+func c2f(eps float64, c []float64) {
+	coeff := []float64{
+		1, 2, 16, 32,
+		35, 64, 384, 2048,
+		15, 80, 768,
+		7, 35, 512,
+		63, 1280,
+		77, 2048,
+	}
+	fillEvenSeries(eps, coeff, c)
+}
+
+// fillEvenSeries evaluates coefficients c[l] = eps^l * P_l(eps^2), where the
+// polynomials P_l and their denominators are packed in coeff.
+func fillEvenSeries(eps float64, coeff, c []float64) {
+	eps2 := eps * eps
+	d := eps
+	o := 0
+	for l := 1; l <= nSeries; l++ {
+		m := (nSeries - l) / 2
+		c[l] = d * polyval(m, coeff[o:], eps2) / coeff[o+m+1]
+		o += m + 2
+		d *= eps
+	}
+}
+
+// a3coeff returns the coefficients of the polynomial in eps giving A3,
+// equation 24, for third flattening n.
+func a3coeff(n float64) (a3x [nSeries]float64) {
+	coeff := []float64{
+		-3, 128,
+		-2, -3, 64,
+		-1, -3, -1, 16,
+		3, -1, -2, 8,
+		1, -1, 2,
+		1, 1,
+	}
+	o, k := 0, 0
+	for j := nSeries - 1; j >= 0; j-- {
+		m := nSeries - j - 1
+		if j < m {
+			m = j
+		}
+		a3x[k] = polyval(m, coeff[o:], n) / coeff[o+m+1]
+		k++
+		o += m + 2
+	}
+	return a3x
+}
+
+// c3coeff returns the coefficients of the polynomials in eps giving C3[l],
+// equation 25, for third flattening n.
+func c3coeff(n float64) (c3x [nC3x]float64) {
+	coeff := []float64{
+		3, 128,
+		2, 5, 128,
+		-1, 3, 3, 64,
+		-1, 0, 1, 8,
+		-1, 1, 4,
+		5, 256,
+		1, 3, 128,
+		-3, -2, 3, 64,
+		1, -3, 2, 32,
+		7, 512,
+		-10, 9, 384,
+		5, -9, 5, 192,
+		7, 512,
+		-14, 7, 512,
+		21, 2560,
+	}
+	o, k := 0, 0
+	for l := 1; l < nSeries; l++ {
+		for j := nSeries - 1; j >= l; j-- {
+			m := nSeries - j - 1
+			if j < m {
+				m = j
+			}
+			c3x[k] = polyval(m, coeff[o:], n) / coeff[o+m+1]
+			k++
+			o += m + 2
+		}
+	}
+	return c3x
+}
+
+// sinCosSeries evaluates the sum of c[l]*sin(2*l*x) for l=1..len(c)-1 if sinp,
+// or of c[l]*cos((2*l+1)*x) for l=0..len(c)-1 otherwise, by Clenshaw summation.
+func sinCosSeries(sinp bool, sinx, cosx float64, c []float64) (y float64) {
+	k := len(c)
+	n := k
+	if sinp {
+		n--
+	}
+	ar := 2 * (cosx - sinx) * (cosx + sinx)
+	var y0, y1 float64
+	if n&1 != 0 {
+		k--
+		y0 = c[k]
+	}
+	for n /= 2; n > 0; n-- {
+		k--
+		y1 = ar*y0 - y1 + c[k]
+		k--
+		y0 = ar*y1 - y0 + c[k]
+	}
+	if sinp {
+		return 2 * sinx * cosx * y0
+	}
+	return cosx * (y0 - y1)
+}
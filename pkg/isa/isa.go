@@ -0,0 +1,171 @@
+// Package isa implements the ICAO Standard Atmosphere (ISA), relating pressure,
+// temperature and density to altitude up to 80km, and the conversions between
+// pressure altitude, flight levels and the geometric heights used by the egm96
+// and wmm packages.
+//
+// The standard atmosphere is defined in terms of geopotential altitude, the
+// height in a uniform gravity field of g0 with the same potential energy.
+// Geopotential and geometric altitude differ by about 0.3% at 20km.
+// Pressure altitude is the geopotential altitude at which the standard atmosphere
+// has a given pressure, which is what a barometric altimeter set to the standard
+// pressure of 1013.25hPa displays.  Flight levels are pressure altitudes in hundreds of feet.
+//
+// The definitions are those of ICAO Doc 7488/3, Manual of the ICAO Standard Atmosphere,
+// which agrees with the US Standard Atmosphere 1976 below 32km.
+package isa
+
+import (
+	"math"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// Constants defining the standard atmosphere.
+const (
+	P0  = 101325         // Sea level pressure, Pa
+	T0  = 288.15         // Sea level temperature, K
+	G0  = 9.80665        // Standard acceleration of gravity, m/s²
+	R   = 287.05287      // Specific gas constant of dry air, J/(kg·K)
+	R0  = 6356766        // Earth radius used to relate geopotential and geometric altitude, m
+	HPa = 100            // Pa per hectopascal (millibar)
+	FL  = 100 * egm96.Ft // Meters of pressure altitude per flight level
+)
+
+// layer is a layer of the standard atmosphere with a constant temperature lapse rate.
+type layer struct {
+	h     float64 // Geopotential altitude of the base of the layer, m
+	lapse float64 // Temperature gradient, K/m
+	t, p  float64 // Temperature and pressure at the base of the layer
+}
+
+// MaxAltitude is the top of the standard atmosphere as a geopotential altitude in meters.
+const MaxAltitude = 80000
+
+var layers = []layer{
+	{h: 0, lapse: -0.0065},
+	{h: 11000, lapse: 0},
+	{h: 20000, lapse: 0.001},
+	{h: 32000, lapse: 0.0028},
+	{h: 47000, lapse: 0},
+	{h: 51000, lapse: -0.0028},
+	{h: 71000, lapse: -0.002},
+}
+
+func init() {
+	layers[0].t, layers[0].p = T0, P0
+	for i := 1; i < len(layers); i++ {
+		b := layers[i-1]
+		layers[i].t = b.t + b.lapse*(layers[i].h-b.h)
+		layers[i].p = b.pressure(layers[i].h)
+	}
+}
+
+// pressure returns the pressure at geopotential altitude h within the layer.
+func (b layer) pressure(h float64) (p float64) {
+	if b.lapse == 0 {
+		return b.p * math.Exp(-G0*(h-b.h)/(R*b.t))
+	}
+	return b.p * math.Pow(b.t/(b.t+b.lapse*(h-b.h)), G0/(R*b.lapse))
+}
+
+// altitude returns the geopotential altitude within the layer at which the pressure is p.
+func (b layer) altitude(p float64) (h float64) {
+	if b.lapse == 0 {
+		return b.h - R*b.t/G0*math.Log(p/b.p)
+	}
+	return b.h + b.t/b.lapse*(math.Pow(p/b.p, -R*b.lapse/G0)-1)
+}
+
+// layerAt returns the layer containing geopotential altitude h.
+// Altitudes below sea level are in the lowest layer and those above
+// MaxAltitude in the highest.
+func layerAt(h float64) (b layer) {
+	b = layers[0]
+	for _, l := range layers[1:] {
+		if h < l.h {
+			break
+		}
+		b = l
+	}
+	return b
+}
+
+// Temperature returns the standard temperature in K at geopotential altitude h in meters.
+func Temperature(h float64) (t float64) {
+	b := layerAt(h)
+	return b.t + b.lapse*(h-b.h)
+}
+
+// Pressure returns the standard pressure in Pa at geopotential altitude h in meters.
+func Pressure(h float64) (p float64) {
+	return layerAt(h).pressure(h)
+}
+
+// Density returns the standard air density in kg/m³ at geopotential altitude h in meters.
+func Density(h float64) (rho float64) {
+	return Pressure(h) / (R * Temperature(h))
+}
+
+// PressureAltitude returns the pressure altitude in meters corresponding to the
+// static pressure p in Pa, the geopotential altitude at which the standard
+// atmosphere has that pressure.
+func PressureAltitude(p float64) (h float64) {
+	b := layers[0]
+	for _, l := range layers[1:] {
+		if p > l.p {
+			break
+		}
+		b = l
+	}
+	return b.altitude(p)
+}
+
+// FlightLevel returns the pressure altitude in meters of flight level fl,
+// e.g. FlightLevel(350) is 10668m.
+func FlightLevel(fl float64) (h float64) {
+	return fl * FL
+}
+
+// QNHAltitude returns the altitude in meters that an altimeter set to the
+// sea level pressure qnh in Pa displays at pressure altitude h in meters.
+//
+// This is the standard atmosphere's thickness between the qnh and static
+// pressure levels, and approximates the geopotential altitude above mean sea level
+// when the temperature is close to standard.
+func QNHAltitude(h, qnh float64) (alt float64) {
+	return h - PressureAltitude(qnh)
+}
+
+// PressureAltitudeFromQNH inverts QNHAltitude, returning the pressure altitude in meters
+// corresponding to the altitude alt in meters displayed by an altimeter set to qnh in Pa.
+func PressureAltitudeFromQNH(alt, qnh float64) (h float64) {
+	return alt + PressureAltitude(qnh)
+}
+
+// GeopotentialToGeometric converts a geopotential altitude in meters to a
+// geometric height above mean sea level in meters.
+func GeopotentialToGeometric(h float64) (z float64) {
+	return R0 * h / (R0 - h)
+}
+
+// GeometricToGeopotential converts a geometric height above mean sea level in meters
+// to a geopotential altitude in meters.
+func GeometricToGeopotential(z float64) (h float64) {
+	return R0 * z / (R0 + z)
+}
+
+// NewLocationPressureAltitude returns the egm96.Location at latitude lat and
+// longitude lng in degrees, east or west, of an aircraft at pressure altitude h in meters,
+// with the altimeter corrected to the sea level pressure qnh in Pa.
+// Pass a qnh of P0 for flight levels or when the local pressure is unknown.
+//
+// The height above mean sea level is found assuming the standard temperature
+// profile, so it may be in error by about 4% of the height for each 10K
+// that the air is warmer or colder than standard.
+func NewLocationPressureAltitude(lat, lng, h, qnh float64) (loc egm96.Location, err error) {
+	// The geoid grid is indexed by longitudes in [0, 360)
+	if lng = math.Mod(lng, 360); lng < 0 {
+		lng += 360
+	}
+	return egm96.NewLocationMSL(lat, lng, GeopotentialToGeometric(QNHAltitude(h, qnh)))
+}
@@ -0,0 +1,62 @@
+package isa
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.6f, got %8.6f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.6f, got %8.6f", name, expected, actual)
+}
+
+func TestStandardAtmosphere(t *testing.T) {
+	// ICAO Doc 7488/3 and US Standard Atmosphere 1976 tables
+	hs := []float64{-1000, 0, 1000, 5000, 11000, 20000, 32000, 47000, 51000, 71000}
+	ts := []float64{294.65, 288.15, 281.65, 255.65, 216.65, 216.65, 228.65, 270.65, 270.65, 214.65}
+	ps := []float64{113929, 101325, 89874.6, 54019.9, 22632.1, 5474.89, 868.019, 110.906, 66.9389, 3.95642}
+	rhos := []float64{1.34700, 1.22500, 1.11164, 0.736116, 0.363918, 0.0880349, 0.0132250, 0.00142753, 0.000861606, 0.0000642110}
+
+	for i, h := range hs {
+		testDiff(fmt.Sprintf("temperature at %5.0fm", h), Temperature(h), ts[i], 1e-9, t)
+		testDiff(fmt.Sprintf("pressure at %5.0fm", h), Pressure(h)/ps[i], 1, 1e-5, t)
+		testDiff(fmt.Sprintf("density at %5.0fm", h), Density(h)/rhos[i], 1, 1e-5, t)
+		testDiff(fmt.Sprintf("pressure altitude at %5.0fm", h), PressureAltitude(Pressure(h)), h, 1e-6, t)
+	}
+}
+
+func TestAltitudes(t *testing.T) {
+	testDiff("FL350", FlightLevel(350), 10668, 1e-9, t)
+	testDiff("FL350 pressure", Pressure(FlightLevel(350))/HPa, 238.42, 0.01, t)
+	testDiff("geopotential of 10km", GeometricToGeopotential(10000), 9984.3, 0.1, t)
+	testDiff("geometric round trip", GeopotentialToGeometric(GeometricToGeopotential(12345)), 12345, 1e-6, t)
+
+	// With a QNH of 1023hPa an altimeter reads about 270ft more than the pressure altitude
+	testDiff("QNH altitude", QNHAltitude(1000, 1023*HPa)/egm96.Ft, 1000/egm96.Ft+270, 5, t)
+	testDiff("QNH round trip", PressureAltitudeFromQNH(QNHAltitude(3000, 998*HPa), 998*HPa), 3000, 1e-6, t)
+	testDiff("standard QNH", QNHAltitude(3000, P0), 3000, 1e-6, t)
+}
+
+func TestNewLocationPressureAltitude(t *testing.T) {
+	loc, err := NewLocationPressureAltitude(45, 10, FlightLevel(100), P0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := loc.HeightAboveMSL()
+	testDiff("FL100 height above MSL", h, GeopotentialToGeometric(3048), 1e-6, t)
+
+	// West longitudes are accepted as well as east ones
+	loc, err = NewLocationPressureAltitude(40, -105, FlightLevel(100), P0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	east, _ := NewLocationPressureAltitude(40, 255, FlightLevel(100), P0)
+	if !loc.Equals(east) {
+		t.Errorf("expected 105°W to be 255°E, got %v and %v", loc, east)
+	}
+}
@@ -0,0 +1,281 @@
+// Package lookup provides a precomputed grid of the declination, inclination and
+// total intensity of the World Magnetic Model for a single date, with a fast
+// bilinear interpolating lookup for hardware that cannot afford the full
+// spherical harmonic sum of wmm.CalculateWMMMagneticField for every reading.
+//
+// The interpolation error depends on the grid spacing and is largest near the
+// magnetic poles, where the declination changes rapidly.  MaxError measures it
+// against the full model at random points, so that a spacing can be chosen to
+// meet a required accuracy.
+package lookup
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// BlackoutH is the horizontal intensity in nT below which the declination is
+// unreliable, defining the WMM blackout zones around the magnetic poles.
+// MaxError does not measure declination errors where the horizontal intensity is below it.
+const BlackoutH = 2000
+
+// poleLat is the largest latitude at which Calculate evaluates the model.
+const poleLat = 90 - 1e-6
+
+// Spec describes the extent and spacing of a Grid, in degrees.
+// The extents must be whole numbers of steps.  Longitudes may be given from
+// -180 to 180 or from 0 to 360, and a grid covering all longitudes wraps around.
+type Spec struct {
+	LatMin, LatMax, LatStep float64
+	LngMin, LngMax, LngStep float64
+	Height                  float64 // Height above mean sea level, meters
+}
+
+// Global is a Spec for a global grid at mean sea level with the given spacing in degrees.
+func Global(step float64) Spec {
+	return Spec{LatMin: -90, LatMax: 90, LatStep: step, LngMin: -180, LngMax: 180, LngStep: step}
+}
+
+// Values are the field values at a point.
+type Values struct {
+	D float64 // Declination, degrees
+	I float64 // Inclination, degrees
+	F float64 // Total intensity, nT
+}
+
+// H returns the horizontal intensity in nT.
+func (v Values) H() float64 {
+	return v.F * math.Cos(v.I*egm96.Deg)
+}
+
+// Grid is a precomputed grid of field values for a single date.
+type Grid struct {
+	Spec
+	Date       time.Time
+	nLat, nLng int
+	d, i, f    []float32 // Values at each node, by latitude then longitude
+}
+
+// Build calculates the field values at each node of the grid described by s at time t
+// using the currently loaded WMM coefficients.
+// As for wmm.CalculateWMMMagneticField, an error for a date outside the validity
+// of the coefficients is informational and the grid is still returned.
+func Build(s Spec, t time.Time) (g *Grid, err error) {
+	nLat, err := steps(s.LatMin, s.LatMax, s.LatStep)
+	if err != nil {
+		return nil, fmt.Errorf("latitude: %s", err)
+	}
+	nLng, err := steps(s.LngMin, s.LngMax, s.LngStep)
+	if err != nil {
+		return nil, fmt.Errorf("longitude: %s", err)
+	}
+	if s.LatMin < -90 || s.LatMax > 90 {
+		return nil, fmt.Errorf("latitudes %v to %v are outside the range -90 to 90", s.LatMin, s.LatMax)
+	}
+	if s.LngMin < -180 || s.LngMax-s.LngMin > 360 {
+		return nil, fmt.Errorf("longitudes %v to %v must be within 360 degrees from -180", s.LngMin, s.LngMax)
+	}
+
+	g = &Grid{Spec: s, Date: t, nLat: nLat, nLng: nLng,
+		d: make([]float32, nLat*nLng), i: make([]float32, nLat*nLng), f: make([]float32, nLat*nLng)}
+	var errField error
+	for j := 0; j < nLat; j++ {
+		for k := 0; k < nLng; k++ {
+			v, e := Calculate(s.LatMin+float64(j)*s.LatStep, s.LngMin+float64(k)*s.LngStep, s.Height, t)
+			if e != nil && errField == nil {
+				errField = e
+			}
+			n := j*nLng + k
+			g.d[n], g.i[n], g.f[n] = float32(v.D), float32(v.I), float32(v.F)
+		}
+	}
+	return g, errField
+}
+
+// steps returns the number of nodes from min to max inclusive at spacing step.
+func steps(min, max, step float64) (n int, err error) {
+	if step <= 0 {
+		return 0, fmt.Errorf("step %v must be positive", step)
+	}
+	if max < min {
+		return 0, fmt.Errorf("maximum %v is less than minimum %v", max, min)
+	}
+	x := (max - min) / step
+	if math.Abs(x-math.Round(x)) > 1e-9*math.Max(1, x) {
+		return 0, fmt.Errorf("range %v to %v is not a whole number of steps of %v", min, max, step)
+	}
+	return int(math.Round(x)) + 1, nil
+}
+
+// Calculate returns the field values from the full model at a latitude and
+// longitude in degrees and a height in meters above mean sea level, as Field.
+func Calculate(lat, lng, h float64, t time.Time) (v Values, err error) {
+	mf, err := Field(lat, lng, h, t)
+	return Values{D: mf.D(), I: mf.I(), F: mf.F()}, err
+}
+
+// Field returns the magnetic field from the full model at a latitude and
+// longitude in degrees and a height in meters above mean sea level.
+// Longitudes may be given from -180 to 180 or from 0 to 360.
+// At the poles, where the spherical harmonic sum is singular, the field is
+// the limit approaching the pole along the meridian.
+// As for wmm.CalculateWMMMagneticField, an error for a date outside the validity
+// of the coefficients is informational and the field is still returned, but
+// no field is returned with an error converting the height above mean sea level.
+func Field(lat, lng, h float64, t time.Time) (mf wmm.MagneticField, err error) {
+	lat = math.Max(-poleLat, math.Min(poleLat, lat))
+	loc, err := parsing.NewLocation(lat, lng, h, false)
+	if err != nil {
+		return mf, err
+	}
+	return wmm.CalculateWMMMagneticField(loc, t)
+}
+
+// Size returns the number of nodes of the grid in latitude and longitude.
+func (g *Grid) Size() (nLat, nLng int) {
+	return g.nLat, g.nLng
+}
+
+// Node returns the values at the node j steps north of LatMin and k steps east of LngMin.
+func (g *Grid) Node(j, k int) Values {
+	n := j*g.nLng + k
+	return Values{D: float64(g.d[n]), I: float64(g.i[n]), F: float64(g.f[n])}
+}
+
+// Map returns a copy of the grid with the values f(v) at each node, for example
+// to measure the errors of lookups from values stored with less precision.
+func (g *Grid) Map(f func(v Values) Values) *Grid {
+	m := &Grid{Spec: g.Spec, Date: g.Date, nLat: g.nLat, nLng: g.nLng,
+		d: make([]float32, len(g.d)), i: make([]float32, len(g.i)), f: make([]float32, len(g.f))}
+	for n := range g.d {
+		v := f(Values{D: float64(g.d[n]), I: float64(g.i[n]), F: float64(g.f[n])})
+		m.d[n], m.i[n], m.f[n] = float32(v.D), float32(v.I), float32(v.F)
+	}
+	return m
+}
+
+// Lookup returns the field values at a latitude and longitude in degrees,
+// interpolated bilinearly from the four surrounding grid nodes.
+// The declination is interpolated as an angle, so that it is correct where it
+// passes through ±180°.  An error is returned if the point is outside the grid.
+func (g *Grid) Lookup(lat, lng float64) (v Values, err error) {
+	if lat < g.LatMin || lat > g.LatMax {
+		return v, fmt.Errorf("latitude %v is outside the grid from %v to %v", lat, g.LatMin, g.LatMax)
+	}
+	for lng < g.LngMin {
+		lng += 360
+	}
+	for lng >= g.LngMin+360 {
+		lng -= 360
+	}
+	if lng > g.LngMax {
+		return v, fmt.Errorf("longitude %v is outside the grid from %v to %v", lng, g.LngMin, g.LngMax)
+	}
+
+	j, u := cell((lat-g.LatMin)/g.LatStep, g.nLat)
+	k, w := cell((lng-g.LngMin)/g.LngStep, g.nLng)
+	n00, n01 := j*g.nLng+k, j*g.nLng+k+1
+	n10, n11 := n00+g.nLng, n01+g.nLng
+	if g.nLng == 1 {
+		n01, n11 = n00, n10
+	}
+	if g.nLat == 1 {
+		n10, n11 = n00, n01
+	}
+	interp := func(x []float32) float64 {
+		return (1-u)*((1-w)*float64(x[n00])+w*float64(x[n01])) + u*((1-w)*float64(x[n10])+w*float64(x[n11]))
+	}
+
+	d0 := float64(g.d[n00])
+	v.D = d0 + (1-u)*w*AngleDiff(float64(g.d[n01]), d0) + u*(1-w)*AngleDiff(float64(g.d[n10]), d0) + u*w*AngleDiff(float64(g.d[n11]), d0)
+	if v.D > 180 {
+		v.D -= 360
+	} else if v.D <= -180 {
+		v.D += 360
+	}
+	v.I = interp(g.i)
+	v.F = interp(g.f)
+	return v, nil
+}
+
+// cell returns the index of the grid cell containing the fractional node
+// position x in a dimension with n nodes, and the position within the cell.
+func cell(x float64, n int) (i int, u float64) {
+	if n == 1 {
+		return 0, 0
+	}
+	i = int(math.Floor(x))
+	if i >= n-1 {
+		i = n - 2
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i, x - float64(i)
+}
+
+// AngleDiff returns the angle a-b in degrees in the range -180 to 180.
+func AngleDiff(a, b float64) float64 {
+	d := math.Mod(a-b, 360)
+	if d > 180 {
+		d -= 360
+	} else if d < -180 {
+		d += 360
+	}
+	return d
+}
+
+// Errors are the largest absolute errors of grid lookups against the full model.
+type Errors struct {
+	D, I, F float64    // Largest absolute errors in degrees and nT
+	DAt     [2]float64 // Latitude and longitude of the largest declination error
+	N       int        // Number of points compared
+}
+
+// MaxError compares Lookup with the full model at n points chosen at random
+// by r, uniformly over the area of the grid, and returns the largest errors.
+// Declination errors are only measured outside the blackout zones, where the
+// horizontal intensity is at least BlackoutH.
+func (g *Grid) MaxError(n int, r *rand.Rand) (e Errors) {
+	// Sample uniformly in the sine of latitude so that points are uniform by area.
+	s0, s1 := math.Sin(g.LatMin*egm96.Deg), math.Sin(g.LatMax*egm96.Deg)
+	for i := 0; i < n; i++ {
+		lat := math.Asin(s0+r.Float64()*(s1-s0)) / egm96.Deg
+		lat = math.Max(g.LatMin, math.Min(g.LatMax, lat))
+		lng := g.LngMin + r.Float64()*(g.LngMax-g.LngMin)
+		e.Add(g, lat, lng)
+	}
+	return e
+}
+
+// Add compares Lookup with the full model at a point of the grid g, updating
+// the largest errors and the number of points compared.
+// Points outside the grid are skipped.
+func (e *Errors) Add(g *Grid, lat, lng float64) {
+	v, err := g.Lookup(lat, lng)
+	if err != nil {
+		return
+	}
+	e.N++
+	m, _ := Calculate(lat, lng, g.Height, g.Date)
+	if m.H() >= BlackoutH {
+		if d := math.Abs(AngleDiff(v.D, m.D)); d > e.D {
+			e.D = d
+			e.DAt = [2]float64{lat, lng}
+		}
+	}
+	e.I = math.Max(e.I, math.Abs(v.I-m.I))
+	e.F = math.Max(e.F, math.Abs(v.F-m.F))
+}
+
+// String describes the errors.
+func (e Errors) String() string {
+	return fmt.Sprintf("max errors over %d points: D %.3f° (at %.2f, %.2f), I %.3f°, F %.1f nT",
+		e.N, e.D, e.DAt[0], e.DAt[1], e.I, e.F)
+}
@@ -0,0 +1,133 @@
+package lookup
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.4f, got %8.4f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.4f, got %8.4f", name, expected, actual)
+}
+
+var date = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLookupAtNodes(t *testing.T) {
+	g, err := Build(Spec{LatMin: 30, LatMax: 50, LatStep: 5, LngMin: -130, LngMax: -60, LngStep: 5}, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nLat, nLng := g.Size(); nLat != 5 || nLng != 15 {
+		t.Errorf("expected a 5x15 grid, got %dx%d", nLat, nLng)
+	}
+	for _, p := range [][2]float64{{30, -130}, {40, -105}, {50, -60}, {45, 240}} {
+		v, err := g.Lookup(p[0], p[1])
+		if err != nil {
+			t.Errorf("unexpected error %s", err)
+			continue
+		}
+		m, _ := Calculate(p[0], p[1], 0, date)
+		testDiff("node D", v.D, m.D, 1e-4, t)
+		testDiff("node I", v.I, m.I, 1e-4, t)
+		testDiff("node F", v.F, m.F, 0.01, t)
+	}
+	for _, p := range [][2]float64{{29, -100}, {51, -100}, {40, -131}, {40, -59}} {
+		if _, err := g.Lookup(p[0], p[1]); err == nil {
+			t.Errorf("expected an error for %v outside the grid", p)
+		}
+	}
+}
+
+func TestLookupAccuracy(t *testing.T) {
+	g, err := Build(Global(2), date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare directly with the full model at random points away from the poles.
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		lat, lng := -55+110*r.Float64(), -180+360*r.Float64()
+		v, err := g.Lookup(lat, lng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, _ := Calculate(lat, lng, 0, date)
+		if math.Abs(AngleDiff(v.D, m.D)) > 0.3 || math.Abs(v.I-m.I) > 0.3 || math.Abs(v.F-m.F) > 100 {
+			t.Errorf("lookup at %.2f, %.2f: %+v differs from the full model %+v", lat, lng, v, m)
+		}
+	}
+
+	// Errors are largest near the poles, where the declination changes rapidly with position.
+	e := g.MaxError(1000, rand.New(rand.NewSource(2)))
+	t.Log(e)
+	if e.N != 1000 {
+		t.Errorf("expected 1000 points, got %d", e.N)
+	}
+	if math.Abs(e.DAt[0]) < 55 {
+		t.Errorf("largest declination error expected near a pole, got %s", e)
+	}
+
+	// A finer grid is more accurate
+	fine, _ := Build(Spec{LatMin: -60, LatMax: 60, LatStep: 1, LngMin: 0, LngMax: 360, LngStep: 1}, date)
+	coarse, _ := Build(Spec{LatMin: -60, LatMax: 60, LatStep: 5, LngMin: 0, LngMax: 360, LngStep: 5}, date)
+	ef, ec := fine.MaxError(500, rand.New(rand.NewSource(3))), coarse.MaxError(500, rand.New(rand.NewSource(3)))
+	t.Log(ef, ec)
+	if ef.D > 0.1 || ef.I > 0.05 || ef.F > 10 {
+		t.Errorf("errors too large for a 1 degree grid: %s", ef)
+	}
+	if ef.D >= ec.D || ef.I >= ec.I || ef.F >= ec.F {
+		t.Errorf("a finer grid should be more accurate: %s, %s", ef, ec)
+	}
+}
+
+func TestDeclinationWrap(t *testing.T) {
+	// Declination interpolated across ±180°
+	testDiff("wrap", AngleDiff(179, -179), -2, 1e-9, t)
+	g := &Grid{Spec: Spec{LatMin: 0, LatMax: 1, LatStep: 1, LngMin: 0, LngMax: 1, LngStep: 1}, nLat: 2, nLng: 2,
+		d: []float32{179, -179, 179, -179}, i: make([]float32, 4), f: make([]float32, 4)}
+	v, _ := g.Lookup(0.5, 0.25)
+	testDiff("wrapped D", v.D, 179.5, 1e-4, t)
+	v, _ = g.Lookup(0.5, 0.75)
+	testDiff("wrapped D", v.D, -179.5, 1e-4, t)
+}
+
+func TestField(t *testing.T) {
+	mf, _ := Field(40, -100, 1000, date)
+	east, _ := Field(40, 260, 1000, date)
+	testDiff("F at a negative longitude", mf.F(), east.F(), 1e-9, t)
+	v, _ := Calculate(40, -100, 1000, date)
+	testDiff("D", v.D, mf.D(), 0, t)
+	testDiff("I", v.I, mf.I(), 0, t)
+	testDiff("F", v.F, mf.F(), 0, t)
+}
+
+func TestPoles(t *testing.T) {
+	for _, lat := range []float64{-90, 90} {
+		m, _ := Calculate(lat, 0, 0, date)
+		near, _ := Calculate(lat-math.Copysign(0.001, lat), 0, 0, date)
+		testDiff("pole I", m.I, near.I, 0.01, t)
+		testDiff("pole F", m.F, near.F, 2, t)
+		// Only the geoid height differs between longitudes at the pole
+		other, _ := Calculate(lat, 90, 0, date)
+		testDiff("pole F at another longitude", other.F, m.F, 2, t)
+	}
+}
+
+func TestBuildBad(t *testing.T) {
+	for _, s := range []Spec{
+		{LatMin: 0, LatMax: 10, LatStep: 3, LngMin: 0, LngMax: 10, LngStep: 1},
+		{LatMin: 0, LatMax: 10, LatStep: 0, LngMin: 0, LngMax: 10, LngStep: 1},
+		{LatMin: -95, LatMax: 10, LatStep: 5, LngMin: 0, LngMax: 10, LngStep: 1},
+		{LatMin: 0, LatMax: 10, LatStep: 1, LngMin: -180, LngMax: 360, LngStep: 1},
+	} {
+		if _, err := Build(s, date); err == nil {
+			t.Errorf("expected an error for %+v", s)
+		}
+	}
+}
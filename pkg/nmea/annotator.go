@@ -0,0 +1,236 @@
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	parsing "github.com/westphae/geomag/internal/util"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+// ErrNoFix is returned by Variation before a position and date are known.
+var ErrNoFix = errors.New("no position and date have been received yet")
+
+// An Annotator follows the position and date reported in a stream of NMEA
+// sentences and adds the magnetic variation calculated with the World Magnetic
+// Model to the sentences that carry it.
+//
+// The position is taken from GGA and RMC sentences with a valid fix, the height
+// above mean sea level from GGA and the date from RMC.  Then
+//  - RMC sentences with blank magnetic variation fields have them filled in;
+//  - HDG sentences with blank magnetic variation fields have them filled in, and
+//    are followed by the HDT true heading and HDM magnetic heading they imply;
+//  - HDM sentences are replaced by HDG, HDT and HDM sentences.
+// Other sentences are passed through unchanged.
+//
+// The zero Annotator is ready to use.
+type Annotator struct {
+	Date      time.Time // Date to use until an RMC sentence gives one; zero to wait for an RMC sentence
+	Overwrite bool      // Replace magnetic variations already present in RMC and HDG sentences
+	Talker    string    // Talker ID of derived heading sentences, empty for the talker of the input
+
+	lat, lng float64       // Degrees
+	alt      float64       // Meters above mean sea level
+	hasPos   bool          // Whether lat and lng are known
+	date     time.Time     // UTC date of the last RMC sentence
+	tod      time.Duration // Time of day of the last GGA or RMC sentence
+}
+
+// Variation returns the magnetic variation (declination) at the last position
+// and time received, in degrees east positive.
+// It returns ErrNoFix if no position or date is known, or the error converting
+// the height above mean sea level of a position that cannot be located.  As for
+// wmm.CalculateWMMMagneticField, an error for a date outside the validity
+// of the model is informational and the variation is still returned.
+func (a *Annotator) Variation() (deg float64, err error) {
+	deg, _, err = a.variation()
+	return deg, err
+}
+
+// variation returns the variation and error as Variation does, and whether
+// the variation could be calculated.
+func (a *Annotator) variation() (deg float64, ok bool, err error) {
+	t := a.Time()
+	if !a.hasPos || t.IsZero() {
+		return 0, false, ErrNoFix
+	}
+	loc, err := parsing.NewLocation(a.lat, a.lng, a.alt, false)
+	if err != nil {
+		return 0, false, err
+	}
+	mf, err := wmm.CalculateWMMMagneticField(loc, t)
+	return mf.D(), true, err
+}
+
+// Time returns the time of the last position received, or the zero time if the date is unknown.
+func (a *Annotator) Time() time.Time {
+	if a.date.IsZero() {
+		if a.Date.IsZero() {
+			return time.Time{}
+		}
+		y, m, d := a.Date.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(a.tod)
+	}
+	return a.date.Add(a.tod)
+}
+
+// Process updates the Annotator from the sentence s and returns the sentences
+// to output in its place.
+//
+// The returned error reports a sentence that could not be interpreted or a
+// variation that could not be calculated.  Like the error from
+// wmm.CalculateWMMMagneticField it is informational: the sentences to output
+// are returned in any case, with s passed through unchanged if it could not be annotated.
+func (a *Annotator) Process(s Sentence) (out []Sentence, err error) {
+	switch s.Type {
+	case "GGA":
+		err = a.gga(s)
+	case "RMC":
+		if err = a.rmc(s); err != nil {
+			return []Sentence{s}, err
+		}
+		if s.Field(9) == "" || a.Overwrite {
+			var (
+				v  float64
+				ok bool
+			)
+			if v, ok, err = a.variation(); ok {
+				s = s.copy()
+				val, dir := FormatAngle(v)
+				s.setField(9, val)
+				s.setField(10, dir)
+			}
+		}
+	case "HDG":
+		return a.hdg(s)
+	case "HDM":
+		if s.Field(0) == "" {
+			return []Sentence{s}, nil
+		}
+		hdg := Sentence{Start: s.Start, Talker: s.Talker, Type: "HDG", Fields: []string{s.Field(0), "", "", "", ""}}
+		out, err = a.hdg(hdg)
+		if len(out) == 1 {
+			// Without a variation there is no true heading to add
+			return []Sentence{s}, err
+		}
+		return out, err
+	}
+	return []Sentence{s}, err
+}
+
+// gga updates the position and time from a GGA sentence.
+func (a *Annotator) gga(s Sentence) (err error) {
+	if q := s.Field(5); q == "" || q == "0" {
+		return nil
+	}
+	if err = a.position(s.Field(1), s.Field(2), s.Field(3), s.Field(4)); err != nil {
+		return err
+	}
+	if alt := s.Field(8); alt != "" {
+		if a.alt, err = strconv.ParseFloat(alt, 64); err != nil {
+			return fmt.Errorf("invalid GGA altitude %q", alt)
+		}
+	}
+	return a.timeOfDay(s.Field(0))
+}
+
+// rmc updates the position, date and time from an RMC sentence.
+func (a *Annotator) rmc(s Sentence) (err error) {
+	if s.Field(1) != "A" {
+		return nil
+	}
+	if err = a.position(s.Field(2), s.Field(3), s.Field(4), s.Field(5)); err != nil {
+		return err
+	}
+	if err = a.timeOfDay(s.Field(0)); err != nil {
+		return err
+	}
+	d := s.Field(8)
+	if d == "" {
+		return nil
+	}
+	date, err := time.Parse("020106", d)
+	if err != nil {
+		return fmt.Errorf("invalid RMC date %q", d)
+	}
+	a.date = date
+	return nil
+}
+
+// position sets the position from NMEA latitude and longitude fields.
+func (a *Annotator) position(lat, ns, lng, ew string) (err error) {
+	if lat == "" || lng == "" {
+		return nil
+	}
+	if a.lat, err = ParseLatLng(lat, ns); err != nil {
+		return err
+	}
+	if a.lng, err = ParseLatLng(lng, ew); err != nil {
+		return err
+	}
+	a.hasPos = true
+	return nil
+}
+
+// timeOfDay sets the time of day from an NMEA hhmmss.ss field, advancing the
+// date when the time passes midnight.
+func (a *Annotator) timeOfDay(hms string) (err error) {
+	if len(hms) < 6 {
+		return nil
+	}
+	h, errH := strconv.Atoi(hms[0:2])
+	m, errM := strconv.Atoi(hms[2:4])
+	sec, errS := strconv.ParseFloat(hms[4:], 64)
+	if errH != nil || errM != nil || errS != nil || h > 23 || m > 59 || sec >= 61 {
+		return fmt.Errorf("invalid time %q", hms)
+	}
+	tod := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second))
+	if tod < a.tod-12*time.Hour && !a.date.IsZero() {
+		a.date = a.date.AddDate(0, 0, 1)
+	}
+	a.tod = tod
+	return nil
+}
+
+// hdg fills in the variation of an HDG sentence and adds the HDT and HDM
+// sentences for its heading.
+func (a *Annotator) hdg(s Sentence) (out []Sentence, err error) {
+	if s.Field(0) == "" {
+		return []Sentence{s}, nil
+	}
+	heading, err := strconv.ParseFloat(s.Field(0), 64)
+	if err != nil {
+		return []Sentence{s}, fmt.Errorf("invalid HDG heading %q", s.Field(0))
+	}
+	if s.Field(1) != "" {
+		dev, err := ParseAngle(s.Field(1), s.Field(2))
+		if err != nil {
+			return []Sentence{s}, err
+		}
+		heading += dev
+	}
+
+	talker := a.Talker
+	if talker == "" {
+		talker = s.Talker
+	}
+	hdm := Sentence{Start: s.Start, Talker: talker, Type: "HDM", Fields: []string{formatHeading(heading), "M"}}
+
+	var v float64
+	if s.Field(3) == "" || a.Overwrite {
+		var ok bool
+		if v, ok, err = a.variation(); !ok {
+			return []Sentence{s}, err
+		}
+		s = s.copy()
+		val, dir := FormatAngle(v)
+		s.setField(3, val)
+		s.setField(4, dir)
+	} else if v, err = ParseAngle(s.Field(3), s.Field(4)); err != nil {
+		return []Sentence{s}, err
+	}
+	hdt := Sentence{Start: s.Start, Talker: talker, Type: "HDT", Fields: []string{formatHeading(heading + v), "T"}}
+	return []Sentence{s, hdt, hdm}, err
+}
@@ -0,0 +1,148 @@
+package nmea
+
+import (
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+	"github.com/westphae/geomag/pkg/wmm"
+)
+
+func process(a *Annotator, line string, t *testing.T) (out []string) {
+	s, err := Parse(line)
+	if err != nil {
+		t.Fatalf("%s: %s", line, err)
+	}
+	ss, err := a.Process(s)
+	if err != nil && err != ErrNoFix {
+		t.Errorf("%s: unexpected error %s", line, err)
+	}
+	for _, s := range ss {
+		out = append(out, s.String())
+	}
+	return out
+}
+
+func TestAnnotator(t *testing.T) {
+	loc, _ := egm96.NewLocationMSL(48.1173, 11.516666667, 545.4)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, time.Date(2022, 3, 23, 12, 35, 19, 0, time.UTC))
+	val, dir := FormatAngle(mf.D())
+	d := mf.D()
+
+	a := new(Annotator)
+	in := Sentence{Talker: "HC", Type: "HDG", Fields: []string{"98.3", "0.5", "W", "", ""}}
+	out := process(a, in.String(), t)
+	if len(out) != 1 || out[0] != in.String() {
+		t.Errorf("HDG without a fix should pass through, got %v", out)
+	}
+
+	out = process(a, "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", t)
+	if len(out) != 1 {
+		t.Errorf("GGA should pass through, got %v", out)
+	}
+	if _, err := a.Variation(); err != ErrNoFix {
+		t.Errorf("expected ErrNoFix before an RMC date, got %v", err)
+	}
+
+	rmc := Sentence{Talker: "GP", Type: "RMC",
+		Fields: []string{"123519", "A", "4807.038", "N", "01131.000", "E", "022.4", "084.4", "230322", "", "", "A"}}
+	out = process(a, rmc.String(), t)
+	rmc.Fields[9], rmc.Fields[10] = val, dir
+	if len(out) != 1 || out[0] != rmc.String() {
+		t.Errorf("RMC variation not filled in: got %v, expected %s", out, rmc.String())
+	}
+	if !a.Time().Equal(time.Date(2022, 3, 23, 12, 35, 19, 0, time.UTC)) {
+		t.Errorf("incorrect time %v", a.Time())
+	}
+	v, _ := a.Variation()
+	testDiff("variation", v, d, 1e-9, t)
+
+	// An existing variation is kept unless Overwrite is set
+	rmc.Fields[9], rmc.Fields[10] = "003.1", "W"
+	out = process(a, rmc.String(), t)
+	if out[0] != rmc.String() {
+		t.Errorf("RMC variation should not be replaced, got %v", out)
+	}
+
+	out = process(a, in.String(), t)
+	expected := []string{
+		Sentence{Talker: "HC", Type: "HDG", Fields: []string{"98.3", "0.5", "W", val, dir}}.String(),
+		Sentence{Talker: "HC", Type: "HDT", Fields: []string{formatHeading(97.8 + d), "T"}}.String(),
+		Sentence{Talker: "HC", Type: "HDM", Fields: []string{"97.8", "M"}}.String(),
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected HDG, HDT and HDM, got %v", out)
+	}
+	for i := range expected {
+		if out[i] != expected[i] {
+			t.Errorf("heading sentence %d: expected %s, got %s", i, expected[i], out[i])
+		}
+	}
+
+	a.Talker = "HE"
+	out = process(a, Sentence{Talker: "HC", Type: "HDM", Fields: []string{"350.0", "M"}}.String(), t)
+	if len(out) != 3 || out[1] != (Sentence{Talker: "HE", Type: "HDT", Fields: []string{formatHeading(350 + d), "T"}}).String() ||
+		out[2] != (Sentence{Talker: "HE", Type: "HDM", Fields: []string{"350.0", "M"}}).String() {
+		t.Errorf("HDM not converted correctly, got %v", out)
+	}
+
+	// The date advances at midnight
+	process(a, "$GPGGA,000001,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", t)
+	if !a.Time().Equal(time.Date(2022, 3, 24, 0, 0, 1, 0, time.UTC)) {
+		t.Errorf("incorrect time after midnight %v", a.Time())
+	}
+}
+
+func TestAnnotatorDate(t *testing.T) {
+	a := &Annotator{Date: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	process(a, "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", t)
+	if !a.Time().Equal(time.Date(2021, 6, 1, 12, 35, 19, 0, time.UTC)) {
+		t.Errorf("incorrect time %v", a.Time())
+	}
+	if _, err := a.Variation(); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestAnnotatorOutsideModel(t *testing.T) {
+	if err := wmm.LoadWMMCOF(""); err != nil {
+		t.Fatal(err)
+	}
+	// An RMC sentence dated after the end of the model still has its variation
+	// filled in, with an informational error
+	a := new(Annotator)
+	rmc := Sentence{Talker: "GP", Type: "RMC",
+		Fields: []string{"123519", "A", "4807.038", "N", "01131.000", "E", "022.4", "084.4", "010130", "", "", "A"}}
+	out, err := a.Process(rmc)
+	if err == nil || err == ErrNoFix {
+		t.Errorf("expected an error for a date outside the model, got %v", err)
+	}
+	if len(out) != 1 || out[0].Field(9) == "" {
+		t.Errorf("RMC variation not filled in: got %v", out)
+	}
+	v, err := a.Variation()
+	if err == nil || err == ErrNoFix {
+		t.Errorf("expected an error for a date outside the model, got %v", err)
+	}
+	loc, _ := egm96.NewLocationMSL(48.1173, 11.516666667, 0)
+	mf, _ := wmm.CalculateWMMMagneticField(loc, time.Date(2030, 1, 1, 12, 35, 19, 0, time.UTC))
+	testDiff("variation outside the model", v, mf.D(), 1e-9, t)
+}
+
+func TestAnnotatorBadPosition(t *testing.T) {
+	// A latitude beyond the pole cannot be located, so no variation is added
+	a := &Annotator{Date: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	rmc := Sentence{Talker: "GP", Type: "RMC",
+		Fields: []string{"123519", "A", "9130.000", "N", "01131.000", "E", "022.4", "084.4", "010621", "", "", "A"}}
+	out, err := a.Process(rmc)
+	if err == nil || err == ErrNoFix {
+		t.Errorf("expected an error for a latitude beyond the pole, got %v", err)
+	}
+	if len(out) != 1 || out[0].Field(9) != "" {
+		t.Errorf("RMC variation should be left blank, got %v", out)
+	}
+	hdg := Sentence{Talker: "HC", Type: "HDG", Fields: []string{"98.3", "", "", "", ""}}
+	if out, err = a.Process(hdg); err == nil || len(out) != 1 || out[0].String() != hdg.String() {
+		t.Errorf("HDG should pass through with an error, got %v, %v", out, err)
+	}
+}
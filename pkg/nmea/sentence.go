@@ -0,0 +1,167 @@
+// Package nmea reads and writes NMEA 0183 sentences and uses the World Magnetic
+// Model to supply the magnetic variation that GPS receivers often leave blank.
+//
+// An Annotator follows the position and date reported by GGA and RMC sentences
+// from a stream, fills in the magnetic variation fields of RMC and HDG sentences,
+// and derives HDG, HDT and HDM heading sentences from magnetic heading input.
+package nmea
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Sentence is an NMEA 0183 sentence such as
+//  $GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A
+// split into its talker ID (GP), sentence type (RMC) and data fields.
+type Sentence struct {
+	Start  byte   // Start delimiter, '$' or '!' for encapsulated sentences
+	Talker string // Talker ID, e.g. GP or HC; empty for proprietary sentences
+	Type   string // Sentence type, e.g. RMC, or the whole address of a proprietary sentence
+	Fields []string
+}
+
+// Checksum returns the NMEA checksum of the body of a sentence, the characters
+// between the start delimiter and the *: the exclusive or of all its bytes.
+func Checksum(body string) (c byte) {
+	for i := 0; i < len(body); i++ {
+		c ^= body[i]
+	}
+	return c
+}
+
+// Parse parses a single NMEA sentence, ignoring any surrounding whitespace.
+// If the sentence has a checksum it must be correct; sentences without a
+// checksum are accepted.
+func Parse(line string) (s Sentence, err error) {
+	line = strings.TrimSpace(line)
+	if len(line) < 2 || (line[0] != '$' && line[0] != '!') {
+		return s, fmt.Errorf("sentence %q does not start with $ or !", line)
+	}
+	s.Start = line[0]
+	body := line[1:]
+	if i := strings.LastIndexByte(body, '*'); i >= 0 {
+		sum, err := strconv.ParseUint(body[i+1:], 16, 8)
+		if err != nil || len(body)-i-1 != 2 {
+			return s, fmt.Errorf("sentence %q has invalid checksum %q", line, body[i+1:])
+		}
+		body = body[:i]
+		if c := Checksum(body); byte(sum) != c {
+			return s, fmt.Errorf("sentence %q has checksum %02X, expected %02X", line, sum, c)
+		}
+	}
+
+	fields := strings.Split(body, ",")
+	addr := fields[0]
+	switch {
+	case strings.HasPrefix(addr, "P"):
+		s.Type = addr
+	case len(addr) == 5:
+		s.Talker, s.Type = addr[:2], addr[2:]
+	default:
+		return s, fmt.Errorf("sentence %q has invalid address %q", line, addr)
+	}
+	s.Fields = fields[1:]
+	return s, nil
+}
+
+// String returns the sentence with its checksum, without a line ending.
+func (s Sentence) String() string {
+	start := s.Start
+	if start == 0 {
+		start = '$'
+	}
+	body := s.Talker + s.Type
+	if len(s.Fields) > 0 {
+		body += "," + strings.Join(s.Fields, ",")
+	}
+	return fmt.Sprintf("%c%s*%02X", start, body, Checksum(body))
+}
+
+// Field returns the i'th data field of the sentence, or "" if it has fewer fields.
+func (s Sentence) Field(i int) string {
+	if i < 0 || i >= len(s.Fields) {
+		return ""
+	}
+	return s.Fields[i]
+}
+
+// copy returns a copy of the sentence that can be modified without changing s.
+func (s Sentence) copy() Sentence {
+	s.Fields = append([]string(nil), s.Fields...)
+	return s
+}
+
+// setField sets the i'th data field of the sentence, adding empty fields as needed.
+func (s *Sentence) setField(i int, v string) {
+	for len(s.Fields) <= i {
+		s.Fields = append(s.Fields, "")
+	}
+	s.Fields[i] = v
+}
+
+// ParseLatLng parses a latitude or longitude in the NMEA format ddmm.mmmm or
+// dddmm.mmmm with its hemisphere N, S, E or W, returning decimal degrees
+// negative to the south and west.
+func ParseLatLng(v, hemi string) (deg float64, err error) {
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil || x < 0 {
+		return 0, fmt.Errorf("invalid latitude or longitude %q", v)
+	}
+	d := math.Floor(x / 100)
+	m := x - 100*d
+	if m >= 60 {
+		return 0, fmt.Errorf("invalid latitude or longitude %q", v)
+	}
+	deg = d + m/60
+	switch hemi {
+	case "N", "E":
+	case "S", "W":
+		deg = -deg
+	default:
+		return 0, fmt.Errorf("invalid hemisphere %q", hemi)
+	}
+	return deg, nil
+}
+
+// FormatAngle formats an angle such as a variation or deviation in degrees as
+// its magnitude to 0.1° and its direction E or W, east positive.
+func FormatAngle(deg float64) (v, dir string) {
+	dir = "E"
+	if deg < 0 {
+		dir = "W"
+		deg = -deg
+	}
+	return strconv.FormatFloat(deg, 'f', 1, 64), dir
+}
+
+// ParseAngle parses an angle such as a variation or deviation with its
+// direction E or W, returning degrees east positive.
+func ParseAngle(v, dir string) (deg float64, err error) {
+	if deg, err = strconv.ParseFloat(v, 64); err != nil {
+		return 0, fmt.Errorf("invalid angle %q", v)
+	}
+	switch dir {
+	case "E":
+	case "W":
+		deg = -deg
+	default:
+		return 0, fmt.Errorf("invalid direction %q", dir)
+	}
+	return deg, nil
+}
+
+// formatHeading formats a heading in degrees to 0.1°, in the range [0, 360).
+func formatHeading(deg float64) string {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	v := strconv.FormatFloat(deg, 'f', 1, 64)
+	if v == "360.0" {
+		v = "0.0"
+	}
+	return v
+}
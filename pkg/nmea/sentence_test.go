@@ -0,0 +1,74 @@
+package nmea
+
+import (
+	"testing"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.6f, got %8.6f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.6f, got %8.6f", name, expected, actual)
+}
+
+func TestParseSentence(t *testing.T) {
+	for _, line := range []string{
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A",
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47",
+		"$HCHDG,98.3,0.0,E,12.6,W*57",
+	} {
+		s, err := Parse(line + "\r\n")
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", line, err)
+			continue
+		}
+		if s.String() != line {
+			t.Errorf("%s: round trip gave %s", line, s.String())
+		}
+	}
+
+	s, _ := Parse("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A")
+	if s.Talker != "GP" || s.Type != "RMC" || len(s.Fields) != 11 || s.Field(8) != "230394" || s.Field(11) != "" {
+		t.Errorf("RMC parsed incorrectly: %+v", s)
+	}
+
+	s, err := Parse("$PGRME,15.0,M,45.0,M,25.0,M")
+	if err != nil || s.Type != "PGRME" || s.Talker != "" {
+		t.Errorf("proprietary sentence parsed incorrectly: %+v, %v", s, err)
+	}
+
+	for _, line := range []string{
+		"GPRMC,123519,A*00",
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B",
+		"$GPRMC,123519*6",
+		"$GPRMCX,123519",
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestLatLngAngles(t *testing.T) {
+	lat, _ := ParseLatLng("4807.038", "N")
+	testDiff("latitude", lat, 48.1173, 1e-9, t)
+	lng, _ := ParseLatLng("01131.000", "W")
+	testDiff("longitude", lng, -11.516666667, 1e-9, t)
+	if _, err := ParseLatLng("4860.0", "N"); err == nil {
+		t.Error("expected an error for 60 minutes")
+	}
+	if _, err := ParseLatLng("4807.038", "X"); err == nil {
+		t.Error("expected an error for an invalid hemisphere")
+	}
+
+	v, dir := FormatAngle(-3.14)
+	if v != "3.1" || dir != "W" {
+		t.Errorf("FormatAngle gave %s,%s", v, dir)
+	}
+	deg, _ := ParseAngle("3.1", "W")
+	testDiff("angle", deg, -3.1, 1e-9, t)
+	if h := formatHeading(-0.01); h != "0.0" {
+		t.Errorf("formatHeading gave %s", h)
+	}
+}
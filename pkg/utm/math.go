@@ -0,0 +1,110 @@
+package utm
+
+import "math"
+
+// Helper functions for the projections.  Angles passed to and returned from
+// these are in degrees, following the conventions of C. F. F. Karney's
+// GeographicLib, from which the algorithms are taken.
+
+const (
+	tol0    = 0x1p-52 // Machine epsilon
+	degrees = 180 / math.Pi
+)
+
+// angNormalize reduces an angle to the range [-180, 180].
+func angNormalize(x float64) (y float64) {
+	y = math.Remainder(x, 360)
+	if math.Abs(y) == 180 {
+		return math.Copysign(180, x)
+	}
+	return y
+}
+
+// sinCosD returns the sine and cosine of x in degrees, reducing the
+// argument exactly so that e.g. sinCosD(90) is exactly (1, 0).
+func sinCosD(x float64) (s, c float64) {
+	r := math.Mod(x, 360)
+	q := 0
+	if !math.IsNaN(r) {
+		q = int(math.Round(r / 90))
+	}
+	r -= 90 * float64(q)
+	r /= degrees
+	s, c = math.Sin(r), math.Cos(r)
+	switch q & 3 {
+	case 1:
+		s, c = c, -s
+	case 2:
+		s, c = -s, -c
+	case 3:
+		s, c = -c, s
+	}
+	c += 0
+	if s == 0 {
+		s = math.Copysign(s, x)
+	}
+	return s, c
+}
+
+// atan2D returns atan2(y, x) in degrees, in the range [-180, 180].
+func atan2D(y, x float64) (ang float64) {
+	q := 0
+	if math.Abs(y) > math.Abs(x) {
+		q = 2
+		x, y = y, x
+	}
+	if x < 0 {
+		q++
+		x = -x
+	}
+	ang = math.Atan2(y, x) * degrees
+	switch q {
+	case 1:
+		ang = math.Copysign(180, y) - ang
+	case 2:
+		ang = 90 - ang
+	case 3:
+		ang = -90 + ang
+	}
+	return ang
+}
+
+// eatanhe returns e*atanh(e*x) for eccentricity e.
+func eatanhe(x, e float64) (y float64) {
+	return e * math.Atanh(e*x)
+}
+
+// taupf returns tan(chi), where chi is the conformal latitude, given
+// tau = tan(phi) for geodetic latitude phi and eccentricity e.
+func taupf(tau, e float64) (taup float64) {
+	tau1 := math.Hypot(1, tau)
+	sig := math.Sinh(eatanhe(tau/tau1, e))
+	return math.Hypot(1, sig)*tau - sig*tau1
+}
+
+// tauf inverts taupf by Newton's method, returning tan(phi) given tan(chi).
+func tauf(taup, e float64) (tau float64) {
+	const numit = 5
+	tol := math.Sqrt(tol0) / 10
+	taumax := 2 / math.Sqrt(tol0)
+	e2m := 1 - e*e
+	if math.Abs(taup) > 70 {
+		tau = taup * math.Exp(eatanhe(1, e))
+	} else {
+		tau = taup / e2m
+	}
+	stol := tol * math.Max(1, math.Abs(taup))
+	if !(math.Abs(tau) < taumax) {
+		return tau
+	}
+	for i := 0; i < numit; i++ {
+		taupa := taupf(tau, e)
+		dtau := (taup - taupa) * (1 + e2m*tau*tau) /
+			(e2m * math.Hypot(1, tau) * math.Hypot(1, taupa))
+		tau += dtau
+		if math.Abs(dtau) < stol {
+			break
+		}
+	}
+	return tau
+}
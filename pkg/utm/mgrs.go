@@ -0,0 +1,264 @@
+package utm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// Letters used in MGRS references, which omit I and O.
+const (
+	latBands = "CDEFGHJKLMNPQRSTUVWX" // UTM latitude bands from 80°S in 8° steps
+	upsBands = "ABYZ"                 // UPS bands: south-west, south-east, north-west, north-east
+	utmRows  = "ABCDEFGHJKLMNPQRSTUV" // UTM 100km row letters, cycling every 2000km
+)
+
+var (
+	utmCols = [3]string{"ABCDEFGH", "JKLMNPQR", "STUVWXYZ"} // UTM 100km column letters by zone mod 3
+	upsCols = [4]string{"JKLPQRSTUXYZ", "ABCFGHJKLPQR", "RSTUXYZ", "ABCFGHJ"}
+	upsRows = [2]string{"ABCDEFGHJKLMNPQRSTUVWXYZ", "ABCDEFGHJKLMNP"}
+)
+
+const (
+	tile          = 100000 // Size of an MGRS square, m
+	maxPrecision  = 5      // Digits per coordinate for a 1m square
+	utmRowPeriod  = 20     // Rows before the row letters repeat
+	utmEvenShift  = 5      // Row letter offset of even numbered zones
+	minUTMCol     = 1      // Easting of the first column, in tiles
+	maxUTMSRow    = 100    // False northing of the southern hemisphere, in tiles
+	minUPSSInd    = 8      // Smallest easting or northing of UPS south, in tiles
+	minUPSNInd    = 13     // Smallest easting or northing of UPS north, in tiles
+	upsEastingInd = 20     // Easting of the pole, in tiles
+)
+
+// MGRS returns the Military Grid Reference System reference of the Location, e.g.
+// "38SMB4414084706", with prec digits (0 to 5) for each of the easting and northing.
+// Precision 5 identifies a 1m square, and each lower precision a square 10 times larger.
+// As MGRS requires, the coordinates are truncated rather than rounded.
+func MGRS(l egm96.Location, prec int) (ref string, err error) {
+	if prec < 0 || prec > maxPrecision {
+		return "", fmt.Errorf("MGRS precision %d is not in the range 0 to %d", prec, maxPrecision)
+	}
+	c, err := NewCoord(l)
+	if err != nil {
+		return "", err
+	}
+	lat, _ := latLngDegrees(l)
+
+	// Work in integer meters to avoid round-off in the truncation
+	x := int(math.Floor(c.Easting))
+	y := int(math.Floor(c.Northing))
+	xh, yh := x/tile, y/tile
+
+	var b strings.Builder
+	if c.Zone == UPS {
+		iBand := 0
+		eastp := xh >= upsEastingInd
+		if eastp {
+			iBand++
+		}
+		minInd := minUPSSInd
+		if c.North {
+			iBand += 2
+			minInd = minUPSNInd
+		}
+		col := xh - minInd
+		if eastp {
+			col = xh - upsEastingInd
+		}
+		row := yh - minInd
+		iRow := 0
+		if c.North {
+			iRow = 1
+		}
+		if col < 0 || col >= len(upsCols[iBand]) || row < 0 || row >= len(upsRows[iRow]) {
+			return "", fmt.Errorf("UPS coordinates %.0f %.0f are outside the MGRS grid", c.Easting, c.Northing)
+		}
+		b.WriteByte(upsBands[iBand])
+		b.WriteByte(upsCols[iBand][col])
+		b.WriteByte(upsRows[iRow][row])
+	} else {
+		zone1 := c.Zone - 1
+		iBand := latitudeBand(lat)
+		if math.Abs(lat) < 1e-9 {
+			// Latitude round-off near the equator
+			iBand = -1
+			if c.North {
+				iBand = 0
+			}
+		}
+		col := xh - minUTMCol
+		if col < 0 || col >= len(utmCols[zone1%3]) {
+			return "", fmt.Errorf("UTM easting %.0f is outside the MGRS grid", c.Easting)
+		}
+		row := yh
+		if zone1%2 == 1 {
+			row += utmEvenShift
+		}
+		fmt.Fprintf(&b, "%02d", c.Zone)
+		b.WriteByte(latBands[10+iBand])
+		b.WriteByte(utmCols[zone1%3][col])
+		b.WriteByte(utmRows[row%utmRowPeriod])
+	}
+
+	if prec > 0 {
+		div := int(math.Pow10(maxPrecision - prec))
+		fmt.Fprintf(&b, "%0*d%0*d", prec, (x%tile)/div, prec, (y%tile)/div)
+	}
+	return b.String(), nil
+}
+
+// ParseMGRS reads a Military Grid Reference System reference, returning the grid
+// coordinates of the center of the square it identifies and the precision of the reference.
+// Spaces within the reference are ignored and letters may be in either case.
+func ParseMGRS(inp string) (c Coord, prec int, err error) {
+	ref := strings.ToUpper(strings.Join(strings.Fields(inp), ""))
+
+	i := strings.IndexFunc(ref, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i < 0 || i > 2 || len(ref) < i+3 {
+		return Coord{}, 0, fmt.Errorf("%s is not a valid MGRS reference", inp)
+	}
+	if i > 0 {
+		if c.Zone, err = strconv.Atoi(ref[:i]); err != nil || c.Zone < 1 || c.Zone > 60 {
+			return Coord{}, 0, fmt.Errorf("invalid UTM zone %s in MGRS reference %s", ref[:i], inp)
+		}
+	}
+	band, col, row := ref[i:i+1], ref[i+1:i+2], ref[i+2:i+3]
+	digits := ref[i+3:]
+	if len(digits)%2 != 0 || len(digits) > 2*maxPrecision {
+		return Coord{}, 0, fmt.Errorf("MGRS reference %s must have an equal number of easting and northing digits", inp)
+	}
+	for _, d := range digits {
+		if !unicode.IsDigit(d) {
+			return Coord{}, 0, fmt.Errorf("%s is not a valid MGRS reference", inp)
+		}
+	}
+	prec = len(digits) / 2
+
+	var xh, yh int
+	if c.Zone == UPS {
+		iBand := strings.Index(upsBands, band)
+		if iBand < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid UPS band %s in MGRS reference %s", band, inp)
+		}
+		c.North = iBand >= 2
+		iRow := 0
+		minInd := minUPSSInd
+		if c.North {
+			iRow = 1
+			minInd = minUPSNInd
+		}
+		iCol := strings.Index(upsCols[iBand], col)
+		if iCol < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid UPS column letter %s in MGRS reference %s", col, inp)
+		}
+		if iBand%2 == 1 {
+			xh = iCol + upsEastingInd
+		} else {
+			xh = iCol + minInd
+		}
+		iRow = strings.Index(upsRows[iRow], row)
+		if iRow < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid UPS row letter %s in MGRS reference %s", row, inp)
+		}
+		yh = iRow + minInd
+	} else {
+		zone1 := c.Zone - 1
+		iBand := strings.Index(latBands, band)
+		if iBand < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid latitude band %s in MGRS reference %s", band, inp)
+		}
+		iBand -= 10
+		c.North = iBand >= 0
+		iCol := strings.Index(utmCols[zone1%3], col)
+		if iCol < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid UTM column letter %s in MGRS reference %s", col, inp)
+		}
+		iRow := strings.Index(utmRows, row)
+		if iRow < 0 {
+			return Coord{}, 0, fmt.Errorf("invalid UTM row letter %s in MGRS reference %s", row, inp)
+		}
+		if zone1%2 == 1 {
+			iRow = (iRow + utmRowPeriod - utmEvenShift) % utmRowPeriod
+		}
+		iRow = utmRow(iBand, iCol, iRow)
+		if iRow == maxUTMSRow {
+			return Coord{}, 0, fmt.Errorf("row letter %s is inconsistent with band %s in MGRS reference %s", row, band, inp)
+		}
+		if !c.North {
+			iRow += maxUTMSRow
+		}
+		xh = iCol + minUTMCol
+		yh = iRow
+	}
+
+	var x, y int
+	if prec > 0 {
+		x, _ = strconv.Atoi(digits[:prec])
+		y, _ = strconv.Atoi(digits[prec:])
+	}
+	unit := math.Pow10(maxPrecision - prec)
+	c.Easting = float64(xh*tile) + (float64(x)+0.5)*unit
+	c.Northing = float64(yh*tile) + (float64(y)+0.5)*unit
+	return c, prec, nil
+}
+
+// latitudeBand returns the MGRS latitude band index of a latitude in degrees,
+// from -10 for band C to 9 for band X.
+func latitudeBand(lat float64) (band int) {
+	band = (int(math.Floor(lat))+80)/8 - 10
+	if band < -10 {
+		return -10
+	}
+	if band > 9 {
+		return 9
+	}
+	return band
+}
+
+// utmRow returns the row index of a 100km square measured from the equator, in the
+// range [-90, 95), given the band index iBand in [-10, 10), the column index iCol in
+// [0, 8) and the row index iRow in [0, 20) modulo the 2000km period of the row letters.
+// It returns maxUTMSRow if the row lies outside the band.
+func utmRow(iBand, iCol, iRow int) (row int) {
+	c := 100 * float64(8*iBand+4) / 90
+	north := 0.0
+	if iBand >= 0 {
+		north = 1
+	}
+	minRow, maxRow := -90, 94
+	if iBand > -10 {
+		minRow = int(math.Floor(c - 4.3 - 0.1*north))
+	}
+	if iBand < 9 {
+		maxRow = int(math.Floor(c + 4.4 - 0.1*north))
+	}
+	baseRow := (minRow+maxRow)/2 - utmRowPeriod/2
+	// Offset the row by the multiple of the period which brings it closest to the center of the band
+	row = (iRow-baseRow+maxUTMSRow)%utmRowPeriod + baseRow
+	if row >= minRow && row <= maxRow {
+		return row
+	}
+	// Northings of 7100km and 8000km cross band boundaries in some columns
+	sBand, sRow, sCol := iBand, row, iCol
+	if sBand < 0 {
+		sBand = -sBand - 1
+	}
+	if sRow < 0 {
+		sRow = -sRow - 1
+	}
+	if sCol >= 4 {
+		sCol = 7 - sCol
+	}
+	if (sRow == 70 && sBand == 8 && sCol >= 2) ||
+		(sRow == 71 && sBand == 7 && sCol <= 2) ||
+		(sRow == 79 && sBand == 9 && sCol >= 1) ||
+		(sRow == 80 && sBand == 8 && sCol <= 1) {
+		return row
+	}
+	return maxUTMSRow
+}
@@ -0,0 +1,86 @@
+package utm
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func TestMGRS(t *testing.T) {
+	lats := []float64{33.3, 33.3, 33.3, 43.642567, 90, -90, 0, -0.000001}
+	lngs := []float64{44.4, 44.4, 44.4, -79.387139, 0, 0, 3, 3}
+	precs := []int{5, 2, 0, 5, 5, 1, 3, 3}
+	refs := []string{"38SMB4414084706", "38SMB4484", "38SMB", "17TPJ3008433438",
+		"ZAH0000000000", "BAN00", "31NEA000000", "31MEV000999"}
+
+	for i := range lats {
+		ref, err := MGRS(egm96.NewLocationGeodetic(lats[i], lngs[i], 0), precs[i])
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if ref != refs[i] {
+			t.Errorf("MGRS of %6.2f %7.2f: expected %s, got %s", lats[i], lngs[i], refs[i], ref)
+		}
+	}
+
+	if _, err := MGRS(egm96.NewLocationGeodetic(0, 0, 0), 6); err == nil {
+		t.Error("MGRS should fail for precision 6")
+	}
+}
+
+func TestMGRSRoundTrip(t *testing.T) {
+	for lat := -89.5; lat < 90; lat += 3.7 {
+		for lng := -179.5; lng < 180; lng += 13.1 {
+			l := egm96.NewLocationGeodetic(lat, lng, 0)
+			ref, err := MGRS(l, 5)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			c, prec, err := ParseMGRS(ref)
+			if err != nil {
+				t.Errorf("ParseMGRS(%s): %v", ref, err)
+				continue
+			}
+			if prec != 5 {
+				t.Errorf("ParseMGRS(%s): expected precision 5, got %d", ref, prec)
+			}
+			// The reference identifies the 1m square containing the location
+			c0, _ := NewCoord(l)
+			name := fmt.Sprintf("%s at %5.2f %6.2f", ref, lat, lng)
+			if c.Zone != c0.Zone || c.North != c0.North ||
+				math.Abs(c.Easting-c0.Easting) > 0.5 || math.Abs(c.Northing-c0.Northing) > 0.5 {
+				t.Errorf("%s: expected %v, got %v", name, c0, c)
+			}
+		}
+	}
+}
+
+func TestParseMGRS(t *testing.T) {
+	inps := []string{"38SMB4414084706", "38S MB 44140 84706", "38smb4484", "38SMB", "ZAH0000000000", "4QFJ12345678"}
+	cs := []Coord{{38, true, 444140.5, 3684706.5}, {38, true, 444140.5, 3684706.5},
+		{38, true, 444500, 3684500}, {38, true, 450000, 3650000},
+		{UPS, true, 2000000.5, 2000000.5}, {4, true, 612345, 2356785}}
+	precs := []int{5, 5, 2, 0, 5, 4}
+
+	for i, inp := range inps {
+		c, prec, err := ParseMGRS(inp)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if c != cs[i] || prec != precs[i] {
+			t.Errorf("ParseMGRS(%s): expected %v %d, got %v %d", inp, cs[i], precs[i], c, prec)
+		}
+	}
+
+	for _, inp := range []string{"38SMB441408470", "38SIB44148470", "61SMB4414", "38SMW4414", "38S", "CAH00",
+		"38SMB44A4", "ZIH0000"} {
+		if _, _, err := ParseMGRS(inp); err == nil {
+			t.Errorf("ParseMGRS incorrectly thought it could parse %s", inp)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package utm
+
+import "math"
+
+// polarStereographic holds the ellipsoid parameters of the polar stereographic
+// projection with a given scale factor at the pole.
+type polarStereographic struct {
+	a, f, k0    float64
+	e2, es, e2m float64 // Eccentricity squared, eccentricity, 1-e²
+	c           float64
+}
+
+// newPolarStereographic returns the polar stereographic projection for the
+// ellipsoid with equatorial radius a and flattening f, with scale factor k0
+// at the pole.
+func newPolarStereographic(a, f, k0 float64) (ps polarStereographic) {
+	ps.a = a
+	ps.f = f
+	ps.k0 = k0
+	ps.e2 = f * (2 - f)
+	ps.es = math.Sqrt(ps.e2)
+	ps.e2m = 1 - ps.e2
+	ps.c = (1 - f) * math.Exp(eatanhe(1, ps.es))
+	return ps
+}
+
+// forward projects the latitude lat and longitude lon, in degrees, about the
+// north pole if north is true or else the south pole, returning the easting x and
+// northing y in meters relative to the pole, the meridian convergence gamma
+// in degrees and the point scale k.
+func (ps polarStereographic) forward(north bool, lat, lon float64) (x, y, gamma, k float64) {
+	if !north {
+		lat = -lat
+	}
+	tau := math.Tan(lat / degrees)
+	secphi := math.Hypot(1, tau)
+	taup := taupf(tau, ps.es)
+	rho := math.Hypot(1, taup) + math.Abs(taup)
+	if taup >= 0 {
+		if lat != 90 {
+			rho = 1 / rho
+		} else {
+			rho = 0
+		}
+	}
+	rho *= 2 * ps.k0 * ps.a / ps.c
+	if lat != 90 {
+		k = rho / ps.a * secphi * math.Sqrt(ps.e2m+ps.e2/(secphi*secphi))
+	} else {
+		k = ps.k0
+	}
+	slam, clam := sinCosD(lon)
+	x = rho * slam
+	y = rho * clam
+	if north {
+		y = -y
+		gamma = angNormalize(lon)
+	} else {
+		gamma = angNormalize(-lon)
+	}
+	return x, y, gamma, k
+}
+
+// reverse inverts forward, returning the latitude and longitude in degrees, the
+// meridian convergence gamma in degrees and the point scale k.
+func (ps polarStereographic) reverse(north bool, x, y float64) (lat, lon, gamma, k float64) {
+	rho := math.Hypot(x, y)
+	t := tol0 * tol0
+	if rho != 0 {
+		t = rho / (2 * ps.k0 * ps.a / ps.c)
+	}
+	taup := (1/t - t) / 2
+	tau := tauf(taup, ps.es)
+	secphi := math.Hypot(1, tau)
+	if rho != 0 {
+		k = rho / ps.a * secphi * math.Sqrt(ps.e2m+ps.e2/(secphi*secphi))
+	} else {
+		k = ps.k0
+	}
+	lat = math.Atan(tau) * degrees
+	if north {
+		lon = atan2D(x, -y)
+		gamma = angNormalize(lon)
+	} else {
+		lat = -lat
+		lon = atan2D(x, y)
+		gamma = angNormalize(-lon)
+	}
+	return lat, lon, gamma, k
+}
@@ -0,0 +1,223 @@
+package utm
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// maxPow is the order of the Krüger series, which gives an accuracy of
+// about 5 nm within 3900 km of the central meridian.
+const maxPow = 6
+
+// transverseMercator holds the ellipsoid parameters and series coefficients
+// of the transverse Mercator projection with a given central scale factor.
+type transverseMercator struct {
+	a, f, k0    float64
+	e2, es, e2m float64 // Eccentricity squared, eccentricity, 1-e²
+	c           float64 // Scale factor at the pole
+	a1, b1      float64 // Rectifying radius and its ratio to a
+	alp, bet    [maxPow + 1]float64
+}
+
+// newTransverseMercator returns the transverse Mercator projection for the
+// ellipsoid with equatorial radius a and flattening f, with scale factor k0
+// on the central meridian.
+//
+// The series coefficients are from C. F. F. Karney, Transverse Mercator with an
+// accuracy of a few nanometers, J. Geodesy 85, 475-485 (2011),
+// https://doi.org/10.1007/s00190-011-0445-3.
+func newTransverseMercator(a, f, k0 float64) (tm transverseMercator) {
+	tm.a = a
+	tm.f = f
+	tm.k0 = k0
+	tm.e2 = f * (2 - f)
+	tm.es = math.Sqrt(tm.e2)
+	tm.e2m = 1 - tm.e2
+	tm.c = math.Sqrt(tm.e2m) * math.Exp(eatanhe(1, tm.es))
+
+	n := f / (2 - f)
+	n2 := n * n
+	tm.b1 = (n2*(n2*(n2+4)+64) + 256) / (256 * (1 + n))
+	tm.a1 = tm.b1 * a
+
+	// Coefficients of the series in n, highest order first
+	alp := [maxPow + 1][]float64{nil,
+		{31564, -66675, 34440, 47250, -100800, 75600, 151200},
+		{-1983433, 863232, 748608, -1161216, 524160, 1935360},
+		{670412, 406647, -533952, 184464, 725760},
+		{6601661, -7732800, 2230245, 7257600},
+		{-13675556, 3438171, 7983360},
+		{212378941, 319334400},
+	}
+	bet := [maxPow + 1][]float64{nil,
+		{384796, -382725, -6720, 932400, -1612800, 1209600, 2419200},
+		{-1118711, 1695744, -1174656, 258048, 80640, 3870720},
+		{22276, -16929, -15984, 12852, 362880},
+		{-830251, -158400, 197865, 7257600},
+		{-435388, 453717, 15966720},
+		{20648693, 638668800},
+	}
+	d := n
+	for l := 1; l <= maxPow; l++ {
+		m := maxPow - l
+		tm.alp[l] = d * polyval(m, alp[l], n) / alp[l][m+1]
+		tm.bet[l] = d * polyval(m, bet[l], n) / bet[l][m+1]
+		d *= n
+	}
+	return tm
+}
+
+// polyval evaluates the polynomial of order n whose coefficients,
+// highest order first, start at p[0].
+func polyval(n int, p []float64, x float64) (y float64) {
+	if n < 0 {
+		return 0
+	}
+	y = p[0]
+	for i := 1; i <= n; i++ {
+		y = y*x + p[i]
+	}
+	return y
+}
+
+// clenshaw sums the series sum_j c[j]*sin(2*j*z) and its derivative with respect to z,
+// 1 + sum_j 2*j*c[j]*cos(2*j*z), for complex z with real part xi and imaginary part eta.
+func clenshaw(c [maxPow + 1]float64, xi, eta float64) (sum, deriv complex128) {
+	s0, c0 := math.Sincos(2 * xi)
+	sh0, ch0 := math.Sinh(2*eta), math.Cosh(2*eta)
+	a := complex(2*c0*ch0, -2*s0*sh0) // 2*cos(2z)
+
+	var y0, y1, z0, z1 complex128
+	n := maxPow
+	if n&1 == 1 {
+		y0 = complex(c[n], 0)
+		z0 = complex(2*float64(n)*c[n], 0)
+		n--
+	}
+	for n > 0 {
+		y1 = a*y0 - y1 + complex(c[n], 0)
+		z1 = a*z0 - z1 + complex(2*float64(n)*c[n], 0)
+		n--
+		y0 = a*y1 - y0 + complex(c[n], 0)
+		z0 = a*z1 - z0 + complex(2*float64(n)*c[n], 0)
+		n--
+	}
+	a /= 2
+	deriv = 1 - z1 + a*z0
+	sum = complex(s0*ch0, c0*sh0) * y0 // sin(2z)*y0
+	return sum, deriv
+}
+
+// forward projects the latitude lat and longitude lon, in degrees, with central
+// meridian lon0, returning the easting x and northing y in meters relative to the
+// intersection of the central meridian and the equator, the meridian convergence
+// gamma in degrees and the point scale k.
+func (tm transverseMercator) forward(lon0, lat, lon float64) (x, y, gamma, k float64) {
+	lon = angNormalize(lon - lon0)
+	latSign, lonSign := 1.0, 1.0
+	if math.Signbit(lat) {
+		latSign = -1
+	}
+	if math.Signbit(lon) {
+		lonSign = -1
+	}
+	lat *= latSign
+	lon *= lonSign
+	backside := lon > 90
+	if backside {
+		if lat == 0 {
+			latSign = -1
+		}
+		lon = 180 - lon
+	}
+	sphi, cphi := sinCosD(lat)
+	slam, clam := sinCosD(lon)
+
+	var xip, etap float64
+	if lat != 90 {
+		tau := sphi / cphi
+		taup := taupf(tau, tm.es)
+		xip = math.Atan2(taup, clam)
+		etap = math.Asinh(slam / math.Hypot(taup, clam))
+		gamma = atan2D(slam*taup, clam*math.Hypot(1, taup))
+		k = math.Sqrt(tm.e2m+tm.e2*cphi*cphi) * math.Hypot(1, tau) / math.Hypot(taup, clam)
+	} else {
+		xip = math.Pi / 2
+		etap = 0
+		gamma = lon
+		k = tm.c
+	}
+
+	// Convert from Gauss-Schreiber to Gauss-Krüger transverse Mercator
+	sum, deriv := clenshaw(tm.alp, xip, etap)
+	xi := xip + real(sum)
+	eta := etap + imag(sum)
+	gamma -= atan2D(imag(deriv), real(deriv))
+	k *= tm.b1 * cmplx.Abs(deriv)
+
+	if backside {
+		xi = math.Pi - xi
+		gamma = 180 - gamma
+	}
+	y = tm.a1 * tm.k0 * xi * latSign
+	x = tm.a1 * tm.k0 * eta * lonSign
+	gamma = angNormalize(gamma * latSign * lonSign)
+	k *= tm.k0
+	return x, y, gamma, k
+}
+
+// reverse inverts forward, returning the latitude and longitude in degrees, the
+// meridian convergence gamma in degrees and the point scale k.
+func (tm transverseMercator) reverse(lon0, x, y float64) (lat, lon, gamma, k float64) {
+	xi := y / (tm.a1 * tm.k0)
+	eta := x / (tm.a1 * tm.k0)
+	xiSign, etaSign := 1.0, 1.0
+	if math.Signbit(xi) {
+		xiSign = -1
+	}
+	if math.Signbit(eta) {
+		etaSign = -1
+	}
+	xi *= xiSign
+	eta *= etaSign
+	backside := xi > math.Pi/2
+	if backside {
+		xi = math.Pi - xi
+	}
+
+	// Convert from Gauss-Krüger to Gauss-Schreiber transverse Mercator
+	var mbet [maxPow + 1]float64
+	for j := range tm.bet {
+		mbet[j] = -tm.bet[j]
+	}
+	sum, deriv := clenshaw(mbet, xi, eta)
+	xip := xi + real(sum)
+	etap := eta + imag(sum)
+	gamma = atan2D(imag(deriv), real(deriv))
+	k = tm.b1 / cmplx.Abs(deriv)
+
+	s := math.Sinh(etap)
+	c := math.Max(0, math.Cos(xip))
+	r := math.Hypot(s, c)
+	if r != 0 {
+		lon = atan2D(s, c)
+		sxip := math.Sin(xip)
+		tau := tauf(sxip/r, tm.es)
+		gamma += atan2D(sxip*math.Tanh(etap), c)
+		lat = math.Atan(tau) * degrees
+		k *= math.Sqrt(tm.e2m+tm.e2/(1+tau*tau)) * math.Hypot(1, tau) * r
+	} else {
+		lat = 90
+		lon = 0
+		k *= tm.c
+	}
+	lat *= xiSign
+	if backside {
+		lon = 180 - lon
+		gamma = 180 - gamma
+	}
+	lon = angNormalize(lon*etaSign + lon0)
+	gamma = angNormalize(gamma * xiSign * etaSign)
+	k *= tm.k0
+	return lat, lon, gamma, k
+}
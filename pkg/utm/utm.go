@@ -0,0 +1,255 @@
+// Package utm converts egm96.Locations to and from Universal Transverse Mercator (UTM)
+// and Universal Polar Stereographic (UPS) grid coordinates, and to and from
+// Military Grid Reference System (MGRS) strings, on the WGS84 ellipsoid.
+//
+// The transverse Mercator projection uses Krüger's series to sixth order in the
+// third flattening, as described in C. F. F. Karney, Transverse Mercator with an
+// accuracy of a few nanometers, J. Geodesy 85, 475-485 (2011).  The conventions for
+// zones, bands and MGRS letters follow NGA.SIG.0012 and GeographicLib.
+package utm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// UPS is the zone number used for Universal Polar Stereographic coordinates.
+const UPS = 0
+
+const (
+	utmK0         = 0.9996 // Central scale factor of UTM
+	upsK0         = 0.994  // Central scale factor of UPS
+	falseEasting  = 5e5    // UTM false easting, m
+	falseNorthing = 1e7    // UTM false northing in the southern hemisphere, m
+	upsFalse      = 2e6    // UPS false easting and northing, m
+	utmMaxEasting = 1e6    // Largest UTM easting accepted, m
+	minUTMLat     = -80    // UPS is used south of this latitude
+	maxUTMLat     = 84     // UPS is used north of this latitude
+	zoneOverlap   = 0.5    // Degrees of latitude by which UTM and UPS may overlap
+)
+
+var (
+	tm = newTransverseMercator(egm96.WGS84.A, egm96.WGS84.F, utmK0)
+	ps = newPolarStereographic(egm96.WGS84.A, egm96.WGS84.F, upsK0)
+)
+
+// Coord represents a position in UTM or UPS grid coordinates.
+type Coord struct {
+	Zone     int     // UTM zone 1-60, or UPS for the polar regions
+	North    bool    // Whether the position is in the northern hemisphere
+	Easting  float64 // Easting in meters, including the false easting
+	Northing float64 // Northing in meters, including the false northing
+}
+
+// StandardZone returns the UTM zone for the Location, including the exceptions
+// for southwest Norway and Svalbard, or UPS north of 84°N and south of 80°S.
+func StandardZone(l egm96.Location) (zone int) {
+	lat, lng := latLngDegrees(l)
+	if lat >= maxUTMLat || lat < minUTMLat {
+		return UPS
+	}
+	ilon := int(math.Floor(angNormalize(lng)))
+	if ilon >= 180 {
+		ilon -= 360
+	}
+	zone = (ilon + 186) / 6
+	band := latitudeBand(lat)
+	if band == 7 && zone == 31 && ilon >= 3 {
+		// Southwest Norway
+		zone = 32
+	} else if band == 9 && ilon >= 0 && ilon < 42 {
+		// Svalbard
+		zone = 2*((ilon+183)/12) + 1
+	}
+	return zone
+}
+
+// NewCoord returns the UTM or UPS coordinates of the Location in its standard zone.
+// The height of the Location is ignored.
+func NewCoord(l egm96.Location) (c Coord, err error) {
+	return NewCoordZone(l, StandardZone(l))
+}
+
+// NewCoordZone returns the UTM coordinates of the Location in the given zone, or its UPS
+// coordinates if zone is UPS.  This allows coordinates near a zone boundary to be
+// expressed in a neighboring zone.  An error is returned if the Location lies too far
+// outside the zone.
+func NewCoordZone(l egm96.Location, zone int) (c Coord, err error) {
+	lat, lng := latLngDegrees(l)
+	c.Zone = zone
+	c.North = lat >= 0
+	switch {
+	case zone == UPS:
+		if (c.North && lat < maxUTMLat-zoneOverlap) || (!c.North && lat > minUTMLat+zoneOverlap) {
+			return Coord{}, fmt.Errorf("latitude %4.2f is outside the UPS range", lat)
+		}
+		x, y, _, _ := ps.forward(c.North, lat, lng)
+		c.Easting, c.Northing = x+upsFalse, y+upsFalse
+	case zone >= 1 && zone <= 60:
+		if lat < minUTMLat-zoneOverlap || lat > maxUTMLat+zoneOverlap {
+			return Coord{}, fmt.Errorf("latitude %4.2f is outside the UTM range", lat)
+		}
+		x, y, _, _ := tm.forward(centralMeridian(zone), lat, lng)
+		c.Easting, c.Northing = x+falseEasting, y
+		if !c.North {
+			c.Northing += falseNorthing
+		}
+		if c.Easting < 0 || c.Easting > utmMaxEasting {
+			return Coord{}, fmt.Errorf("longitude %4.2f is too far from UTM zone %d", lng, zone)
+		}
+	default:
+		return Coord{}, fmt.Errorf("invalid UTM zone %d", zone)
+	}
+	return c, nil
+}
+
+// Location returns the egm96.Location of the grid coordinates, with zero height above the ellipsoid.
+func (c Coord) Location() (l egm96.Location) {
+	lat, lng, _, _ := c.reverse()
+	return egm96.NewLocationGeodetic(lat, lng, 0)
+}
+
+// Convergence returns the meridian convergence at the grid coordinates,
+// the bearing of grid north clockwise from true north, in degrees.
+func (c Coord) Convergence() (gamma float64) {
+	_, _, gamma, _ = c.reverse()
+	return gamma
+}
+
+// Scale returns the point scale factor of the projection at the grid coordinates,
+// the ratio of a small distance on the grid to the corresponding distance on the ellipsoid.
+func (c Coord) Scale() (k float64) {
+	_, _, _, k = c.reverse()
+	return k
+}
+
+// String formats the coordinates as the zone, a hemisphere letter n or s, and the
+// easting and northing rounded to the meter, e.g. "38n 444141 3684706".
+// UPS coordinates omit the zone.
+func (c Coord) String() string {
+	h := "s"
+	if c.North {
+		h = "n"
+	}
+	z := ""
+	if c.Zone != UPS {
+		z = strconv.Itoa(c.Zone)
+	}
+	return fmt.Sprintf("%s%s %.0f %.0f", z, h, math.Floor(c.Easting+0.5), math.Floor(c.Northing+0.5))
+}
+
+// Parse reads UTM or UPS coordinates as written by String.
+//
+// The zone and hemisphere may be separated by a space, and the fields by commas.
+// The hemisphere is given by n or s in either case; as in MGRS the hemisphere may
+// instead be given by a latitude band letter C-M (south) or P-X (north), but note
+// that S then means the southern hemisphere and not band S.
+// UPS coordinates are given without a zone or with zone 0.
+func Parse(inp string) (c Coord, err error) {
+	fs := strings.Fields(strings.ReplaceAll(inp, ",", " "))
+	if len(fs) == 4 {
+		fs = []string{fs[0] + fs[1], fs[2], fs[3]}
+	}
+	if len(fs) != 3 {
+		return Coord{}, fmt.Errorf("%s is not in the format ZZh EEEEEE NNNNNNN", inp)
+	}
+
+	zh := fs[0]
+	i := strings.IndexFunc(zh, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 || i != len(zh)-1 {
+		return Coord{}, fmt.Errorf("%s is not a zone and hemisphere", zh)
+	}
+	if i > 0 {
+		if c.Zone, err = strconv.Atoi(zh[:i]); err != nil {
+			return Coord{}, err
+		}
+	}
+	switch h := strings.ToUpper(zh[i:]); {
+	case h == "N":
+		c.North = true
+	case h == "S":
+		c.North = false
+	case strings.Contains(latBands, h):
+		c.North = strings.Index(latBands, h) >= 10
+	default:
+		return Coord{}, fmt.Errorf("%s is not a valid hemisphere or latitude band", h)
+	}
+
+	if c.Easting, err = strconv.ParseFloat(fs[1], 64); err != nil {
+		return Coord{}, fmt.Errorf("bad easting %s", fs[1])
+	}
+	if c.Northing, err = strconv.ParseFloat(fs[2], 64); err != nil {
+		return Coord{}, fmt.Errorf("bad northing %s", fs[2])
+	}
+	if err = c.check(); err != nil {
+		return Coord{}, err
+	}
+	return c, nil
+}
+
+// GridVariation returns the grid variation, the angle from grid north to magnetic
+// north in degrees, for the magnetic declination decl in degrees at the Location.
+// Grid north is that of the Location's standard UTM zone, or of the UPS grid in the
+// polar regions.
+//
+// wmm.MagneticField.GV approximates the polar grid by the UPS grid everywhere poleward
+// of 55° and reports the declination elsewhere, following the NOAA software; this
+// function uses the grid that applies at the Location.
+func GridVariation(decl float64, l egm96.Location) (gv float64, err error) {
+	c, err := NewCoord(l)
+	if err != nil {
+		return 0, err
+	}
+	return angNormalize(decl - c.Convergence()), nil
+}
+
+// check returns an error if the grid coordinates are outside the valid range for the zone.
+func (c Coord) check() (err error) {
+	if c.Zone == UPS {
+		// UPS covers up to about 10° from the pole
+		if c.Easting < 0 || c.Easting > 2*upsFalse || c.Northing < 0 || c.Northing > 2*upsFalse {
+			return fmt.Errorf("UPS coordinates %.0f %.0f out of range", c.Easting, c.Northing)
+		}
+		return nil
+	}
+	if c.Zone < 1 || c.Zone > 60 {
+		return fmt.Errorf("invalid UTM zone %d", c.Zone)
+	}
+	if c.Easting < 0 || c.Easting > utmMaxEasting {
+		return fmt.Errorf("UTM easting %.0f out of range", c.Easting)
+	}
+	if (c.North && (c.Northing < 0 || c.Northing > 9.6e6)) ||
+		(!c.North && (c.Northing < 0.9e6 || c.Northing > falseNorthing)) {
+		return fmt.Errorf("UTM northing %.0f out of range", c.Northing)
+	}
+	return nil
+}
+
+// reverse returns the latitude and longitude in degrees, the convergence in degrees
+// and the point scale at the grid coordinates.
+func (c Coord) reverse() (lat, lng, gamma, k float64) {
+	if c.Zone == UPS {
+		return ps.reverse(c.North, c.Easting-upsFalse, c.Northing-upsFalse)
+	}
+	y := c.Northing
+	if !c.North {
+		y -= falseNorthing
+	}
+	return tm.reverse(centralMeridian(c.Zone), c.Easting-falseEasting, y)
+}
+
+// centralMeridian returns the longitude of the central meridian of a UTM zone in degrees.
+func centralMeridian(zone int) (lon0 float64) {
+	return float64(6*zone - 183)
+}
+
+// latLngDegrees returns the latitude and longitude of l in degrees,
+// clamping the latitude so that round-off can't push a pole out of range.
+func latLngDegrees(l egm96.Location) (lat, lng float64) {
+	lat, lng, _ = l.Geodetic()
+	return math.Max(-90, math.Min(90, lat/egm96.Deg)), angNormalize(lng / egm96.Deg)
+}
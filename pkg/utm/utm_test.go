@@ -0,0 +1,148 @@
+package utm
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func testDiff(name string, actual, expected float64, eps float64, t *testing.T) {
+	if actual-expected >= -eps && actual-expected <= eps {
+		t.Logf("%s correct: expected %8.6f, got %8.6f", name, expected, actual)
+		return
+	}
+	t.Errorf("%s incorrect: expected %8.6f, got %8.6f", name, expected, actual)
+}
+
+func TestForward(t *testing.T) {
+	// Reference values from GeographicLib's GeoConvert, Snyder's series and the exact
+	// polar stereographic formulas (USGS Professional Paper 1395)
+	lats := []float64{33.3, 43.642567, 0, -33.856, 90, -90, 85, 60.5}
+	lngs := []float64{44.4, -79.387139, 3, 151.215, 0, 0, 100, 5}
+	zones := []int{38, 17, 31, 56, UPS, UPS, UPS, 32}
+	norths := []bool{true, true, true, false, true, false, true, true}
+	es := []float64{444140.54, 630084.30, 500000, 334871.27, 2000000, 2000000, 2547018.75, 280356.45}
+	ns := []float64{3684706.36, 4833438.59, 0, 6252376.99, 2000000, 2000000, 2096454.16, 6713774.23}
+
+	for i := range lats {
+		l := egm96.NewLocationGeodetic(lats[i], lngs[i], 0)
+		c, err := NewCoord(l)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		name := fmt.Sprintf("%6.2f %7.2f", lats[i], lngs[i])
+		if c.Zone != zones[i] || c.North != norths[i] {
+			t.Errorf("%s: expected zone %d north %t, got %d %t", name, zones[i], norths[i], c.Zone, c.North)
+		}
+		testDiff(name+" easting", c.Easting, es[i], 0.01, t)
+		testDiff(name+" northing", c.Northing, ns[i], 0.01, t)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for lat := -89.5; lat < 90; lat += 7.25 {
+		for lng := -179.5; lng < 180; lng += 11.3 {
+			l := egm96.NewLocationGeodetic(lat, lng, 0)
+			c, err := NewCoord(l)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			lat2, lng2 := latLngDegrees(c.Location())
+			if math.Abs(lat2-lat) > 1e-9 || math.Abs(angNormalize(lng2-lng)) > 1e-9 {
+				t.Errorf("round trip of %5.2f %6.2f via %s gave %5.2f %6.2f", lat, lng, c, lat2, lng2)
+			}
+		}
+	}
+}
+
+func TestZones(t *testing.T) {
+	lats := []float64{0, 0, 0, 59, 59, 78, 78, 78, 78, 84, -80.1, 83.9}
+	lngs := []float64{-180, 179.9, 180, 2.9, 3, 8, 9, 21, 33, 0, 0, 0}
+	zones := []int{1, 60, 1, 31, 32, 31, 33, 35, 37, UPS, UPS, 31}
+
+	for i := range lats {
+		z := StandardZone(egm96.NewLocationGeodetic(lats[i], lngs[i], 0))
+		if z != zones[i] {
+			t.Errorf("zone at %5.1f %6.1f: expected %d, got %d", lats[i], lngs[i], zones[i], z)
+		}
+	}
+
+	// A neighboring zone may be forced near a zone boundary, but not far from it
+	l := egm96.NewLocationGeodetic(45, 11.9, 0)
+	if _, err := NewCoordZone(l, 33); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewCoordZone(l, 40); err == nil {
+		t.Error("NewCoordZone should fail far from the zone")
+	}
+	if _, err := NewCoordZone(l, UPS); err == nil {
+		t.Error("NewCoordZone should fail for UPS at mid latitudes")
+	}
+	if _, err := NewCoordZone(l, 61); err == nil {
+		t.Error("NewCoordZone should fail for an invalid zone")
+	}
+}
+
+func TestConvergenceScale(t *testing.T) {
+	// On the central meridian grid north is true north and the scale is k0
+	c, _ := NewCoord(egm96.NewLocationGeodetic(40, 3, 0))
+	testDiff("central meridian convergence", c.Convergence(), 0, 1e-9, t)
+	testDiff("central meridian scale", c.Scale(), utmK0, 1e-9, t)
+
+	// Off the central meridian, approximately the spherical values
+	lat, dlng := 45.0, 2.5
+	c, _ = NewCoord(egm96.NewLocationGeodetic(lat, 3+dlng, 0))
+	gamma := math.Atan(math.Tan(dlng*egm96.Deg)*math.Sin(lat*egm96.Deg)) / egm96.Deg
+	testDiff("convergence", c.Convergence(), gamma, 0.001, t)
+	b := math.Cos(lat*egm96.Deg) * math.Sin(dlng*egm96.Deg)
+	testDiff("scale", c.Scale(), utmK0/math.Sqrt(1-b*b), 1e-5, t)
+
+	// UPS grid north is along the 180° meridian in the north and 0° in the south
+	c, _ = NewCoord(egm96.NewLocationGeodetic(88, 40, 0))
+	testDiff("UPS north convergence", c.Convergence(), 40, 1e-9, t)
+	c, _ = NewCoord(egm96.NewLocationGeodetic(-88, 40, 0))
+	testDiff("UPS south convergence", c.Convergence(), -40, 1e-9, t)
+	c, _ = NewCoord(egm96.NewLocationGeodetic(90, 0, 0))
+	testDiff("UPS pole scale", c.Scale(), upsK0, 1e-9, t)
+}
+
+func TestGridVariation(t *testing.T) {
+	// In the polar regions this matches the NOAA grid variation
+	gv, _ := GridVariation(10, egm96.NewLocationGeodetic(87, 30, 0))
+	testDiff("UPS north GV", gv, -20, 1e-9, t)
+	gv, _ = GridVariation(10, egm96.NewLocationGeodetic(-85, 30, 0))
+	testDiff("UPS south GV", gv, 40, 1e-9, t)
+	gv, _ = GridVariation(10, egm96.NewLocationGeodetic(40, 3, 0))
+	testDiff("UTM central meridian GV", gv, 10, 1e-9, t)
+}
+
+func TestParse(t *testing.T) {
+	inps := []string{"38n 444141 3684706", "38N,444141,3684706", "38 S 444141 6315294",
+		"17T 630084 4833439", "n 2000000 2000000", "0s 2000000 2000000"}
+	cs := []Coord{{38, true, 444141, 3684706}, {38, true, 444141, 3684706}, {38, false, 444141, 6315294},
+		{17, true, 630084, 4833439}, {UPS, true, 2000000, 2000000}, {UPS, false, 2000000, 2000000}}
+	for i, inp := range inps {
+		c, err := Parse(inp)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if c != cs[i] {
+			t.Errorf("Parse(%s): expected %v, got %v", inp, cs[i], c)
+		}
+	}
+	if s := cs[0].String(); s != inps[0] {
+		t.Errorf("String: expected %s, got %s", inps[0], s)
+	}
+
+	for _, inp := range []string{"38n 444141", "38 444141 3684706", "38I 444141 3684706", "61n 444141 3684706",
+		"38n 1444141 3684706", "38n 444141 -5", "n 5000000 2000000", "38n abc 3684706"} {
+		if _, err := Parse(inp); err == nil {
+			t.Errorf("Parse incorrectly thought it could parse %s", inp)
+		}
+	}
+}
@@ -16,40 +16,92 @@ const (
 )
 
 var (
-	Epoch     DecimalYear // The Epoch of the loaded coefficients file, e.g. 2015.0
-	COFName   string      // The filename of the loaded COF file
-	ValidDate time.Time   // The beginning valid date of the loaded COF file
-	cGnm      [][]float64
-	cHnm      [][]float64
-	cDGnm     [][]float64
-	cDHnm     [][]float64
+	Epoch     DecimalYear   // The Epoch of the loaded coefficients file, e.g. 2015.0
+	COFName   string        // The filename of the loaded COF file
+	ValidDate time.Time     // The beginning valid date of the loaded COF file
+	coef      *coefficients // The loaded coefficients, guarded by cacheMu
 )
 
+// coefficients are the spherical harmonic coefficients of a model and their
+// rates of change, which are loaded and replaced together.
+type coefficients struct {
+	epoch      DecimalYear
+	name       string
+	validDate  time.Time
+	nMax       int // Highest degree of the coefficients
+	gnm, hnm   [][]float64
+	dgnm, dhnm [][]float64
+}
+
+// newCoefficients returns zero coefficients up to degree nMax.
+func newCoefficients(nMax int) (c *coefficients) {
+	c = &coefficients{nMax: nMax}
+	c.gnm, c.hnm = make([][]float64, nMax+1), make([][]float64, nMax+1)
+	c.dgnm, c.dhnm = make([][]float64, nMax+1), make([][]float64, nMax+1)
+	for n := range c.gnm {
+		c.gnm[n], c.hnm[n] = make([]float64, n+1), make([]float64, n+1)
+		c.dgnm[n], c.dhnm[n] = make([]float64, n+1), make([]float64, n+1)
+	}
+	return c
+}
+
+// setCoefficients makes c the loaded coefficients and discards the cached field.
+func setCoefficients(c *coefficients) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	coef, curValid = c, false
+	Epoch, COFName, ValidDate = c.epoch, c.name, c.validDate
+}
+
+// loadedCoefficients returns the loaded coefficients, loading the default
+// coefficients file if none are.
+func loadedCoefficients() (c *coefficients) {
+	cacheMu.Lock()
+	c = coef
+	cacheMu.Unlock()
+	if c==nil {
+		_ = LoadWMMCOF("")
+		cacheMu.Lock()
+		c = coef
+		cacheMu.Unlock()
+	}
+	return c
+}
+
+// checkValid returns an error if the time t is outside the validity period of the coefficients.
+func (c *coefficients) checkValid(t time.Time) (err error) {
+	if t.Before(c.validDate) || TimeToDecimalYears(t)>c.epoch+5 {
+		return fmt.Errorf("requested date %v is outside of validity period beginning %v of WMM.COF file",
+			t, c.validDate)
+	}
+	return nil
+}
+
 // GetWMMCoefficients calculates the spherical harmonic coefficients G(n,m), H(n,m)
 // and their rates of change dG(n,m), dH(n,m) at the input time.
 //
 // If the request n,m are invalid or the requested time is outside of the range
 // of validity of the loaded coefficients file, it will return an error.
 func GetWMMCoefficients(n, m int, t time.Time) (gnm, hnm, dgnm, dhnm float64, err error) {
-	if Epoch==0 {
-		_ = LoadWMMCOF("")
-	}
-	if n<0 || n>MaxLegendreOrder || m<0 || m>MaxLegendreOrder {
+	return loadedCoefficients().at(n, m, t)
+}
+
+// at calculates the coefficients G(n,m), H(n,m), dG(n,m) and dH(n,m) at the time t,
+// as for GetWMMCoefficients.
+func (c *coefficients) at(n, m int, t time.Time) (gnm, hnm, dgnm, dhnm float64, err error) {
+	if n<0 || n>c.nMax || m<0 || m>c.nMax {
 		return 0, 0, 0, 0, fmt.Errorf("n, m = (%d,%d) must be between 0 and %d",
-			n, m, MaxLegendreOrder)
+			n, m, c.nMax)
 	}
 	if m>n {
 		return 0, 0, 0, 0, fmt.Errorf("m=%d must be less than n=%d", m, n)
 	}
-	if t.Sub(ValidDate) < 0 || TimeToDecimalYears(t)>Epoch+5 {
-		err = fmt.Errorf("requested date %v is outside of validity period beginning %v of WMM.COF file",
-				t, ValidDate)
-	}
-	dt := float64(TimeToDecimalYears(t)- Epoch)
-	gnm = cGnm[n][m] + dt*cDGnm[n][m]
-	hnm = cHnm[n][m] + dt*cDHnm[n][m]
-	dgnm = cDGnm[n][m]
-	dhnm = cDHnm[n][m]
+	err = c.checkValid(t)
+	dt := float64(TimeToDecimalYears(t)- c.epoch)
+	gnm = c.gnm[n][m] + dt*c.dgnm[n][m]
+	hnm = c.hnm[n][m] + dt*c.dhnm[n][m]
+	dgnm = c.dgnm[n][m]
+	dhnm = c.dhnm[n][m]
 	return gnm, hnm, dgnm, dhnm, err
 }
 
@@ -58,6 +110,11 @@ func GetWMMCoefficients(n, m int, t time.Time) (gnm, hnm, dgnm, dhnm float64, er
 // It populates the internal coefficient values representing G(n,m), H(n,m), DG(n,m), DH(n,m),
 // Epoch, COFName, and ValidDate.
 // If the passed filename is "", it loads the default (current) coefficients file.
+// The field cached by CalculateWMMMagneticField is discarded, so several files
+// may be loaded in turn to compare or chain models.  The coefficients are
+// replaced together once the whole file has been read, so a file with errors
+// leaves the previous coefficients loaded, and fields being calculated in other
+// goroutines use either the previous coefficients or the new ones throughout.
 //
 // The default coefficients file is currently WMM2020.COF, valid from
 // 12/10/2019 until 12/31/2024.
@@ -77,6 +134,7 @@ func LoadWMMCOF(fn string) (err error) {
 		return err
 	}
 
+	c := newCoefficients(MaxLegendreOrder)
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	// Read and parse header
 	if !scanner.Scan() {
@@ -86,51 +144,34 @@ func LoadWMMCOF(fn string) (err error) {
 	if epoch, err = strconv.ParseFloat(dat[0], 64); err != nil {
 		return fmt.Errorf("bad header epoch date in WMM coefficient file %s", fn)
 	}
-	Epoch = DecimalYear(epoch)
-	COFName = dat[1]
-	if ValidDate, err = time.Parse("01/02/2006", dat[2]); err != nil {
+	c.epoch = DecimalYear(epoch)
+	c.name = dat[1]
+	if c.validDate, err = time.Parse("01/02/2006", dat[2]); err != nil {
 		return fmt.Errorf("bad header valid date in WMM coefficient file %s", fn)
 	}
 
-	cGnm = make([][]float64, MaxLegendreOrder+1)
-	cGnm[0] = []float64{0}
-	cHnm = make([][]float64, MaxLegendreOrder+1)
-	cHnm[0] = []float64{0}
-	cDGnm = make([][]float64, MaxLegendreOrder+1)
-	cDGnm[0] = []float64{0}
-	cDHnm = make([][]float64, MaxLegendreOrder+1)
-	cDHnm[0] = []float64{0}
-
 	// Read and parse testdata
-	curN := 0
 	for scanner.Scan() {
 		s := strings.Fields(scanner.Text())
 		if len(s)<6 {
 			continue
 		}
-		if n, err = strconv.Atoi(s[0]); err!=nil {
+		if n, err = strconv.Atoi(s[0]); err!=nil || n<1 || n>MaxLegendreOrder {
 			return fmt.Errorf("bad n value in WMM coefficient file %s", fn)
 		}
-		if m, err = strconv.Atoi(s[1]); err!=nil {
+		if m, err = strconv.Atoi(s[1]); err!=nil || m<0 || m>n {
 			return fmt.Errorf("bad m value in WMM coefficient file %s", fn)
 		}
-		if n>curN {
-			cGnm[n] = make([]float64, n+1)
-			cHnm[n] = make([]float64, n+1)
-			cDGnm[n] = make([]float64, n+1)
-			cDHnm[n] = make([]float64, n+1)
-			curN = n
-		}
-		if cGnm[n][m], err = strconv.ParseFloat(s[2], 64); err != nil {
+		if c.gnm[n][m], err = strconv.ParseFloat(s[2], 64); err != nil {
 			return fmt.Errorf("bad Gnm value in WMM coefficient file %s", fn)
 		}
-		if cHnm[n][m], err = strconv.ParseFloat(s[3], 64); err != nil {
+		if c.hnm[n][m], err = strconv.ParseFloat(s[3], 64); err != nil {
 			return fmt.Errorf("bad Hnm value in WMM coefficient file %s", fn)
 		}
-		if cDGnm[n][m], err = strconv.ParseFloat(s[4], 64); err != nil {
+		if c.dgnm[n][m], err = strconv.ParseFloat(s[4], 64); err != nil {
 			return fmt.Errorf("bad DGnm value in WMM coefficient file %s", fn)
 		}
-		if cDHnm[n][m], err = strconv.ParseFloat(s[5], 64); err != nil {
+		if c.dhnm[n][m], err = strconv.ParseFloat(s[5], 64); err != nil {
 			return fmt.Errorf("bad DHnm value in WMM coefficient file %s", fn)
 		}
 	}
@@ -138,5 +179,6 @@ func LoadWMMCOF(fn string) (err error) {
 	if err := scanner.Err(); err != nil {
 		return err
 	}
+	setCoefficients(c)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,112 @@
+package wmm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIGRFDegree is the highest degree of the IGRF coefficients.
+const maxIGRFDegree = 13
+
+// LoadIGRF loads the coefficients of the International Geomagnetic Reference
+// Field for the five-year interval containing the time t from the IGRF
+// coefficients table in the file fn, for dates before the WMM is valid.
+//
+// The table is in the format distributed by IAGA, e.g. igrf13coeffs.txt: a line
+//  g/h n m 1900.0 1905.0 ... 2020.0 2020-25
+// naming the epochs of the models and a final secular variation column, followed by a line
+//  g 1 0 -31543 -31464 ... -29404.8 5.7
+// for each coefficient.  Lines starting with # are comments.
+//
+// The IGRF coefficients vary linearly between epochs, so the coefficients at
+// the beginning of the interval and their rates of change over it are loaded
+// as for a WMM coefficients file, setting Epoch and ValidDate to the beginning
+// of the interval and COFName to IGRF.  After the last epoch the secular
+// variation column is used.  The terms of degrees 11 to 13, present since
+// 2000, are all loaded: together they amount to over 10 nT.
+// The coefficients are replaced together and the field cached by
+// CalculateWMMMagneticField is discarded, as by LoadWMMCOF.
+//
+// An error is returned if t is before the first epoch of the table.
+func LoadIGRF(fn string, t time.Time) (err error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	var (
+		epochs []float64
+		c      = newCoefficients(maxIGRFDegree)
+		i      = -1 // The interval of t
+	)
+	y := float64(TimeToDecimalYears(t))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s)==0 || strings.HasPrefix(s[0], "#") {
+			continue
+		}
+		if s[0]=="g/h" {
+			for _, e := range s[3:len(s)-1] {
+				epoch, err := strconv.ParseFloat(e, 64)
+				if err!=nil {
+					return fmt.Errorf("bad epoch %s in IGRF coefficient file %s", e, fn)
+				}
+				epochs = append(epochs, epoch)
+			}
+			if len(epochs)==0 || y<epochs[0] {
+				return fmt.Errorf("requested date %v is before the first epoch of IGRF coefficient file %s", t, fn)
+			}
+			for i = 0; i<len(epochs)-1 && y>=epochs[i+1]; i++ {
+			}
+			continue
+		}
+		if s[0]!="g" && s[0]!="h" {
+			continue
+		}
+		if i<0 {
+			return fmt.Errorf("missing g/h header line in IGRF coefficient file %s", fn)
+		}
+		if len(s)!=len(epochs)+4 {
+			return fmt.Errorf("expected %d values for each coefficient in IGRF coefficient file %s",
+				len(epochs)+1, fn)
+		}
+		n, errN := strconv.Atoi(s[1])
+		m, errM := strconv.Atoi(s[2])
+		if errN!=nil || errM!=nil || n<1 || n>maxIGRFDegree || m<0 || m>n {
+			return fmt.Errorf("bad n, m values %s, %s in IGRF coefficient file %s", s[1], s[2], fn)
+		}
+		var v, dv float64
+		if v, err = strconv.ParseFloat(s[3+i], 64); err!=nil {
+			return fmt.Errorf("bad %snm value in IGRF coefficient file %s", strings.ToUpper(s[0]), fn)
+		}
+		if dv, err = strconv.ParseFloat(s[4+i], 64); err!=nil {
+			return fmt.Errorf("bad %snm value in IGRF coefficient file %s", strings.ToUpper(s[0]), fn)
+		}
+		if i<len(epochs)-1 {
+			dv = (dv-v)/(epochs[i+1]-epochs[i])
+		}
+		if s[0]=="g" {
+			c.gnm[n][m], c.dgnm[n][m] = v, dv
+		} else {
+			c.hnm[n][m], c.dhnm[n][m] = v, dv
+		}
+	}
+	if err = scanner.Err(); err!=nil {
+		return err
+	}
+	if i<0 {
+		return fmt.Errorf("missing g/h header line in IGRF coefficient file %s", fn)
+	}
+
+	c.epoch = DecimalYear(epochs[i])
+	c.name = "IGRF"
+	c.validDate = c.epoch.ToTime()
+	setCoefficients(c)
+	return nil
+}
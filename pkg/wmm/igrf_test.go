@@ -0,0 +1,93 @@
+package wmm
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func TestLoadIGRF(t *testing.T) {
+	// The test table has the WMM2015 and WMM2020 main fields at 2015.0 and 2020.0
+	if err := LoadIGRF("testdata/IGRF_TEST.txt", DecimalYear(2017.5).ToTime()); err != nil {
+		t.Fatal(err)
+	}
+	if Epoch != 2015 || COFName != "IGRF" || !ValidDate.Equal(DecimalYear(2015).ToTime()) {
+		t.Errorf("unexpected model %s %v valid from %v", COFName, Epoch, ValidDate)
+	}
+	g, _, dg, _, err := GetWMMCoefficients(1, 0, DecimalYear(2017.5).ToTime())
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	testDiff("G(1,0) between epochs", g, (-29438.5-29404.5)/2, eps, t)
+	testDiff("DG(1,0) between epochs", dg, (-29404.5+29438.5)/5, eps, t)
+	_, h, _, dh, _ := GetWMMCoefficients(2, 2, DecimalYear(2015).ToTime())
+	testDiff("H(2,2) at the epoch", h, -642.0, eps, t)
+	testDiff("DH(2,2) between epochs", dh, (-734.8-h)/5, eps, t)
+
+	// After the last epoch it is the WMM2020 model, secular variation and all
+	ts := DecimalYear(2022.25).ToTime()
+	if err = LoadIGRF("testdata/IGRF_TEST.txt", ts); err != nil {
+		t.Fatal(err)
+	}
+	loc := egm96.NewLocationGeodetic(-45, 170, 2000)
+	igrf, err := CalculateWMMMagneticField(loc, ts)
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	mf, _ := CalculateWMMMagneticField(loc, ts)
+	testDiff("D after the last epoch", igrf.D(), mf.D(), 1e-9, t)
+	testDiff("F after the last epoch", igrf.F(), mf.F(), 1e-6, t)
+	testDiff("dD after the last epoch", igrf.DD(), mf.DD(), 1e-9, t)
+
+	if err = LoadIGRF("testdata/IGRF_TEST.txt", time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("expected an error for a date before the first epoch")
+	}
+	if err = LoadIGRF("testdata/WMM2020.COF", ts); err == nil {
+		t.Error("expected an error for a file that is not an IGRF table")
+	}
+	if COFName != "WMM-2020" {
+		t.Errorf("expected a failed load to leave the model loaded, got %s", COFName)
+	}
+}
+
+func TestLoadIGRFTable(t *testing.T) {
+	// Values from the IGRF reference program in the 1920, 1965 and 1995 intervals,
+	// from the testdata of github.com/proway2/go-igrf; see testdata/README.md.
+	tests := []struct {
+		lat, lng, h   float64 // Degrees and km above the ellipsoid
+		date, d, i, f float64 // Decimal year, degrees and nT
+	}{
+		{59.9, -109.9, 1.1, 1921.5, 31.77, 82.27, 62150},
+		{59.9, -109.9, 1.1, 1965.5, 26.18, 81.73, 60913},
+		{59.9, -109.9, 1.1, 1995.5, 20.57, 81.07, 60251},
+		{59.9, 39.9, 0, 1921.5, 7.54, 71.76, 50779},
+		{59.9, 39.9, 0, 1965.5, 10.76, 73.28, 52197},
+		{59.9, 39.9, 0, 1995.5, 11.25, 73.64, 52743},
+		{-59.9, -39.9, -0.5, 1921.5, -0.31, -53.91, 40685},
+		{-59.9, -39.9, -0.5, 1995.5, -1.27, -55.52, 32961},
+		{-59.9, 146.9, 5.5, 1921.5, 11.12, -83.35, 67834},
+		{-59.9, 146.9, 5.5, 1965.5, 26.61, -84.42, 67833},
+	}
+	defer func() { _ = LoadWMMCOF("") }()
+	for _, tt := range tests {
+		ts := DecimalYear(tt.date).ToTime()
+		if err := LoadIGRF("testdata/igrf14coeffs.txt", ts); err != nil {
+			t.Fatal(err)
+		}
+		if start := 5*math.Floor(tt.date/5); Epoch != DecimalYear(start) {
+			t.Errorf("expected the interval starting at %v, got %v", start, Epoch)
+		}
+		mf, err := CalculateWMMMagneticField(egm96.NewLocationGeodetic(tt.lat, tt.lng, tt.h*1000), ts)
+		if err != nil {
+			t.Errorf("unexpected error %s", err)
+		}
+		name := fmt.Sprintf("(%.1f, %.1f) at %.1f", tt.lat, tt.lng, tt.date)
+		testDiff(name+" D", mf.D(), tt.d, 0.01, t)
+		testDiff(name+" I", mf.I(), tt.i, 0.01, t)
+		testDiff(name+" F", mf.F(), tt.f, 1, t)
+	}
+}
@@ -16,6 +16,7 @@ package wmm
 
 import (
 	"math"
+	"sync"
 	"time"
 
 	"github.com/westphae/geomag/pkg/egm96"
@@ -41,6 +42,11 @@ type MagneticField struct {
 	dx, dy, dz float64
 }
 
+// Location returns the location at which the magnetic field was calculated.
+func (m MagneticField) Location() (loc egm96.Location) {
+	return m.l
+}
+
 // Ellipsoidal returns the magnetic field in ellipsoidal coordinate axes.
 //
 // The Ellipsoidal axes are the most commonly desired axes, in which the
@@ -72,6 +78,35 @@ func (m MagneticField) Spherical() (x, y, z, dx, dy, dz float64) {
 	return m.x, m.y, m.z, m.dx, m.dy, m.dz
 }
 
+// NED returns the magnetic field in the local North-East-Down frame at its location,
+// with the horizontal axes parallel to the WGS84 ellipsoid.
+// These are the same as the Ellipsoidal axes.
+//
+// Field strengths are in nT and field strength changes in nT/Year.
+func (m MagneticField) NED() (n, e, d, dn, de, dd float64) {
+	return m.Ellipsoidal()
+}
+
+// ENU returns the magnetic field in the local East-North-Up frame at its location,
+// with the horizontal axes parallel to the WGS84 ellipsoid.
+//
+// Field strengths are in nT and field strength changes in nT/Year.
+func (m MagneticField) ENU() (e, n, u, de, dn, du float64) {
+	n, e, d, dn, de, dd := m.Ellipsoidal()
+	return e, n, -d, de, dn, -dd
+}
+
+// ECEF returns the magnetic field in Earth-Centered, Earth-Fixed axes.
+//
+// Field strengths are in nT and field strength changes in nT/Year.
+func (m MagneticField) ECEF() (x, y, z, dx, dy, dz float64) {
+	r := m.l.ECEFToNED().Inverse()
+	n, e, d, dn, de, dd := m.Ellipsoidal()
+	x, y, z = r.Apply(n, e, d)
+	dx, dy, dz = r.Apply(dn, de, dd)
+	return x, y, z, dx, dy, dz
+}
+
 // H returns the strength of the magnetic field in the horizontal
 // direction, i.e. the component parallel to the WGS84 ellipsoid.
 //
@@ -231,6 +266,8 @@ func (m MagneticField) ErrD() (f float64) {
 }
 
 var (
+	cacheMu  sync.Mutex     // Guards coef, curValid, curLoc and curField
+	curValid bool           // Whether curField is the field at curLoc for the loaded coefficients
 	curLoc   egm96.Location // Spherical
 	curField MagneticField
 )
@@ -249,58 +286,100 @@ func init() {
 // coefficients. The function will still return the calculated field in these
 // cases.  The error is informational.
 //
-// This function caches the WMM coefficients for computational speed.
-// TODO: implement this and check the description is correct. Use benchmarking
-// It also caches intermediate computational steps for speed in looping over
-// locations.
-// The innermost loop should be over time, followed in order by height,
-// latitude, and finally longitude.
+// This function caches the field at the last location for computational speed,
+// so the innermost loop should be over time.
+// It is safe to call from multiple goroutines, also while coefficients are
+// being loaded, although the cache is then shared between them and each call
+// holds it while the field is calculated.
 //
 // See the description of LoadWMMCOF for the validity period of the
 // default (current) coefficients file.
 func CalculateWMMMagneticField(loc egm96.Location, t time.Time) (field MagneticField, err error) {
 	// TODO: give an err if height<-1000m or height>850000m.
-	if !loc.Equals(curLoc) {
-		curLoc = loc
-		curField = *new(MagneticField)
-		phi, lambda, hh := loc.Spherical()
-		sinPhi := math.Sin(phi)
-		cosPhi := math.Cos(phi)
-		var g, h, dg, dh float64
-		for n:=1; n<=MaxLegendreOrder; n++ {
-			nn := float64(n+1)
-			// if height varies, recalculate from here
-			f := polynomial.Pow(AGeo/hh, n+2)
-			for m:=0; m<=n; m++ {
-				mf := float64(m)
-				// if latitude varies, recalculate from here
-				p := polynomial.LegendreFunction(n, m, sinPhi)
-				q := polynomial.LegendreFunction(n+1, m, sinPhi)
-				if m>0 {
-					p *= math.Sqrt(2/polynomial.FactorialRatioFloat(n+m, n-m))
-					q *= math.Sqrt(2/polynomial.FactorialRatioFloat(n+m, n-m))
-				}
-				dp := nn*math.Tan(phi)*p - (nn-mf)/cosPhi*q
-				g, h, dg, dh, err = GetWMMCoefficients(n, m, ValidDate)
-				// if longitude varies, recalculate from here
-				sinMLambda := math.Sin(mf*lambda)
-				cosMLambda := math.Cos(mf*lambda)
-				curField.x += -f*(g*cosMLambda+h*sinMLambda)*dp
-				curField.y += f/cosPhi*mf*(g*sinMLambda-h*cosMLambda)*p
-				curField.z += -nn*f*(g*cosMLambda+h*sinMLambda)*p
-				curField.dx += -f*(dg*cosMLambda+dh*sinMLambda)*dp
-				curField.dy += f/cosPhi*mf*(dg*sinMLambda-dh*cosMLambda)*p
-				curField.dz += -nn*f*(dg*cosMLambda+dh*sinMLambda)*p
+	_ = loadedCoefficients()
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	c := coef
+	if !curValid || !loc.Equals(curLoc) {
+		curValid, curLoc = true, loc
+		curField, err = sphericalHarmonicField(c, loc)
+	}
+	if err==nil {
+		err = c.checkValid(t)
+	}
+	return curField.extrapolate(loc, t, c.validDate), err
+}
+
+// CalculateWMMMagneticFieldSeries returns the magnetic field at a single
+// location for each of the times ts, as CalculateWMMMagneticField would.
+//
+// The spherical harmonic terms at the location are evaluated only once, and the
+// field at each time is extrapolated from them with the secular variation.
+// Unlike CalculateWMMMagneticField it does not use or change the cache, so it
+// is not slowed by calculations for other locations in other goroutines.
+//
+// The error is informational as for CalculateWMMMagneticField, and reports the
+// first time outside the validity period of the loaded coefficients, if any.
+// The fields are returned for all the times regardless.
+func CalculateWMMMagneticFieldSeries(loc egm96.Location, ts []time.Time) (fields []MagneticField, err error) {
+	c := loadedCoefficients()
+	base, err := sphericalHarmonicField(c, loc)
+	fields = make([]MagneticField, len(ts))
+	for i, t := range ts {
+		if err==nil {
+			err = c.checkValid(t)
+		}
+		fields[i] = base.extrapolate(loc, t, c.validDate)
+	}
+	return fields, err
+}
+
+// sphericalHarmonicField sums the spherical harmonic expansion of the
+// coefficients c at loc, returning the main field at their valid date and its
+// secular variation.
+func sphericalHarmonicField(c *coefficients, loc egm96.Location) (field MagneticField, err error) {
+	phi, lambda, hh := loc.Spherical()
+	sinPhi := math.Sin(phi)
+	cosPhi := math.Cos(phi)
+	var g, h, dg, dh float64
+	for n:=1; n<=c.nMax; n++ {
+		nn := float64(n+1)
+		// if height varies, recalculate from here
+		f := polynomial.Pow(AGeo/hh, n+2)
+		for m:=0; m<=n; m++ {
+			mf := float64(m)
+			// if latitude varies, recalculate from here
+			p := polynomial.LegendreFunction(n, m, sinPhi)
+			q := polynomial.LegendreFunction(n+1, m, sinPhi)
+			if m>0 {
+				p *= math.Sqrt(2/polynomial.FactorialRatioFloat(n+m, n-m))
+				q *= math.Sqrt(2/polynomial.FactorialRatioFloat(n+m, n-m))
 			}
+			dp := nn*math.Tan(phi)*p - (nn-mf)/cosPhi*q
+			g, h, dg, dh, err = c.at(n, m, c.validDate)
+			// if longitude varies, recalculate from here
+			sinMLambda := math.Sin(mf*lambda)
+			cosMLambda := math.Cos(mf*lambda)
+			field.x += -f*(g*cosMLambda+h*sinMLambda)*dp
+			field.y += f/cosPhi*mf*(g*sinMLambda-h*cosMLambda)*p
+			field.z += -nn*f*(g*cosMLambda+h*sinMLambda)*p
+			field.dx += -f*(dg*cosMLambda+dh*sinMLambda)*dp
+			field.dy += f/cosPhi*mf*(dg*sinMLambda-dh*cosMLambda)*p
+			field.dz += -nn*f*(dg*cosMLambda+dh*sinMLambda)*p
 		}
 	}
-	dt := float64(TimeToDecimalYears(t) - TimeToDecimalYears(ValidDate))
-	field.l = loc
-	field.x = curField.x + dt*curField.dx
-	field.y = curField.y + dt*curField.dy
-	field.z = curField.z + dt*curField.dz
-	field.dx = curField.dx
-	field.dy = curField.dy
-	field.dz = curField.dz
 	return field, err
+}
+
+// extrapolate returns the field at time t from the field m at the time from and its secular variation.
+func (m MagneticField) extrapolate(loc egm96.Location, t, from time.Time) (field MagneticField) {
+	dt := float64(TimeToDecimalYears(t) - TimeToDecimalYears(from))
+	field.l = loc
+	field.x = m.x + dt*m.dx
+	field.y = m.y + dt*m.dy
+	field.z = m.z + dt*m.dz
+	field.dx = m.dx
+	field.dy = m.dy
+	field.dz = m.dz
+	return field
 }
\ No newline at end of file
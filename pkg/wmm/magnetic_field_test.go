@@ -5,9 +5,12 @@ import (
 	"bufio"
 	"bytes"
 	"io/ioutil"
+	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/westphae/geomag/pkg/egm96"
 )
@@ -339,4 +342,152 @@ func TestAll2020TestValuesFromPaper(t *testing.T) {
 		panic(err)
 	}
 
-}
\ No newline at end of file
+}
+
+func TestMagneticFieldFrames(t *testing.T) {
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	loc := egm96.NewLocationGeodetic(-45, 170, 2000)
+	mag, _ := CalculateWMMMagneticField(loc, DecimalYear(2022.5).ToTime())
+
+	x, _, z, _, _, dz := mag.Ellipsoidal()
+	n, e, d, _, de, dd := mag.NED()
+	testDiff("NED north", n, x, 1e-9, t)
+	testDiff("NED down", d, z, 1e-9, t)
+	testDiff("NED down rate", dd, dz, 1e-9, t)
+	e2, n2, u, de2, _, du := mag.ENU()
+	testDiff("ENU east", e2, e, 1e-9, t)
+	testDiff("ENU north", n2, n, 1e-9, t)
+	testDiff("ENU up", u, -d, 1e-9, t)
+	testDiff("ENU east rate", de2, de, 1e-9, t)
+	testDiff("ENU up rate", du, -dd, 1e-9, t)
+
+	// The ECEF field matches the spherical components rotated at the spherical latitude
+	xc, yc, zc, dxc, dyc, dzc := mag.ECEF()
+	testDiff("ECEF F", math.Sqrt(xc*xc+yc*yc+zc*zc), mag.F(), 1e-6, t)
+	phi, lambda, _ := loc.Spherical()
+	r := egm96.NewLocationGeodetic(phi/egm96.Deg, lambda/egm96.Deg, 0).ECEFToNED().Inverse()
+	xs, ys, zs, dxs, dys, dzs := mag.Spherical()
+	xx, yy, zz := r.Apply(xs, ys, zs)
+	testDiff("ECEF x", xc, xx, 1e-6, t)
+	testDiff("ECEF y", yc, yy, 1e-6, t)
+	testDiff("ECEF z", zc, zz, 1e-6, t)
+	xx, yy, zz = r.Apply(dxs, dys, dzs)
+	testDiff("ECEF x rate", dxc, xx, 1e-6, t)
+	testDiff("ECEF y rate", dyc, yy, 1e-6, t)
+	testDiff("ECEF z rate", dzc, zz, 1e-6, t)
+}
+
+func TestMagneticFieldSeries(t *testing.T) {
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	loc := egm96.NewLocationGeodetic(43, 93, 65000)
+	ts := []time.Time{DecimalYear(2020).ToTime(), DecimalYear(2022.5).ToTime(), DecimalYear(2024.75).ToTime()}
+	fields, err := CalculateWMMMagneticFieldSeries(loc, ts)
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	testDiff("D 2020.0", fields[0].D(), 0.71, 0.005, t)
+	testDiff("F 2020.0", fields[0].F(), 55348.7, 0.05, t)
+	for i, tt := range ts {
+		mf, _ := CalculateWMMMagneticField(loc, tt)
+		testDiff("series D", fields[i].D(), mf.D(), 1e-9, t)
+		testDiff("series dD", fields[i].DD(), mf.DD(), 1e-9, t)
+		testDiff("series F", fields[i].F(), mf.F(), 1e-9, t)
+	}
+
+	if _, err = CalculateWMMMagneticFieldSeries(loc, []time.Time{DecimalYear(2026).ToTime()}); err == nil {
+		t.Error("expected an error for a date outside the validity period")
+	}
+}
+
+func TestMagneticFieldCache(t *testing.T) {
+	// Loading other coefficients must discard the field cached for the same location
+	loc := egm96.NewLocationGeodetic(43, 93, 65000)
+	_ = LoadWMMCOF("testdata/WMM2015v1.COF")
+	mf2015, _ := CalculateWMMMagneticField(loc, DecimalYear(2017.5).ToTime())
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	mf2020, _ := CalculateWMMMagneticField(loc, DecimalYear(2017.5).ToTime())
+	base, _ := CalculateWMMMagneticFieldSeries(loc, []time.Time{DecimalYear(2017.5).ToTime()})
+	testDiff("field after reloading", mf2020.F(), base[0].F(), 1e-9, t)
+	if math.Abs(mf2020.F()-mf2015.F()) < 1e-6 {
+		t.Error("expected the models to differ")
+	}
+
+	// The zero location is not mistaken for an empty cache
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	mf, _ := CalculateWMMMagneticField(egm96.NewLocationGeodetic(0, 0, 0), DecimalYear(2022).ToTime())
+	if mf.F() == 0 {
+		t.Error("expected a field at latitude 0, longitude 0 and height 0")
+	}
+}
+
+func TestMagneticFieldConcurrent(t *testing.T) {
+	// Fields calculated while coefficients are loaded use one set of coefficients throughout
+	locs := []egm96.Location{egm96.NewLocationGeodetic(43, 93, 65000), egm96.NewLocationGeodetic(-45, 170, 2000)}
+	tt := DecimalYear(2019).ToTime()
+	var expected [2][2]float64
+	for i, fn := range []string{"testdata/WMM2015v1.COF", "testdata/WMM2020.COF"} {
+		_ = LoadWMMCOF(fn)
+		for j, loc := range locs {
+			mf, _ := CalculateWMMMagneticField(loc, tt)
+			expected[i][j] = mf.F()
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+		bad  = make(chan float64, 1)
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				j := (i + w) % 2
+				mf, _ := CalculateWMMMagneticField(locs[j], tt)
+				series, _ := CalculateWMMMagneticFieldSeries(locs[j], []time.Time{tt})
+				for _, f := range []float64{mf.F(), series[0].F()} {
+					if math.Abs(f-expected[0][j]) > 1e-6 && math.Abs(f-expected[1][j]) > 1e-6 {
+						select {
+						case bad <- f:
+						default:
+						}
+					}
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 50; i++ {
+		_ = LoadWMMCOF("testdata/WMM2015v1.COF")
+		_ = LoadWMMCOF("testdata/WMM2020.COF")
+	}
+	close(done)
+	wg.Wait()
+	select {
+	case f := <-bad:
+		t.Errorf("field %.3f matches neither model", f)
+	default:
+	}
+}
+
+func TestMagneticFieldValidity(t *testing.T) {
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	loc := egm96.NewLocationGeodetic(43, 93, 65000)
+	if _, err := CalculateWMMMagneticField(loc, DecimalYear(2022.5).ToTime()); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	for _, y := range []DecimalYear{2019.5, 2025.5} {
+		mf, err := CalculateWMMMagneticField(loc, y.ToTime())
+		series, errSeries := CalculateWMMMagneticFieldSeries(loc, []time.Time{y.ToTime()})
+		if err == nil || errSeries == nil || err.Error() != errSeries.Error() {
+			t.Errorf("expected the same error for %v, got %v and %v", y, err, errSeries)
+		}
+		// The field is still returned
+		testDiff("field outside validity", mf.F(), series[0].F(), 1e-9, t)
+	}
+}
@@ -0,0 +1,82 @@
+package wmm
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+// magneticFieldJSON is the JSON representation of a MagneticField.
+// Vector components are on the ellipsoidal (North-East-Down) axes.
+type magneticFieldJSON struct {
+	Location egm96.Location `json:"location"`
+	X        float64        `json:"x"`
+	Y        float64        `json:"y"`
+	Z        float64        `json:"z"`
+	H        float64        `json:"h"`
+	F        float64        `json:"f"`
+	I        float64        `json:"i"`
+	D        float64        `json:"d"`
+	GV       float64        `json:"gv"`
+	DX       float64        `json:"dx"`
+	DY       float64        `json:"dy"`
+	DZ       float64        `json:"dz"`
+	DH       float64        `json:"dh"`
+	DF       float64        `json:"df"`
+	DI       float64        `json:"di"`
+	DD       float64        `json:"dd"`
+	DGV      float64        `json:"dgv"`
+	ErrX     float64        `json:"err_x"`
+	ErrY     float64        `json:"err_y"`
+	ErrZ     float64        `json:"err_z"`
+	ErrH     float64        `json:"err_h"`
+	ErrF     float64        `json:"err_f"`
+	ErrI     float64        `json:"err_i"`
+	ErrD     float64        `json:"err_d"`
+}
+
+// MarshalJSON encodes the MagneticField as a JSON object holding its location,
+// the ellipsoidal X, Y, Z components and the derived H, F, I, D and GV values,
+// their rates of change prefixed with d, and the uncertainties prefixed with err_.
+//
+// Field strengths are in nT, angles in degrees and rates of change per year,
+// as returned by the corresponding methods.
+func (m MagneticField) MarshalJSON() ([]byte, error) {
+	x, y, z, dx, dy, dz := m.Ellipsoidal()
+	return json.Marshal(magneticFieldJSON{
+		Location: m.l,
+
+		X: x, Y: y, Z: z,
+		H: m.H(), F: m.F(), I: m.I(), D: m.D(), GV: m.GV(m.l),
+		DX: dx, DY: dy, DZ: dz,
+		DH: m.DH(), DF: m.DF(), DI: m.DI(), DD: m.DD(), DGV: m.DGV(),
+		ErrX: m.ErrX(), ErrY: m.ErrY(), ErrZ: m.ErrZ(),
+		ErrH: m.ErrH(), ErrF: m.ErrF(), ErrI: m.ErrI(), ErrD: m.ErrD(),
+	})
+}
+
+// UnmarshalJSON decodes a MagneticField from the JSON object produced by MarshalJSON.
+// Only the location and the X, Y, Z components and their rates of change are
+// read; the other values are derived from them.
+func (m *MagneticField) UnmarshalJSON(b []byte) error {
+	var mj magneticFieldJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return err
+	}
+	// Rotate the ellipsoidal components back to the spherical axes
+	latS, _, _ := mj.Location.Spherical()
+	latG, _, _ := mj.Location.Geodetic()
+	cosDPhi := math.Cos(latS - latG)
+	sinDPhi := math.Sin(latS - latG)
+	*m = MagneticField{
+		l:  mj.Location,
+		x:  mj.X*cosDPhi + mj.Z*sinDPhi,
+		y:  mj.Y,
+		z:  -mj.X*sinDPhi + mj.Z*cosDPhi,
+		dx: mj.DX*cosDPhi + mj.DZ*sinDPhi,
+		dy: mj.DY,
+		dz: -mj.DX*sinDPhi + mj.DZ*cosDPhi,
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package wmm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+func TestMagneticFieldJSON(t *testing.T) {
+	_ = LoadWMMCOF("testdata/WMM2020.COF")
+	loc := egm96.NewLocationGeodetic(43, 93, 65e3)
+	mag, _ := CalculateWMMMagneticField(loc, DecimalYear(2020).ToTime())
+
+	b, err := json.Marshal(mag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vals map[string]interface{}
+	if err = json.Unmarshal(b, &vals); err != nil {
+		t.Fatal(err)
+	}
+	// Values from the WMM2020 test values
+	for k, v := range map[string]float64{"x": 24375.3, "y": 303.2, "z": 49691.4, "h": 24377.2, "f": 55348.7,
+		"i": 63.87, "d": 0.71, "gv": 0.71, "dx": -33.7, "dy": -32.4, "dz": 101.1, "dh": -34.1, "df": 75.7} {
+		f, ok := vals[k].(float64)
+		if !ok {
+			t.Errorf("MagneticField JSON has no %s: %s", k, b)
+			continue
+		}
+		testDiff("JSON "+k, f, v, 0.06, t)
+	}
+	for _, k := range []string{"location", "di", "dd", "dgv", "err_x", "err_y", "err_z", "err_h", "err_f", "err_i", "err_d"} {
+		if _, ok := vals[k]; !ok {
+			t.Errorf("MagneticField JSON has no %s: %s", k, b)
+		}
+	}
+
+	var mag2 MagneticField
+	if err = json.Unmarshal(b, &mag2); err != nil {
+		t.Fatal(err)
+	}
+	x, y, z, dx, dy, dz := mag.Spherical()
+	x2, y2, z2, dx2, dy2, dz2 := mag2.Spherical()
+	testDiff("round trip x", x2, x, 1e-6, t)
+	testDiff("round trip y", y2, y, 1e-6, t)
+	testDiff("round trip z", z2, z, 1e-6, t)
+	testDiff("round trip dx", dx2, dx, 1e-6, t)
+	testDiff("round trip dy", dy2, dy, 1e-6, t)
+	testDiff("round trip dz", dz2, dz, 1e-6, t)
+	lat, _, h := mag2.Location().Geodetic()
+	testDiff("round trip latitude", lat/egm96.Deg, 43, 1e-9, t)
+	testDiff("round trip height", h, 65e3, 1e-9, t)
+}